@@ -0,0 +1,1392 @@
+package main
+
+import (
+	"fmt"
+	gofmt "go/format"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NateScarlet/mongo-operators/pkg/format"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Input kinds.
+const (
+	autoMode     = "auto"
+	pipelineMode = "pipeline"
+	filterMode   = "filter"
+	updateMode   = "update"
+	exprMode     = "expr"
+)
+
+// convert parses text and returns go expression that builds same value.
+func convert(text, mode string) (string, error) {
+	v, err := format.Parse(text)
+	if err != nil {
+		return "", err
+	}
+	if mode == autoMode {
+		v, mode = detect(v)
+	}
+	var c = new(converter)
+	var src string
+	switch mode {
+	case pipelineMode:
+		a, ok := v.(primitive.A)
+		if !ok {
+			return "", fmt.Errorf("pipeline must be an array, got %T", v)
+		}
+		src = c.pipeline(a)
+	case filterMode:
+		d, ok := v.(primitive.D)
+		if !ok {
+			return "", fmt.Errorf("filter must be a document, got %T", v)
+		}
+		src = c.filter(d)
+	case updateMode:
+		src = c.update(v)
+	case exprMode:
+		src = c.expr(v)
+	default:
+		return "", fmt.Errorf("unknown mode %q", mode)
+	}
+	return formatSource(src)
+}
+
+// detect input kind of v, command documents from slow query log
+// are unwrapped to their pipeline or filter.
+func detect(v interface{}) (interface{}, string) {
+	switch v := v.(type) {
+	case primitive.A:
+		if isPipeline(v) {
+			return v, pipelineMode
+		}
+		return v, exprMode
+	case primitive.D:
+		if attr, ok := lookup(v, "attr").(primitive.D); ok {
+			if cmd, ok := lookup(attr, "command").(primitive.D); ok {
+				return detect(cmd)
+			}
+		}
+		if cmd, ok := lookup(v, "command").(primitive.D); ok {
+			return detect(cmd)
+		}
+		if p, ok := lookup(v, "pipeline").(primitive.A); ok && lookup(v, "aggregate") != nil {
+			return p, pipelineMode
+		}
+		if f, ok := lookup(v, "filter").(primitive.D); ok && lookup(v, "find") != nil {
+			return f, filterMode
+		}
+		for _, e := range v {
+			if _, ok := updateOperators[e.Key]; ok {
+				return v, updateMode
+			}
+		}
+		if len(v) == 1 && strings.HasPrefix(v[0].Key, "$") && !isTopLevelQueryOperator(v[0].Key) {
+			return v, exprMode
+		}
+		return v, filterMode
+	}
+	return v, exprMode
+}
+
+func isPipeline(a primitive.A) bool {
+	for _, i := range a {
+		if d, ok := i.(primitive.D); !ok || len(d) != 1 || !strings.HasPrefix(d[0].Key, "$") {
+			return false
+		}
+	}
+	return true
+}
+
+func lookup(d primitive.D, key string) interface{} {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+func isTopLevelQueryOperator(key string) bool {
+	switch key {
+	case "$and", "$or", "$nor", "$where":
+		return true
+	}
+	_, ok := topLevelQueryOperators[key]
+	return ok
+}
+
+func isOperatorDoc(d primitive.D) bool {
+	for _, e := range d {
+		if !strings.HasPrefix(e.Key, "$") {
+			return false
+		}
+	}
+	return len(d) > 0
+}
+
+// formatSource formats go expression with gofmt.
+func formatSource(src string) (string, error) {
+	const prefix = "package p\n\nvar _ = "
+	b, err := gofmt.Source([]byte(prefix + src + "\n"))
+	if err != nil {
+		return "", fmt.Errorf("generated invalid source: %w\n%s", err, src)
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(b), prefix), "\n"), nil
+}
+
+// composite returns composite literal of typ,
+// items are placed on separate lines when multiline or too long.
+func composite(typ string, items []string, multiline bool) string {
+	if len(items) == 0 {
+		return typ + "{}"
+	}
+	if multiline || isLong(items, 60) {
+		return typ + "{\n" + strings.Join(items, ",\n") + ",\n}"
+	}
+	return typ + "{" + strings.Join(items, ", ") + "}"
+}
+
+// call returns function call expression,
+// arguments are placed on separate lines when too long.
+func call(fn string, args ...string) string {
+	if len(args) == 0 {
+		return fn + "()"
+	}
+	var last = args[len(args)-1]
+	if len(args) > 1 && (isLong(args[:len(args)-1], 80) || !strings.Contains(last, "\n") && isLong(args, 80)) {
+		return fn + "(\n" + strings.Join(args, ",\n") + ",\n)"
+	}
+	return fn + "(" + strings.Join(args, ", ") + ")"
+}
+
+func isLong(items []string, limit int) bool {
+	var n int
+	for _, i := range items {
+		if strings.Contains(i, "\n") {
+			return true
+		}
+		n += len(i) + 2
+	}
+	return n > limit
+}
+
+type converter struct{}
+
+func (c *converter) document(d primitive.D, value func(interface{}) string) string {
+	var items = make([]string, 0, len(d))
+	for _, e := range d {
+		items = append(items, strconv.Quote(e.Key)+": "+value(e.Value))
+	}
+	return composite("bson.M", items, false)
+}
+
+// orderedDocument returns bson.D when key order matters.
+func (c *converter) orderedDocument(d primitive.D, value func(interface{}) string) string {
+	if len(d) < 2 {
+		return c.document(d, value)
+	}
+	var items = make([]string, 0, len(d))
+	for _, e := range d {
+		items = append(items, fmt.Sprintf("{Key: %s, Value: %s}", strconv.Quote(e.Key), value(e.Value)))
+	}
+	return composite("bson.D", items, false)
+}
+
+func (c *converter) array(a primitive.A, value func(interface{}) string) string {
+	var items = make([]string, 0, len(a))
+	for _, i := range a {
+		items = append(items, value(i))
+	}
+	return composite("bson.A", items, false)
+}
+
+// literal returns go source of value as is.
+func (c *converter) literal(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case primitive.D:
+		return c.document(v, c.literal)
+	case primitive.A:
+		return c.array(v, c.literal)
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	case int64:
+		return "int64(" + strconv.FormatInt(v, 10) + ")"
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "math.NaN()"
+		case math.IsInf(v, 1):
+			return "math.Inf(1)"
+		case math.IsInf(v, -1):
+			return "math.Inf(-1)"
+		}
+		var s = strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			s += ".0"
+		}
+		return s
+	case primitive.Decimal128:
+		var h, l = v.GetBytes()
+		return fmt.Sprintf("primitive.NewDecimal128(%#x, %#x) /* %s */", h, l, v)
+	case primitive.DateTime:
+		var t = v.Time().UTC()
+		return fmt.Sprintf(
+			"primitive.NewDateTimeFromTime(time.Date(%d, %d, %d, %d, %d, %d, %d, time.UTC))",
+			t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/int(time.Millisecond)*int(time.Millisecond),
+		)
+	case primitive.ObjectID:
+		var items = make([]string, len(v))
+		for index, b := range v {
+			items[index] = fmt.Sprintf("%#02x", b)
+		}
+		return "primitive.ObjectID{" + strings.Join(items, ", ") + "} /* " + v.Hex() + " */"
+	case primitive.Regex:
+		return fmt.Sprintf("primitive.Regex{Pattern: %s, Options: %s}", strconv.Quote(v.Pattern), strconv.Quote(v.Options))
+	case primitive.Binary:
+		return fmt.Sprintf("primitive.Binary{Subtype: %#02x, Data: %#v}", v.Subtype, v.Data)
+	case primitive.Timestamp:
+		return fmt.Sprintf("primitive.Timestamp{T: %d, I: %d}", v.T, v.I)
+	case primitive.MinKey:
+		return "primitive.MinKey{}"
+	case primitive.MaxKey:
+		return "primitive.MaxKey{}"
+	case primitive.Undefined:
+		return "primitive.Undefined{}"
+	case primitive.Null:
+		return "primitive.Null{}"
+	case primitive.Symbol:
+		return "primitive.Symbol(" + strconv.Quote(string(v)) + ")"
+	case primitive.JavaScript:
+		return "primitive.JavaScript(" + strconv.Quote(string(v)) + ")"
+	case primitive.CodeWithScope:
+		return fmt.Sprintf("primitive.CodeWithScope{Code: %s, Scope: %s}", strconv.Quote(string(v.Code)), c.literal(v.Scope))
+	case primitive.DBPointer:
+		return fmt.Sprintf("primitive.DBPointer{DB: %s, Pointer: %s}", strconv.Quote(v.DB), c.literal(v.Pointer))
+	}
+	return fmt.Sprintf("%#v", v)
+}
+
+// constant returns v as untyped constant of typ,
+// ok is false when v is not convertible.
+func (c *converter) constant(typ argType, v interface{}) (string, bool) {
+	switch typ {
+	case stringArg, jsArg:
+		switch v := v.(type) {
+		case string:
+			return strconv.Quote(v), true
+		case primitive.JavaScript:
+			if typ == jsArg {
+				return strconv.Quote(string(v)), true
+			}
+		}
+	case boolArg:
+		if v, ok := v.(bool); ok {
+			return strconv.FormatBool(v), true
+		}
+	case intArg, numberArg:
+		switch v := v.(type) {
+		case int32:
+			return strconv.FormatInt(int64(v), 10), true
+		case int64:
+			return strconv.FormatInt(v, 10), true
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return "", false
+			}
+			if typ == numberArg || v == math.Trunc(v) {
+				return strconv.FormatFloat(v, 'g', -1, 64), true
+			}
+		}
+	}
+	return "", false
+}
+
+// vectorSearchFilterOperators is field operators accepted by SetFilter of VectorSearch.
+var vectorSearchFilterOperators = map[string]bool{
+	"$eq": true, "$ne": true, "$gt": true, "$gte": true, "$lt": true, "$lte": true,
+	"$in": true, "$nin": true, "$exists": true, "$not": true,
+}
+
+// isVectorSearchFilter reports whether SetFilter of VectorSearch accepts d,
+// other filters are kept as raw document since SetFilter panics on them.
+func isVectorSearchFilter(d primitive.D) bool {
+	for _, e := range d {
+		switch {
+		case e.Key == "$and" || e.Key == "$or" || e.Key == "$nor":
+			var a, _ = e.Value.(primitive.A)
+			for _, i := range a {
+				if d, ok := i.(primitive.D); ok && !isVectorSearchFilter(d) {
+					return false
+				}
+			}
+		case strings.HasPrefix(e.Key, "$"):
+			return false
+		default:
+			if d, ok := e.Value.(primitive.D); ok && len(d) > 0 && strings.HasPrefix(d[0].Key, "$") && !isVectorSearchCondition(d) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isVectorSearchCondition(d primitive.D) bool {
+	for _, e := range d {
+		if !vectorSearchFilterOperators[e.Key] {
+			return false
+		}
+		if d, ok := e.Value.(primitive.D); ok && e.Key == "$not" && !isVectorSearchCondition(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// arg returns go source of argument v.
+func (c *converter) arg(typ argType, v interface{}) (string, bool) {
+	switch typ {
+	case exprArg:
+		return c.expr(v), true
+	case literalArg:
+		return c.literal(v), true
+	case filterArg:
+		if d, ok := v.(primitive.D); ok {
+			return c.filter(d), true
+		}
+	case vectorSearchFilterArg:
+		if d, ok := v.(primitive.D); ok && isVectorSearchFilter(d) {
+			return c.filter(d), true
+		}
+	case pipelineArg:
+		if a, ok := v.(primitive.A); ok {
+			return c.pipeline(a), true
+		}
+	case sortArg:
+		if d, ok := v.(primitive.D); ok {
+			return c.sort("a", d), true
+		}
+		return c.constant(intArg, v)
+	case sortSpecArg:
+		if d, ok := v.(primitive.D); ok {
+			return c.sortSpec("a", d), true
+		}
+	case accumulatorsArg:
+		if d, ok := v.(primitive.D); ok {
+			return c.document(d, c.accumulator), true
+		}
+	default:
+		return c.constant(typ, v)
+	}
+	return "", false
+}
+
+// call returns constructor call of op with argument v,
+// ok is false when v does not match parameters of constructor.
+func (c *converter) call(pkg string, op operator, v interface{}) (string, bool) {
+	var fn = pkg + "." + op.fn
+	switch op.kind {
+	case unaryCall:
+		var typ = exprArg
+		if len(op.args) > 0 {
+			typ = op.args[0].typ
+		}
+		if a, ok := v.(primitive.A); ok && typ == exprArg {
+			if len(a) != 1 {
+				return "", false
+			}
+			if _, ok := a[0].(primitive.A); ok {
+				return "", false
+			}
+			v = a[0]
+		}
+		s, ok := c.arg(typ, v)
+		if !ok {
+			return "", false
+		}
+		return call(fn, s), true
+	case positionalCall:
+		a, ok := v.(primitive.A)
+		if !ok || len(a) < len(op.args) || len(a) > len(op.args)+len(op.options) {
+			return "", false
+		}
+		var args = make([]string, len(op.args))
+		for index, i := range op.args {
+			s, ok := c.arg(i.typ, a[index])
+			if !ok {
+				return "", false
+			}
+			args[index] = s
+		}
+		var ret = call(fn, args...)
+		for index, i := range a[len(op.args):] {
+			var o = op.options[index]
+			s, ok := c.arg(o.typ, i)
+			if !ok {
+				return "", false
+			}
+			ret = call(ret+"."+o.method, s)
+		}
+		return ret, true
+	case variadicCall, spreadCall:
+		a, ok := v.(primitive.A)
+		if !ok {
+			if op.kind == variadicCall {
+				return "", false
+			}
+			return call(fn, c.expr(v)), true
+		}
+		if len(a) == 0 || op.kind == spreadCall && len(a) == 1 {
+			return "", false
+		}
+		var args = make([]string, len(a))
+		for index, i := range a {
+			args[index] = c.expr(i)
+		}
+		return call(fn, args...), true
+	case namedCall:
+		d, ok := v.(primitive.D)
+		if !ok {
+			return "", false
+		}
+		return c.namedCall(fn, op, d)
+	case emptyCall:
+		if d, ok := v.(primitive.D); ok && len(d) == 0 {
+			return fn + "()", true
+		}
+	case dateCall:
+		d, ok := v.(primitive.D)
+		if !ok || lookup(d, "date") == nil {
+			if a, ok := v.(primitive.A); ok {
+				if len(a) != 1 {
+					return "", false
+				}
+				v = a[0]
+			}
+			return call(fn, c.expr(v)), true
+		}
+		return c.namedCall(fn, operator{
+			args:    []arg{{"date", "", exprArg}},
+			options: []arg{{"timezone", "SetTimezone", exprArg}},
+		}, d)
+	}
+	return "", false
+}
+
+func (c *converter) namedCall(fn string, op operator, d primitive.D) (string, bool) {
+	var args []string
+	for _, i := range op.args {
+		var v, ok = lookupOK(d, i.key)
+		if !ok {
+			return "", false
+		}
+		if i.typ == spreadArg {
+			a, ok := v.(primitive.A)
+			if !ok {
+				return "", false
+			}
+			for _, j := range a {
+				args = append(args, c.expr(j))
+			}
+			continue
+		}
+		s, ok := c.arg(i.typ, v)
+		if !ok {
+			return "", false
+		}
+		args = append(args, s)
+	}
+	var ret = call(fn, args...)
+	for _, e := range d {
+		if hasArg(op.args, e.Key) {
+			continue
+		}
+		var found bool
+		for _, o := range op.options {
+			if o.key != e.Key {
+				continue
+			}
+			s, ok := c.arg(o.typ, e.Value)
+			if !ok {
+				return "", false
+			}
+			if o.method != "" {
+				ret = call(ret+"."+o.method, s)
+			}
+			found = true
+			break
+		}
+		if !found {
+			return "", false
+		}
+	}
+	return ret, true
+}
+
+func lookupOK(d primitive.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+func hasArg(args []arg, key string) bool {
+	for _, i := range args {
+		if i.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// operatorDocument returns fallback document for operator without constructor.
+func (c *converter) operatorDocument(key string, v interface{}, value func(interface{}) string) string {
+	return composite("bson.M", []string{strconv.Quote(key) + ": " + value(v)}, false)
+}
+
+// expr returns go source of aggregation expression.
+func (c *converter) expr(v interface{}) string {
+	switch v := v.(type) {
+	case primitive.D:
+		if len(v) == 1 && strings.HasPrefix(v[0].Key, "$") {
+			if s, ok := c.expressionOperator(v[0].Key, v[0].Value); ok {
+				return s
+			}
+			return c.operatorDocument(v[0].Key, v[0].Value, c.expr)
+		}
+		return c.document(v, c.expr)
+	case primitive.A:
+		return c.array(v, c.expr)
+	}
+	return c.literal(v)
+}
+
+func (c *converter) expressionOperator(key string, v interface{}) (string, bool) {
+	switch key {
+	case "$first":
+		return c.call("a", operator{fn: "FirstOfArray", args: unary}, v)
+	case "$last":
+		return c.call("a", operator{fn: "LastOfArray", args: unary}, v)
+	case "$slice":
+		a, ok := v.(primitive.A)
+		if !ok {
+			return "", false
+		}
+		switch len(a) {
+		case 2:
+			return call("a.Slice", c.expr(a[0]), c.expr(a[1])), true
+		case 3:
+			return call(call("a.Slice", c.expr(a[0]), c.expr(a[2]))+".SetPos", c.expr(a[1])), true
+		}
+		return "", false
+	case "$cond":
+		if d, ok := v.(primitive.D); ok {
+			return c.namedCall("a.Cond", operator{args: []arg{{"if", "", exprArg}, {"then", "", exprArg}, {"else", "", exprArg}}}, d)
+		}
+		return c.call("a", operator{fn: "Cond", kind: positionalCall, args: ternary}, v)
+	case "$switch":
+		return c.switchOperator(v)
+	case "$dateFromParts":
+		d, ok := v.(primitive.D)
+		if !ok {
+			return "", false
+		}
+		if lookup(d, "isoWeekYear") != nil {
+			return c.call("a", dateFromPartsW, d)
+		}
+		return c.call("a", dateFromPartsC, d)
+	case "$expMovingAvg":
+		d, ok := v.(primitive.D)
+		if !ok {
+			return "", false
+		}
+		if _, ok := lookupOK(d, "alpha"); ok {
+			return c.namedCall("a.ExpMovingAvgAlpha", operator{args: []arg{{"input", "", exprArg}, {"alpha", "", numberArg}}}, d)
+		}
+		return c.namedCall("a.ExpMovingAvg", operator{args: []arg{{"input", "", exprArg}, {"N", "", intArg}}}, d)
+	case "$function":
+		d, ok := v.(primitive.D)
+		if !ok || lookup(d, "lang") != "js" {
+			return "", false
+		}
+		return c.namedCall("a.Function", operator{
+			args:    []arg{{"body", "", jsArg}, {"args", "", exprArg}},
+			options: []arg{{"lang", "", stringArg}},
+		}, d)
+	}
+	if op, ok := expressionOperators[key]; ok {
+		return c.call("a", op, v)
+	}
+	return "", false
+}
+
+func (c *converter) switchOperator(v interface{}) (string, bool) {
+	d, ok := v.(primitive.D)
+	if !ok {
+		return "", false
+	}
+	var args []string
+	for _, e := range d {
+		switch e.Key {
+		case "branches":
+			branches, ok := e.Value.(primitive.A)
+			if !ok {
+				return "", false
+			}
+			for _, i := range branches {
+				b, ok := i.(primitive.D)
+				if !ok || len(b) != 2 {
+					return "", false
+				}
+				caseExpr, ok := lookupOK(b, "case")
+				if !ok {
+					return "", false
+				}
+				thenExpr, ok := lookupOK(b, "then")
+				if !ok {
+					return "", false
+				}
+				args = append(args, c.expr(caseExpr), c.expr(thenExpr))
+			}
+		case "default":
+		default:
+			return "", false
+		}
+	}
+	if len(args) == 0 {
+		return "", false
+	}
+	if v, ok := lookupOK(d, "default"); ok {
+		args = append(args, c.expr(v))
+	}
+	return call("a.Switch", args...), true
+}
+
+// accumulator returns go source of accumulator or window operator.
+func (c *converter) accumulator(v interface{}) string {
+	d, ok := v.(primitive.D)
+	if !ok || len(d) != 1 || !strings.HasPrefix(d[0].Key, "$") {
+		return c.expr(v)
+	}
+	var key, value = d[0].Key, d[0].Value
+	if op, ok := accumulatorOperators[key]; ok {
+		if _, isArray := value.(primitive.A); !isArray {
+			if s, ok := c.call("a", op, value); ok {
+				return s
+			}
+		}
+	}
+	if key == "$accumulator" {
+		if d, ok := value.(primitive.D); ok && lookup(d, "lang") == "js" {
+			if s, ok := c.namedCall("a.Accumulator", operator{
+				args: []arg{
+					{"init", "", jsArg},
+					{"initArgs", "", exprArg},
+					{"accumulate", "", jsArg},
+					{"accumulateArgs", "", exprArg},
+					{"merge", "", jsArg},
+					{"finalize", "", jsArg},
+				},
+				options: []arg{{"lang", "", stringArg}},
+			}, d); ok {
+				return s
+			}
+		}
+		return c.operatorDocument(key, value, c.literal)
+	}
+	return c.expr(v)
+}
+
+// filter returns go source of query filter.
+func (c *converter) filter(d primitive.D) string {
+	if len(d) == 1 {
+		if s, ok := c.topLevelOperator(d[0].Key, d[0].Value); ok {
+			return s
+		}
+	}
+	var items = make([]string, 0, len(d))
+	for _, e := range d {
+		var value string
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			value = c.literal(e.Value)
+			if a, ok := e.Value.(primitive.A); ok {
+				value = c.array(a, c.filterValue)
+			}
+		case "$expr":
+			value = c.expr(e.Value)
+		default:
+			if strings.HasPrefix(e.Key, "$") {
+				value = c.literal(e.Value)
+			} else {
+				value = c.fieldValue(e.Value)
+			}
+		}
+		items = append(items, strconv.Quote(e.Key)+": "+value)
+	}
+	return composite("bson.M", items, false)
+}
+
+func (c *converter) filterValue(v interface{}) string {
+	if d, ok := v.(primitive.D); ok {
+		return c.filter(d)
+	}
+	return c.literal(v)
+}
+
+func (c *converter) topLevelOperator(key string, v interface{}) (string, bool) {
+	switch key {
+	case "$and", "$or", "$nor":
+		a, ok := v.(primitive.A)
+		if !ok || len(a) == 0 {
+			return "", false
+		}
+		var args = make([]string, len(a))
+		for index, i := range a {
+			d, ok := i.(primitive.D)
+			if !ok {
+				return "", false
+			}
+			args[index] = c.filter(d)
+		}
+		return call("q."+strings.ToUpper(key[1:2])+key[2:], args...), true
+	case "$where":
+		if s, ok := c.constant(jsArg, v); ok {
+			return call("q.Where", s), true
+		}
+		return "", false
+	}
+	if op, ok := topLevelQueryOperators[key]; ok {
+		return c.call("q", op, v)
+	}
+	return "", false
+}
+
+// fieldValue returns go source of query condition of a field.
+func (c *converter) fieldValue(v interface{}) string {
+	d, ok := v.(primitive.D)
+	if !ok || !isOperatorDoc(d) {
+		return c.literal(v)
+	}
+	var parts []string
+	for _, e := range d {
+		switch e.Key {
+		case "$options":
+			if _, ok := lookupOK(d, "$regex"); ok {
+				continue
+			}
+		case "$regex":
+			if s, ok := c.regex(e.Value, d); ok {
+				parts = append(parts, s)
+				continue
+			}
+		case "$not":
+			if _, ok := e.Value.(primitive.D); ok {
+				parts = append(parts, call("q.Not", c.fieldValue(e.Value)))
+				continue
+			}
+			if _, ok := e.Value.(primitive.Regex); ok {
+				parts = append(parts, call("q.Not", c.literal(e.Value)))
+				continue
+			}
+		case "$elemMatch":
+			if m, ok := e.Value.(primitive.D); ok {
+				if isOperatorDoc(m) {
+					parts = append(parts, call("q.ElemMatch", c.fieldValue(m)))
+				} else {
+					parts = append(parts, call("q.ElemMatch", c.filter(m)))
+				}
+				continue
+			}
+		default:
+			if op, ok := queryOperators[e.Key]; ok {
+				if s, ok := c.call("q", op, e.Value); ok {
+					parts = append(parts, s)
+					continue
+				}
+			}
+		}
+		parts = append(parts, c.operatorDocument(e.Key, e.Value, c.literal))
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return call("q.MergeOperators", parts...)
+}
+
+func (c *converter) regex(v interface{}, d primitive.D) (string, bool) {
+	var re primitive.Regex
+	switch v := v.(type) {
+	case string:
+		re.Pattern = v
+	case primitive.Regex:
+		re = v
+	default:
+		return "", false
+	}
+	if options, ok := lookupOK(d, "$options"); ok {
+		s, ok := options.(string)
+		if !ok {
+			return "", false
+		}
+		re.Options = s
+	}
+	return call("q.Regex", c.literal(re)), true
+}
+
+// update returns go source of update document or pipeline.
+func (c *converter) update(v interface{}) string {
+	switch v := v.(type) {
+	case primitive.A:
+		return c.pipeline(v)
+	case primitive.D:
+		var parts []string
+		for _, e := range v {
+			var fn, ok = updateOperators[e.Key]
+			var spec, isDoc = e.Value.(primitive.D)
+			if !ok || !isDoc {
+				if !strings.HasPrefix(e.Key, "$") {
+					// replacement document
+					return c.literal(v)
+				}
+				parts = append(parts, c.operatorDocument(e.Key, e.Value, c.literal))
+				continue
+			}
+			var value = c.literal
+			switch e.Key {
+			case "$push", "$addToSet":
+				value = c.each
+			case "$pull":
+				value = c.fieldValue
+			}
+			parts = append(parts, call("q."+fn, c.document(spec, value)))
+		}
+		if len(parts) == 1 {
+			return parts[0]
+		}
+		return call("q.MergeOperators", parts...)
+	}
+	return c.literal(v)
+}
+
+// each returns go source of value of $push and $addToSet.
+func (c *converter) each(v interface{}) string {
+	d, ok := v.(primitive.D)
+	if !ok {
+		return c.literal(v)
+	}
+	each, ok := lookup(d, "$each").(primitive.A)
+	if !ok {
+		return c.literal(v)
+	}
+	var ret = call("q.Each", c.literal(each))
+	for _, e := range d {
+		var s string
+		var ok bool
+		switch e.Key {
+		case "$each":
+			continue
+		case "$position":
+			s, ok = c.constant(intArg, e.Value)
+			ret = call(ret+".Position", s)
+		case "$slice":
+			s, ok = c.constant(intArg, e.Value)
+			ret = call(ret+".Slice", s)
+		case "$sort":
+			if spec, isDoc := e.Value.(primitive.D); isDoc {
+				s, ok = c.sortSpec("q", spec), true
+				ret = call(ret+".Sort", s)
+			} else {
+				s, ok = c.constant(intArg, e.Value)
+				ret = call(ret+".SortElements", s)
+			}
+		}
+		if !ok {
+			return c.literal(v)
+		}
+	}
+	return ret
+}
+
+// sort returns go source of sort specification,
+// a SortSpec is used when every field is a direction or score.
+func (c *converter) sort(pkg string, d primitive.D) string {
+	var ret = pkg
+	for _, e := range d {
+		var method string
+		switch v := e.Value.(type) {
+		case int32, int64, float64:
+			switch v {
+			case int32(1), int64(1), float64(1):
+				method = "Asc"
+			case int32(-1), int64(-1), float64(-1):
+				method = "Desc"
+			}
+		case primitive.D:
+			if len(v) == 1 && v[0].Key == "$meta" {
+				switch v[0].Value {
+				case "textScore":
+					method = "TextScore"
+				case "searchScore":
+					method = "SearchScore"
+				}
+			}
+		}
+		if method == "" {
+			return c.orderedDocument(d, c.expr)
+		}
+		ret = call(ret+"."+method, strconv.Quote(e.Key))
+	}
+	if len(d) == 0 {
+		return c.orderedDocument(d, c.expr)
+	}
+	return ret
+}
+
+// sortSpec returns go source of sort specification as SortSpec,
+// fields that are not a direction or score are written as SortSpec literal.
+func (c *converter) sortSpec(pkg string, d primitive.D) string {
+	var s = c.sort(pkg, d)
+	if strings.HasPrefix(s, pkg+".") {
+		return s
+	}
+	var items = make([]string, 0, len(d))
+	for _, e := range d {
+		items = append(items, fmt.Sprintf("{Key: %s, Value: %s}", strconv.Quote(e.Key), c.expr(e.Value)))
+	}
+	return composite(pkg+".SortSpec", items, false)
+}
+
+// pipeline returns go source of aggregation pipeline.
+func (c *converter) pipeline(a primitive.A) string {
+	var items = make([]string, 0, len(a))
+	for _, i := range a {
+		items = append(items, c.stage(i))
+	}
+	return composite("bson.A", items, len(items) > 0)
+}
+
+func (c *converter) stage(v interface{}) string {
+	d, ok := v.(primitive.D)
+	if !ok || len(d) != 1 {
+		return c.literal(v)
+	}
+	var key, value = d[0].Key, d[0].Value
+	if s, ok := c.stageOperator(key, value); ok {
+		return s
+	}
+	return c.operatorDocument(key, value, c.literal)
+}
+
+func (c *converter) stageOperator(key string, v interface{}) (string, bool) {
+	switch key {
+	case "$match":
+		if d, ok := v.(primitive.D); ok && len(d) == 1 && d[0].Key == "$expr" {
+			return call("a.MatchExpr", c.expr(d[0].Value)), true
+		}
+	case "$lookup":
+		return c.lookup(v)
+	case "$unwind":
+		if s, ok := c.constant(stringArg, v); ok {
+			return call("a.Unwind", s), true
+		}
+		return c.call("a", operator{fn: "Unwind", kind: namedCall, args: []arg{{"path", "", stringArg}}, options: []arg{
+			{"includeArrayIndex", "SetIncludeArrayIndex", stringArg},
+			{"preserveNullAndEmptyArrays", "SetPreserveNullAndEmptyArrays", boolArg},
+		}}, v)
+	case "$unset":
+		if s, ok := c.constant(stringArg, v); ok {
+			return call("a.Unset", s), true
+		}
+		a, ok := v.(primitive.A)
+		if !ok || len(a) == 0 {
+			return "", false
+		}
+		var args = make([]string, len(a))
+		for index, i := range a {
+			if args[index], ok = c.constant(stringArg, i); !ok {
+				return "", false
+			}
+		}
+		return call("a.Unset", args...), true
+	case "$merge":
+		if s, ok := c.constant(stringArg, v); ok {
+			return call("a.Merge", s), true
+		}
+		d, ok := v.(primitive.D)
+		if !ok {
+			return "", false
+		}
+		var whenMatched = literalArg
+		if _, ok := lookup(d, "whenMatched").(primitive.A); ok {
+			whenMatched = pipelineArg
+		}
+		return c.namedCall("a.Merge", operator{args: []arg{{"into", "", literalArg}}, options: []arg{
+			{"on", "SetOn", literalArg},
+			{"whenMatched", "SetWhenMatched", whenMatched},
+			{"let", "SetLet", exprArg},
+			{"whenNotMatched", "SetWhenNotMatched", literalArg},
+		}}, d)
+	case "$unionWith":
+		if s, ok := c.constant(stringArg, v); ok {
+			return call("a.UnionWith", s, "nil"), true
+		}
+		d, ok := v.(primitive.D)
+		if !ok {
+			return "", false
+		}
+		if _, ok := lookupOK(d, "pipeline"); ok {
+			return c.namedCall("a.UnionWith", operator{args: []arg{{"coll", "", stringArg}, {"pipeline", "", pipelineArg}}}, d)
+		}
+		s, ok := c.namedCall("a.UnionWith", operator{args: []arg{{"coll", "", stringArg}}}, d)
+		if !ok {
+			return "", false
+		}
+		return strings.TrimSuffix(s, ")") + ", nil)", true
+	case "$facet":
+		d, ok := v.(primitive.D)
+		if !ok {
+			return "", false
+		}
+		var items = make([]string, 0, len(d))
+		for _, e := range d {
+			s, ok := c.arg(pipelineArg, e.Value)
+			if !ok {
+				return "", false
+			}
+			items = append(items, strconv.Quote(e.Key)+": "+s)
+		}
+		return call("a.Facet", composite("bson.M", items, false)), true
+	case "$collStats":
+		return c.collStats(v)
+	case "$setWindowFields":
+		return c.setWindowFields(v)
+	case "$densify":
+		return c.densify(v)
+	case "$fill":
+		return c.fill(v)
+	}
+	if op, ok := stages[key]; ok {
+		return c.call("a", op, v)
+	}
+	return "", false
+}
+
+func (c *converter) lookup(v interface{}) (string, bool) {
+	d, ok := v.(primitive.D)
+	if !ok {
+		return "", false
+	}
+	if _, ok := lookupOK(d, "pipeline"); !ok {
+		return c.namedCall("a.LookupF", operator{args: []arg{
+			{"from", "", stringArg},
+			{"localField", "", stringArg},
+			{"foreignField", "", stringArg},
+			{"as", "", stringArg},
+		}}, d)
+	}
+	var let = "nil"
+	if v, ok := lookupOK(d, "let"); ok {
+		m, ok := v.(primitive.D)
+		if !ok {
+			return "", false
+		}
+		let = c.document(m, c.expr)
+	}
+	for _, e := range d {
+		switch e.Key {
+		case "from", "let", "pipeline", "as":
+		default:
+			return "", false
+		}
+	}
+	from, ok := c.constant(stringArg, lookup(d, "from"))
+	if !ok {
+		return "", false
+	}
+	as, ok := c.constant(stringArg, lookup(d, "as"))
+	if !ok {
+		return "", false
+	}
+	pipeline, ok := c.arg(pipelineArg, lookup(d, "pipeline"))
+	if !ok {
+		return "", false
+	}
+	return call("a.LookupP", from, let, pipeline, as), true
+}
+
+func (c *converter) collStats(v interface{}) (string, bool) {
+	d, ok := v.(primitive.D)
+	if !ok {
+		return "", false
+	}
+	var ret = "a.CollStats()"
+	for _, e := range d {
+		var option, ok = e.Value.(primitive.D)
+		if !ok {
+			return "", false
+		}
+		switch {
+		case e.Key == "latencyStats" && len(option) == 1 && option[0].Key == "histograms":
+			s, ok := c.constant(boolArg, option[0].Value)
+			if !ok {
+				return "", false
+			}
+			ret = call(ret+".SetLatencyStats", s)
+		case e.Key == "storageStats" && len(option) == 1 && option[0].Key == "scale":
+			s, ok := c.constant(intArg, option[0].Value)
+			if !ok {
+				return "", false
+			}
+			ret = call(ret+".SetStorageStats", s)
+		case e.Key == "count" && len(option) == 0:
+			ret += ".SetCount()"
+		default:
+			return "", false
+		}
+	}
+	return ret, true
+}
+
+// fields returns go source of field names passed as variadic arguments.
+func (c *converter) fields(v interface{}) ([]string, bool) {
+	a, ok := v.(primitive.A)
+	if !ok || len(a) == 0 {
+		return nil, false
+	}
+	var ret = make([]string, len(a))
+	for index, i := range a {
+		if ret[index], ok = c.constant(stringArg, i); !ok {
+			return nil, false
+		}
+	}
+	return ret, true
+}
+
+func (c *converter) densify(v interface{}) (string, bool) {
+	d, ok := v.(primitive.D)
+	if !ok {
+		return "", false
+	}
+	field, ok := c.constant(stringArg, lookup(d, "field"))
+	if !ok {
+		return "", false
+	}
+	var ret = call("a.Densify", field)
+	for _, e := range d {
+		switch e.Key {
+		case "field":
+		case "range":
+			s, ok := c.densifyRange(e.Value)
+			if !ok {
+				return "", false
+			}
+			ret = call(ret+".SetRange", s...)
+		case "partitionByFields":
+			s, ok := c.fields(e.Value)
+			if !ok {
+				return "", false
+			}
+			ret = call(ret+".SetPartitionByFields", s...)
+		default:
+			return "", false
+		}
+	}
+	return ret, true
+}
+
+// densifyRange returns arguments of DensifyStage.SetRange.
+func (c *converter) densifyRange(v interface{}) ([]string, bool) {
+	d, ok := v.(primitive.D)
+	if !ok {
+		return nil, false
+	}
+	for _, e := range d {
+		switch e.Key {
+		case "step", "unit", "bounds":
+		default:
+			return nil, false
+		}
+	}
+	step, ok := c.constant(numberArg, lookup(d, "step"))
+	if !ok {
+		return nil, false
+	}
+	var unit = `""`
+	if v, ok := lookupOK(d, "unit"); ok {
+		if unit, ok = c.constant(stringArg, v); !ok {
+			return nil, false
+		}
+	}
+	bounds, ok := lookupOK(d, "bounds")
+	if !ok {
+		return nil, false
+	}
+	return []string{step, unit, c.literal(bounds)}, true
+}
+
+// fillMethods maps $fill output method to constant.
+var fillMethods = map[interface{}]string{
+	"locf":   "a.FillLOCF",
+	"linear": "a.FillLinear",
+}
+
+func (c *converter) fill(v interface{}) (string, bool) {
+	d, ok := v.(primitive.D)
+	if !ok {
+		return "", false
+	}
+	output, ok := lookup(d, "output").(primitive.D)
+	if !ok || len(output) == 0 {
+		return "", false
+	}
+	var outputs = make([]string, 0, len(output))
+	for _, e := range output {
+		o, ok := e.Value.(primitive.D)
+		if !ok || len(o) != 1 {
+			return "", false
+		}
+		switch o[0].Key {
+		case "method":
+			method, ok := fillMethods[o[0].Value]
+			if !ok {
+				return "", false
+			}
+			outputs = append(outputs, call("a.FillOutputMethod", strconv.Quote(e.Key), method))
+		case "value":
+			outputs = append(outputs, call("a.FillOutputValue", strconv.Quote(e.Key), c.expr(o[0].Value)))
+		default:
+			return "", false
+		}
+	}
+	var ret string
+	if len(outputs) == 1 {
+		ret = call("a.Fill", outputs...)
+	} else {
+		ret = "a.Fill(\n" + strings.Join(outputs, ",\n") + ",\n)"
+	}
+	for _, e := range d {
+		switch e.Key {
+		case "output":
+		case "partitionBy":
+			ret = call(ret+".SetPartitionBy", c.expr(e.Value))
+		case "partitionByFields":
+			s, ok := c.fields(e.Value)
+			if !ok {
+				return "", false
+			}
+			ret = call(ret+".SetPartitionByFields", s...)
+		case "sortBy":
+			s, ok := c.arg(sortSpecArg, e.Value)
+			if !ok {
+				return "", false
+			}
+			ret = call(ret+".SetSortBy", s)
+		default:
+			return "", false
+		}
+	}
+	return ret, true
+}
+
+// typedWindowOperators are constructors that not returns M.
+var typedWindowOperators = []string{"a.Derivative(", "a.Integral(", "a.Shift("}
+
+func (c *converter) setWindowFields(v interface{}) (string, bool) {
+	d, ok := v.(primitive.D)
+	if !ok {
+		return "", false
+	}
+	output, ok := lookup(d, "output").(primitive.D)
+	if !ok || len(output) == 0 {
+		return "", false
+	}
+	var outputs = make([]string, 0, len(output))
+	for _, e := range output {
+		s, ok := c.windowOutput(e.Key, e.Value)
+		if !ok {
+			return "", false
+		}
+		outputs = append(outputs, s)
+	}
+	var ret string
+	if len(outputs) == 1 {
+		ret = call("a.SetWindowFields", outputs...)
+	} else {
+		ret = "a.SetWindowFields(\n" + strings.Join(outputs, ",\n") + ",\n)"
+	}
+	for _, e := range d {
+		switch e.Key {
+		case "output":
+		case "partitionBy":
+			ret = call(ret+".SetPartitionBy", c.expr(e.Value))
+		case "sortBy":
+			s, ok := c.arg(sortSpecArg, e.Value)
+			if !ok {
+				return "", false
+			}
+			ret = call(ret+".SetSortBy", s)
+		default:
+			return "", false
+		}
+	}
+	return ret, true
+}
+
+func (c *converter) windowOutput(field string, v interface{}) (string, bool) {
+	d, ok := v.(primitive.D)
+	if !ok {
+		return "", false
+	}
+	var op primitive.D
+	var window primitive.D
+	for _, e := range d {
+		if e.Key == "window" {
+			if window, ok = e.Value.(primitive.D); !ok {
+				return "", false
+			}
+			continue
+		}
+		op = append(op, e)
+	}
+	if len(op) != 1 {
+		return "", false
+	}
+	var operator = c.accumulator(op)
+	for _, i := range typedWindowOperators {
+		if strings.HasPrefix(operator, i) {
+			operator = "bson.M(" + operator + ")"
+		}
+	}
+	var ret = call("a.SetWindowFieldsOutput", strconv.Quote(field), operator)
+	for _, e := range window {
+		switch e.Key {
+		case "documents", "range":
+			bounds, ok := e.Value.(primitive.A)
+			if !ok || len(bounds) != 2 {
+				return "", false
+			}
+			ret = call(ret+".Set"+strings.ToUpper(e.Key[:1])+e.Key[1:], c.literal(bounds[0]), c.literal(bounds[1]))
+		case "unit":
+			s, ok := c.constant(stringArg, e.Value)
+			if !ok {
+				return "", false
+			}
+			ret = call(ret+".SetUnit", s)
+		default:
+			return "", false
+		}
+	}
+	return ret, true
+}
@@ -0,0 +1,63 @@
+// Command mongo-operators-conv converts mongo shell or Extended JSON text
+// to go code that uses builders of this module,
+// so hand-written bson.M literals can be migrated mechanically.
+//
+// Usage:
+//
+//	mongo-operators-conv [-mode auto|pipeline|filter|update|expr] [file]
+//
+// Input is read from file or stdin, e.g. a pipeline exported
+// from Compass's aggregation builder, or a command of slow query log.
+// Output is a go expression, which expects these imports:
+//
+//	import (
+//		"go.mongodb.org/mongo-driver/bson"
+//		"go.mongodb.org/mongo-driver/bson/primitive"
+//		q "github.com/NateScarlet/mongo-operators/pkg/query"
+//		a "github.com/NateScarlet/mongo-operators/pkg/aggregation"
+//	)
+//
+// For example, [{$geoNear: {near: [0, 0], distanceField: 'dist', spherical: true}}]
+// is converted to:
+//
+//	bson.A{
+//		a.GeoNear(bson.A{0, 0}, "dist").SetSpherical(true),
+//	}
+//
+// Operators and options without a matching builder are kept as bson.M literal.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mongo-operators-conv: ")
+	var mode = flag.String("mode", autoMode, "kind of input: auto, pipeline, filter, update or expr")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of mongo-operators-conv:\n")
+		fmt.Fprintf(os.Stderr, "\tmongo-operators-conv [flags] [file]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	var b []byte
+	var err error
+	if flag.NArg() > 0 {
+		b, err = ioutil.ReadFile(flag.Arg(0))
+	} else {
+		b, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := convert(string(b), *mode)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(src)
+}
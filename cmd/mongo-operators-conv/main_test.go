@@ -0,0 +1,163 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		text string
+		mode string
+		want string
+	}{
+		{"geo near", "[{ $geoNear: { near: [0, 0], distanceField: 'dist', spherical: true } }]", autoMode, `bson.A{
+	a.GeoNear(bson.A{0, 0}, "dist").SetSpherical(true),
+}`},
+		{"vector search", "[{ $vectorSearch: { index: 'v', path: 'embedding', queryVector: [0.5, 1], numCandidates: 100, limit: 10, filter: { year: { $gte: 2000 } } } }]", autoMode, `bson.A{
+	a.VectorSearch("v", "embedding", bson.A{0.5, 1}, 10).SetNumCandidates(100).SetFilter(bson.M{"year": q.Gte(2000)}),
+}`},
+		{"vector search unsupported filter", "[{ $vectorSearch: { index: 'v', path: 'embedding', queryVector: [0.5], limit: 10, exact: true, filter: { title: { $regex: '^a' } } } }]", autoMode, `bson.A{
+	bson.M{
+		"$vectorSearch": bson.M{
+			"index":       "v",
+			"path":        "embedding",
+			"queryVector": bson.A{0.5},
+			"limit":       10,
+			"exact":       true,
+			"filter":      bson.M{"title": bson.M{"$regex": "^a"}},
+		},
+	},
+}`},
+		{"pipeline", `[
+	// comment
+	{ $match: { age: { $gte: 18, $lt: 65 }, name: /^a/i } },
+	{ $group: { _id: "$city", n: { $sum: 1 }, names: { $push: "$name" } } },
+	{ $sort: { n: -1, _id: 1 } },
+	{ $project: { n: 1, top: { $slice: ["$names", 1, 3] } } },
+	{ $limit: 10 },
+]`, autoMode, `bson.A{
+	a.Match(bson.M{
+		"age":  q.MergeOperators(q.Gte(18), q.Lt(65)),
+		"name": primitive.Regex{Pattern: "^a", Options: "i"},
+	}),
+	a.Group(bson.M{"_id": "$city", "n": a.Sum(1), "names": a.Push("$name")}),
+	a.Sort(a.Desc("n").Asc("_id")),
+	a.Project(bson.M{"n": 1, "top": a.Slice("$names", 3).SetPos(1)}),
+	a.Limit(10),
+}`},
+		{"lookup", `[
+	{ $lookup: { from: "b", localField: "x", foreignField: "y", as: "bs" } },
+	{ $lookup: { from: "c", let: { x: "$x" }, pipeline: [{ $match: { $expr: { $eq: ["$$x", "$y"] } } }], as: "cs" } },
+	{ $unwind: { path: "$bs", preserveNullAndEmptyArrays: true } },
+	{ $unionWith: "d" },
+]`, autoMode, `bson.A{
+	a.LookupF("b", "x", "y", "bs"),
+	a.LookupP(
+		"c",
+		bson.M{"x": "$x"},
+		bson.A{
+			a.MatchExpr(a.Eq("$$x", "$y")),
+		},
+		"cs",
+	),
+	a.Unwind("$bs").SetPreserveNullAndEmptyArrays(true),
+	a.UnionWith("d", nil),
+}`},
+		{"window", `[{ $setWindowFields: { partitionBy: "$a", sortBy: { t: 1 }, output: {
+	prev: { $shift: { output: "$x", by: -1 } },
+	total: { $sum: "$x", window: { documents: ["unbounded", "current"] } },
+} } }]`, autoMode, `bson.A{
+	a.SetWindowFields(
+		a.SetWindowFieldsOutput("prev", bson.M(a.Shift("$x", -1))),
+		a.SetWindowFieldsOutput("total", a.Sum("$x")).SetDocuments("unbounded", "current"),
+	).SetPartitionBy("$a").SetSortBy(a.Asc("t")),
+}`},
+		{"densify", `[
+	{ $densify: { field: "at", range: { step: 1, unit: "hour", bounds: "full" }, partitionByFields: ["a", "b"] } },
+	{ $densify: { field: "n", range: { step: 0.5, bounds: [0, 10] } } },
+]`, autoMode, `bson.A{
+	a.Densify("at").SetRange(1, "hour", "full").SetPartitionByFields("a", "b"),
+	a.Densify("n").SetRange(0.5, "", bson.A{0, 10}),
+}`},
+		{"fill", `[
+	{ $fill: { partitionBy: "$a", sortBy: { at: 1 }, output: { v: { method: "linear" }, s: { value: "x" } } } },
+	{ $fill: { partitionByFields: ["a"], output: { v: { method: "locf" } } } },
+	{ $fill: { output: { v: { method: "nope" } } } },
+]`, autoMode, `bson.A{
+	a.Fill(
+		a.FillOutputMethod("v", a.FillLinear),
+		a.FillOutputValue("s", "x"),
+	).SetPartitionBy("$a").SetSortBy(a.Asc("at")),
+	a.Fill(a.FillOutputMethod("v", a.FillLOCF)).SetPartitionByFields("a"),
+	bson.M{
+		"$fill": bson.M{"output": bson.M{"v": bson.M{"method": "nope"}}},
+	},
+}`},
+		{"n accumulators", `[{ $group: { _id: "$c", top: { $topN: { n: 3, sortBy: { total: -1 }, output: "$_id" } }, last: { $bottom: { sortBy: { a: "x" }, output: "$a" } } } }]`, autoMode, `bson.A{
+	a.Group(bson.M{
+		"_id":  "$c",
+		"top":  a.TopN(3, a.Desc("total"), "$_id"),
+		"last": a.Bottom(a.SortSpec{{Key: "a", Value: "x"}}, "$a"),
+	}),
+}`},
+		{"unknown stage", `[{ $documents: [{ a: 1 }] }]`, autoMode, `bson.A{
+	bson.M{"$documents": bson.A{bson.M{"a": 1}}},
+}`},
+		{"filter", `{ $or: [{ a: { $exists: true } }, { b: { $in: [1, 2] } }] }`, autoMode,
+			`q.Or(bson.M{"a": q.Exists(true)}, bson.M{"b": q.In(bson.A{1, 2})})`},
+		{"filter operators", `{ name: { $regex: "^a", $options: "i" }, n: { $mod: [4, 0] }, m: { $not: { $gt: 5 } }, l: { $near: [0, 0] } }`, filterMode, `bson.M{
+	"name": q.Regex(primitive.Regex{Pattern: "^a", Options: "i"}),
+	"n":    q.Mod(4, 0),
+	"m":    q.Not(q.Gt(5)),
+	"l":    bson.M{"$near": bson.A{0, 0}},
+}`},
+		{"update", `{ $set: { a: 1 }, $push: { tags: { $each: ["x"], $slice: -5 } }, $inc: { n: NumberLong(1) } }`, autoMode, `q.MergeOperators(
+	q.Set(bson.M{"a": 1}),
+	q.Push(bson.M{"tags": q.Each(bson.A{"x"}).Slice(-5)}),
+	q.Inc(bson.M{"n": int64(1)}),
+)`},
+		{"push sort", `{ $push: { tags: { $each: ["x"], $sort: -1 }, items: { $each: [], $sort: { score: { $meta: "textScore" }, n: 1 } } } }`, updateMode, `q.Push(bson.M{
+	"tags":  q.Each(bson.A{"x"}).SortElements(-1),
+	"items": q.Each(bson.A{}).Sort(q.TextScore("score").Asc("n")),
+})`},
+		{"expression", `{ $cond: { if: { $gt: [{ $year: { date: "$at", timezone: "+08" } }, 2020] }, then: { $literal: "$x" }, else: null } }`, autoMode,
+			`a.Cond(a.Gt(a.Year("$at").SetTimezone("+08"), 2020), a.Literal("$x"), nil)`},
+		{"date trunc", `{ $dateTrunc: { date: { $dateAdd: { startDate: "$at", unit: "day", amount: 1 } }, unit: "week", startOfWeek: "mon" } }`, exprMode,
+			`a.DateTruncNative(a.DateAdd("$at", "day", 1), "week").SetStartOfWeek("mon")`},
+		{"percentile", `{ $percentile: { input: "$latency", p: [0.5, 0.95], method: "approximate" } }`, exprMode,
+			`a.Percentile("$latency", bson.A{0.5, 0.95}, "approximate")`},
+		{"sortArray", `{ $sortArray: { input: { $sortArray: { input: "$scores", sortBy: -1 } }, sortBy: { n: 1 } } }`, exprMode,
+			`a.SortArray(a.SortArray("$scores", -1), a.Asc("n"))`},
+		{"maxN", `{ $maxN: { input: "$scores", n: 2 } }`, exprMode, `a.MaxN("$scores", 2)`},
+		{"maxN expression n", `{ $maxN: { input: "$scores", n: "$k" } }`, exprMode, `bson.M{"$maxN": bson.M{"input": "$scores", "n": "$k"}}`},
+		{"switch", `{ $switch: { branches: [{ case: { $eq: ["$a", 1] }, then: "one" }], default: "other" } }`, exprMode,
+			`a.Switch(a.Eq("$a", 1), "one", "other")`},
+		{"spread", `{ $add: [{ $sum: ["$a"] }, { $sum: ["$a", "$b"] }] }`, exprMode,
+			`a.Add(bson.M{"$sum": bson.A{"$a"}}, a.Sum("$a", "$b"))`},
+		{"slow query log", `{"t":{"$date":"2021-01-01T00:00:00Z"},"attr":{"command":{"aggregate":"c","pipeline":[{"$match":{"at":{"$lt":{"$date":"2021-01-02T03:04:05.006Z"}}}},{"$count":"n"}]}}}`, autoMode, `bson.A{
+	a.Match(bson.M{
+		"at": q.Lt(primitive.NewDateTimeFromTime(time.Date(2021, 1, 2, 3, 4, 5, 6000000, time.UTC))),
+	}),
+	a.Count("n"),
+}`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := convert(c.text, c.mode)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, res)
+		})
+	}
+}
+
+func TestConvertError(t *testing.T) {
+	_, err := convert("{", autoMode)
+	assert.EqualError(t, err, "format: 1:2: expected key, got end of input")
+	_, err = convert("{}", pipelineMode)
+	assert.EqualError(t, err, "pipeline must be an array, got primitive.D")
+	_, err = convert("{}", "foo")
+	assert.EqualError(t, err, `unknown mode "foo"`)
+}
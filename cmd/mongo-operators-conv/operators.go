@@ -0,0 +1,374 @@
+package main
+
+// argType is how an argument is converted to go code.
+type argType int
+
+const (
+	// exprArg is an aggregation expression.
+	exprArg argType = iota
+	// literalArg is written as is.
+	literalArg
+	// stringArg must be a string, e.g. field name of a Path or string parameter.
+	stringArg
+	// boolArg must be a boolean.
+	boolArg
+	// intArg must be an integer, written as untyped constant.
+	intArg
+	// numberArg must be a number, written as untyped constant.
+	numberArg
+	// jsArg must be a string, used as primitive.JavaScript.
+	jsArg
+	// filterArg is a query filter.
+	filterArg
+	// vectorSearchFilterArg is a query filter using only operators
+	// supported in $vectorSearch pre-filter.
+	vectorSearchFilterArg
+	// pipelineArg is an aggregation pipeline.
+	pipelineArg
+	// sortArg is a sort specification, key order is kept.
+	sortArg
+	// sortSpecArg is a sort specification passed as SortSpec, key order is kept.
+	sortSpecArg
+	// accumulatorsArg is a document of accumulator expressions.
+	accumulatorsArg
+	// spreadArg must be an array, items are expressions passed as variadic arguments.
+	spreadArg
+)
+
+type arg struct {
+	key string
+	// method of optional argument, e.g. SetTimezone.
+	method string
+	typ    argType
+}
+
+// callKind is how operator argument maps to constructor parameters.
+type callKind int
+
+const (
+	// unaryCall accepts a single argument, an one-element array is unwrapped.
+	unaryCall callKind = iota
+	// positionalCall accepts an array of len(args) items,
+	// trailing items are optional arguments set by methods.
+	positionalCall
+	// variadicCall accepts an array of expressions.
+	variadicCall
+	// spreadCall accepts a single expression or an array of expressions.
+	spreadCall
+	// namedCall accepts a document, args are required keys in order,
+	// options are optional keys set by methods,
+	// option without method is a fixed value set by constructor.
+	namedCall
+	// emptyCall accepts an empty document.
+	emptyCall
+	// dateCall accepts a date expression or a document with date and timezone.
+	dateCall
+)
+
+type operator struct {
+	fn      string
+	kind    callKind
+	args    []arg
+	options []arg
+}
+
+func exprArgs(n int) []arg {
+	return make([]arg, n)
+}
+
+var (
+	unary   = exprArgs(1)
+	binary  = exprArgs(2)
+	ternary = exprArgs(3)
+)
+
+// expressionOperators maps aggregation expression operators to constructors.
+// $first, $last, $slice, $cond, $switch, $dateFromParts, $expMovingAvg,
+// $function and $accumulator are handled separately.
+// $replaceAll is omitted, since ReplaceAll emits $replaceOne.
+var expressionOperators = map[string]operator{
+	"$abs":              {fn: "Abs", kind: unaryCall, args: unary},
+	"$acos":             {fn: "ACos", kind: unaryCall, args: unary},
+	"$acosh":            {fn: "ACosH", kind: unaryCall, args: unary},
+	"$add":              {fn: "Add", kind: variadicCall},
+	"$allElementsTrue":  {fn: "AllElementsTrue", kind: unaryCall, args: unary},
+	"$and":              {fn: "And", kind: variadicCall},
+	"$anyElementsTrue":  {fn: "AnyElementsTrue", kind: unaryCall, args: unary},
+	"$arrayElemAt":      {fn: "ArrayElemAt", kind: positionalCall, args: binary},
+	"$arrayToObject":    {fn: "ArrayToObject", kind: unaryCall, args: unary},
+	"$asin":             {fn: "ASin", kind: unaryCall, args: unary},
+	"$asinh":            {fn: "ASinH", kind: unaryCall, args: unary},
+	"$atan":             {fn: "ATan", kind: unaryCall, args: unary},
+	"$atan2":            {fn: "ATan2", kind: positionalCall, args: binary},
+	"$atanh":            {fn: "ATanH", kind: unaryCall, args: unary},
+	"$avg":              {fn: "Avg", kind: spreadCall},
+	"$binarySize":       {fn: "BinarySize", kind: unaryCall, args: unary},
+	"$bsonSize":         {fn: "BSONSize", kind: unaryCall, args: unary},
+	"$ceil":             {fn: "Ceil", kind: unaryCall, args: unary},
+	"$cmp":              {fn: "Cmp", kind: positionalCall, args: binary},
+	"$concat":           {fn: "Concat", kind: variadicCall},
+	"$concatArrays":     {fn: "ConcatArrays", kind: variadicCall},
+	"$convert":          {fn: "Convert", kind: namedCall, args: []arg{{"input", "", exprArg}, {"to", "", exprArg}}, options: []arg{{"onError", "SetOnError", exprArg}, {"onNull", "SetOnNull", exprArg}}},
+	"$cos":              {fn: "Cos", kind: unaryCall, args: unary},
+	"$covariancePop":    {fn: "CovariancePop", kind: positionalCall, args: binary},
+	"$covarianceSamp":   {fn: "CovarianceSamp", kind: positionalCall, args: binary},
+	"$dateAdd":          {fn: "DateAdd", kind: namedCall, args: []arg{{"startDate", "", exprArg}, {"unit", "", stringArg}, {"amount", "", exprArg}}, options: []arg{{"timezone", "SetTimezone", exprArg}}},
+	"$dateDiff":         {fn: "DateDiff", kind: namedCall, args: []arg{{"startDate", "", exprArg}, {"endDate", "", exprArg}, {"unit", "", stringArg}}, options: []arg{{"timezone", "SetTimezone", exprArg}, {"startOfWeek", "SetStartOfWeek", exprArg}}},
+	"$dateFromString":   {fn: "DateFromString", kind: namedCall, args: []arg{{"dateString", "", exprArg}}, options: []arg{{"format", "SetFormat", exprArg}, {"timezone", "SetTimezone", exprArg}, {"onError", "SetOnError", exprArg}, {"onNull", "SetOnNull", exprArg}}},
+	"$dateToParts":      {fn: "DateToParts", kind: namedCall, args: []arg{{"date", "", exprArg}}, options: []arg{{"timezone", "SetTimezone", exprArg}, {"iso8601", "SetISO8601", boolArg}}},
+	"$dateSubtract":     {fn: "DateSubtract", kind: namedCall, args: []arg{{"startDate", "", exprArg}, {"unit", "", stringArg}, {"amount", "", exprArg}}, options: []arg{{"timezone", "SetTimezone", exprArg}}},
+	"$dateToString":     {fn: "DateToString", kind: namedCall, args: []arg{{"date", "", exprArg}}, options: []arg{{"format", "SetFormat", stringArg}, {"timezone", "SetTimezone", exprArg}}},
+	"$dateTrunc":        {fn: "DateTruncNative", kind: namedCall, args: []arg{{"date", "", exprArg}, {"unit", "", stringArg}}, options: []arg{{"binSize", "SetBinSize", exprArg}, {"timezone", "SetTimezone", exprArg}, {"startOfWeek", "SetStartOfWeek", exprArg}}},
+	"$dayOfMonth":       {fn: "DayOfMonth", kind: dateCall},
+	"$dayOfWeek":        {fn: "DayOfWeek", kind: dateCall},
+	"$dayOfYear":        {fn: "DayOfYear", kind: dateCall},
+	"$degreesToRadians": {fn: "DegreesToRadians", kind: unaryCall, args: unary},
+	"$denseRank":        {fn: "DenseRank", kind: emptyCall},
+	"$derivative":       {fn: "Derivative", kind: namedCall, args: []arg{{"input", "", exprArg}}, options: []arg{{"unit", "SetUnit", stringArg}}},
+	"$divide":           {fn: "Divide", kind: positionalCall, args: binary},
+	"$documentNumber":   {fn: "DocumentNumber", kind: emptyCall},
+	"$eq":               {fn: "Eq", kind: positionalCall, args: binary},
+	"$exp":              {fn: "Exp", kind: unaryCall, args: unary},
+	"$filter":           {fn: "Filter", kind: namedCall, args: []arg{{"input", "", exprArg}, {"cond", "", exprArg}}, options: []arg{{"as", "SetAs", stringArg}}},
+	"$firstN":           nOperator("FirstN"),
+	"$floor":            {fn: "Floor", kind: unaryCall, args: unary},
+	"$getField":         {fn: "GetField", kind: namedCall, args: []arg{{"field", "", stringArg}, {"input", "", exprArg}}},
+	"$gt":               {fn: "Gt", kind: positionalCall, args: binary},
+	"$gte":              {fn: "Gte", kind: positionalCall, args: binary},
+	"$hour":             {fn: "Hour", kind: dateCall},
+	"$ifNull":           {fn: "IfNull", kind: positionalCall, args: binary},
+	"$in":               {fn: "In", kind: positionalCall, args: binary},
+	"$indexOfArray":     {fn: "IndexOfArray", kind: positionalCall, args: binary, options: []arg{{"", "SetStart", exprArg}, {"", "SetEnd", exprArg}}},
+	"$indexOfBytes":     {fn: "IndexOfBytes", kind: positionalCall, args: binary},
+	"$indexOfCP":        {fn: "IndexOfCP", kind: positionalCall, args: binary, options: []arg{{"", "SetStart", exprArg}, {"", "SetEnd", exprArg}}},
+	"$integral":         {fn: "Integral", kind: namedCall, args: []arg{{"input", "", exprArg}}, options: []arg{{"unit", "SetUnit", stringArg}}},
+	"$isArray":          {fn: "IsArray", kind: unaryCall, args: unary},
+	"$isNumber":         {fn: "IsNumber", kind: unaryCall, args: unary},
+	"$isoDayOfWeek":     {fn: "ISODayOfWeek", kind: dateCall},
+	"$isoWeek":          {fn: "ISOWeek", kind: dateCall},
+	"$isoWeekYear":      {fn: "ISOWeekYear", kind: dateCall},
+	"$lastN":            nOperator("LastN"),
+	"$let":              {fn: "Let", kind: namedCall, args: []arg{{"vars", "", exprArg}, {"in", "", exprArg}}},
+	"$linearFill":       {fn: "LinearFill", kind: unaryCall, args: unary},
+	"$literal":          {fn: "Literal", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$ln":               {fn: "Ln", kind: unaryCall, args: unary},
+	"$log":              {fn: "Log", kind: positionalCall, args: binary},
+	"$log10":            {fn: "Log10", kind: unaryCall, args: unary},
+	"$locf":             {fn: "Locf", kind: unaryCall, args: unary},
+	"$lt":               {fn: "Lt", kind: positionalCall, args: binary},
+	"$lte":              {fn: "Lte", kind: positionalCall, args: binary},
+	"$ltrim":            {fn: "LTrim", kind: namedCall, args: []arg{{"input", "", exprArg}}, options: []arg{{"chars", "SetChars", exprArg}}},
+	"$map":              {fn: "Map", kind: namedCall, args: []arg{{"input", "", exprArg}, {"in", "", exprArg}}, options: []arg{{"as", "SetAs", stringArg}}},
+	"$max":              {fn: "Max", kind: spreadCall},
+	"$maxN":             nOperator("MaxN"),
+	"$median":           medianOperator,
+	"$mergeObjects":     {fn: "MergeObjects", kind: spreadCall},
+	"$meta":             {fn: "Meta", kind: unaryCall, args: []arg{{"", "", stringArg}}},
+	"$millisecond":      {fn: "Millisecond", kind: dateCall},
+	"$min":              {fn: "Min", kind: spreadCall},
+	"$minN":             nOperator("MinN"),
+	"$minute":           {fn: "Minute", kind: dateCall},
+	"$mod":              {fn: "Mod", kind: positionalCall, args: binary},
+	"$month":            {fn: "Month", kind: dateCall},
+	"$multiply":         {fn: "Multiply", kind: positionalCall, args: binary},
+	"$ne":               {fn: "Ne", kind: positionalCall, args: binary},
+	"$not":              {fn: "Not", kind: unaryCall, args: unary},
+	"$objectToArray":    {fn: "ObjectToArray", kind: unaryCall, args: unary},
+	"$or":               {fn: "Or", kind: variadicCall},
+	"$percentile":       percentileOperator,
+	"$pow":              {fn: "Pow", kind: positionalCall, args: binary},
+	"$radiansToDegrees": {fn: "RadiansToDegrees", kind: unaryCall, args: unary},
+	"$rand":             {fn: "Rand", kind: emptyCall},
+	"$range":            {fn: "Range", kind: positionalCall, args: binary, options: []arg{{"", "SetStep", exprArg}}},
+	"$rank":             {fn: "Rank", kind: emptyCall},
+	"$reduce":           {fn: "Reduce", kind: namedCall, args: []arg{{"input", "", exprArg}, {"initialValue", "", exprArg}, {"in", "", exprArg}}},
+	"$regexFind":        {fn: "RegexFind", kind: namedCall, args: []arg{{"input", "", exprArg}, {"regex", "", exprArg}}, options: []arg{{"options", "SetOptions", exprArg}}},
+	"$regexFindAll":     {fn: "RegexFindAll", kind: namedCall, args: []arg{{"input", "", exprArg}, {"regex", "", exprArg}}, options: []arg{{"options", "SetOptions", exprArg}}},
+	"$regexMatch":       {fn: "RegexMatch", kind: namedCall, args: []arg{{"input", "", exprArg}, {"regex", "", exprArg}}, options: []arg{{"options", "SetOptions", exprArg}}},
+	"$replaceOne":       {fn: "ReplaceOne", kind: namedCall, args: []arg{{"input", "", exprArg}, {"find", "", exprArg}, {"replacement", "", exprArg}}},
+	"$reverseArray":     {fn: "ReverseArray", kind: unaryCall, args: unary},
+	"$round":            {fn: "Round", kind: positionalCall, args: binary},
+	"$rtrim":            {fn: "RTrim", kind: namedCall, args: []arg{{"input", "", exprArg}}, options: []arg{{"chars", "SetChars", exprArg}}},
+	"$second":           {fn: "Second", kind: dateCall},
+	"$setDifference":    {fn: "SetDifference", kind: positionalCall, args: binary},
+	"$setEquals":        {fn: "SetEquals", kind: variadicCall},
+	"$setField":         {fn: "SetField", kind: namedCall, args: []arg{{"field", "", stringArg}, {"input", "", exprArg}, {"value", "", exprArg}}},
+	"$setIntersection":  {fn: "SetIntersection", kind: variadicCall},
+	"$setIsSubset":      {fn: "SetIsSubset", kind: positionalCall, args: binary},
+	"$setUnion":         {fn: "SetUnion", kind: variadicCall},
+	"$shift":            {fn: "Shift", kind: namedCall, args: []arg{{"output", "", exprArg}, {"by", "", intArg}}, options: []arg{{"default", "SetDefault", exprArg}}},
+	"$sin":              {fn: "Sin", kind: unaryCall, args: unary},
+	"$size":             {fn: "Size", kind: unaryCall, args: unary},
+	"$sortArray":        {fn: "SortArray", kind: namedCall, args: []arg{{"input", "", exprArg}, {"sortBy", "", sortArg}}},
+	"$split":            {fn: "Split", kind: positionalCall, args: binary},
+	"$sqrt":             {fn: "Sqrt", kind: unaryCall, args: unary},
+	"$stdDevPop":        {fn: "StdDevPop", kind: spreadCall},
+	"$stdDevSamp":       {fn: "StdDevSamp", kind: spreadCall},
+	"$strcasecmp":       {fn: "StrCaseCmp", kind: positionalCall, args: binary},
+	"$strLenBytes":      {fn: "StrLenBytes", kind: unaryCall, args: unary},
+	"$strLenCP":         {fn: "StrLenCP", kind: unaryCall, args: unary},
+	"$substrBytes":      {fn: "SubstrBytes", kind: positionalCall, args: ternary},
+	"$substrCP":         {fn: "SubstrCP", kind: positionalCall, args: ternary},
+	"$subtract":         {fn: "Subtract", kind: positionalCall, args: binary},
+	"$sum":              {fn: "Sum", kind: spreadCall},
+	"$tan":              {fn: "Tan", kind: unaryCall, args: unary},
+	"$toBool":           {fn: "ToBool", kind: unaryCall, args: unary},
+	"$toDate":           {fn: "ToDate", kind: unaryCall, args: unary},
+	"$toDecimal":        {fn: "ToDecimal", kind: unaryCall, args: unary},
+	"$toDouble":         {fn: "ToDouble", kind: unaryCall, args: unary},
+	"$toInt":            {fn: "ToInt", kind: unaryCall, args: unary},
+	"$toLong":           {fn: "ToLong", kind: unaryCall, args: unary},
+	"$toLower":          {fn: "ToLower", kind: unaryCall, args: unary},
+	"$toObjectId":       {fn: "ToObjectID", kind: unaryCall, args: unary},
+	"$toString":         {fn: "ToString", kind: unaryCall, args: unary},
+	"$toUpper":          {fn: "ToUpper", kind: unaryCall, args: unary},
+	"$trim":             {fn: "Trim", kind: namedCall, args: []arg{{"input", "", exprArg}}, options: []arg{{"chars", "SetChars", exprArg}}},
+	"$trunc":            {fn: "Trunc", kind: positionalCall, args: binary},
+	"$type":             {fn: "Type", kind: unaryCall, args: unary},
+	"$unsetField":       {fn: "UnsetField", kind: namedCall, args: []arg{{"field", "", stringArg}, {"input", "", exprArg}}},
+	"$week":             {fn: "Week", kind: dateCall},
+	"$year":             {fn: "Year", kind: dateCall},
+	"$zip":              {fn: "Zip", kind: namedCall, args: []arg{{"inputs", "", spreadArg}}, options: []arg{{"useLongestLength", "SetUseLongestLength", boolArg}, {"defaults", "SetDefaults", exprArg}}},
+}
+
+var dateFromPartsC = operator{fn: "DateFromPartsC", kind: namedCall, args: []arg{{"year", "", exprArg}}, options: []arg{
+	{"month", "SetMonth", exprArg},
+	{"day", "SetDay", exprArg},
+	{"hour", "SetHour", exprArg},
+	{"minute", "SetMinute", exprArg},
+	{"second", "SetSecond", exprArg},
+	{"millisecond", "SetMillisecond", exprArg},
+	{"timezone", "SetTimezone", exprArg},
+}}
+
+var dateFromPartsW = operator{fn: "DateFromPartsW", kind: namedCall, args: []arg{{"isoWeekYear", "", exprArg}}, options: []arg{
+	{"isoWeek", "SetWeek", exprArg},
+	{"isoDayOfWeek", "SetDayOfWeek", exprArg},
+	{"hour", "SetHour", exprArg},
+	{"minute", "SetMinute", exprArg},
+	{"second", "SetSecond", exprArg},
+	{"millisecond", "SetMillisecond", exprArg},
+	{"timezone", "SetTimezone", exprArg},
+}}
+
+// accumulatorOperators maps operators of $group, $bucket
+// and $setWindowFields output, expression operators are used as fallback.
+var accumulatorOperators = map[string]operator{
+	"$addToSet":     {fn: "AddToSet", kind: unaryCall, args: unary},
+	"$avg":          {fn: "Avg", kind: unaryCall, args: unary},
+	"$bottom":       {fn: "Bottom", kind: namedCall, args: []arg{{"sortBy", "", sortSpecArg}, {"output", "", exprArg}}},
+	"$bottomN":      {fn: "BottomN", kind: namedCall, args: []arg{{"n", "", intArg}, {"sortBy", "", sortSpecArg}, {"output", "", exprArg}}},
+	"$count":        {fn: "CountAccumulator", kind: emptyCall},
+	"$first":        {fn: "First", kind: unaryCall, args: unary},
+	"$firstN":       nOperator("FirstN"),
+	"$last":         {fn: "Last", kind: unaryCall, args: unary},
+	"$lastN":        nOperator("LastN"),
+	"$max":          {fn: "Max", kind: unaryCall, args: unary},
+	"$maxN":         nOperator("MaxN"),
+	"$median":       medianOperator,
+	"$mergeObjects": {fn: "MergeObjects", kind: unaryCall, args: unary},
+	"$min":          {fn: "Min", kind: unaryCall, args: unary},
+	"$minN":         nOperator("MinN"),
+	"$percentile":   percentileOperator,
+	"$push":         {fn: "Push", kind: unaryCall, args: unary},
+	"$stdDevPop":    {fn: "StdDevPop", kind: unaryCall, args: unary},
+	"$stdDevSamp":   {fn: "StdDevSamp", kind: unaryCall, args: unary},
+	"$sum":          {fn: "Sum", kind: unaryCall, args: unary},
+	"$top":          {fn: "Top", kind: namedCall, args: []arg{{"sortBy", "", sortSpecArg}, {"output", "", exprArg}}},
+	"$topN":         {fn: "TopN", kind: namedCall, args: []arg{{"n", "", intArg}, {"sortBy", "", sortSpecArg}, {"output", "", exprArg}}},
+}
+
+// percentile operators are available as accumulator and expression.
+var (
+	medianOperator     = operator{fn: "Median", kind: namedCall, args: []arg{{"input", "", exprArg}, {"method", "", stringArg}}}
+	percentileOperator = operator{fn: "Percentile", kind: namedCall, args: []arg{{"input", "", exprArg}, {"p", "", exprArg}, {"method", "", stringArg}}}
+)
+
+// nOperator is $firstN like operator, available as accumulator and array expression.
+func nOperator(fn string) operator {
+	return operator{fn: fn, kind: namedCall, args: []arg{{"input", "", exprArg}, {"n", "", intArg}}}
+}
+
+// stages maps aggregation stages to constructors,
+// $lookup, $unwind, $unset, $merge, $unionWith, $collStats, $setWindowFields,
+// $densify and $fill are handled separately.
+var stages = map[string]operator{
+	"$addFields":         {fn: "AddFields", kind: unaryCall, args: unary},
+	"$bucket":            {fn: "Bucket", kind: namedCall, args: []arg{{"groupBy", "", exprArg}, {"boundaries", "", literalArg}}, options: []arg{{"default", "SetDefault", literalArg}, {"output", "SetOutput", accumulatorsArg}}},
+	"$bucketAuto":        {fn: "BucketAuto", kind: namedCall, args: []arg{{"groupBy", "", exprArg}, {"buckets", "", intArg}}, options: []arg{{"output", "SetOutput", accumulatorsArg}, {"granularity", "SetGranularity", stringArg}}},
+	"$count":             {fn: "Count", kind: unaryCall, args: []arg{{"", "", stringArg}}},
+	"$currentOp":         {fn: "CurrentOp", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$geoNear":           {fn: "GeoNear", kind: namedCall, args: []arg{{"near", "", literalArg}, {"distanceField", "", stringArg}}, options: []arg{{"spherical", "SetSpherical", boolArg}, {"maxDistance", "SetMaxDistance", numberArg}, {"query", "SetQuery", filterArg}, {"distanceMultiplier", "SetDistanceMultiplier", numberArg}, {"includeLocs", "SetIncludeLocs", stringArg}, {"uniqueDocs", "SetUniqueDocs", boolArg}, {"minDistance", "SetMinDistance", numberArg}, {"key", "SetKey", stringArg}}},
+	"$graphLookup":       {fn: "GraphLookup", kind: namedCall, args: []arg{{"from", "", stringArg}, {"startWith", "", exprArg}, {"connectFromField", "", stringArg}, {"connectToField", "", stringArg}, {"as", "", stringArg}}, options: []arg{{"maxDepth", "SetMaxDepth", intArg}, {"depthField", "SetDepthField", stringArg}, {"restrictSearchWithMatch", "SetRestrictSearchWithMatch", filterArg}}},
+	"$group":             {fn: "Group", kind: unaryCall, args: []arg{{"", "", accumulatorsArg}}},
+	"$indexStats":        {fn: "IndexStats", kind: emptyCall},
+	"$limit":             {fn: "Limit", kind: unaryCall, args: []arg{{"", "", intArg}}},
+	"$listLocalSessions": {fn: "ListLocalSessions", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$match":             {fn: "Match", kind: unaryCall, args: []arg{{"", "", filterArg}}},
+	"$out":               {fn: "Out", kind: unaryCall, args: []arg{{"", "", stringArg}}},
+	"$planCacheStats":    {fn: "PlanCacheStats", kind: emptyCall},
+	"$project":           {fn: "Project", kind: unaryCall, args: unary},
+	"$redact":            {fn: "Redact", kind: unaryCall, args: unary},
+	"$replaceRoot":       {fn: "ReplaceRoot", kind: namedCall, args: []arg{{"newRoot", "", exprArg}}},
+	"$replaceWith":       {fn: "ReplaceWith", kind: unaryCall, args: unary},
+	"$sample":            {fn: "Sample", kind: namedCall, args: []arg{{"size", "", intArg}}},
+	"$search":            {fn: "Search", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$searchMeta":        {fn: "SearchMeta", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$set":               {fn: "Set", kind: unaryCall, args: unary},
+	"$skip":              {fn: "Skip", kind: unaryCall, args: []arg{{"", "", intArg}}},
+	"$sort":              {fn: "Sort", kind: unaryCall, args: []arg{{"", "", sortSpecArg}}},
+	"$sortByCount":       {fn: "SortByCount", kind: unaryCall, args: unary},
+	"$vectorSearch":      {fn: "VectorSearch", kind: namedCall, args: []arg{{"index", "", stringArg}, {"path", "", stringArg}, {"queryVector", "", literalArg}, {"limit", "", intArg}}, options: []arg{{"numCandidates", "SetNumCandidates", intArg}, {"filter", "SetFilter", vectorSearchFilterArg}, {"exact", "SetExact", boolArg}}},
+}
+
+// queryOperators maps query operators of a field to constructors,
+// $regex and $options are handled separately.
+var queryOperators = map[string]operator{
+	"$all":           {fn: "All", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$bitsAllClear":  {fn: "BitsAllClear", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$bitsAllSet":    {fn: "BitsAllSet", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$bitsAnyClear":  {fn: "BitsAnyClear", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$bitsAnySet":    {fn: "BitsAnySet", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$eq":            {fn: "Eq", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$exists":        {fn: "Exists", kind: unaryCall, args: []arg{{"", "", boolArg}}},
+	"$geoIntersects": {fn: "GeoIntersects", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$geoWithin":     {fn: "GeoWithIn", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$gt":            {fn: "Gt", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$gte":           {fn: "Gte", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$in":            {fn: "In", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$lt":            {fn: "Lt", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$lte":           {fn: "Lte", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$mod":           {fn: "Mod", kind: positionalCall, args: []arg{{"", "", intArg}, {"", "", intArg}}},
+	"$ne":            {fn: "Ne", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$nin":           {fn: "Nin", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$size":          {fn: "Size", kind: unaryCall, args: []arg{{"", "", intArg}}},
+	"$type":          {fn: "Type", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+}
+
+// topLevelQueryOperators maps query operators of a filter document to constructors,
+// $and, $or, $nor and $where are handled separately.
+var topLevelQueryOperators = map[string]operator{
+	"$comment":    {fn: "Comment", kind: unaryCall, args: []arg{{"", "", stringArg}}},
+	"$expr":       {fn: "Expr", kind: unaryCall, args: unary},
+	"$jsonSchema": {fn: "JSONSchema", kind: unaryCall, args: []arg{{"", "", literalArg}}},
+	"$text":       {fn: "Text", kind: namedCall, args: []arg{{"$search", "", stringArg}}},
+}
+
+// updateOperators maps update operators to constructors.
+var updateOperators = map[string]string{
+	"$addToSet":    "AddToSet",
+	"$bit":         "Bit",
+	"$currentDate": "CurrentDate",
+	"$inc":         "Inc",
+	"$max":         "Max",
+	"$min":         "Min",
+	"$mul":         "Mul",
+	"$pop":         "Pop",
+	"$pull":        "Pull",
+	"$pullAll":     "PullAll",
+	"$push":        "Push",
+	"$rename":      "Rename",
+	"$set":         "Set",
+	"$setOnInsert": "SetOnInsert",
+	"$unset":       "Unset",
+}
@@ -0,0 +1,315 @@
+// Command mongo-operators-gen generates typed field paths
+// from struct bson tags, so renaming a field breaks compilation
+// instead of silently breaking queries.
+//
+// Usage:
+//
+//	//go:generate go run github.com/NateScarlet/mongo-operators/cmd/mongo-operators-gen -type User,Order
+//
+// For each struct type T, it generates type TPath with a method
+// for each field, and variable TFields as root path:
+//
+//	bson.M{UserFields.Profile().Name().String(): q.Ne("foo")}
+//	a.Unwind(UserFields.Tags())
+//	a.Size(UserFields.Items().Path)
+//	UserFields.ItemsAt(0).SKU().Ref() // "$items.0.sku"
+//
+// Slice fields also have an accessor for element at index.
+// Nested path types embed query.Path, so the Path field, Ref and String
+// are available on every generated path.
+// Fields whose accessor would shadow a method of query.Path,
+// e.g. a field named Ref or String, are reported as error.
+//
+// Field keys follow the driver's default struct codec:
+// bson tag name or lowercased field name,
+// "-" fields are skipped and ",inline" struct fields are flattened.
+// Struct types of same package used by fields are generated as well,
+// so list all root types of a package in a single command.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("mongo-operators-gen: ")
+	var typeNames = flag.String("type", "", "comma-separated list of struct type names; must be set")
+	var output = flag.String("output", "", "output file name; default <type>_fields.go")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of mongo-operators-gen:\n")
+		fmt.Fprintf(os.Stderr, "\tmongo-operators-gen -type T [directory]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *typeNames == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	var dir = "."
+	if flag.NArg() > 0 {
+		dir = flag.Arg(0)
+	}
+	var types = strings.Split(*typeNames, ",")
+	src, err := generate(dir, types)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var name = *output
+	if name == "" {
+		name = filepath.Join(dir, strings.ToLower(types[0])+"_fields.go")
+	}
+	if err := ioutil.WriteFile(name, src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate parses go package in dir and returns generated source for types.
+func generate(dir string, types []string) ([]byte, error) {
+	var fset = token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("expected exactly one package in %s, found %d", dir, len(pkgs))
+	}
+	var g = &generator{structs: map[string]*ast.StructType{}, done: map[string]bool{}}
+	for _, pkg := range pkgs {
+		g.pkg = pkg.Name
+		for _, f := range pkg.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if spec, ok := n.(*ast.TypeSpec); ok {
+					if st, ok := spec.Type.(*ast.StructType); ok {
+						g.structs[spec.Name.Name] = st
+					}
+				}
+				return true
+			})
+		}
+	}
+	for _, i := range types {
+		if _, ok := g.structs[i]; !ok {
+			return nil, fmt.Errorf("struct type %s not found", i)
+		}
+		g.queue = append(g.queue, i)
+	}
+	return g.generate(types)
+}
+
+type generator struct {
+	pkg     string
+	structs map[string]*ast.StructType
+	queue   []string
+	done    map[string]bool
+	buf     bytes.Buffer
+}
+
+// field is a generated accessor.
+type field struct {
+	name string
+	key  string
+	// struct type name for nested document, empty for leaf value.
+	typ   string
+	slice bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) generate(types []string) ([]byte, error) {
+	g.printf("// Code generated by \"mongo-operators-gen -type %s\"; DO NOT EDIT.\n\n", strings.Join(types, ","))
+	g.printf("package %s\n\n", g.pkg)
+	g.printf("import \"github.com/NateScarlet/mongo-operators/pkg/query\"\n")
+	for len(g.queue) > 0 {
+		var name = g.queue[0]
+		g.queue = g.queue[1:]
+		if g.done[name] {
+			continue
+		}
+		g.done[name] = true
+		if err := g.generateType(name); err != nil {
+			return nil, err
+		}
+	}
+	return format.Source(g.buf.Bytes())
+}
+
+func (g *generator) generateType(name string) error {
+	fields, err := g.fields(g.structs[name], map[string]bool{name: true})
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	var methods = map[string]string{}
+	var addMethod = func(method, key string) error {
+		if method == "Path" || isPathMethod(method) {
+			return fmt.Errorf("%s: method %s generated for %q conflicts with embedded query.Path", name, method, key)
+		}
+		if other, ok := methods[method]; ok {
+			return fmt.Errorf("%s: method %s generated for both %q and %q", name, method, other, key)
+		}
+		methods[method] = key
+		return nil
+	}
+	var pathType = name + "Path"
+	g.printf("\n// %s is field paths of %s.\n", pathType, name)
+	g.printf("type %s struct{ query.Path }\n", pathType)
+	g.printf("\n// %sFields is root of %s field paths.\n", name, name)
+	g.printf("var %sFields %s\n", name, pathType)
+	for _, f := range fields {
+		if err := addMethod(f.name, f.key); err != nil {
+			return err
+		}
+		var ret, wrap = "query.Path", "%s"
+		if f.typ != "" {
+			ret, wrap = f.typ+"Path", f.typ+"Path{%s}"
+			g.queue = append(g.queue, f.typ)
+		}
+		var path = fmt.Sprintf("p.Path.Sub(%s)", strconv.Quote(f.key))
+		g.printf("\n// %s is path of %q.\n", f.name, f.key)
+		g.printf("func (p %s) %s() %s {\n", pathType, f.name, ret)
+		g.printf("\treturn "+wrap+"\n}\n", path)
+		if f.slice {
+			var method = f.name + "At"
+			if err := addMethod(method, f.key); err != nil {
+				return err
+			}
+			g.printf("\n// %s is path of %q element at index.\n", method, f.key)
+			g.printf("func (p %s) %s(index int) %s {\n", pathType, method, ret)
+			g.printf("\treturn "+wrap+"\n}\n", path+".Index(index)")
+		}
+	}
+	return nil
+}
+
+// isPathMethod reports whether name is a method promoted from embedded query.Path.
+func isPathMethod(name string) bool {
+	_, ok := reflect.TypeOf(query.Path("")).MethodByName(name)
+	return ok
+}
+
+// fields collects fields of st, inline fields are flattened.
+func (g *generator) fields(st *ast.StructType, inlining map[string]bool) ([]field, error) {
+	var ret []field
+	for _, i := range st.Fields.List {
+		var tag reflect.StructTag
+		if i.Tag != nil {
+			s, err := strconv.Unquote(i.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(s)
+		}
+		var names []string
+		for _, n := range i.Names {
+			names = append(names, n.Name)
+		}
+		if len(names) == 0 {
+			names = []string{embeddedName(i.Type)}
+		}
+		var typ, slice = g.resolve(i.Type)
+		for _, name := range names {
+			if name == "" || !ast.IsExported(name) {
+				continue
+			}
+			key, inline, skip := parseTag(name, tag)
+			if skip {
+				continue
+			}
+			if inline {
+				if typ == "" || slice {
+					// inline map holds arbitrary keys
+					continue
+				}
+				if inlining[typ] {
+					return nil, fmt.Errorf("recursive inline struct %s", typ)
+				}
+				inlining[typ] = true
+				sub, err := g.fields(g.structs[typ], inlining)
+				delete(inlining, typ)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, sub...)
+				continue
+			}
+			ret = append(ret, field{name: name, key: key, typ: typ, slice: slice})
+		}
+	}
+	return ret, nil
+}
+
+// resolve returns struct type name of a field type
+// and whether it is a slice or array.
+func (g *generator) resolve(expr ast.Expr) (string, bool) {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if _, ok := g.structs[t.Name]; ok {
+			return t.Name, false
+		}
+	case *ast.StarExpr:
+		return g.resolve(t.X)
+	case *ast.ParenExpr:
+		return g.resolve(t.X)
+	case *ast.ArrayType:
+		if elt, ok := t.Elt.(*ast.Ident); ok && elt.Name == "byte" {
+			// []byte is binary data
+			return "", false
+		}
+		var name, _ = g.resolve(t.Elt)
+		return name, true
+	}
+	return "", false
+}
+
+// embeddedName returns field name of an embedded field.
+func embeddedName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	}
+	return ""
+}
+
+// parseTag parses bson struct tag like the driver's default struct tag parser.
+func parseTag(name string, tag reflect.StructTag) (key string, inline, skip bool) {
+	key = strings.ToLower(name)
+	s, ok := tag.Lookup("bson")
+	if !ok && !strings.Contains(string(tag), ":") && len(tag) > 0 {
+		s = string(tag)
+	}
+	if s == "-" {
+		return "", false, true
+	}
+	for index, i := range strings.Split(s, ",") {
+		if index == 0 && i != "" {
+			key = i
+		}
+		if i == "inline" {
+			inline = true
+		}
+	}
+	return key, inline, false
+}
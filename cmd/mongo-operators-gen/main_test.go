@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateSource(t *testing.T, src string, types ...string) (string, error) {
+	dir, err := ioutil.TempDir("", "mongo-operators-gen")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "model.go"), []byte(src), 0644))
+	b, err := generate(dir, types)
+	return string(b), err
+}
+
+func TestGenerate(t *testing.T) {
+	res, err := generateSource(t, `package model
+
+type Base struct {
+	ID string `+"`bson:\"_id\"`"+`
+}
+
+type Item struct {
+	SKU string `+"`bson:\"sku\"`"+`
+}
+
+type Profile struct {
+	Name string `+"`bson:\"name,omitempty\"`"+`
+	Age  int
+}
+
+type User struct {
+	Base    `+"`bson:\",inline\"`"+`
+	Profile *Profile          `+"`bson:\"profile\"`"+`
+	Tags    []string          `+"`bson:\"tags\"`"+`
+	Items   []Item            `+"`bson:\"items\"`"+`
+	Data    []byte            `+"`bson:\"data\"`"+`
+	Extra   map[string]string `+"`bson:\",inline\"`"+`
+	Secret  string            `+"`bson:\"-\"`"+`
+	private string
+}
+`, "User")
+	require.NoError(t, err)
+	for _, i := range []string{
+		"package model\n",
+		"type UserPath struct{ query.Path }\n",
+		"var UserFields UserPath\n",
+		"func (p UserPath) ID() query.Path {\n\treturn p.Path.Sub(\"_id\")\n}\n",
+		"func (p UserPath) Profile() ProfilePath {\n\treturn ProfilePath{p.Path.Sub(\"profile\")}\n}\n",
+		"func (p UserPath) TagsAt(index int) query.Path {\n\treturn p.Path.Sub(\"tags\").Index(index)\n}\n",
+		"func (p UserPath) ItemsAt(index int) ItemPath {\n\treturn ItemPath{p.Path.Sub(\"items\").Index(index)}\n}\n",
+		"func (p UserPath) Data() query.Path {\n",
+		"func (p ProfilePath) Name() query.Path {\n\treturn p.Path.Sub(\"name\")\n}\n",
+		"func (p ProfilePath) Age() query.Path {\n\treturn p.Path.Sub(\"age\")\n}\n",
+		"func (p ItemPath) SKU() query.Path {\n",
+	} {
+		assert.Contains(t, res, i)
+	}
+	for _, i := range []string{"DataAt", "Secret", "private", "Extra", "BasePath"} {
+		assert.NotContains(t, res, i)
+	}
+}
+
+func TestGenerateError(t *testing.T) {
+	var err error
+	_, err = generateSource(t, "package model\n\ntype User struct{}\n", "Order")
+	assert.Error(t, err)
+	_, err = generateSource(t, "package model\n\ntype User struct{ Path string }\n", "User")
+	assert.Error(t, err)
+	for _, i := range []string{"Ref", "String", "Sub", "Index", "IsVar", "MarshalBSONValue"} {
+		_, err = generateSource(t, "package model\n\ntype Profile struct{ "+i+" string }\n", "Profile")
+		assert.EqualError(t, err, "Profile: method "+i+" generated for \""+strings.ToLower(i)+"\" conflicts with embedded query.Path", i)
+	}
+	_, err = generateSource(t, "package model\n\ntype Base struct{ ID string }\n\ntype User struct {\n\tBase `bson:\",inline\"`\n\tID   string\n}\n", "User")
+	assert.Error(t, err)
+}
@@ -1,25 +1,90 @@
 package aggregation
 
+import "reflect"
+
 // https://docs.mongodb.com/manual/reference/operator/aggregation/#array-expression-operators
 
+// ArrayCountIf returns number of elements in array that match cond,
+// cond references the element as "$$this".
+func ArrayCountIf(input, cond interface{}) M {
+	return Size(Filter(input, cond))
+}
+
 // ArrayElemAt returns the element at the specified array index.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/arrayElemAt
 func ArrayElemAt(array, index interface{}) M {
 	return M{"$arrayElemAt": A{array, index}}
 }
 
+// ArrayFlatten flattens nested arrays in input by depth levels,
+// non-array elements are kept.
+// Depth less than 1 is treated as 1.
+func ArrayFlatten(input interface{}, depth int) M {
+	var flatten = func(input interface{}) M {
+		return Reduce(input, A{}, ConcatArrays(
+			"$$value",
+			Cond(IsArray("$$this"), "$$this", A{"$$this"}),
+		))
+	}
+	var ret = flatten(input)
+	for i := 1; i < depth; i++ {
+		ret = flatten(ret)
+	}
+	return ret
+}
+
+// ArrayIndexBy converts an array of documents to a document
+// keyed by field of each element converted to string,
+// later element wins on duplicated key.
+// Requires 4.0 for $toString.
+func ArrayIndexBy(input interface{}, field Path) M {
+	return ArrayToObject(Map(input, A{ToString(Var("this").Sub(field.String())), "$$this"}))
+}
+
 // ArrayToObject converts an array into a single document.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/arrayToObject/
 func ArrayToObject(expr interface{}) M {
 	return M{"$arrayToObject": expr}
 }
 
+// ArrayUnique removes duplicated elements of array, first occurrence is kept,
+// unlike SetUnion, element order is preserved.
+func ArrayUnique(input interface{}) M {
+	return Reduce(input, A{}, Cond(
+		In("$$this", "$$value"),
+		"$$value",
+		ConcatArrays("$$value", A{"$$this"}),
+	))
+}
+
 // ConcatArrays concatenates arrays to return the concatenated array.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/concatArrays/
 func ConcatArrays(array ...interface{}) M {
 	return M{"$concatArrays": array}
 }
 
+// ConcatArraysLiteral is ConcatArrays that wraps go slice arguments with $literal,
+// so elements like "$name" or { $gt: ... } are kept as is
+// instead of being parsed as expression.
+func ConcatArraysLiteral(array ...interface{}) M {
+	var args = make(A, 0, len(array))
+	for _, i := range array {
+		if isSlice(i) {
+			i = Literal(i)
+		}
+		args = append(args, i)
+	}
+	return ConcatArrays(args...)
+}
+
+func isSlice(v interface{}) bool {
+	if _, ok := v.([]byte); ok {
+		return false
+	}
+	var k = reflect.ValueOf(v).Kind()
+	return k == reflect.Slice || k == reflect.Array
+}
+
 // FilterOperator returned from Filter
 type FilterOperator M
 
@@ -190,6 +255,15 @@ func (op SliceOperator) SetPos(v interface{}) SliceOperator {
 	return op
 }
 
+// SortArray sorts an array based on its elements.
+// sortBy is 1 or -1 to sort by element value,
+// or a sort specification (e.g. Asc("a").Desc("b")) to sort documents by fields.
+// New in version 5.2.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/sortArray/
+func SortArray(input, sortBy interface{}) M {
+	return M{"$sortArray": M{"input": input, "sortBy": sortBy}}
+}
+
 // ZipOperator returned from Zip
 type ZipOperator M
 
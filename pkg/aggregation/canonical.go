@@ -0,0 +1,19 @@
+package aggregation
+
+import (
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+)
+
+// CanonicalizePipeline converts every stage of pipeline to an ordered document
+// with stable key order, see query.Canonicalize.
+func CanonicalizePipeline(pipeline A) (A, error) {
+	var ret = make(A, len(pipeline))
+	for index, stage := range pipeline {
+		d, err := bsonutil.Doc(bsonutil.Ordered(stage, false))
+		if err != nil {
+			return nil, err
+		}
+		ret[index] = d
+	}
+	return ret, nil
+}
@@ -0,0 +1,29 @@
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalizePipeline(t *testing.T) {
+	p, err := CanonicalizePipeline(A{
+		Match(M{"b": 1, "a": 2}),
+		Sort(SortSpec{{Key: "n", Value: -1}, {Key: "_id", Value: 1}}),
+		GeoNear(A{0, 0}, "dist").SetSpherical(true),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, A{
+		D{{Key: "$match", Value: D{{Key: "a", Value: int32(2)}, {Key: "b", Value: int32(1)}}}},
+		D{{Key: "$sort", Value: D{{Key: "n", Value: int32(-1)}, {Key: "_id", Value: int32(1)}}}},
+		D{{Key: "$geoNear", Value: D{
+			{Key: "distanceField", Value: "dist"},
+			{Key: "near", Value: A{int32(0), int32(0)}},
+			{Key: "spherical", Value: true},
+		}}},
+	}, p)
+
+	_, err = CanonicalizePipeline(A{1})
+	assert.Error(t, err)
+}
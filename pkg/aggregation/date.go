@@ -2,6 +2,62 @@ package aggregation
 
 // https://docs.mongodb.com/manual/reference/operator/aggregation/#date-expression-operators
 
+// TimeUnit is unit of $dateAdd, $dateSubtract, $dateDiff and $dateTrunc,
+// it is an alias of SetWindowFieldsUnit.
+type TimeUnit = SetWindowFieldsUnit
+
+// Aliases of SWFU constants for date operators.
+const (
+	TUYear        = SWFUYear
+	TUQuarter     = SWFUQuarter
+	TUMonth       = SWFUMonth
+	TUWeek        = SWFUWeek
+	TUDay         = SWFUDay
+	TUHour        = SWFUHour
+	TUMinute      = SWFUMinute
+	TUSecond      = SWFUSecond
+	TUMillisecond = SWFUMillisecond
+)
+
+// DateAddOperator returned from DateAdd
+type DateAddOperator M
+
+// DateAdd increments a Date object by a specified number of time units.
+// New in version 5.0.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/dateAdd/
+func DateAdd(startDate interface{}, unit TimeUnit, amount interface{}) DateAddOperator {
+	return DateAddOperator{"$dateAdd": M{"startDate": startDate, "unit": unit, "amount": amount}}
+}
+
+// SetTimezone option
+func (op DateAddOperator) SetTimezone(v interface{}) DateAddOperator {
+	op["$dateAdd"].(M)["timezone"] = v
+	return op
+}
+
+// DateDiffOperator returned from DateDiff
+type DateDiffOperator M
+
+// DateDiff returns the difference between two dates,
+// counted by boundaries of unit crossed.
+// New in version 5.0.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/dateDiff/
+func DateDiff(startDate, endDate interface{}, unit TimeUnit) DateDiffOperator {
+	return DateDiffOperator{"$dateDiff": M{"startDate": startDate, "endDate": endDate, "unit": unit}}
+}
+
+// SetTimezone option
+func (op DateDiffOperator) SetTimezone(v interface{}) DateDiffOperator {
+	op["$dateDiff"].(M)["timezone"] = v
+	return op
+}
+
+// SetStartOfWeek option, used when unit is week, defaults to "sunday".
+func (op DateDiffOperator) SetStartOfWeek(v interface{}) DateDiffOperator {
+	op["$dateDiff"].(M)["startOfWeek"] = v
+	return op
+}
+
 // DateFromPartsCOperator returned from DateFromParts
 type DateFromPartsCOperator M
 
@@ -184,6 +240,51 @@ func (op DateToStringOperator) SetTimezone(v interface{}) DateToStringOperator {
 	return op
 }
 
+// DateSubtractOperator returned from DateSubtract
+type DateSubtractOperator M
+
+// DateSubtract decrements a Date object by a specified number of time units.
+// New in version 5.0.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/dateSubtract/
+func DateSubtract(startDate interface{}, unit TimeUnit, amount interface{}) DateSubtractOperator {
+	return DateSubtractOperator{"$dateSubtract": M{"startDate": startDate, "unit": unit, "amount": amount}}
+}
+
+// SetTimezone option
+func (op DateSubtractOperator) SetTimezone(v interface{}) DateSubtractOperator {
+	op["$dateSubtract"].(M)["timezone"] = v
+	return op
+}
+
+// DateTruncOperator returned from DateTruncNative
+type DateTruncOperator M
+
+// DateTruncNative truncates a date with native $dateTrunc operator,
+// use DateTrunc to support older servers.
+// New in version 5.0.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/dateTrunc/
+func DateTruncNative(date interface{}, unit TimeUnit) DateTruncOperator {
+	return DateTruncOperator{"$dateTrunc": M{"date": date, "unit": unit}}
+}
+
+// SetBinSize option
+func (op DateTruncOperator) SetBinSize(v interface{}) DateTruncOperator {
+	op["$dateTrunc"].(M)["binSize"] = v
+	return op
+}
+
+// SetTimezone option
+func (op DateTruncOperator) SetTimezone(v interface{}) DateTruncOperator {
+	op["$dateTrunc"].(M)["timezone"] = v
+	return op
+}
+
+// SetStartOfWeek option, used when unit is week, defaults to "sunday".
+func (op DateTruncOperator) SetStartOfWeek(v interface{}) DateTruncOperator {
+	op["$dateTrunc"].(M)["startOfWeek"] = v
+	return op
+}
+
 // DayOfMonthOperator returned from DayOfMonth
 type DayOfMonthOperator M
 
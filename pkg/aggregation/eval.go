@@ -0,0 +1,238 @@
+package aggregation
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// operatorFunc evaluates an expression operator,
+// arg is the unevaluated operator argument.
+type operatorFunc func(e *evaluator, arg interface{}) (interface{}, error)
+
+// expressionOperators registered by eval_*.go files.
+var expressionOperators = map[string]operatorFunc{}
+
+func registerOperators(m map[string]operatorFunc) {
+	for k, v := range m {
+		expressionOperators[k] = v
+	}
+}
+
+type missing = bsonutil.Missing
+
+// evaluator evaluates aggregation expressions in a variable scope.
+type evaluator struct {
+	vars map[string]interface{}
+}
+
+func newEvaluator(root primitive.D, now time.Time) *evaluator {
+	return &evaluator{vars: map[string]interface{}{
+		"ROOT":         root,
+		"CURRENT":      root,
+		"NOW":          primitive.NewDateTimeFromTime(now),
+		"CLUSTER_TIME": primitive.Timestamp{T: uint32(now.Unix())},
+		"REMOVE":       missing{},
+		"DESCEND":      "descend",
+		"PRUNE":        "prune",
+		"KEEP":         "keep",
+	}}
+}
+
+// with returns a child scope with additional variables.
+func (e *evaluator) with(vars map[string]interface{}) *evaluator {
+	var m = make(map[string]interface{}, len(e.vars)+len(vars))
+	for k, v := range e.vars {
+		m[k] = v
+	}
+	for k, v := range vars {
+		m[k] = v
+	}
+	return &evaluator{vars: m}
+}
+
+// withRoot returns a scope that use doc as $$ROOT and $$CURRENT.
+func (e *evaluator) withRoot(doc primitive.D) *evaluator {
+	return e.with(map[string]interface{}{"ROOT": doc, "CURRENT": doc})
+}
+
+func (e *evaluator) current() interface{} {
+	return e.vars["CURRENT"]
+}
+
+// eval evaluates expr, result may be missing.
+func (e *evaluator) eval(expr interface{}) (interface{}, error) {
+	switch expr := expr.(type) {
+	case string:
+		if strings.HasPrefix(expr, "$$") {
+			var parts = strings.Split(expr[2:], ".")
+			v, ok := e.vars[parts[0]]
+			if !ok {
+				return nil, fmt.Errorf("use of undefined variable: %s", parts[0])
+			}
+			return getPath(v, parts[1:]), nil
+		}
+		if strings.HasPrefix(expr, "$") {
+			return getPath(e.current(), strings.Split(expr[1:], ".")), nil
+		}
+		return expr, nil
+	case primitive.D:
+		if len(expr) > 0 && strings.HasPrefix(expr[0].Key, "$") {
+			if len(expr) != 1 {
+				return nil, fmt.Errorf("an object representing an expression must have exactly one field: %v", expr)
+			}
+			fn, ok := expressionOperators[expr[0].Key]
+			if !ok {
+				return nil, fmt.Errorf("unrecognized expression '%s'", expr[0].Key)
+			}
+			v, err := fn(e, expr[0].Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", expr[0].Key, err)
+			}
+			return v, nil
+		}
+		var ret = make(primitive.D, 0, len(expr))
+		for _, i := range expr {
+			v, err := e.eval(i.Value)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := v.(missing); ok {
+				continue
+			}
+			ret = append(ret, primitive.E{Key: i.Key, Value: v})
+		}
+		return ret, nil
+	case primitive.A:
+		var ret = make(primitive.A, 0, len(expr))
+		for _, i := range expr {
+			v, err := e.eval(i)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, nullIfMissing(v))
+		}
+		return ret, nil
+	}
+	return expr, nil
+}
+
+// evalArgs evaluates operator arguments,
+// a non array argument is treated as single argument.
+func (e *evaluator) evalArgs(arg interface{}) ([]interface{}, error) {
+	var a, ok = arg.(primitive.A)
+	if !ok {
+		a = primitive.A{arg}
+	}
+	var ret = make([]interface{}, 0, len(a))
+	for _, i := range a {
+		v, err := e.eval(i)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+// evalArgsN evaluates operator arguments and check argument count.
+func (e *evaluator) evalArgsN(arg interface{}, min, max int) ([]interface{}, error) {
+	args, err := e.evalArgs(arg)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		if min == max {
+			return nil, fmt.Errorf("expression takes exactly %d arguments, %d were passed in", min, len(args))
+		}
+		return nil, fmt.Errorf("expression takes %d to %d arguments, %d were passed in", min, max, len(args))
+	}
+	return args, nil
+}
+
+// namedArgs returns operator argument as document.
+func namedArgs(arg interface{}, allowed ...string) (primitive.D, error) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		return nil, fmt.Errorf("expects an object as argument, found %s", typeName(arg))
+	}
+	for _, i := range d {
+		var found bool
+		for _, j := range allowed {
+			if i.Key == j {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unrecognized parameter: %s", i.Key)
+		}
+	}
+	return d, nil
+}
+
+// evalNamed evaluates a named argument, returns missing if not given.
+func (e *evaluator) evalNamed(d primitive.D, key string) (interface{}, error) {
+	v, ok := bsonutil.Get(d, key)
+	if !ok {
+		return missing{}, nil
+	}
+	return e.eval(v)
+}
+
+// getPath resolves field path, arrays of documents are mapped.
+func getPath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return v
+	}
+	switch v := v.(type) {
+	case primitive.D:
+		if i, ok := bsonutil.Get(v, path[0]); ok {
+			return getPath(i, path[1:])
+		}
+	case primitive.A:
+		var ret = make(primitive.A, 0, len(v))
+		for _, i := range v {
+			switch i.(type) {
+			case primitive.D, primitive.A:
+				var r = getPath(i, path)
+				if _, ok := r.(missing); !ok {
+					ret = append(ret, r)
+				}
+			}
+		}
+		return ret
+	}
+	return missing{}
+}
+
+func nullIfMissing(v interface{}) interface{} {
+	if _, ok := v.(missing); ok {
+		return nil
+	}
+	return v
+}
+
+func isNullish(v interface{}) bool {
+	return bsonutil.IsNullish(v)
+}
+
+func anyNullish(args []interface{}) bool {
+	for _, i := range args {
+		if isNullish(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName returns $type result of v.
+func typeName(v interface{}) string {
+	if _, ok := v.(missing); ok {
+		return "missing"
+	}
+	return bsonutil.TypeAlias(bsonutil.Type(v))
+}
@@ -0,0 +1,650 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// accumulator aggregates values of a group.
+type accumulator interface {
+	add(v interface{}) error
+	result() interface{}
+}
+
+type accumulatorFactory func() accumulator
+
+var accumulators = map[string]accumulatorFactory{
+	"$addToSet":     func() accumulator { return &addToSetAccumulator{set: newValueSet()} },
+	"$avg":          func() accumulator { return &avgAccumulator{sum: int32(0)} },
+	"$first":        func() accumulator { return &firstAccumulator{} },
+	"$firstN":       func() accumulator { return &nAccumulator{} },
+	"$last":         func() accumulator { return &lastAccumulator{} },
+	"$lastN":        func() accumulator { return &nAccumulator{last: true} },
+	"$max":          func() accumulator { return &extremeAccumulator{sign: 1} },
+	"$maxN":         func() accumulator { return &nAccumulator{sign: 1} },
+	"$median":       func() accumulator { return &percentileAccumulator{median: true} },
+	"$mergeObjects": func() accumulator { return &mergeObjectsAccumulator{} },
+	"$min":          func() accumulator { return &extremeAccumulator{sign: -1} },
+	"$minN":         func() accumulator { return &nAccumulator{sign: -1} },
+	"$percentile":   func() accumulator { return &percentileAccumulator{} },
+	"$push":         func() accumulator { return &pushAccumulator{values: primitive.A{}} },
+	"$stdDevPop":    func() accumulator { return &stdDevAccumulator{} },
+	"$stdDevSamp":   func() accumulator { return &stdDevAccumulator{sample: true} },
+	"$sum":          func() accumulator { return &sumAccumulator{sum: int32(0)} },
+}
+
+func init() {
+	// accumulators that are also available as expression,
+	// takes a single array argument or multiple arguments.
+	for _, k := range []string{"$avg", "$max", "$min", "$stdDevPop", "$stdDevSamp", "$sum"} {
+		var factory = accumulators[k]
+		registerOperators(map[string]operatorFunc{
+			k: func(e *evaluator, arg interface{}) (interface{}, error) {
+				args, err := e.evalArgs(arg)
+				if err != nil {
+					return nil, err
+				}
+				if len(args) == 1 {
+					if a, ok := args[0].(primitive.A); ok {
+						args = a
+					}
+				}
+				var acc = factory()
+				for _, i := range args {
+					if err := acc.add(i); err != nil {
+						return nil, err
+					}
+				}
+				return acc.result(), nil
+			},
+		})
+	}
+	// percentile accumulators that are also available as expression,
+	// takes a single numeric or array input.
+	for _, k := range []string{"$median", "$percentile"} {
+		var factory = accumulators[k]
+		registerOperators(map[string]operatorFunc{
+			k: func(e *evaluator, arg interface{}) (interface{}, error) {
+				v, err := e.eval(arg)
+				if err != nil {
+					return nil, err
+				}
+				var d, _ = v.(primitive.D)
+				var input, _ = bsonutil.Get(d, "input")
+				var acc = factory()
+				var items, ok = input.(primitive.A)
+				if !ok {
+					items = primitive.A{input}
+				}
+				for _, i := range items {
+					if err := acc.add(setDocField(d, "input", i)); err != nil {
+						return nil, err
+					}
+				}
+				if len(items) == 0 {
+					if err := acc.add(setDocField(d, "input", nil)); err != nil {
+						return nil, err
+					}
+				}
+				return acc.result(), nil
+			},
+		})
+	}
+	// n accumulators that are also available as array expression.
+	for _, k := range []string{"$firstN", "$lastN", "$maxN", "$minN"} {
+		var factory = accumulators[k]
+		registerOperators(map[string]operatorFunc{
+			k: func(e *evaluator, arg interface{}) (interface{}, error) {
+				d, err := namedArgs(arg, "input", "n")
+				if err != nil {
+					return nil, err
+				}
+				n, err := e.evalNamed(d, "n")
+				if err != nil {
+					return nil, err
+				}
+				if _, err := requireN(n); err != nil {
+					return nil, err
+				}
+				input, err := e.evalNamed(d, "input")
+				if err != nil {
+					return nil, err
+				}
+				if isNullish(input) {
+					return nil, nil
+				}
+				a, err := requireArray(input)
+				if err != nil {
+					return nil, err
+				}
+				var acc = factory()
+				for _, i := range a {
+					if err := acc.add(primitive.D{{Key: "input", Value: i}, {Key: "n", Value: n}}); err != nil {
+						return nil, err
+					}
+				}
+				return acc.result(), nil
+			},
+		})
+	}
+}
+
+// groupAccumulator is a compiled accumulator field of $group like stages.
+type groupAccumulator struct {
+	field   string
+	factory accumulatorFactory
+	expr    interface{}
+}
+
+func compileAccumulators(spec primitive.D) ([]groupAccumulator, error) {
+	var ret = make([]groupAccumulator, 0, len(spec))
+	for _, i := range spec {
+		d, ok := i.Value.(primitive.D)
+		if !ok || len(d) != 1 {
+			return nil, fmt.Errorf("the field '%s' must be an accumulator object", i.Key)
+		}
+		var acc = groupAccumulator{field: i.Key, expr: d[0].Value}
+		switch d[0].Key {
+		case "$count":
+			if arg, ok := d[0].Value.(primitive.D); !ok || len(arg) != 0 {
+				return nil, fmt.Errorf("'%s': $count takes no arguments", i.Key)
+			}
+			acc.factory, acc.expr = accumulators["$sum"], int32(1)
+		case "$percentile":
+			if err := requireNamedArgs(d[0].Value, []string{"input", "p", "method"}); err != nil {
+				return nil, fmt.Errorf("'%s': %s: %w", i.Key, d[0].Key, err)
+			}
+			acc.factory = accumulators[d[0].Key]
+		case "$median":
+			if err := requireNamedArgs(d[0].Value, []string{"input", "method"}); err != nil {
+				return nil, fmt.Errorf("'%s': %s: %w", i.Key, d[0].Key, err)
+			}
+			acc.factory = accumulators[d[0].Key]
+		case "$firstN", "$lastN", "$maxN", "$minN":
+			if err := requireNamedArgs(d[0].Value, []string{"input", "n"}); err != nil {
+				return nil, fmt.Errorf("'%s': %s: %w", i.Key, d[0].Key, err)
+			}
+			var n, _ = bsonutil.Get(d[0].Value.(primitive.D), "n")
+			if err := checkGroupN(n); err != nil {
+				return nil, fmt.Errorf("'%s': %s: %w", i.Key, d[0].Key, err)
+			}
+			acc.factory = accumulators[d[0].Key]
+		case "$top", "$bottom", "$topN", "$bottomN":
+			var err error
+			acc.factory, acc.expr, err = compileSortedAccumulator(d[0].Key, d[0].Value)
+			if err != nil {
+				return nil, fmt.Errorf("'%s': %s: %w", i.Key, d[0].Key, err)
+			}
+		default:
+			acc.factory, ok = accumulators[d[0].Key]
+			if !ok {
+				return nil, fmt.Errorf("unknown group operator '%s'", d[0].Key)
+			}
+		}
+		ret = append(ret, acc)
+	}
+	return ret, nil
+}
+
+type sumAccumulator struct {
+	sum interface{}
+}
+
+func (a *sumAccumulator) add(v interface{}) error {
+	if bsonutil.IsNumber(v) {
+		a.sum = addNumber(a.sum, v)
+	}
+	return nil
+}
+
+func (a *sumAccumulator) result() interface{} {
+	return a.sum
+}
+
+type avgAccumulator struct {
+	sum   interface{}
+	count int64
+}
+
+func (a *avgAccumulator) add(v interface{}) error {
+	if bsonutil.IsNumber(v) {
+		a.sum = addNumber(a.sum, v)
+		a.count++
+	}
+	return nil
+}
+
+func (a *avgAccumulator) result() interface{} {
+	if a.count == 0 {
+		return nil
+	}
+	if numberKind(a.sum) == kindDecimal {
+		var x = bigFloat(a.sum)
+		if x == nil {
+			return a.sum
+		}
+		return bsonutil.Decimal(new(big.Float).Quo(x, new(big.Float).SetInt64(a.count)))
+	}
+	var f, _ = bsonutil.Float64(a.sum)
+	return f / float64(a.count)
+}
+
+type firstAccumulator struct {
+	value interface{}
+	done  bool
+}
+
+func (a *firstAccumulator) add(v interface{}) error {
+	if !a.done {
+		a.value, a.done = nullIfMissing(v), true
+	}
+	return nil
+}
+
+func (a *firstAccumulator) result() interface{} {
+	return a.value
+}
+
+type lastAccumulator struct {
+	value interface{}
+}
+
+func (a *lastAccumulator) add(v interface{}) error {
+	a.value = nullIfMissing(v)
+	return nil
+}
+
+func (a *lastAccumulator) result() interface{} {
+	return a.value
+}
+
+// extremeAccumulator implements $max with sign 1 and $min with sign -1.
+type extremeAccumulator struct {
+	sign  int
+	value interface{}
+	found bool
+}
+
+func (a *extremeAccumulator) add(v interface{}) error {
+	if isNullish(v) {
+		return nil
+	}
+	if !a.found || bsonutil.Compare(v, a.value)*a.sign > 0 {
+		a.value, a.found = v, true
+	}
+	return nil
+}
+
+func (a *extremeAccumulator) result() interface{} {
+	return a.value
+}
+
+type pushAccumulator struct {
+	values primitive.A
+}
+
+func (a *pushAccumulator) add(v interface{}) error {
+	if _, ok := v.(missing); !ok {
+		a.values = append(a.values, v)
+	}
+	return nil
+}
+
+func (a *pushAccumulator) result() interface{} {
+	return a.values
+}
+
+type addToSetAccumulator struct {
+	set *valueSet
+}
+
+func (a *addToSetAccumulator) add(v interface{}) error {
+	if _, ok := v.(missing); !ok {
+		a.set.add(v)
+	}
+	return nil
+}
+
+func (a *addToSetAccumulator) result() interface{} {
+	return a.set.items
+}
+
+type mergeObjectsAccumulator struct {
+	values []interface{}
+}
+
+func (a *mergeObjectsAccumulator) add(v interface{}) error {
+	if isNullish(v) {
+		return nil
+	}
+	if _, ok := v.(primitive.D); !ok {
+		return errors.New("$mergeObjects requires object inputs")
+	}
+	a.values = append(a.values, v)
+	return nil
+}
+
+func (a *mergeObjectsAccumulator) result() interface{} {
+	var ret, _ = mergeObjects(a.values)
+	return ret
+}
+
+// stdDevAccumulator uses Welford's online algorithm.
+type stdDevAccumulator struct {
+	sample bool
+	count  float64
+	mean   float64
+	m2     float64
+}
+
+func (a *stdDevAccumulator) add(v interface{}) error {
+	if !bsonutil.IsNumber(v) {
+		return nil
+	}
+	var f, _ = bsonutil.Float64(v)
+	a.count++
+	var delta = f - a.mean
+	a.mean += delta / a.count
+	a.m2 += delta * (f - a.mean)
+	return nil
+}
+
+func (a *stdDevAccumulator) result() interface{} {
+	var n = a.count
+	if a.sample {
+		n--
+	}
+	if n <= 0 {
+		return nil
+	}
+	return math.Sqrt(a.m2 / n)
+}
+
+// requireNamedArgs checks arg is a document with exactly given keys.
+func requireNamedArgs(arg interface{}, keys []string) error {
+	d, err := namedArgs(arg, keys...)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if _, ok := bsonutil.Get(d, k); !ok {
+			return fmt.Errorf("missing '%s' parameter", k)
+		}
+	}
+	return nil
+}
+
+// checkGroupN checks n of accumulator in $group,
+// a constant must be a positive integer,
+// and a field path can only reference the group key.
+func checkGroupN(n interface{}) error {
+	switch n := n.(type) {
+	case string:
+		if strings.HasPrefix(n, "$") {
+			if n != "$_id" && !strings.HasPrefix(n, "$_id.") && !strings.HasPrefix(n, "$$") {
+				return errors.New("'n' can only reference the group key")
+			}
+			return nil
+		}
+	case primitive.D:
+		if len(n) > 0 && strings.HasPrefix(n[0].Key, "$") {
+			return nil
+		}
+	}
+	_, err := requireN(n)
+	return err
+}
+
+func requireN(v interface{}) (int64, error) {
+	n, err := requireInt(v)
+	if err != nil || n <= 0 {
+		return 0, errors.New("value for 'n' must be a positive integer")
+	}
+	return n, nil
+}
+
+// nAccumulator implements $firstN, $lastN, $maxN with sign 1 and $minN with sign -1,
+// added values are documents with input and n.
+type nAccumulator struct {
+	last   bool
+	sign   int
+	n      int64
+	values primitive.A
+}
+
+func (a *nAccumulator) add(v interface{}) error {
+	var d, _ = v.(primitive.D)
+	var n, _ = bsonutil.Get(d, "n")
+	var input, _ = bsonutil.Get(d, "input")
+	if a.n == 0 {
+		var err error
+		a.n, err = requireN(n)
+		if err != nil {
+			return err
+		}
+	}
+	switch {
+	case a.sign != 0:
+		if isNullish(input) {
+			return nil
+		}
+		var index = sort.Search(len(a.values), func(i int) bool {
+			return bsonutil.Compare(input, a.values[i])*a.sign > 0
+		})
+		if int64(index) >= a.n {
+			return nil
+		}
+		a.values = append(a.values, nil)
+		copy(a.values[index+1:], a.values[index:])
+		a.values[index] = input
+		if int64(len(a.values)) > a.n {
+			a.values = a.values[:a.n]
+		}
+	case a.last:
+		a.values = append(a.values, nullIfMissing(input))
+		if int64(len(a.values)) > a.n {
+			a.values = a.values[1:]
+		}
+	default:
+		if int64(len(a.values)) < a.n {
+			a.values = append(a.values, nullIfMissing(input))
+		}
+	}
+	return nil
+}
+
+func (a *nAccumulator) result() interface{} {
+	if a.values == nil {
+		return primitive.A{}
+	}
+	return a.values
+}
+
+// compileSortedAccumulator compiles $top, $bottom, $topN and $bottomN,
+// returned expression evaluates to a document of output, n and $$ROOT.
+func compileSortedAccumulator(name string, arg interface{}) (accumulatorFactory, interface{}, error) {
+	var keys = []string{"sortBy", "output"}
+	var single = name == "$top" || name == "$bottom"
+	if !single {
+		keys = append(keys, "n")
+	}
+	if err := requireNamedArgs(arg, keys); err != nil {
+		return nil, nil, err
+	}
+	var d = arg.(primitive.D)
+	var sortBy, _ = bsonutil.Get(d, "sortBy")
+	var output, _ = bsonutil.Get(d, "output")
+	var n interface{} = int32(1)
+	if !single {
+		n, _ = bsonutil.Get(d, "n")
+		if err := checkGroupN(n); err != nil {
+			return nil, nil, err
+		}
+	}
+	sortByDoc, ok := sortBy.(primitive.D)
+	if !ok {
+		return nil, nil, errors.New("'sortBy' must be an object")
+	}
+	fields, err := compileSortFields(sortByDoc)
+	if err != nil {
+		return nil, nil, err
+	}
+	var bottom = name == "$bottom" || name == "$bottomN"
+	var factory = func() accumulator {
+		return &sortedAccumulator{fields: fields, bottom: bottom, single: single}
+	}
+	var expr = primitive.D{
+		{Key: "output", Value: output},
+		{Key: "n", Value: n},
+		{Key: "root", Value: "$$ROOT"},
+	}
+	return factory, expr, nil
+}
+
+type sortedItem struct {
+	keys   []sortKey
+	output interface{}
+}
+
+// sortedAccumulator implements $top, $bottom, $topN and $bottomN,
+// items are kept in sort order.
+type sortedAccumulator struct {
+	fields []sortField
+	bottom bool
+	single bool
+	n      int64
+	items  []sortedItem
+}
+
+func (a *sortedAccumulator) less(i, j sortedItem) bool {
+	for index, f := range a.fields {
+		if c := compareSortKey(i.keys[index], j.keys[index]); c != 0 {
+			return c*f.direction < 0
+		}
+	}
+	return false
+}
+
+func (a *sortedAccumulator) add(v interface{}) error {
+	var d, _ = v.(primitive.D)
+	var n, _ = bsonutil.Get(d, "n")
+	var output, _ = bsonutil.Get(d, "output")
+	var root, _ = bsonutil.Get(d, "root")
+	if a.n == 0 {
+		var err error
+		a.n, err = requireN(n)
+		if err != nil {
+			return err
+		}
+	}
+	var doc, _ = root.(primitive.D)
+	var item = sortedItem{keys: make([]sortKey, len(a.fields)), output: nullIfMissing(output)}
+	for index, f := range a.fields {
+		item.keys[index] = newSortKey(doc, f.path, f.direction)
+	}
+	var index = sort.Search(len(a.items), func(i int) bool {
+		return a.less(item, a.items[i])
+	})
+	a.items = append(a.items, sortedItem{})
+	copy(a.items[index+1:], a.items[index:])
+	a.items[index] = item
+	if int64(len(a.items)) > a.n {
+		if a.bottom {
+			a.items = a.items[1:]
+		} else {
+			a.items = a.items[:a.n]
+		}
+	}
+	return nil
+}
+
+func (a *sortedAccumulator) result() interface{} {
+	if a.single {
+		if len(a.items) == 0 {
+			return nil
+		}
+		return a.items[0].output
+	}
+	var ret = make(primitive.A, 0, len(a.items))
+	for _, i := range a.items {
+		ret = append(ret, i.output)
+	}
+	return ret
+}
+
+// percentileAccumulator implements $percentile and $median,
+// added values are documents with input, p and method.
+// Result is computed exactly, which is what approximate method
+// returns for small data set.
+type percentileAccumulator struct {
+	median bool
+	p      []float64
+	values []float64
+}
+
+func (a *percentileAccumulator) init(d primitive.D) error {
+	if method, _ := bsonutil.Get(d, "method"); method != string(PercentileApproximate) {
+		return fmt.Errorf("currently only 'approximate' can be used as percentile 'method', found %v", method)
+	}
+	if a.median {
+		a.p = []float64{0.5}
+		return nil
+	}
+	var p, _ = bsonutil.Get(d, "p")
+	var items, ok = p.(primitive.A)
+	if !ok || len(items) == 0 {
+		return errors.New("'p' must be a non-empty array of numbers")
+	}
+	a.p = make([]float64, 0, len(items))
+	for _, i := range items {
+		f, ok := bsonutil.Float64(i)
+		if !ok || !bsonutil.IsNumber(i) || f < 0 || f > 1 {
+			return fmt.Errorf("'p' must be an array of numbers from [0.0, 1.0], found %v", i)
+		}
+		a.p = append(a.p, f)
+	}
+	return nil
+}
+
+func (a *percentileAccumulator) add(v interface{}) error {
+	var d, _ = v.(primitive.D)
+	if a.p == nil {
+		if err := a.init(d); err != nil {
+			return err
+		}
+	}
+	var input, _ = bsonutil.Get(d, "input")
+	if bsonutil.IsNumber(input) {
+		var f, _ = bsonutil.Float64(input)
+		a.values = append(a.values, f)
+	}
+	return nil
+}
+
+func (a *percentileAccumulator) result() interface{} {
+	var ret = make(primitive.A, 0, len(a.p))
+	var values = append([]float64(nil), a.values...)
+	sort.Float64s(values)
+	for _, p := range a.p {
+		if len(values) == 0 {
+			ret = append(ret, nil)
+			continue
+		}
+		var rank = int(math.Ceil(p*float64(len(values)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		ret = append(ret, values[rank])
+	}
+	if a.median {
+		return ret[0]
+	}
+	return ret
+}
@@ -0,0 +1,480 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	registerOperators(map[string]operatorFunc{
+		"$abs":      evalAbs,
+		"$add":      evalAdd,
+		"$ceil":     unaryFloat(math.Ceil, true),
+		"$divide":   evalDivide,
+		"$exp":      unaryFloat(math.Exp, false),
+		"$floor":    unaryFloat(math.Floor, true),
+		"$ln":       unaryFloat(math.Log, false),
+		"$log":      evalLog,
+		"$log10":    unaryFloat(math.Log10, false),
+		"$mod":      evalMod,
+		"$multiply": evalMultiply,
+		"$pow":      evalPow,
+		"$round":    roundFunc(math.RoundToEven),
+		"$sqrt":     unaryFloat(math.Sqrt, false),
+		"$subtract": evalSubtract,
+		"$trunc":    roundFunc(math.Trunc),
+
+		"$sin":   unaryFloat(math.Sin, false),
+		"$cos":   unaryFloat(math.Cos, false),
+		"$tan":   unaryFloat(math.Tan, false),
+		"$asin":  unaryFloat(math.Asin, false),
+		"$acos":  unaryFloat(math.Acos, false),
+		"$atan":  unaryFloat(math.Atan, false),
+		"$atan2": evalATan2,
+		"$asinh": unaryFloat(math.Asinh, false),
+		"$acosh": unaryFloat(math.Acosh, false),
+		"$atanh": unaryFloat(math.Atanh, false),
+		"$degreesToRadians": unaryFloat(func(v float64) float64 {
+			return v * math.Pi / 180
+		}, false),
+		"$radiansToDegrees": unaryFloat(func(v float64) float64 {
+			return v * 180 / math.Pi
+		}, false),
+	})
+}
+
+// numeric kinds in widening order.
+const (
+	kindInt32 = iota
+	kindInt64
+	kindDouble
+	kindDecimal
+)
+
+func numberKind(v interface{}) int {
+	switch v.(type) {
+	case int32:
+		return kindInt32
+	case int64:
+		return kindInt64
+	case float64:
+		return kindDouble
+	}
+	return kindDecimal
+}
+
+func requireNumber(v interface{}) error {
+	if !bsonutil.IsNumber(v) {
+		return fmt.Errorf("only supports numeric types, not %s", typeName(v))
+	}
+	return nil
+}
+
+// fromInt64 returns int32 when v fits and kind is int32.
+func fromInt64(v int64, kind int) interface{} {
+	if kind == kindInt32 && v >= math.MinInt32 && v <= math.MaxInt32 {
+		return int32(v)
+	}
+	return v
+}
+
+func decimalFromFloat(f float64) primitive.Decimal128 {
+	if math.IsNaN(f) {
+		d, _ := primitive.ParseDecimal128("NaN")
+		return d
+	}
+	return bsonutil.Decimal(big.NewFloat(f))
+}
+
+func bigFloat(v interface{}) *big.Float {
+	f, ok := bsonutil.BigFloat(v)
+	if !ok {
+		return nil
+	}
+	return f
+}
+
+// arithmetic applies a binary numeric operation preserving mongodb result type.
+func arithmetic(
+	a, b interface{},
+	intOp func(a, b int64) (int64, bool),
+	floatOp func(a, b float64) float64,
+	bigOp func(a, b *big.Float) *big.Float,
+) interface{} {
+	var kind = numberKind(a)
+	if k := numberKind(b); k > kind {
+		kind = k
+	}
+	switch kind {
+	case kindInt32, kindInt64:
+		var x, _ = bsonutil.Int64(a)
+		var y, _ = bsonutil.Int64(b)
+		if r, ok := intOp(x, y); ok {
+			return fromInt64(r, kind)
+		}
+		return floatOp(float64(x), float64(y))
+	case kindDouble:
+		var x, _ = bsonutil.Float64(a)
+		var y, _ = bsonutil.Float64(b)
+		return floatOp(x, y)
+	}
+	var x, y = bigFloat(a), bigFloat(b)
+	if x == nil || y == nil {
+		return decimalFromFloat(math.NaN())
+	}
+	return bsonutil.Decimal(bigOp(x, y))
+}
+
+func addNumber(a, b interface{}) interface{} {
+	return arithmetic(a, b,
+		func(x, y int64) (int64, bool) {
+			var r = x + y
+			return r, (r > x) == (y > 0)
+		},
+		func(x, y float64) float64 { return x + y },
+		func(x, y *big.Float) *big.Float { return new(big.Float).Add(x, y) },
+	)
+}
+
+func subtractNumber(a, b interface{}) interface{} {
+	return arithmetic(a, b,
+		func(x, y int64) (int64, bool) {
+			var r = x - y
+			return r, (r < x) == (y > 0)
+		},
+		func(x, y float64) float64 { return x - y },
+		func(x, y *big.Float) *big.Float { return new(big.Float).Sub(x, y) },
+	)
+}
+
+func multiplyNumber(a, b interface{}) interface{} {
+	return arithmetic(a, b,
+		func(x, y int64) (int64, bool) {
+			if x == 0 || y == 0 {
+				return 0, true
+			}
+			var r = x * y
+			return r, r/y == x && !(x == -1 && y == math.MinInt64) && !(y == -1 && x == math.MinInt64)
+		},
+		func(x, y float64) float64 { return x * y },
+		func(x, y *big.Float) *big.Float { return new(big.Float).Mul(x, y) },
+	)
+}
+
+func evalAdd(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgs(arg)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{} = int32(0)
+	var date *primitive.DateTime
+	for _, i := range args {
+		if isNullish(i) {
+			return nil, nil
+		}
+		if d, ok := i.(primitive.DateTime); ok {
+			if date != nil {
+				return nil, errors.New("only one date allowed")
+			}
+			date = &d
+			continue
+		}
+		if err := requireNumber(i); err != nil {
+			return nil, err
+		}
+		ret = addNumber(ret, i)
+	}
+	if date != nil {
+		f, _ := bsonutil.Float64(ret)
+		return primitive.DateTime(int64(*date) + int64(math.Round(f))), nil
+	}
+	return ret, nil
+}
+
+func evalSubtract(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if anyNullish(args) {
+		return nil, nil
+	}
+	var a, b = args[0], args[1]
+	if da, ok := a.(primitive.DateTime); ok {
+		if db, ok := b.(primitive.DateTime); ok {
+			return int64(da) - int64(db), nil
+		}
+		if err := requireNumber(b); err != nil {
+			return nil, err
+		}
+		f, _ := bsonutil.Float64(b)
+		return primitive.DateTime(int64(da) - int64(math.Round(f))), nil
+	}
+	if err := requireNumber(a); err != nil {
+		return nil, err
+	}
+	if err := requireNumber(b); err != nil {
+		return nil, err
+	}
+	return subtractNumber(a, b), nil
+}
+
+func evalMultiply(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgs(arg)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{} = int32(1)
+	for _, i := range args {
+		if isNullish(i) {
+			return nil, nil
+		}
+		if err := requireNumber(i); err != nil {
+			return nil, err
+		}
+		ret = multiplyNumber(ret, i)
+	}
+	return ret, nil
+}
+
+func evalDivide(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if anyNullish(args) {
+		return nil, nil
+	}
+	for _, i := range args {
+		if err := requireNumber(i); err != nil {
+			return nil, err
+		}
+	}
+	if f, _ := bsonutil.Float64(args[1]); f == 0 {
+		return nil, errors.New("can't divide by zero")
+	}
+	if numberKind(args[0]) == kindDecimal || numberKind(args[1]) == kindDecimal {
+		var x, y = bigFloat(args[0]), bigFloat(args[1])
+		if x == nil || y == nil {
+			return decimalFromFloat(math.NaN()), nil
+		}
+		return bsonutil.Decimal(new(big.Float).Quo(x, y)), nil
+	}
+	var x, _ = bsonutil.Float64(args[0])
+	var y, _ = bsonutil.Float64(args[1])
+	return x / y, nil
+}
+
+func evalMod(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if anyNullish(args) {
+		return nil, nil
+	}
+	for _, i := range args {
+		if err := requireNumber(i); err != nil {
+			return nil, err
+		}
+	}
+	var kind = numberKind(args[0])
+	if k := numberKind(args[1]); k > kind {
+		kind = k
+	}
+	if kind <= kindInt64 {
+		var x, _ = bsonutil.Int64(args[0])
+		var y, _ = bsonutil.Int64(args[1])
+		if y == 0 {
+			return nil, errors.New("can't mod by zero")
+		}
+		return fromInt64(x%y, kind), nil
+	}
+	var x, _ = bsonutil.Float64(args[0])
+	var y, _ = bsonutil.Float64(args[1])
+	if y == 0 {
+		return nil, errors.New("can't mod by zero")
+	}
+	return math.Mod(x, y), nil
+}
+
+func evalAbs(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	var v = args[0]
+	if isNullish(v) {
+		return nil, nil
+	}
+	switch v := v.(type) {
+	case int32:
+		if v == math.MinInt32 {
+			return -int64(v), nil
+		}
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case int64:
+		if v == math.MinInt64 {
+			return nil, errors.New("can't take $abs of long long min")
+		}
+		if v < 0 {
+			return -v, nil
+		}
+		return v, nil
+	case float64:
+		return math.Abs(v), nil
+	case primitive.Decimal128:
+		var f = bigFloat(v)
+		if f == nil {
+			return v, nil
+		}
+		return bsonutil.Decimal(new(big.Float).Abs(f)), nil
+	}
+	return nil, requireNumber(v)
+}
+
+// unaryFloat evaluates a single argument math function.
+// integer input is kept as is when keepInt.
+func unaryFloat(fn func(float64) float64, keepInt bool) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		args, err := e.evalArgsN(arg, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		var v = args[0]
+		if isNullish(v) {
+			return nil, nil
+		}
+		if err := requireNumber(v); err != nil {
+			return nil, err
+		}
+		if keepInt && numberKind(v) <= kindInt64 {
+			return v, nil
+		}
+		var f, _ = bsonutil.Float64(v)
+		var r = fn(f)
+		if numberKind(v) == kindDecimal {
+			return decimalFromFloat(r), nil
+		}
+		return r, nil
+	}
+}
+
+func evalLog(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if anyNullish(args) {
+		return nil, nil
+	}
+	for _, i := range args {
+		if err := requireNumber(i); err != nil {
+			return nil, err
+		}
+	}
+	var x, _ = bsonutil.Float64(args[0])
+	var base, _ = bsonutil.Float64(args[1])
+	if x <= 0 || base <= 0 || base == 1 {
+		return nil, errors.New("number and base must be positive, and base must not be 1")
+	}
+	return math.Log(x) / math.Log(base), nil
+}
+
+func evalPow(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if anyNullish(args) {
+		return nil, nil
+	}
+	for _, i := range args {
+		if err := requireNumber(i); err != nil {
+			return nil, err
+		}
+	}
+	var kind = numberKind(args[0])
+	if k := numberKind(args[1]); k > kind {
+		kind = k
+	}
+	var x, _ = bsonutil.Float64(args[0])
+	var y, _ = bsonutil.Float64(args[1])
+	if x == 0 && y < 0 {
+		return nil, errors.New("exponent cannot be negative when base is 0")
+	}
+	var r = math.Pow(x, y)
+	if kind <= kindInt64 && y >= 0 && r >= math.MinInt64 && r <= math.MaxInt64 {
+		return fromInt64(int64(r), kind), nil
+	}
+	if kind == kindDecimal {
+		return decimalFromFloat(r), nil
+	}
+	return r, nil
+}
+
+// roundFunc evaluates $round and $trunc.
+func roundFunc(fn func(float64) float64) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		args, err := e.evalArgsN(arg, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		if anyNullish(args) {
+			return nil, nil
+		}
+		var place int64
+		if len(args) == 2 {
+			p, ok := bsonutil.Int64(args[1])
+			if !ok || p < -20 || p >= 100 {
+				return nil, errors.New("place must be an integer in range [-20, 100)")
+			}
+			place = p
+		}
+		var v = args[0]
+		if err := requireNumber(v); err != nil {
+			return nil, err
+		}
+		if numberKind(v) <= kindInt64 {
+			if place >= 0 {
+				return v, nil
+			}
+			var n, _ = bsonutil.Int64(v)
+			var scale = math.Pow10(int(-place))
+			return fromInt64(int64(fn(float64(n)/scale)*scale), numberKind(v)), nil
+		}
+		var f, _ = bsonutil.Float64(v)
+		var scale = math.Pow10(int(place))
+		var r = fn(f*scale) / scale
+		if numberKind(v) == kindDecimal {
+			return decimalFromFloat(r), nil
+		}
+		return r, nil
+	}
+}
+
+func evalATan2(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if anyNullish(args) {
+		return nil, nil
+	}
+	for _, i := range args {
+		if err := requireNumber(i); err != nil {
+			return nil, err
+		}
+	}
+	var y, _ = bsonutil.Float64(args[0])
+	var x, _ = bsonutil.Float64(args[1])
+	return math.Atan2(y, x), nil
+}
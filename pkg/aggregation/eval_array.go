@@ -0,0 +1,786 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	registerOperators(map[string]operatorFunc{
+		"$arrayElemAt":   evalArrayElemAt,
+		"$arrayToObject": evalArrayToObject,
+		"$concatArrays":  evalConcatArrays,
+		"$filter":        evalFilter,
+		"$first":         arrayEndFunc(true),
+		"$in":            evalIn,
+		"$indexOfArray":  evalIndexOfArray,
+		"$isArray":       evalIsArray,
+		"$last":          arrayEndFunc(false),
+		"$map":           evalMap,
+		"$objectToArray": evalObjectToArray,
+		"$range":         evalRange,
+		"$reduce":        evalReduce,
+		"$reverseArray":  evalReverseArray,
+		"$size":          evalSize,
+		"$slice":         evalSlice,
+		"$sortArray":     evalSortArray,
+		"$zip":           evalZip,
+
+		"$allElementsTrue": evalAllElementsTrue,
+		"$anyElementTrue":  evalAnyElementTrue,
+		"$setDifference":   evalSetDifference,
+		"$setEquals":       evalSetEquals,
+		"$setIntersection": evalSetIntersection,
+		"$setIsSubset":     evalSetIsSubset,
+		"$setUnion":        evalSetUnion,
+	})
+}
+
+func requireArray(v interface{}) (primitive.A, error) {
+	a, ok := v.(primitive.A)
+	if !ok {
+		return nil, fmt.Errorf("requires an array, found %s", typeName(v))
+	}
+	return a, nil
+}
+
+func requireInt(v interface{}) (int64, error) {
+	if bsonutil.IsNumber(v) {
+		n, ok := bsonutil.Int64(v)
+		if f, _ := bsonutil.Float64(v); ok && float64(n) == f {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("requires an integral number, found %s", typeName(v))
+}
+
+func evalArrayElemAt(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if anyNullish(args) {
+		return nil, nil
+	}
+	a, err := requireArray(args[0])
+	if err != nil {
+		return nil, err
+	}
+	index, err := requireInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 {
+		index += int64(len(a))
+	}
+	if index < 0 || index >= int64(len(a)) {
+		return missing{}, nil
+	}
+	return a[index], nil
+}
+
+func evalArrayToObject(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+	a, err := requireArray(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var ret = primitive.D{}
+	for _, i := range a {
+		var k, v interface{}
+		switch i := i.(type) {
+		case primitive.A:
+			if len(i) != 2 {
+				return nil, errors.New("array elements must have length 2")
+			}
+			k, v = i[0], i[1]
+		case primitive.D:
+			if len(i) != 2 {
+				return nil, errors.New("document elements must have exactly 2 fields 'k' and 'v'")
+			}
+			var ok1, ok2 bool
+			k, ok1 = bsonutil.Get(i, "k")
+			v, ok2 = bsonutil.Get(i, "v")
+			if !ok1 || !ok2 {
+				return nil, errors.New("document elements must have exactly 2 fields 'k' and 'v'")
+			}
+		default:
+			return nil, errors.New("input array elements must be arrays or documents")
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, errors.New("key must be a string")
+		}
+		ret = setDocField(ret, key, v)
+	}
+	return ret, nil
+}
+
+func evalConcatArrays(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgs(arg)
+	if err != nil {
+		return nil, err
+	}
+	var ret = primitive.A{}
+	for _, i := range args {
+		if isNullish(i) {
+			return nil, nil
+		}
+		a, err := requireArray(i)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, a...)
+	}
+	return ret, nil
+}
+
+// evalInputArray evaluates named "input" argument for $map, $filter and $reduce.
+func (e *evaluator) evalInputArray(d primitive.D) (primitive.A, bool, error) {
+	input, err := e.evalNamed(d, "input")
+	if err != nil {
+		return nil, false, err
+	}
+	if isNullish(input) {
+		return nil, false, nil
+	}
+	a, err := requireArray(input)
+	if err != nil {
+		return nil, false, err
+	}
+	return a, true, nil
+}
+
+func asName(d primitive.D, def string) (string, error) {
+	v, ok := bsonutil.Get(d, "as")
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return "", errors.New("'as' must be a variable name")
+	}
+	return s, nil
+}
+
+func evalFilter(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "input", "as", "cond", "limit")
+	if err != nil {
+		return nil, err
+	}
+	a, ok, err := e.evalInputArray(d)
+	if err != nil || !ok {
+		return nil, err
+	}
+	as, err := asName(d, "this")
+	if err != nil {
+		return nil, err
+	}
+	var limit = int64(math.MaxInt64)
+	if v, err := e.evalNamed(d, "limit"); err != nil {
+		return nil, err
+	} else if !isNullish(v) {
+		limit, err = requireInt(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cond, _ := bsonutil.Get(d, "cond")
+	var ret = primitive.A{}
+	for _, i := range a {
+		if int64(len(ret)) >= limit {
+			break
+		}
+		v, err := e.with(map[string]interface{}{as: i}).eval(cond)
+		if err != nil {
+			return nil, err
+		}
+		if bsonutil.Truthy(v) {
+			ret = append(ret, i)
+		}
+	}
+	return ret, nil
+}
+
+func evalMap(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "input", "as", "in")
+	if err != nil {
+		return nil, err
+	}
+	a, ok, err := e.evalInputArray(d)
+	if err != nil || !ok {
+		return nil, err
+	}
+	as, err := asName(d, "this")
+	if err != nil {
+		return nil, err
+	}
+	in, _ := bsonutil.Get(d, "in")
+	var ret = make(primitive.A, 0, len(a))
+	for _, i := range a {
+		v, err := e.with(map[string]interface{}{as: i}).eval(in)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, nullIfMissing(v))
+	}
+	return ret, nil
+}
+
+func evalReduce(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "input", "initialValue", "in")
+	if err != nil {
+		return nil, err
+	}
+	a, ok, err := e.evalInputArray(d)
+	if err != nil || !ok {
+		return nil, err
+	}
+	value, err := e.evalNamed(d, "initialValue")
+	if err != nil {
+		return nil, err
+	}
+	in, _ := bsonutil.Get(d, "in")
+	for _, i := range a {
+		value, err = e.with(map[string]interface{}{"this": i, "value": value}).eval(in)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+func arrayEndFunc(first bool) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		args, err := e.evalArgsN(arg, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := args[0].(missing); ok {
+			return missing{}, nil
+		}
+		if isNullish(args[0]) {
+			return nil, nil
+		}
+		a, err := requireArray(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(a) == 0 {
+			return missing{}, nil
+		}
+		if first {
+			return a[0], nil
+		}
+		return a[len(a)-1], nil
+	}
+}
+
+func evalIn(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	a, err := requireArray(args[1])
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range a {
+		if bsonutil.Equal(args[0], i) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func evalIndexOfArray(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 4)
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+	a, err := requireArray(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var start, end = int64(0), int64(len(a))
+	if len(args) > 2 {
+		if start, err = requireInt(args[2]); err != nil || start < 0 {
+			return nil, errors.New("starting index must be a non-negative integer")
+		}
+	}
+	if len(args) > 3 {
+		if end, err = requireInt(args[3]); err != nil || end < 0 {
+			return nil, errors.New("ending index must be a non-negative integer")
+		}
+		if end > int64(len(a)) {
+			end = int64(len(a))
+		}
+	}
+	for i := start; i < end; i++ {
+		if bsonutil.Equal(a[i], args[1]) {
+			return int32(i), nil
+		}
+	}
+	return int32(-1), nil
+}
+
+func evalIsArray(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	_, ok := args[0].(primitive.A)
+	return ok, nil
+}
+
+func evalObjectToArray(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+	d, ok := args[0].(primitive.D)
+	if !ok {
+		return nil, fmt.Errorf("requires a document input, found: %s", typeName(args[0]))
+	}
+	var ret = make(primitive.A, 0, len(d))
+	for _, i := range d {
+		ret = append(ret, primitive.D{{Key: "k", Value: i.Key}, {Key: "v", Value: i.Value}})
+	}
+	return ret, nil
+}
+
+func evalRange(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+	var nums = make([]int64, 3)
+	nums[2] = 1
+	for index, i := range args {
+		n, err := requireInt(i)
+		if err != nil {
+			return nil, err
+		}
+		nums[index] = n
+	}
+	var start, end, step = nums[0], nums[1], nums[2]
+	if step == 0 {
+		return nil, errors.New("step cannot be 0")
+	}
+	var ret = primitive.A{}
+	for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+		ret = append(ret, int32(i))
+	}
+	return ret, nil
+}
+
+func evalReverseArray(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+	a, err := requireArray(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var ret = make(primitive.A, len(a))
+	for index, i := range a {
+		ret[len(a)-1-index] = i
+	}
+	return ret, nil
+}
+
+func evalSortArray(e *evaluator, arg interface{}) (interface{}, error) {
+	if err := requireNamedArgs(arg, []string{"input", "sortBy"}); err != nil {
+		return nil, err
+	}
+	var d = arg.(primitive.D)
+	var sortBy, _ = bsonutil.Get(d, "sortBy")
+	var fields []sortField
+	if spec, ok := sortBy.(primitive.D); ok {
+		var err error
+		fields, err = compileSortFields(spec)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		n, err := requireInt(sortBy)
+		if err != nil || (n != 1 && n != -1) {
+			return nil, errors.New("sortBy must be either 1, -1, or an object")
+		}
+		fields = []sortField{{nil, int(n)}}
+	}
+	input, err := e.evalNamed(d, "input")
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(input) {
+		return nil, nil
+	}
+	a, err := requireArray(input)
+	if err != nil {
+		return nil, err
+	}
+	var keys = make([][]sortKey, len(a))
+	for index, i := range a {
+		keys[index] = make([]sortKey, len(fields))
+		for fieldIndex, f := range fields {
+			if f.path == nil {
+				keys[index][fieldIndex] = sortKey{value: i}
+				continue
+			}
+			var doc, _ = i.(primitive.D)
+			keys[index][fieldIndex] = newSortKey(doc, f.path, f.direction)
+		}
+	}
+	var indexes = make([]int, len(a))
+	for index := range indexes {
+		indexes[index] = index
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		for fieldIndex, f := range fields {
+			if c := compareSortKey(keys[indexes[i]][fieldIndex], keys[indexes[j]][fieldIndex]); c != 0 {
+				return c*f.direction < 0
+			}
+		}
+		return false
+	})
+	var ret = make(primitive.A, len(a))
+	for index, i := range indexes {
+		ret[index] = a[i]
+	}
+	return ret, nil
+}
+
+func evalSize(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	a, err := requireArray(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return int32(len(a)), nil
+}
+
+func evalSlice(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 3)
+	if err != nil {
+		return nil, err
+	}
+	if anyNullish(args) {
+		return nil, nil
+	}
+	a, err := requireArray(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var length = int64(len(a))
+	if len(args) == 2 {
+		n, err := requireInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		if n >= 0 {
+			if n > length {
+				n = length
+			}
+			return a[:n], nil
+		}
+		if -n > length {
+			n = -length
+		}
+		return a[length+n:], nil
+	}
+	pos, err := requireInt(args[1])
+	if err != nil {
+		return nil, err
+	}
+	n, err := requireInt(args[2])
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, errors.New("third argument must be positive")
+	}
+	if pos < 0 {
+		pos += length
+		if pos < 0 {
+			pos = 0
+		}
+	}
+	if pos > length {
+		pos = length
+	}
+	var end = pos + n
+	if end > length {
+		end = length
+	}
+	return a[pos:end], nil
+}
+
+func evalZip(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "inputs", "useLongestLength", "defaults")
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := e.evalNamed(d, "inputs")
+	if err != nil {
+		return nil, err
+	}
+	inputArrays, err := requireArray(inputs)
+	if err != nil {
+		return nil, err
+	}
+	useLongest, err := e.evalNamed(d, "useLongestLength")
+	if err != nil {
+		return nil, err
+	}
+	defaults, err := e.evalNamed(d, "defaults")
+	if err != nil {
+		return nil, err
+	}
+	var arrays = make([]primitive.A, 0, len(inputArrays))
+	var minLength, maxLength = math.MaxInt32, 0
+	for _, i := range inputArrays {
+		if isNullish(i) {
+			return nil, nil
+		}
+		a, err := requireArray(i)
+		if err != nil {
+			return nil, err
+		}
+		arrays = append(arrays, a)
+		if len(a) < minLength {
+			minLength = len(a)
+		}
+		if len(a) > maxLength {
+			maxLength = len(a)
+		}
+	}
+	var length = minLength
+	if bsonutil.Truthy(useLongest) {
+		length = maxLength
+	}
+	if len(arrays) == 0 {
+		length = 0
+	}
+	var defaultValues primitive.A
+	if !isNullish(defaults) {
+		defaultValues, err = requireArray(defaults)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var ret = make(primitive.A, 0, length)
+	for index := 0; index < length; index++ {
+		var item = make(primitive.A, 0, len(arrays))
+		for arrayIndex, a := range arrays {
+			switch {
+			case index < len(a):
+				item = append(item, a[index])
+			case arrayIndex < len(defaultValues):
+				item = append(item, defaultValues[arrayIndex])
+			default:
+				item = append(item, nil)
+			}
+		}
+		ret = append(ret, item)
+	}
+	return ret, nil
+}
+
+func evalAllElementsTrue(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	a, err := requireArray(args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range a {
+		if !bsonutil.Truthy(i) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func evalAnyElementTrue(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	a, err := requireArray(args[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range a {
+		if bsonutil.Truthy(i) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// valueSet is an insertion ordered set of bson values.
+type valueSet struct {
+	keys  map[string]struct{}
+	items primitive.A
+}
+
+func newValueSet(items ...interface{}) *valueSet {
+	var s = &valueSet{keys: map[string]struct{}{}, items: primitive.A{}}
+	for _, i := range items {
+		s.add(i)
+	}
+	return s
+}
+
+func (s *valueSet) has(v interface{}) bool {
+	_, ok := s.keys[bsonutil.Key(v)]
+	return ok
+}
+
+func (s *valueSet) add(v interface{}) {
+	var k = bsonutil.Key(v)
+	if _, ok := s.keys[k]; ok {
+		return
+	}
+	s.keys[k] = struct{}{}
+	s.items = append(s.items, v)
+}
+
+// evalSetArgs evaluates set operator arguments,
+// returns nil if any argument is null.
+func (e *evaluator) evalSetArgs(arg interface{}, min, max int) ([]primitive.A, error) {
+	args, err := e.evalArgsN(arg, min, max)
+	if err != nil {
+		return nil, err
+	}
+	var ret = make([]primitive.A, 0, len(args))
+	for _, i := range args {
+		if isNullish(i) {
+			return nil, nil
+		}
+		a, err := requireArray(i)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, a)
+	}
+	return ret, nil
+}
+
+func evalSetDifference(e *evaluator, arg interface{}) (interface{}, error) {
+	sets, err := e.evalSetArgs(arg, 2, 2)
+	if err != nil || sets == nil {
+		return nil, err
+	}
+	var exclude = newValueSet(sets[1]...)
+	var ret = newValueSet()
+	for _, i := range sets[0] {
+		if !exclude.has(i) {
+			ret.add(i)
+		}
+	}
+	return ret.items, nil
+}
+
+func evalSetEquals(e *evaluator, arg interface{}) (interface{}, error) {
+	sets, err := e.evalSetArgs(arg, 2, -1)
+	if err != nil {
+		return nil, err
+	}
+	if sets == nil {
+		return nil, errors.New("all operands must be arrays")
+	}
+	var first = newValueSet(sets[0]...)
+	for _, i := range sets[1:] {
+		var s = newValueSet(i...)
+		if len(s.keys) != len(first.keys) {
+			return false, nil
+		}
+		for k := range s.keys {
+			if _, ok := first.keys[k]; !ok {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func evalSetIntersection(e *evaluator, arg interface{}) (interface{}, error) {
+	sets, err := e.evalSetArgs(arg, 0, -1)
+	if err != nil || sets == nil {
+		return nil, err
+	}
+	if len(sets) == 0 {
+		return primitive.A{}, nil
+	}
+	var ret = newValueSet(sets[0]...)
+	for _, i := range sets[1:] {
+		var s = newValueSet(i...)
+		var next = newValueSet()
+		for _, j := range ret.items {
+			if s.has(j) {
+				next.add(j)
+			}
+		}
+		ret = next
+	}
+	return ret.items, nil
+}
+
+func evalSetIsSubset(e *evaluator, arg interface{}) (interface{}, error) {
+	sets, err := e.evalSetArgs(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if sets == nil {
+		return nil, errors.New("both operands must be arrays")
+	}
+	var s = newValueSet(sets[1]...)
+	for _, i := range sets[0] {
+		if !s.has(i) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func evalSetUnion(e *evaluator, arg interface{}) (interface{}, error) {
+	sets, err := e.evalSetArgs(arg, 0, -1)
+	if err != nil || sets == nil {
+		return nil, err
+	}
+	var ret = newValueSet()
+	for _, i := range sets {
+		for _, j := range i {
+			ret.add(j)
+		}
+	}
+	return ret.items, nil
+}
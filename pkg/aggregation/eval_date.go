@@ -0,0 +1,775 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	registerOperators(map[string]operatorFunc{
+		"$dateFromParts":  evalDateFromParts,
+		"$dateFromString": evalDateFromString,
+		"$dateToParts":    evalDateToParts,
+		"$dateToString":   evalDateToString,
+		"$dateAdd":        dateAddFunc(1),
+		"$dateSubtract":   dateAddFunc(-1),
+		"$dateDiff":       evalDateDiff,
+		"$dateTrunc":      evalDateTrunc,
+
+		"$year":         datePartFunc(func(t time.Time) int { return t.Year() }),
+		"$month":        datePartFunc(func(t time.Time) int { return int(t.Month()) }),
+		"$dayOfMonth":   datePartFunc(func(t time.Time) int { return t.Day() }),
+		"$hour":         datePartFunc(func(t time.Time) int { return t.Hour() }),
+		"$minute":       datePartFunc(func(t time.Time) int { return t.Minute() }),
+		"$second":       datePartFunc(func(t time.Time) int { return t.Second() }),
+		"$millisecond":  datePartFunc(func(t time.Time) int { return t.Nanosecond() / int(time.Millisecond) }),
+		"$dayOfYear":    datePartFunc(func(t time.Time) int { return t.YearDay() }),
+		"$dayOfWeek":    datePartFunc(func(t time.Time) int { return int(t.Weekday()) + 1 }),
+		"$week":         datePartFunc(week),
+		"$isoWeek":      datePartFunc(func(t time.Time) int { _, w := t.ISOWeek(); return w }),
+		"$isoWeekYear":  datePartFunc(func(t time.Time) int { y, _ := t.ISOWeek(); return y }),
+		"$isoDayOfWeek": datePartFunc(isoDayOfWeek),
+	})
+}
+
+const defaultDateFormat = "%Y-%m-%dT%H:%M:%S.%LZ"
+
+var utcOffsetPattern = regexp.MustCompile(`^([+-])(\d{2}):?(\d{2})?$`)
+
+// location parses a timezone argument,
+// Olson timezone identifier and UTC offset are supported.
+func location(v interface{}) (*time.Location, error) {
+	if isNullish(v) {
+		return time.UTC, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, errors.New("timezone must evaluate to a string")
+	}
+	if m := utcOffsetPattern.FindStringSubmatch(s); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3] + strings.Repeat("0", 2-len(m[3])))
+		var offset = hours*3600 + minutes*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return time.FixedZone(s, offset), nil
+	}
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return nil, fmt.Errorf("unrecognized time zone identifier: %s", s)
+	}
+	return loc, nil
+}
+
+// toTime converts date like value to time.
+func toTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case primitive.DateTime:
+		return v.Time().UTC(), nil
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0).UTC(), nil
+	case primitive.ObjectID:
+		return v.Timestamp().UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("can't convert from BSON type %s to Date", typeName(v))
+}
+
+func fromTime(t time.Time) primitive.DateTime {
+	return primitive.NewDateTimeFromTime(t)
+}
+
+func week(t time.Time) int {
+	return (t.YearDay() - 1 - int(t.Weekday()) + 7) / 7
+}
+
+func isoDayOfWeek(t time.Time) int {
+	var d = int(t.Weekday())
+	if d == 0 {
+		return 7
+	}
+	return d
+}
+
+// evalDateArg evaluates date and timezone from date part operator argument.
+// Returns false if date is null.
+func (e *evaluator) evalDateArg(arg interface{}) (time.Time, bool, error) {
+	var dateExpr, timezoneExpr interface{} = arg, nil
+	if a, ok := arg.(primitive.A); ok {
+		if len(a) != 1 {
+			return time.Time{}, false, fmt.Errorf("expression takes exactly 1 arguments, %d were passed in", len(a))
+		}
+		dateExpr = a[0]
+	} else if d, ok := arg.(primitive.D); ok && !isOperatorExpression(d) {
+		d, err := namedArgs(d, "date", "timezone")
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		dateExpr, _ = bsonutil.Get(d, "date")
+		timezoneExpr, _ = bsonutil.Get(d, "timezone")
+	}
+	date, err := e.eval(dateExpr)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	timezone, err := e.eval(timezoneExpr)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if isNullish(date) || (timezoneExpr != nil && isNullish(timezone)) {
+		return time.Time{}, false, nil
+	}
+	t, err := toTime(date)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	loc, err := location(timezone)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return t.In(loc), true, nil
+}
+
+func datePartFunc(fn func(t time.Time) int) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		t, ok, err := e.evalDateArg(arg)
+		if err != nil || !ok {
+			return nil, err
+		}
+		return int32(fn(t)), nil
+	}
+}
+
+func formatOffset(t time.Time) string {
+	_, offset := t.Zone()
+	var sign = "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+}
+
+func formatDate(t time.Time, format string) (string, error) {
+	var b strings.Builder
+	for index := 0; index < len(format); index++ {
+		if format[index] != '%' {
+			b.WriteByte(format[index])
+			continue
+		}
+		index++
+		if index >= len(format) {
+			return "", errors.New("unmatched '%' at end of format string")
+		}
+		switch format[index] {
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'G':
+			y, _ := t.ISOWeek()
+			fmt.Fprintf(&b, "%04d", y)
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'j':
+			fmt.Fprintf(&b, "%03d", t.YearDay())
+		case 'L':
+			fmt.Fprintf(&b, "%03d", t.Nanosecond()/int(time.Millisecond))
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 'w':
+			fmt.Fprintf(&b, "%d", int(t.Weekday())+1)
+		case 'u':
+			fmt.Fprintf(&b, "%d", isoDayOfWeek(t))
+		case 'U':
+			fmt.Fprintf(&b, "%02d", week(t))
+		case 'V':
+			_, w := t.ISOWeek()
+			fmt.Fprintf(&b, "%02d", w)
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'z':
+			b.WriteString(formatOffset(t))
+		case 'Z':
+			_, offset := t.Zone()
+			fmt.Fprintf(&b, "%d", offset/60)
+		case 'b':
+			b.WriteString(t.Month().String()[:3])
+		case 'B':
+			b.WriteString(t.Month().String())
+		case '%':
+			b.WriteByte('%')
+		default:
+			return "", fmt.Errorf("invalid format character '%%%c' in format string", format[index])
+		}
+	}
+	return b.String(), nil
+}
+
+func evalDateToString(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "date", "format", "timezone", "onNull")
+	if err != nil {
+		return nil, err
+	}
+	date, err := e.evalNamed(d, "date")
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(date) {
+		if _, ok := bsonutil.Get(d, "onNull"); ok {
+			return e.evalNamed(d, "onNull")
+		}
+		return nil, nil
+	}
+	var format = defaultDateFormat
+	if v, err := e.evalNamed(d, "format"); err != nil {
+		return nil, err
+	} else if _, ok := v.(missing); !ok {
+		if isNullish(v) {
+			return nil, nil
+		}
+		format, err = requireString(v)
+		if err != nil {
+			return nil, err
+		}
+	}
+	timezone, err := e.evalNamed(d, "timezone")
+	if err != nil {
+		return nil, err
+	}
+	loc, err := location(timezone)
+	if err != nil {
+		return nil, err
+	}
+	t, err := toTime(date)
+	if err != nil {
+		return nil, err
+	}
+	return formatDate(t.In(loc), format)
+}
+
+// parseDateFormat parses s with mongodb date format.
+func parseDateFormat(s, format string, loc *time.Location) (time.Time, error) {
+	var year, month, day, hour, minute, second, millisecond = 1970, 1, 1, 0, 0, 0, 0
+	var pos int
+	var readInt = func(maxDigits int, signed bool) (int, error) {
+		var start = pos
+		if signed && pos < len(s) && (s[pos] == '+' || s[pos] == '-') {
+			pos++
+		}
+		for pos < len(s) && pos-start < maxDigits && s[pos] >= '0' && s[pos] <= '9' {
+			pos++
+		}
+		return strconv.Atoi(s[start:pos])
+	}
+	var err error
+	for index := 0; index < len(format); index++ {
+		if format[index] != '%' {
+			if pos >= len(s) || s[pos] != format[index] {
+				return time.Time{}, fmt.Errorf("error parsing date string '%s'", s)
+			}
+			pos++
+			continue
+		}
+		index++
+		if index >= len(format) {
+			return time.Time{}, errors.New("unmatched '%' at end of format string")
+		}
+		switch format[index] {
+		case 'Y':
+			year, err = readInt(4, false)
+		case 'm':
+			month, err = readInt(2, false)
+		case 'd':
+			day, err = readInt(2, false)
+		case 'H':
+			hour, err = readInt(2, false)
+		case 'M':
+			minute, err = readInt(2, false)
+		case 'S':
+			second, err = readInt(2, false)
+		case 'L':
+			millisecond, err = readInt(3, false)
+		case 'j':
+			var yday int
+			yday, err = readInt(3, false)
+			month, day = 1, yday
+		case 'z':
+			var start = pos
+			if pos < len(s) && (s[pos] == '+' || s[pos] == '-') {
+				pos += 5
+			}
+			if pos > len(s) {
+				return time.Time{}, fmt.Errorf("error parsing date string '%s'", s)
+			}
+			loc, err = location(s[start:pos])
+		case 'Z':
+			var minutes int
+			minutes, err = readInt(4, true)
+			loc = time.FixedZone("", minutes*60)
+		case '%':
+			if pos >= len(s) || s[pos] != '%' {
+				return time.Time{}, fmt.Errorf("error parsing date string '%s'", s)
+			}
+			pos++
+		default:
+			return time.Time{}, fmt.Errorf("invalid format character '%%%c' in format string", format[index])
+		}
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error parsing date string '%s'", s)
+		}
+	}
+	if pos != len(s) {
+		return time.Time{}, fmt.Errorf("error parsing date string '%s'", s)
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, second, millisecond*int(time.Millisecond), loc), nil
+}
+
+var dateStringLayouts = []string{
+	"2006-01-02T15:04:05.999999999Z07:00",
+	"2006-01-02T15:04:05.999999999Z0700",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	"Jan 2, 2006",
+	"January 2, 2006",
+}
+
+func evalDateFromString(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "dateString", "format", "timezone", "onError", "onNull")
+	if err != nil {
+		return nil, err
+	}
+	dateString, err := e.evalNamed(d, "dateString")
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(dateString) {
+		if _, ok := bsonutil.Get(d, "onNull"); ok {
+			return e.evalNamed(d, "onNull")
+		}
+		return nil, nil
+	}
+	format, err := e.evalNamed(d, "format")
+	if err != nil {
+		return nil, err
+	}
+	timezone, err := e.evalNamed(d, "timezone")
+	if err != nil {
+		return nil, err
+	}
+	loc, err := location(timezone)
+	if err != nil {
+		return nil, err
+	}
+	var parse = func() (time.Time, error) {
+		s, err := requireString(dateString)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if _, ok := format.(missing); !ok && !isNullish(format) {
+			f, err := requireString(format)
+			if err != nil {
+				return time.Time{}, err
+			}
+			return parseDateFormat(s, f, loc)
+		}
+		for _, layout := range dateStringLayouts {
+			t, err := time.ParseInLocation(layout, s, loc)
+			if err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("error parsing date string '%s'", s)
+	}
+	t, err := parse()
+	if err != nil {
+		if _, ok := bsonutil.Get(d, "onError"); ok {
+			return e.evalNamed(d, "onError")
+		}
+		return nil, err
+	}
+	return fromTime(t), nil
+}
+
+func evalDateFromParts(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg,
+		"year", "month", "day",
+		"isoWeekYear", "isoWeek", "isoDayOfWeek",
+		"hour", "minute", "second", "millisecond", "timezone",
+	)
+	if err != nil {
+		return nil, err
+	}
+	var _, iso = bsonutil.Get(d, "isoWeekYear")
+	if _, ok := bsonutil.Get(d, "year"); ok == iso {
+		return nil, errors.New("requires either 'year' or 'isoWeekYear'")
+	}
+	var parts = map[string]int{}
+	for _, k := range []string{
+		"year", "month", "day",
+		"isoWeekYear", "isoWeek", "isoDayOfWeek",
+		"hour", "minute", "second", "millisecond",
+	} {
+		v, err := e.evalNamed(d, k)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := v.(missing); ok {
+			continue
+		}
+		if isNullish(v) {
+			return nil, nil
+		}
+		n, err := requireInt(v)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' %w", k, err)
+		}
+		parts[k] = int(n)
+	}
+	timezone, err := e.evalNamed(d, "timezone")
+	if err != nil {
+		return nil, err
+	}
+	loc, err := location(timezone)
+	if err != nil {
+		return nil, err
+	}
+	var partOrDefault = func(k string, def int) int {
+		if v, ok := parts[k]; ok {
+			return v
+		}
+		return def
+	}
+	var clock = time.Duration(partOrDefault("hour", 0))*time.Hour +
+		time.Duration(partOrDefault("minute", 0))*time.Minute +
+		time.Duration(partOrDefault("second", 0))*time.Second +
+		time.Duration(partOrDefault("millisecond", 0))*time.Millisecond
+	var t time.Time
+	if iso {
+		var jan4 = time.Date(parts["isoWeekYear"], time.January, 4, 0, 0, 0, 0, loc)
+		var weekStart = jan4.AddDate(0, 0, 1-isoDayOfWeek(jan4))
+		t = weekStart.AddDate(0, 0, (partOrDefault("isoWeek", 1)-1)*7+partOrDefault("isoDayOfWeek", 1)-1)
+	} else {
+		t = time.Date(parts["year"], time.Month(partOrDefault("month", 1)), partOrDefault("day", 1), 0, 0, 0, 0, loc)
+	}
+	return fromTime(t.Add(clock)), nil
+}
+
+func evalDateToParts(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "date", "timezone", "iso8601")
+	if err != nil {
+		return nil, err
+	}
+	iso8601, err := e.evalNamed(d, "iso8601")
+	if err != nil {
+		return nil, err
+	}
+	var dateArg = primitive.D{}
+	for _, i := range d {
+		if i.Key != "iso8601" {
+			dateArg = append(dateArg, i)
+		}
+	}
+	t, ok, err := e.evalDateArg(dateArg)
+	if err != nil || !ok {
+		return nil, err
+	}
+	var ret primitive.D
+	if bsonutil.Truthy(iso8601) {
+		y, w := t.ISOWeek()
+		ret = primitive.D{
+			{Key: "isoWeekYear", Value: int32(y)},
+			{Key: "isoWeek", Value: int32(w)},
+			{Key: "isoDayOfWeek", Value: int32(isoDayOfWeek(t))},
+		}
+	} else {
+		ret = primitive.D{
+			{Key: "year", Value: int32(t.Year())},
+			{Key: "month", Value: int32(t.Month())},
+			{Key: "day", Value: int32(t.Day())},
+		}
+	}
+	return append(ret,
+		primitive.E{Key: "hour", Value: int32(t.Hour())},
+		primitive.E{Key: "minute", Value: int32(t.Minute())},
+		primitive.E{Key: "second", Value: int32(t.Second())},
+		primitive.E{Key: "millisecond", Value: int32(t.Nanosecond() / int(time.Millisecond))},
+	), nil
+}
+
+var timeUnitDurations = map[TimeUnit]time.Duration{
+	TUHour:        time.Hour,
+	TUMinute:      time.Minute,
+	TUSecond:      time.Second,
+	TUMillisecond: time.Millisecond,
+}
+
+func requireTimeUnit(v interface{}) (TimeUnit, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("unit must evaluate to a string, found %s", typeName(v))
+	}
+	switch u := TimeUnit(s); u {
+	case TUYear, TUQuarter, TUMonth, TUWeek, TUDay:
+		return u, nil
+	default:
+		if _, ok := timeUnitDurations[u]; ok {
+			return u, nil
+		}
+	}
+	return "", fmt.Errorf("unknown time unit value: %s", s)
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+func requireStartOfWeek(v interface{}) (time.Weekday, error) {
+	if _, ok := v.(missing); ok {
+		return time.Sunday, nil
+	}
+	if s, ok := v.(string); ok {
+		if d, ok := weekdays[strings.ToLower(s)]; ok {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown startOfWeek value: %v", v)
+}
+
+// evalDateUnitArgs evaluates arguments of $dateAdd, $dateSubtract, $dateDiff and $dateTrunc.
+// Returns false if a required argument or timezone is null.
+func (e *evaluator) evalDateUnitArgs(d primitive.D, required []string, optional ...string) (map[string]interface{}, bool, error) {
+	var ret = map[string]interface{}{}
+	var ok = true
+	for _, k := range append(required, optional...) {
+		v, err := e.evalNamed(d, k)
+		if err != nil {
+			return nil, false, err
+		}
+		ret[k] = v
+	}
+	for _, k := range required {
+		if _, found := bsonutil.Get(d, k); !found {
+			return nil, false, fmt.Errorf("missing '%s' parameter", k)
+		}
+		if isNullish(ret[k]) {
+			ok = false
+		}
+	}
+	if _, found := bsonutil.Get(d, "timezone"); found && isNullish(ret["timezone"]) {
+		ok = false
+	}
+	return ret, ok, nil
+}
+
+// wallClock returns local date and time of t as UTC time,
+// so calendar arithmetic is not affected by offset changes.
+func wallClock(t time.Time, loc *time.Location) time.Time {
+	var l = t.In(loc)
+	return time.Date(l.Year(), l.Month(), l.Day(), l.Hour(), l.Minute(), l.Second(), l.Nanosecond(), time.UTC)
+}
+
+func fromWallClock(w time.Time, loc *time.Location) time.Time {
+	return time.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), loc)
+}
+
+func floorDiv(a, b int64) int64 {
+	var q = a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
+
+func unixMilli(t time.Time) int64 {
+	return t.Unix()*1000 + int64(t.Nanosecond())/int64(time.Millisecond)
+}
+
+func unixDay(t time.Time) int64 {
+	return floorDiv(t.Unix(), 24*60*60)
+}
+
+// addMonths adds n months to w,
+// day is clamped to end of month like mongodb does.
+func addMonths(w time.Time, n int) time.Time {
+	var first = time.Date(w.Year(), w.Month(), 1, w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), time.UTC).AddDate(0, n, 0)
+	var day = w.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+func dateAddFunc(sign int64) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		d, err := namedArgs(arg, "startDate", "unit", "amount", "timezone")
+		if err != nil {
+			return nil, err
+		}
+		args, ok, err := e.evalDateUnitArgs(d, []string{"startDate", "unit", "amount"}, "timezone")
+		if err != nil || !ok {
+			return nil, err
+		}
+		t, err := toTime(args["startDate"])
+		if err != nil {
+			return nil, err
+		}
+		unit, err := requireTimeUnit(args["unit"])
+		if err != nil {
+			return nil, err
+		}
+		amount, err := requireInt(args["amount"])
+		if err != nil {
+			return nil, fmt.Errorf("'amount' %w", err)
+		}
+		loc, err := location(args["timezone"])
+		if err != nil {
+			return nil, err
+		}
+		amount *= sign
+		var w = wallClock(t, loc)
+		switch unit {
+		case TUYear:
+			return fromTime(fromWallClock(addMonths(w, int(amount)*12), loc)), nil
+		case TUQuarter:
+			return fromTime(fromWallClock(addMonths(w, int(amount)*3), loc)), nil
+		case TUMonth:
+			return fromTime(fromWallClock(addMonths(w, int(amount)), loc)), nil
+		case TUWeek:
+			return fromTime(fromWallClock(w.AddDate(0, 0, int(amount)*7), loc)), nil
+		case TUDay:
+			return fromTime(fromWallClock(w.AddDate(0, 0, int(amount)), loc)), nil
+		}
+		return fromTime(t.Add(time.Duration(amount) * timeUnitDurations[unit])), nil
+	}
+}
+
+// dateIndex returns count of unit boundaries between epoch and wall clock w.
+func dateIndex(w time.Time, unit TimeUnit, startOfWeek time.Weekday) int64 {
+	switch unit {
+	case TUYear:
+		return int64(w.Year())
+	case TUQuarter:
+		return int64(w.Year())*4 + int64(w.Month()-1)/3
+	case TUMonth:
+		return int64(w.Year())*12 + int64(w.Month()-1)
+	case TUWeek:
+		// 1970-01-01 is thursday
+		return floorDiv(unixDay(w)-int64((startOfWeek-time.Thursday+7)%7), 7)
+	case TUDay:
+		return unixDay(w)
+	}
+	return floorDiv(unixMilli(w), int64(timeUnitDurations[unit]/time.Millisecond))
+}
+
+func evalDateDiff(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "startDate", "endDate", "unit", "timezone", "startOfWeek")
+	if err != nil {
+		return nil, err
+	}
+	args, ok, err := e.evalDateUnitArgs(d, []string{"startDate", "endDate", "unit"}, "timezone", "startOfWeek")
+	if err != nil || !ok {
+		return nil, err
+	}
+	start, err := toTime(args["startDate"])
+	if err != nil {
+		return nil, err
+	}
+	end, err := toTime(args["endDate"])
+	if err != nil {
+		return nil, err
+	}
+	unit, err := requireTimeUnit(args["unit"])
+	if err != nil {
+		return nil, err
+	}
+	loc, err := location(args["timezone"])
+	if err != nil {
+		return nil, err
+	}
+	startOfWeek, err := requireStartOfWeek(args["startOfWeek"])
+	if err != nil {
+		return nil, err
+	}
+	return dateIndex(wallClock(end, loc), unit, startOfWeek) -
+		dateIndex(wallClock(start, loc), unit, startOfWeek), nil
+}
+
+// dateTrunc truncates wall clock w,
+// bins are aligned to 2000-01-01 like mongodb does.
+func dateTrunc(w time.Time, unit TimeUnit, binSize int64, startOfWeek time.Weekday) time.Time {
+	var ref = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	switch unit {
+	case TUYear, TUQuarter, TUMonth:
+		var size = binSize * map[TimeUnit]int64{TUYear: 12, TUQuarter: 3, TUMonth: 1}[unit]
+		var n = int64(w.Year()-2000)*12 + int64(w.Month()-1)
+		return ref.AddDate(0, int(floorDiv(n, size)*size), 0)
+	case TUWeek:
+		// 2000-01-01 is saturday
+		ref = ref.AddDate(0, 0, int((startOfWeek-time.Saturday+7)%7))
+		binSize *= 7
+		fallthrough
+	case TUDay:
+		var n = unixDay(w) - unixDay(ref)
+		return ref.AddDate(0, 0, int(floorDiv(n, binSize)*binSize))
+	}
+	var size = binSize * int64(timeUnitDurations[unit]/time.Millisecond)
+	var n = unixMilli(w) - unixMilli(ref)
+	return ref.Add(time.Duration(floorDiv(n, size)*size) * time.Millisecond)
+}
+
+func evalDateTrunc(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "date", "unit", "binSize", "timezone", "startOfWeek")
+	if err != nil {
+		return nil, err
+	}
+	args, ok, err := e.evalDateUnitArgs(d, []string{"date", "unit"}, "binSize", "timezone", "startOfWeek")
+	if err != nil || !ok {
+		return nil, err
+	}
+	t, err := toTime(args["date"])
+	if err != nil {
+		return nil, err
+	}
+	unit, err := requireTimeUnit(args["unit"])
+	if err != nil {
+		return nil, err
+	}
+	var binSize int64 = 1
+	if v := args["binSize"]; !isNullish(v) {
+		binSize, err = requireInt(v)
+		if err != nil || binSize <= 0 {
+			return nil, errors.New("'binSize' must evaluate to a positive integer")
+		}
+	} else if _, ok := v.(missing); !ok {
+		return nil, nil
+	}
+	loc, err := location(args["timezone"])
+	if err != nil {
+		return nil, err
+	}
+	startOfWeek, err := requireStartOfWeek(args["startOfWeek"])
+	if err != nil {
+		return nil, err
+	}
+	return fromTime(fromWallClock(dateTrunc(wallClock(t, loc), unit, binSize, startOfWeek), loc)), nil
+}
@@ -0,0 +1,382 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	registerOperators(map[string]operatorFunc{
+		"$and": evalAnd,
+		"$or":  evalOr,
+		"$not": evalNot,
+
+		"$cmp": compareFunc(func(c int) interface{} { return int32(c) }),
+		"$eq":  compareFunc(func(c int) interface{} { return c == 0 }),
+		"$gt":  compareFunc(func(c int) interface{} { return c > 0 }),
+		"$gte": compareFunc(func(c int) interface{} { return c >= 0 }),
+		"$lt":  compareFunc(func(c int) interface{} { return c < 0 }),
+		"$lte": compareFunc(func(c int) interface{} { return c <= 0 }),
+		"$ne":  compareFunc(func(c int) interface{} { return c != 0 }),
+
+		"$cond":   evalCond,
+		"$ifNull": evalIfNull,
+		"$switch": evalSwitch,
+
+		"$literal": func(e *evaluator, arg interface{}) (interface{}, error) {
+			return arg, nil
+		},
+		"$let": evalLet,
+
+		"$getField":     evalGetField,
+		"$setField":     evalSetField,
+		"$unsetField":   evalUnsetField,
+		"$mergeObjects": evalMergeObjects,
+		"$rand": func(e *evaluator, arg interface{}) (interface{}, error) {
+			return rand.Float64(), nil
+		},
+
+		"$binarySize": evalBinarySize,
+		"$bsonSize":   evalBSONSize,
+	})
+}
+
+func evalAnd(e *evaluator, arg interface{}) (interface{}, error) {
+	var a, ok = arg.(primitive.A)
+	if !ok {
+		a = primitive.A{arg}
+	}
+	for _, i := range a {
+		v, err := e.eval(i)
+		if err != nil {
+			return nil, err
+		}
+		if !bsonutil.Truthy(v) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func evalOr(e *evaluator, arg interface{}) (interface{}, error) {
+	var a, ok = arg.(primitive.A)
+	if !ok {
+		a = primitive.A{arg}
+	}
+	for _, i := range a {
+		v, err := e.eval(i)
+		if err != nil {
+			return nil, err
+		}
+		if bsonutil.Truthy(v) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func evalNot(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return !bsonutil.Truthy(args[0]), nil
+}
+
+func compareFunc(fn func(c int) interface{}) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		args, err := e.evalArgsN(arg, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+		return fn(bsonutil.Compare(args[0], args[1])), nil
+	}
+}
+
+func evalCond(e *evaluator, arg interface{}) (interface{}, error) {
+	var ifExpr, thenExpr, elseExpr interface{}
+	switch arg := arg.(type) {
+	case primitive.A:
+		if len(arg) != 3 {
+			return nil, fmt.Errorf("expression takes exactly 3 arguments, %d were passed in", len(arg))
+		}
+		ifExpr, thenExpr, elseExpr = arg[0], arg[1], arg[2]
+	case primitive.D:
+		d, err := namedArgs(arg, "if", "then", "else")
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range []string{"if", "then", "else"} {
+			if _, ok := bsonutil.Get(d, k); !ok {
+				return nil, fmt.Errorf("missing '%s' parameter", k)
+			}
+		}
+		ifExpr, _ = bsonutil.Get(d, "if")
+		thenExpr, _ = bsonutil.Get(d, "then")
+		elseExpr, _ = bsonutil.Get(d, "else")
+	default:
+		return nil, errors.New("expects an array or an object")
+	}
+	v, err := e.eval(ifExpr)
+	if err != nil {
+		return nil, err
+	}
+	if bsonutil.Truthy(v) {
+		return e.eval(thenExpr)
+	}
+	return e.eval(elseExpr)
+}
+
+func evalIfNull(e *evaluator, arg interface{}) (interface{}, error) {
+	var a, ok = arg.(primitive.A)
+	if !ok || len(a) < 2 {
+		return nil, errors.New("needs at least two arguments")
+	}
+	for index, i := range a {
+		v, err := e.eval(i)
+		if err != nil {
+			return nil, err
+		}
+		if !isNullish(v) || index == len(a)-1 {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+
+func evalSwitch(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "branches", "default")
+	if err != nil {
+		return nil, err
+	}
+	branches, _ := bsonutil.Get(d, "branches")
+	a, ok := branches.(primitive.A)
+	if !ok {
+		return nil, errors.New("expected an array for 'branches'")
+	}
+	for _, i := range a {
+		b, err := namedArgs(i, "case", "then")
+		if err != nil {
+			return nil, err
+		}
+		v, err := e.evalNamed(b, "case")
+		if err != nil {
+			return nil, err
+		}
+		if bsonutil.Truthy(v) {
+			return e.evalNamed(b, "then")
+		}
+	}
+	def, ok := bsonutil.Get(d, "default")
+	if !ok {
+		return nil, errors.New("could not find a matching branch for an input, and no default was specified")
+	}
+	return e.eval(def)
+}
+
+func evalLet(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "vars", "in")
+	if err != nil {
+		return nil, err
+	}
+	varsArg, _ := bsonutil.Get(d, "vars")
+	varsDoc, ok := varsArg.(primitive.D)
+	if !ok {
+		return nil, errors.New("invalid parameter: expected an object (vars)")
+	}
+	var vars = make(map[string]interface{}, len(varsDoc))
+	for _, i := range varsDoc {
+		v, err := e.eval(i.Value)
+		if err != nil {
+			return nil, err
+		}
+		vars[i.Key] = v
+	}
+	in, _ := bsonutil.Get(d, "in")
+	return e.with(vars).eval(in)
+}
+
+// fieldName evaluates $getField like field argument.
+func (e *evaluator) fieldName(d primitive.D) (string, error) {
+	v, err := e.evalNamed(d, "field")
+	if err != nil {
+		return "", err
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", errors.New("'field' must evaluate to a string")
+	}
+	return s, nil
+}
+
+func evalGetField(e *evaluator, arg interface{}) (interface{}, error) {
+	var field string
+	var input interface{}
+	if d, ok := arg.(primitive.D); ok && !isOperatorExpression(d) {
+		d, err := namedArgs(d, "field", "input")
+		if err != nil {
+			return nil, err
+		}
+		field, err = e.fieldName(d)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := bsonutil.Get(d, "input"); ok {
+			input, err = e.evalNamed(d, "input")
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			input = e.current()
+		}
+	} else {
+		v, err := e.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, errors.New("'field' must evaluate to a string")
+		}
+		field, input = s, e.current()
+	}
+	if isNullish(input) {
+		return nil, nil
+	}
+	doc, ok := input.(primitive.D)
+	if !ok {
+		return missing{}, nil
+	}
+	if v, ok := bsonutil.Get(doc, field); ok {
+		return v, nil
+	}
+	return missing{}, nil
+}
+
+func isOperatorExpression(d primitive.D) bool {
+	return len(d) == 1 && len(d[0].Key) > 0 && d[0].Key[0] == '$'
+}
+
+// setDocField returns a copy of doc with field set to v,
+// field is removed if v is missing.
+func setDocField(doc primitive.D, field string, v interface{}) primitive.D {
+	var ret = make(primitive.D, 0, len(doc)+1)
+	var found bool
+	for _, i := range doc {
+		if i.Key == field {
+			found = true
+			if _, ok := v.(missing); ok {
+				continue
+			}
+			ret = append(ret, primitive.E{Key: field, Value: v})
+			continue
+		}
+		ret = append(ret, i)
+	}
+	if _, ok := v.(missing); !found && !ok {
+		ret = append(ret, primitive.E{Key: field, Value: v})
+	}
+	return ret
+}
+
+func evalSetField(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "field", "input", "value")
+	if err != nil {
+		return nil, err
+	}
+	field, err := e.fieldName(d)
+	if err != nil {
+		return nil, err
+	}
+	input, err := e.evalNamed(d, "input")
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(input) {
+		return nil, nil
+	}
+	doc, ok := input.(primitive.D)
+	if !ok {
+		return nil, errors.New("'input' must evaluate to an object")
+	}
+	v, err := e.evalNamed(d, "value")
+	if err != nil {
+		return nil, err
+	}
+	return setDocField(doc, field, v), nil
+}
+
+func evalUnsetField(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "field", "input")
+	if err != nil {
+		return nil, err
+	}
+	var args = append(primitive.D{}, d...)
+	return evalSetField(e, append(args, primitive.E{Key: "value", Value: "$$REMOVE"}))
+}
+
+func mergeObjects(values []interface{}) (interface{}, error) {
+	var ret = primitive.D{}
+	for _, i := range values {
+		if isNullish(i) {
+			continue
+		}
+		d, ok := i.(primitive.D)
+		if !ok {
+			return nil, fmt.Errorf("requires object inputs, but input is of type %s", typeName(i))
+		}
+		for _, j := range d {
+			ret = setDocField(ret, j.Key, j.Value)
+		}
+	}
+	return ret, nil
+}
+
+func evalMergeObjects(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgs(arg)
+	if err != nil {
+		return nil, err
+	}
+	return mergeObjects(args)
+}
+
+func evalBinarySize(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case string:
+		return int32(len(v)), nil
+	case primitive.Binary:
+		return int32(len(v.Data)), nil
+	}
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+	return nil, errors.New("only supports string or BinData")
+}
+
+func evalBSONSize(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+	d, ok := args[0].(primitive.D)
+	if !ok {
+		return nil, errors.New("requires a document input")
+	}
+	b, err := bson.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return int32(len(b)), nil
+}
@@ -0,0 +1,419 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	registerOperators(map[string]operatorFunc{
+		"$concat":       evalConcat,
+		"$indexOfBytes": indexOfFunc(false),
+		"$indexOfCP":    indexOfFunc(true),
+		"$ltrim":        trimFunc(true, false),
+		"$regexFind":    regexFunc(regexFind),
+		"$regexFindAll": regexFunc(regexFindAll),
+		"$regexMatch":   regexFunc(regexMatch),
+		"$replaceAll":   replaceFunc(-1),
+		"$replaceOne":   replaceFunc(1),
+		"$rtrim":        trimFunc(false, true),
+		"$split":        evalSplit,
+		"$strLenBytes":  strLenFunc(false),
+		"$strLenCP":     strLenFunc(true),
+		"$strcasecmp":   evalStrcasecmp,
+		"$substr":       substrFunc(false),
+		"$substrBytes":  substrFunc(false),
+		"$substrCP":     substrFunc(true),
+		"$toLower":      caseFunc(strings.ToLower),
+		"$toUpper":      caseFunc(strings.ToUpper),
+		"$trim":         trimFunc(true, true),
+	})
+}
+
+func requireString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case primitive.Symbol:
+		return string(v), nil
+	}
+	return "", fmt.Errorf("requires a string argument, found: %s", typeName(v))
+}
+
+func evalConcat(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgs(arg)
+	if err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, i := range args {
+		if isNullish(i) {
+			return nil, nil
+		}
+		s, err := requireString(i)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(s)
+	}
+	return b.String(), nil
+}
+
+// codePoints converts s to code points when cp is true,
+// otherwise bytes are used as is.
+func codePoints(s string, cp bool) []rune {
+	if cp {
+		return []rune(s)
+	}
+	var ret = make([]rune, len(s))
+	for index := 0; index < len(s); index++ {
+		ret[index] = rune(s[index])
+	}
+	return ret
+}
+
+func indexOfFunc(cp bool) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		args, err := e.evalArgsN(arg, 2, 4)
+		if err != nil {
+			return nil, err
+		}
+		if isNullish(args[0]) {
+			return nil, nil
+		}
+		s, err := requireString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		sub, err := requireString(args[1])
+		if err != nil {
+			return nil, err
+		}
+		var str, substr = codePoints(s, cp), codePoints(sub, cp)
+		var start, end = int64(0), int64(len(str))
+		if len(args) > 2 {
+			if start, err = requireInt(args[2]); err != nil || start < 0 {
+				return nil, errors.New("starting index must be a non-negative integer")
+			}
+		}
+		if len(args) > 3 {
+			if end, err = requireInt(args[3]); err != nil || end < 0 {
+				return nil, errors.New("ending index must be a non-negative integer")
+			}
+			if end > int64(len(str)) {
+				end = int64(len(str))
+			}
+		}
+		for i := start; i+int64(len(substr)) <= end; i++ {
+			if string(str[i:i+int64(len(substr))]) == string(substr) {
+				return int32(i), nil
+			}
+		}
+		return int32(-1), nil
+	}
+}
+
+func trimFunc(left, right bool) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		d, err := namedArgs(arg, "input", "chars")
+		if err != nil {
+			return nil, err
+		}
+		input, err := e.evalNamed(d, "input")
+		if err != nil {
+			return nil, err
+		}
+		if isNullish(input) {
+			return nil, nil
+		}
+		s, err := requireString(input)
+		if err != nil {
+			return nil, err
+		}
+		chars, err := e.evalNamed(d, "chars")
+		if err != nil {
+			return nil, err
+		}
+		var isTrimmed = func(r rune) bool {
+			return unicode.IsSpace(r) || r == 0
+		}
+		if _, ok := chars.(missing); !ok {
+			if isNullish(chars) {
+				return nil, nil
+			}
+			c, err := requireString(chars)
+			if err != nil {
+				return nil, err
+			}
+			isTrimmed = func(r rune) bool {
+				return strings.ContainsRune(c, r)
+			}
+		}
+		if left {
+			s = strings.TrimLeftFunc(s, isTrimmed)
+		}
+		if right {
+			s = strings.TrimRightFunc(s, isTrimmed)
+		}
+		return s, nil
+	}
+}
+
+type regexMatcher func(re *regexp.Regexp, input string) interface{}
+
+func regexFunc(fn regexMatcher) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		d, err := namedArgs(arg, "input", "regex", "options")
+		if err != nil {
+			return nil, err
+		}
+		input, err := e.evalNamed(d, "input")
+		if err != nil {
+			return nil, err
+		}
+		regex, err := e.evalNamed(d, "regex")
+		if err != nil {
+			return nil, err
+		}
+		options, err := e.evalNamed(d, "options")
+		if err != nil {
+			return nil, err
+		}
+		var pattern, flags string
+		switch v := regex.(type) {
+		case primitive.Regex:
+			pattern, flags = v.Pattern, v.Options
+		case string:
+			pattern = v
+		default:
+			if !isNullish(regex) {
+				return nil, errors.New("'regex' must be a string or regex")
+			}
+		}
+		if s, ok := options.(string); ok {
+			if flags != "" && s != "" {
+				return nil, errors.New("options set in both regex and options")
+			}
+			flags += s
+		}
+		if isNullish(input) || isNullish(regex) {
+			return fn(nil, ""), nil
+		}
+		s, err := requireString(input)
+		if err != nil {
+			return nil, err
+		}
+		re, err := bsonutil.Regexp(pattern, flags)
+		if err != nil {
+			return nil, err
+		}
+		return fn(re, s), nil
+	}
+}
+
+func regexMatch(re *regexp.Regexp, input string) interface{} {
+	if re == nil {
+		return false
+	}
+	return re.MatchString(input)
+}
+
+func regexResult(input string, loc []int) primitive.D {
+	var captures = primitive.A{}
+	for index := 2; index < len(loc); index += 2 {
+		if loc[index] < 0 {
+			captures = append(captures, nil)
+			continue
+		}
+		captures = append(captures, input[loc[index]:loc[index+1]])
+	}
+	return primitive.D{
+		{Key: "match", Value: input[loc[0]:loc[1]]},
+		{Key: "idx", Value: int32(utf8.RuneCountInString(input[:loc[0]]))},
+		{Key: "captures", Value: captures},
+	}
+}
+
+func regexFind(re *regexp.Regexp, input string) interface{} {
+	if re == nil {
+		return nil
+	}
+	var loc = re.FindStringSubmatchIndex(input)
+	if loc == nil {
+		return nil
+	}
+	return regexResult(input, loc)
+}
+
+func regexFindAll(re *regexp.Regexp, input string) interface{} {
+	var ret = primitive.A{}
+	if re == nil {
+		return ret
+	}
+	for _, loc := range re.FindAllStringSubmatchIndex(input, -1) {
+		ret = append(ret, regexResult(input, loc))
+	}
+	return ret
+}
+
+func replaceFunc(n int) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		d, err := namedArgs(arg, "input", "find", "replacement")
+		if err != nil {
+			return nil, err
+		}
+		var values = make([]string, 0, 3)
+		var isNull bool
+		for _, k := range []string{"input", "find", "replacement"} {
+			v, err := e.evalNamed(d, k)
+			if err != nil {
+				return nil, err
+			}
+			if isNullish(v) {
+				isNull = true
+				continue
+			}
+			s, err := requireString(v)
+			if err != nil {
+				return nil, fmt.Errorf("'%s': %w", k, err)
+			}
+			values = append(values, s)
+		}
+		if isNull {
+			return nil, nil
+		}
+		return strings.Replace(values[0], values[1], values[2], n), nil
+	}
+}
+
+func evalSplit(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(args[0]) {
+		return nil, nil
+	}
+	s, err := requireString(args[0])
+	if err != nil {
+		return nil, err
+	}
+	sep, err := requireString(args[1])
+	if err != nil {
+		return nil, err
+	}
+	if sep == "" {
+		return nil, errors.New("requires a non-empty separator")
+	}
+	var ret = primitive.A{}
+	for _, i := range strings.Split(s, sep) {
+		ret = append(ret, i)
+	}
+	return ret, nil
+}
+
+func strLenFunc(cp bool) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		args, err := e.evalArgsN(arg, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		s, err := requireString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if cp {
+			return int32(utf8.RuneCountInString(s)), nil
+		}
+		return int32(len(s)), nil
+	}
+}
+
+func evalStrcasecmp(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 2, 2)
+	if err != nil {
+		return nil, err
+	}
+	var s = make([]string, 2)
+	for index, i := range args {
+		if isNullish(i) {
+			continue
+		}
+		s[index], err = toString(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return int32(strings.Compare(strings.ToUpper(s[0]), strings.ToUpper(s[1]))), nil
+}
+
+func substrFunc(cp bool) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		args, err := e.evalArgsN(arg, 3, 3)
+		if err != nil {
+			return nil, err
+		}
+		var s string
+		if !isNullish(args[0]) {
+			s, err = toString(args[0])
+			if err != nil {
+				return nil, err
+			}
+		}
+		start, err := requireInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		length, err := requireInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+		var str = codePoints(s, cp)
+		var size = int64(len(str))
+		if start < 0 {
+			if cp {
+				return nil, errors.New("starting index must be non-negative")
+			}
+			return "", nil
+		}
+		if start > size {
+			start = size
+		}
+		var end = size
+		if length >= 0 && start+length < size {
+			end = start + length
+		}
+		if cp {
+			return string(str[start:end]), nil
+		}
+		var ret = s[start:end]
+		if !utf8.ValidString(ret) {
+			return nil, errors.New("invalid range, starting or ending index is a UTF-8 continuation byte")
+		}
+		return ret, nil
+	}
+}
+
+func caseFunc(fn func(string) string) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		args, err := e.evalArgsN(arg, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		if isNullish(args[0]) {
+			return "", nil
+		}
+		s, err := toString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(s), nil
+	}
+}
@@ -0,0 +1,290 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	registerOperators(map[string]operatorFunc{
+		"$convert":    evalConvert,
+		"$isNumber":   evalIsNumber,
+		"$toBool":     toTypeFunc(bsontype.Boolean),
+		"$toDate":     toTypeFunc(bsontype.DateTime),
+		"$toDecimal":  toTypeFunc(bsontype.Decimal128),
+		"$toDouble":   toTypeFunc(bsontype.Double),
+		"$toInt":      toTypeFunc(bsontype.Int32),
+		"$toLong":     toTypeFunc(bsontype.Int64),
+		"$toObjectId": toTypeFunc(bsontype.ObjectID),
+		"$toString":   toTypeFunc(bsontype.String),
+		"$type":       evalType,
+	})
+}
+
+const isoDateLayout = "2006-01-02T15:04:05.000Z"
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// toString converts v like $toString.
+func toString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case primitive.Symbol:
+		return string(v), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return formatFloat(v), nil
+	case primitive.Decimal128:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case primitive.ObjectID:
+		return v.Hex(), nil
+	case primitive.DateTime:
+		return v.Time().UTC().Format(isoDateLayout), nil
+	}
+	return "", fmt.Errorf("unsupported conversion from %s to string", typeName(v))
+}
+
+func floatToInt(f float64, min, max float64) (int64, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("attempt to convert %s value to integer", formatFloat(f))
+	}
+	f = math.Trunc(f)
+	if f < min || f > max {
+		return 0, fmt.Errorf("conversion would overflow target type: %s", formatFloat(f))
+	}
+	return int64(f), nil
+}
+
+func toInteger(v interface{}, min, max int64) (int64, error) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		if v < min || v > max {
+			return 0, fmt.Errorf("conversion would overflow target type: %d", v)
+		}
+		return v, nil
+	case float64:
+		return floatToInt(v, float64(min), float64(max))
+	case primitive.Decimal128:
+		f, _ := bsonutil.Float64(v)
+		return floatToInt(f, float64(min), float64(max))
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("failed to parse number '%s' in $convert", v)
+		}
+		return n, nil
+	case primitive.DateTime:
+		if max == math.MaxInt64 {
+			return int64(v), nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported conversion from %s to integer", typeName(v))
+}
+
+func parseDate(s string) (primitive.DateTime, error) {
+	for _, layout := range dateStringLayouts {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return fromTime(t), nil
+		}
+	}
+	return 0, fmt.Errorf("error parsing date string '%s'", s)
+}
+
+// convert converts v to bson type t, v must not be nullish.
+func convert(v interface{}, t bsontype.Type) (interface{}, error) {
+	switch t {
+	case bsontype.Boolean:
+		switch v := v.(type) {
+		case bool:
+			return v, nil
+		case int32, int64, float64, primitive.Decimal128:
+			return bsonutil.Truthy(v), nil
+		case string, primitive.ObjectID, primitive.DateTime:
+			return true, nil
+		}
+	case bsontype.Int32:
+		n, err := toInteger(v, math.MinInt32, math.MaxInt32)
+		return int32(n), err
+	case bsontype.Int64:
+		return toInteger(v, math.MinInt64, math.MaxInt64)
+	case bsontype.Double:
+		switch v := v.(type) {
+		case bool:
+			if v {
+				return float64(1), nil
+			}
+			return float64(0), nil
+		case int32, int64, float64, primitive.Decimal128:
+			f, _ := bsonutil.Float64(v)
+			return f, nil
+		case string:
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse number '%s' in $convert", v)
+			}
+			return f, nil
+		case primitive.DateTime:
+			return float64(v), nil
+		}
+	case bsontype.Decimal128:
+		switch v := v.(type) {
+		case bool:
+			if v {
+				return primitive.NewDecimal128(0, 1), nil
+			}
+			return primitive.NewDecimal128(0, 0), nil
+		case int32, int64, float64:
+			s, _ := toString(v)
+			return primitive.ParseDecimal128(s)
+		case primitive.Decimal128:
+			return v, nil
+		case string:
+			d, err := primitive.ParseDecimal128(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse number '%s' in $convert", v)
+			}
+			return d, nil
+		case primitive.DateTime:
+			return primitive.ParseDecimal128(strconv.FormatInt(int64(v), 10))
+		}
+	case bsontype.String:
+		return toString(v)
+	case bsontype.ObjectID:
+		switch v := v.(type) {
+		case primitive.ObjectID:
+			return v, nil
+		case string:
+			id, err := primitive.ObjectIDFromHex(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse objectId '%s' in $convert", v)
+			}
+			return id, nil
+		}
+	case bsontype.DateTime:
+		switch v := v.(type) {
+		case primitive.DateTime:
+			return v, nil
+		case int64:
+			return primitive.DateTime(v), nil
+		case float64, primitive.Decimal128:
+			n, err := toInteger(v, math.MinInt64, math.MaxInt64)
+			return primitive.DateTime(n), err
+		case string:
+			return parseDate(v)
+		case primitive.ObjectID:
+			return primitive.NewDateTimeFromTime(v.Timestamp()), nil
+		case primitive.Timestamp:
+			return primitive.DateTime(int64(v.T) * 1000), nil
+		}
+	}
+	return nil, fmt.Errorf("unsupported conversion from %s to %s", typeName(v), bsonutil.TypeAlias(t))
+}
+
+func toTypeFunc(t bsontype.Type) operatorFunc {
+	return func(e *evaluator, arg interface{}) (interface{}, error) {
+		args, err := e.evalArgsN(arg, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		if isNullish(args[0]) {
+			return nil, nil
+		}
+		return convert(args[0], t)
+	}
+}
+
+func convertTarget(v interface{}) (bsontype.Type, error) {
+	if s, ok := v.(string); ok {
+		if t, ok := bsonutil.TypeFromAlias(s); ok {
+			return t, nil
+		}
+		return 0, fmt.Errorf("unknown type name: %s", s)
+	}
+	if n, err := requireInt(v); err == nil {
+		return bsontype.Type(n), nil
+	}
+	return 0, errors.New("'to' must be a string or number")
+}
+
+func evalConvert(e *evaluator, arg interface{}) (interface{}, error) {
+	d, err := namedArgs(arg, "input", "to", "onError", "onNull")
+	if err != nil {
+		return nil, err
+	}
+	input, err := e.evalNamed(d, "input")
+	if err != nil {
+		return nil, err
+	}
+	to, err := e.evalNamed(d, "to")
+	if err != nil {
+		return nil, err
+	}
+	if isNullish(input) {
+		if _, ok := bsonutil.Get(d, "onNull"); ok {
+			return e.evalNamed(d, "onNull")
+		}
+		return nil, nil
+	}
+	if isNullish(to) {
+		return nil, nil
+	}
+	t, err := convertTarget(to)
+	if err != nil {
+		return nil, err
+	}
+	v, err := convert(input, t)
+	if err != nil {
+		if _, ok := bsonutil.Get(d, "onError"); ok {
+			return e.evalNamed(d, "onError")
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+func evalIsNumber(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return bsonutil.IsNumber(args[0]), nil
+}
+
+func evalType(e *evaluator, arg interface{}) (interface{}, error) {
+	args, err := e.evalArgsN(arg, 1, 1)
+	if err != nil {
+		return nil, err
+	}
+	return typeName(args[0]), nil
+}
@@ -0,0 +1,88 @@
+package aggregation
+
+// RankFusionInput is a ranked result set combined by ReciprocalRankFusion.
+type RankFusionInput struct {
+	// Pipeline outputs documents in rank order,
+	// e.g. A{VectorSearch(...)} or A{Search(...), Limit(20)}.
+	Pipeline A
+	// ScoreField receives weighted reciprocal rank of the document in this input,
+	// 0 when the document is not returned by this input.
+	ScoreField string
+	// Weight of this input, 0 is treated as 1.
+	Weight float64
+}
+
+// rankFusionScore is the reciprocal rank expression of a 0-based rank,
+// weight / (rank + k + 1).
+func rankFusionScore(rank interface{}, k int, weight float64) M {
+	if weight == 0 {
+		weight = 1
+	}
+	return Divide(weight, Add(rank, k+1))
+}
+
+// rankFusionStages outputs {_id, doc, <input.ScoreField>} for each document of input.
+func rankFusionStages(input RankFusionInput, k int) A {
+	var ret = make(A, 0, len(input.Pipeline)+3)
+	ret = append(ret, input.Pipeline...)
+	return append(ret,
+		Group(D{{Key: "_id", Value: nil}, {Key: "docs", Value: Push("$$ROOT")}}),
+		Unwind("docs").SetIncludeArrayIndex("rank"),
+		Project(D{
+			{Key: "_id", Value: "$docs._id"},
+			{Key: "doc", Value: "$docs"},
+			{Key: input.ScoreField, Value: rankFusionScore("$rank", k, input.Weight)},
+		}),
+	)
+}
+
+// ReciprocalRankFusion combines ranked results of inputs into one result set
+// sorted by scoreField in descending order.
+// The first input runs on the aggregated collection, others run on collection
+// with $unionWith, so collection is usually the aggregated collection.
+// Documents are grouped by _id, scoreField is sum of
+// Weight / (rank + k + 1) of each input, k is usually 60.
+// Each input pushes all of its documents into one group to compute rank,
+// so limit number of documents returned from each input pipeline.
+// https://www.mongodb.com/docs/atlas/atlas-vector-search/tutorials/reciprocal-rank-fusion/
+func ReciprocalRankFusion(collection, scoreField string, k int, inputs ...RankFusionInput) A {
+	if len(inputs) == 0 {
+		return A{}
+	}
+	var ret = rankFusionStages(inputs[0], k)
+	for _, i := range inputs[1:] {
+		ret = append(ret, UnionWith(collection, rankFusionStages(i, k)))
+	}
+	var group = D{
+		{Key: "_id", Value: "$_id"},
+		{Key: "doc", Value: First("$doc")},
+	}
+	var fields = D{}
+	var scores = make([]interface{}, 0, len(inputs))
+	for _, i := range inputs {
+		var ref = Field(i.ScoreField).Ref()
+		group = append(group, E{Key: i.ScoreField, Value: Max(ref)})
+		fields = append(fields, E{Key: i.ScoreField, Value: IfNull(ref, 0)})
+		scores = append(scores, IfNull(ref, 0))
+	}
+	fields = append(fields, E{Key: scoreField, Value: Add(scores...)})
+	return append(ret,
+		Group(group),
+		ReplaceWith(MergeObjects("$doc", fields)),
+		Sort(Desc(Field(scoreField)).Asc("_id")),
+	)
+}
+
+// HybridSearch combines results of a $vectorSearch stage and a $search query
+// with ReciprocalRankFusion, and returns top limit documents.
+// Output documents have "vectorScore", "searchScore" and combined "score" fields.
+// collection is the aggregated collection, search is argument of Search.
+func HybridSearch(collection string, vectorSearch VectorSearchStage, search interface{}, limit int) A {
+	return append(
+		ReciprocalRankFusion(collection, "score", 60,
+			RankFusionInput{Pipeline: A{vectorSearch}, ScoreField: "vectorScore"},
+			RankFusionInput{Pipeline: A{Search(search), Limit(limit)}, ScoreField: "searchScore"},
+		),
+		Limit(limit),
+	)
+}
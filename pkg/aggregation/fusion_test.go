@@ -0,0 +1,49 @@
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestReciprocalRankFusion(t *testing.T) {
+	var docs = runPipeline(t, ReciprocalRankFusion("orders", "score", 60, RankFusionInput{
+		Pipeline:   A{Sort(Desc("price")), Limit(3)},
+		ScoreField: "priceScore",
+		Weight:     2,
+	}), testOrders...)
+	var ids, scores []interface{}
+	for _, i := range docs {
+		ids = append(ids, i.Map()["_id"])
+		scores = append(scores, i.Map()["score"])
+		assert.Equal(t, i.Map()["priceScore"], i.Map()["score"])
+	}
+	assert.Equal(t, []interface{}{int32(2), int32(1), int32(3)}, ids)
+	assert.Equal(t, []interface{}{2.0 / 61, 2.0 / 62, 2.0 / 63}, scores)
+	assert.Equal(t, "jkl", docs[0].Map()["item"])
+
+	assert.Equal(t, A{}, ReciprocalRankFusion("orders", "score", 60))
+}
+
+func TestHybridSearch(t *testing.T) {
+	var vs = VectorSearch("vector_index", "embedding", A{0.1, 0.2}, 10).SetNumCandidates(100)
+	var pipeline = HybridSearch("movies", vs, M{"text": M{"path": "title", "query": "mongo"}}, 10)
+	assert.Empty(t, Validate(pipeline))
+	version, err := MinServerVersion(pipeline)
+	require.NoError(t, err)
+	assert.Equal(t, Version("6.0.11"), version)
+	assert.Equal(t, vs, pipeline[0])
+	var union, ok = pipeline[4].(M)["$unionWith"].(M)
+	if assert.True(t, ok) {
+		assert.Equal(t, "movies", union["coll"])
+		assert.Equal(t, A{
+			Search(M{"text": M{"path": "title", "query": "mongo"}}),
+			Limit(10),
+		}, union["pipeline"].(A)[:2])
+	}
+	assert.Equal(t, Limit(10), pipeline[len(pipeline)-1])
+	_, err = bson.Marshal(bson.M{"pipeline": pipeline})
+	assert.NoError(t, err)
+}
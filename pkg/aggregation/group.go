@@ -22,6 +22,21 @@ func Avg(expr ...interface{}) M {
 	return M{"$avg": expr}
 }
 
+// Bottom returns the bottom element within a group according to sortBy.
+// New in version 5.2.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/bottom/
+func Bottom(sortBy SortSpec, output interface{}) M {
+	return M{"$bottom": M{"sortBy": sortBy, "output": output}}
+}
+
+// BottomN returns an aggregation of the bottom n elements within a group
+// according to sortBy, in sort order.
+// New in version 5.2.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/bottomN/
+func BottomN(n int, sortBy SortSpec, output interface{}) M {
+	return M{"$bottomN": M{"n": n, "sortBy": sortBy, "output": output}}
+}
+
 // First returns the value that results from applying an expression
 // to the first document in a group of documents that share the same group by key.
 // Only meaningful when documents are in a defined order.
@@ -31,6 +46,14 @@ func First(expr interface{}) M {
 	return M{"$first": expr}
 }
 
+// FirstN returns an aggregation of the first n elements within a group,
+// or the first n elements of an input array when used as expression.
+// New in version 5.2.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/firstN/
+func FirstN(input interface{}, n int) M {
+	return M{"$firstN": M{"input": input, "n": n}}
+}
+
 // Last returns the value that results from applying an expression
 // to the last document in a group of documents that share the same group by key.
 // Only meaningful when documents are in a defined order.
@@ -40,6 +63,14 @@ func Last(expr interface{}) M {
 	return M{"$last": expr}
 }
 
+// LastN returns an aggregation of the last n elements within a group,
+// or the last n elements of an input array when used as expression.
+// New in version 5.2.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/lastN/
+func LastN(input interface{}, n int) M {
+	return M{"$lastN": M{"input": input, "n": n}}
+}
+
 // Max returns the maximum value. $max compares both value and type,
 // using the specified BSON comparison order for values of different types.
 // In MongoDB 3.2 and earlier, $max is available in the $group stage only.
@@ -51,6 +82,24 @@ func Max(expr ...interface{}) M {
 	return M{"$max": expr}
 }
 
+// MaxN returns an aggregation of the maximum value n elements within a group,
+// or of an input array when used as expression.
+// Null and missing values are ignored.
+// New in version 5.2.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/maxN/
+func MaxN(input interface{}, n int) M {
+	return M{"$maxN": M{"input": input, "n": n}}
+}
+
+// Median returns an approximation of the median, the 50th percentile,
+// as a scalar value.
+// Available as accumulator, in $setWindowFields and as expression.
+// New in version 7.0.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/median/
+func Median(input interface{}, method PercentileMethod) M {
+	return M{"$median": M{"input": input, "method": method}}
+}
+
 // MergeObjects combines multiple documents into a single document.
 // New in version 3.6.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/mergeObjects/
@@ -72,6 +121,35 @@ func Min(expr ...interface{}) M {
 	return M{"$min": expr}
 }
 
+// MinN returns an aggregation of the minimum value n elements within a group,
+// or of an input array when used as expression.
+// Null and missing values are ignored.
+// New in version 5.2.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/minN/
+func MinN(input interface{}, n int) M {
+	return M{"$minN": M{"input": input, "n": n}}
+}
+
+// PercentileMethod is method of $percentile and $median.
+type PercentileMethod string
+
+const (
+	// PercentileApproximate uses t-digest algorithm, the only method supported by 7.0.
+	PercentileApproximate PercentileMethod = "approximate"
+)
+
+// Percentile returns an array of scalar values that correspond to
+// specified percentile values, e.g. p50, p95 and p99 of latency:
+//
+//	Percentile("$latency", A{0.5, 0.95, 0.99}, PercentileApproximate)
+//
+// Available as accumulator, in $setWindowFields and as expression.
+// New in version 7.0.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/percentile/
+func Percentile(input, p interface{}, method PercentileMethod) M {
+	return M{"$percentile": M{"input": input, "p": p, "method": method}}
+}
+
 // Push Returns an array of all values that result from applying an expression
 // to each document in a group of documents that share the same group by key.
 // $push is only available in the $group stage.
@@ -110,3 +188,21 @@ func Sum(expr ...interface{}) M {
 	}
 	return M{"$sum": expr}
 }
+
+// Top returns the top element within a group according to sortBy.
+// New in version 5.2.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/top/
+func Top(sortBy SortSpec, output interface{}) M {
+	return M{"$top": M{"sortBy": sortBy, "output": output}}
+}
+
+// TopN returns an aggregation of the top n elements within a group
+// according to sortBy, e.g. top 3 orders per customer:
+//
+//	Group(M{"_id": "$customer", "orders": TopN(3, Desc("total"), "$_id")})
+//
+// New in version 5.2.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/topN/
+func TopN(n int, sortBy SortSpec, output interface{}) M {
+	return M{"$topN": M{"n": n, "sortBy": sortBy, "output": output}}
+}
@@ -0,0 +1,100 @@
+package aggregation
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Iterator iterates over a sequence of documents.
+// *mongo.Cursor implements it.
+type Iterator interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+}
+
+type sliceIterator struct {
+	docs  []interface{}
+	index int
+	err   error
+}
+
+// Documents returns an Iterator over docs,
+// doc can be anything marshals to a bson document.
+func Documents(docs ...interface{}) Iterator {
+	return &sliceIterator{docs: docs, index: -1}
+}
+
+func (it *sliceIterator) Next(ctx context.Context) bool {
+	if it.err != nil {
+		return false
+	}
+	if err := ctx.Err(); err != nil {
+		it.err = err
+		return false
+	}
+	if it.index+1 >= len(it.docs) {
+		return false
+	}
+	it.index++
+	return true
+}
+
+func (it *sliceIterator) Decode(val interface{}) error {
+	if it.index < 0 || it.index >= len(it.docs) {
+		return errors.New("aggregation: Decode called without a current document")
+	}
+	b, err := bson.Marshal(it.docs[it.index])
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(b, val)
+}
+
+func (it *sliceIterator) Err() error {
+	return it.err
+}
+
+// All decodes every remaining document of it into results,
+// results must be a pointer to a slice.
+func All(ctx context.Context, it Iterator, results interface{}) error {
+	var v = reflect.ValueOf(results)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return errors.New("aggregation: results argument must be a pointer to a slice")
+	}
+	var slice = v.Elem()
+	var elemType = slice.Type().Elem()
+	slice.Set(slice.Slice(0, 0))
+	for it.Next(ctx) {
+		var elem = reflect.New(elemType)
+		if err := it.Decode(elem.Interface()); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	return it.Err()
+}
+
+func readAll(ctx context.Context, it Iterator) ([]primitive.D, error) {
+	var ret []primitive.D
+	for it.Next(ctx) {
+		var d primitive.D
+		if err := it.Decode(&d); err != nil {
+			return nil, err
+		}
+		ret = append(ret, d)
+	}
+	return ret, it.Err()
+}
+
+func iterate(docs []primitive.D) Iterator {
+	var ret = make([]interface{}, len(docs))
+	for index, i := range docs {
+		ret[index] = i
+	}
+	return Documents(ret...)
+}
@@ -5,9 +5,11 @@ package aggregation
 // GetField returns the value of a specified field from a document.
 // You can use $getField to retrieve the value of fields with names
 // that contain periods (.) or start with dollar signs ($).
+// field is a string or an expression that resolves to a string,
+// e.g. Literal("$price") for name starts with "$".
 // New in version 5.0.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/getField/
-func GetField(field string, inputExpr interface{}) M {
+func GetField(field interface{}, inputExpr interface{}) M {
 	return M{
 		"$getField": M{
 			"field": field,
@@ -1,9 +1,10 @@
 package aggregation
 
 // SetField adds, updates, or removes a specified field in a document.
+// field is same as GetField.
 // New in version 5.0.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/setField/
-func SetField(field string, inputExpr interface{}, valueExpr interface{}) M {
+func SetField(field interface{}, inputExpr interface{}, valueExpr interface{}) M {
 	return M{
 		"$setField": M{
 			"field": field,
@@ -14,9 +15,10 @@ func SetField(field string, inputExpr interface{}, valueExpr interface{}) M {
 }
 
 // UnsetField removes a specified field in a document.
+// field is same as GetField.
 // New in version 5.0.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/unsetField/
-func UnsetField(field string, inputExpr interface{}) M {
+func UnsetField(field interface{}, inputExpr interface{}) M {
 	return M{
 		"$unsetField": M{
 			"field": field,
@@ -0,0 +1,336 @@
+package aggregation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rewrite is a change made by Optimize.
+type Rewrite struct {
+	// Stage is index of the first affected stage,
+	// in the pipeline when the rewrite is applied.
+	Stage int
+	// Rule describes the rewrite, e.g. "merge adjacent $match".
+	Rule string
+}
+
+func (r Rewrite) String() string {
+	return fmt.Sprintf("stage %d: %s", r.Stage, r.Rule)
+}
+
+// Optimize applies safe rewrites to pipeline, like server does
+// before execution, so it is shown as expected in explain output.
+// See OptimizeWithReport for rewrites.
+func Optimize(pipeline A) A {
+	ret, _ := OptimizeWithReport(pipeline)
+	return ret
+}
+
+// OptimizeWithReport is like Optimize, also returns applied rewrites in order:
+//
+//   - merge adjacent $match with query.AndFilters, and remove empty $match
+//   - move $match before $sort, and before $addFields, $set, $project or $unset
+//     when fields used in filter are not changed by that stage
+//   - merge adjacent $skip, adjacent $limit and adjacent $unset
+//   - move $limit before $skip, e.g. $skip 10, $limit 5 becomes $limit 15, $skip 10
+//
+// $match that uses $expr, $where or $text is never moved.
+// Sub-pipelines are kept as is, and pipeline is not modified.
+func OptimizeWithReport(pipeline A) (A, []Rewrite) {
+	var o = new(optimizer)
+	for _, i := range pipeline {
+		o.stages = append(o.stages, newOptimizerStage(i))
+	}
+	for o.step() {
+	}
+	var ret = make(A, len(o.stages))
+	for index, i := range o.stages {
+		ret[index] = i.value
+	}
+	return ret, o.rewrites
+}
+
+type optimizerStage struct {
+	// name is empty when stage is not recognized.
+	name string
+	// arg is normalized stage argument.
+	arg interface{}
+	// raw is stage argument as is.
+	raw   interface{}
+	value interface{}
+}
+
+func newOptimizerStage(v interface{}) optimizerStage {
+	var ret = optimizerStage{value: v}
+	switch s := v.(type) {
+	case M:
+		for k, v := range s {
+			ret.name, ret.raw = k, v
+		}
+		if len(s) != 1 {
+			ret.name = ""
+		}
+	case D:
+		if len(s) == 1 {
+			ret.name, ret.raw = s[0].Key, s[0].Value
+		}
+	default:
+		if d, err := bsonutil.Doc(v); err == nil && len(d) == 1 {
+			ret.name, ret.raw = d[0].Key, d[0].Value
+		}
+	}
+	var err error
+	ret.arg, err = bsonutil.Normalize(ret.raw)
+	if err != nil {
+		ret.name = ""
+	}
+	return ret
+}
+
+type optimizer struct {
+	stages   []optimizerStage
+	rewrites []Rewrite
+}
+
+// step applies first possible rewrite, returns false when nothing changed.
+func (o *optimizer) step() bool {
+	for index, s := range o.stages {
+		if s.name == "$match" {
+			if d, ok := s.arg.(primitive.D); ok && len(d) == 0 {
+				o.replace(index, 1, "remove empty $match")
+				return true
+			}
+		}
+		if index == 0 {
+			continue
+		}
+		var prev = o.stages[index-1]
+		switch {
+		case prev.name == "$match" && s.name == "$match":
+			o.replace(index-1, 2, "merge adjacent $match", Match(mergeFilters(prev.raw, s.raw)))
+		case prev.name == "$skip" && s.name == "$skip":
+			var a, b = stageInt(prev), stageInt(s)
+			if a < 0 || b < 0 {
+				continue
+			}
+			o.replace(index-1, 2, "merge adjacent $skip", Skip(a+b))
+		case prev.name == "$limit" && s.name == "$limit":
+			var a, b = stageInt(prev), stageInt(s)
+			if a < 0 || b < 0 {
+				continue
+			}
+			if b < a {
+				a = b
+			}
+			o.replace(index-1, 2, "merge adjacent $limit", Limit(a))
+		case prev.name == "$skip" && s.name == "$limit":
+			var a, b = stageInt(prev), stageInt(s)
+			if a < 0 || b < 0 {
+				continue
+			}
+			o.replace(index-1, 2, "move $limit before $skip", Limit(a+b), prev.value)
+		case prev.name == "$unset" && s.name == "$unset":
+			var fields = append(unsetFields(prev.arg), unsetFields(s.arg)...)
+			o.replace(index-1, 2, "merge adjacent $unset", Unset(unsetPaths(fields)...))
+		case s.name == "$match" && matchCanMoveBefore(s.arg, prev):
+			o.replace(index-1, 2, "move $match before "+prev.name, s.value, prev.value)
+		default:
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// replace n stages from index with values.
+func (o *optimizer) replace(index, n int, rule string, values ...interface{}) {
+	o.rewrites = append(o.rewrites, Rewrite{Stage: index, Rule: rule})
+	var stages = make([]optimizerStage, 0, len(o.stages)-n+len(values))
+	stages = append(stages, o.stages[:index]...)
+	for _, i := range values {
+		stages = append(stages, newOptimizerStage(i))
+	}
+	o.stages = append(stages, o.stages[index+n:]...)
+}
+
+// stageInt returns integral argument of stage, or -1 if not an integer.
+func stageInt(s optimizerStage) int {
+	n, err := requireInt(s.arg)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return int(n)
+}
+
+func mergeFilters(a, b interface{}) interface{} {
+	m1, ok1 := a.(M)
+	m2, ok2 := b.(M)
+	if ok1 && ok2 {
+		return query.AndFilters(m1, m2)
+	}
+	return M{"$and": A{a, b}}
+}
+
+func unsetFields(arg interface{}) []Path {
+	switch v := arg.(type) {
+	case string:
+		return []Path{Path(v)}
+	case primitive.A:
+		var ret = make([]Path, 0, len(v))
+		for _, i := range v {
+			if s, ok := i.(string); ok {
+				ret = append(ret, Path(s))
+			}
+		}
+		return ret
+	}
+	return nil
+}
+
+// unsetPaths removes duplicated paths and paths inside another path of l,
+// since server rejects $unset with colliding paths.
+func unsetPaths(l []Path) []Path {
+	var ret = make([]Path, 0, len(l))
+	for index, i := range l {
+		var redundant = false
+		for j, other := range l {
+			if other == i && j < index || strings.HasPrefix(string(i), string(other)+".") {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// matchCanMoveBefore reports whether $match with filter
+// returns same result when executed before stage.
+func matchCanMoveBefore(filter interface{}, stage optimizerStage) bool {
+	d, ok := filter.(primitive.D)
+	if !ok {
+		return false
+	}
+	paths, ok := filterPaths(d)
+	if !ok {
+		return false
+	}
+	switch stage.name {
+	case "$sort":
+		return true
+	case "$addFields", "$set":
+		fields, ok := stage.arg.(primitive.D)
+		if !ok {
+			return false
+		}
+		for _, i := range fields {
+			if pathsConflict(paths, i.Key) {
+				return false
+			}
+		}
+		return true
+	case "$unset":
+		for _, i := range unsetFields(stage.arg) {
+			if pathsConflict(paths, i.String()) {
+				return false
+			}
+		}
+		return true
+	case "$project":
+		spec, ok := stage.arg.(primitive.D)
+		return ok && projectKeeps(spec, paths)
+	}
+	return false
+}
+
+// filterPaths returns field paths used in filter,
+// ok is false when filter may use fields that can not be determined.
+func filterPaths(filter primitive.D) (paths []string, ok bool) {
+	for _, e := range filter {
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			l, ok := e.Value.(primitive.A)
+			if !ok {
+				return nil, false
+			}
+			for _, i := range l {
+				d, ok := i.(primitive.D)
+				if !ok {
+					return nil, false
+				}
+				p, ok := filterPaths(d)
+				if !ok {
+					return nil, false
+				}
+				paths = append(paths, p...)
+			}
+		case "$comment":
+		default:
+			if strings.HasPrefix(e.Key, "$") {
+				return nil, false
+			}
+			paths = append(paths, e.Key)
+		}
+	}
+	return paths, true
+}
+
+func isSubPath(path, parent string) bool {
+	return path == parent || strings.HasPrefix(path, parent+".")
+}
+
+func pathsConflict(paths []string, field string) bool {
+	for _, i := range paths {
+		if isSubPath(i, field) || isSubPath(field, i) {
+			return true
+		}
+	}
+	return false
+}
+
+// projectKeeps reports whether value of paths are same
+// before and after $project with spec.
+func projectKeeps(spec primitive.D, paths []string) bool {
+	var included, others []string
+	var exclusion = true
+	for _, e := range spec {
+		switch v := e.Value.(type) {
+		case bool, int32, int64, float64:
+			if bsonutil.Truthy(v) {
+				included = append(included, e.Key)
+				exclusion = exclusion && e.Key == "_id" && len(spec) > 1
+				continue
+			}
+		default:
+			exclusion = false
+		}
+		others = append(others, e.Key)
+	}
+	if exclusion {
+		for _, i := range others {
+			if pathsConflict(paths, i) {
+				return false
+			}
+		}
+		return true
+	}
+	if _, ok := bsonutil.Get(spec, "_id"); !ok {
+		included = append(included, "_id")
+	}
+	for _, p := range paths {
+		var kept bool
+		for _, i := range included {
+			kept = kept || isSubPath(p, i)
+		}
+		if !kept || pathsConflict(others, p) {
+			return false
+		}
+	}
+	return true
+}
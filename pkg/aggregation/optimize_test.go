@@ -0,0 +1,108 @@
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptimize(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		pipeline A
+		want     A
+		rewrites []string
+	}{
+		{
+			"match",
+			A{Match(M{"price": M{"$gt": 5}}), Match(M{"price": M{"$lt": 20}}), Match(M{})},
+			A{Match(M{"price": M{"$gt": 5, "$lt": 20}})},
+			[]string{"stage 0: merge adjacent $match", "stage 1: remove empty $match"},
+		},
+		{
+			"skip limit",
+			A{Skip(1), Skip(1), Limit(3), Limit(2)},
+			A{Limit(4), Skip(2)},
+			[]string{
+				"stage 0: merge adjacent $skip",
+				"stage 0: move $limit before $skip",
+				"stage 1: move $limit before $skip",
+				"stage 0: merge adjacent $limit",
+			},
+		},
+		{
+			"unset",
+			A{Unset("tags"), Unset("qty", "tags")},
+			A{Unset("tags", "qty")},
+			[]string{"stage 0: merge adjacent $unset"},
+		},
+		{
+			"unset colliding paths",
+			A{Unset("tags.x"), Unset("tags", "qty"), Unset("tags.y", "tags-x")},
+			A{Unset("tags", "qty", "tags-x")},
+			[]string{"stage 0: merge adjacent $unset", "stage 0: merge adjacent $unset"},
+		},
+		{
+			"move match",
+			A{
+				Sort(Asc("price")),
+				AddFields(M{"total": Multiply("$price", "$qty")}),
+				Project(M{"item": 1, "price": 1, "total": 1}),
+				Unset("total"),
+				Match(M{"item": "abc", "$or": A{M{"price": M{"$gt": 5}}, M{"_id": 4}}}),
+			},
+			A{
+				Match(M{"item": "abc", "$or": A{M{"price": M{"$gt": 5}}, M{"_id": 4}}}),
+				Sort(Asc("price")),
+				AddFields(M{"total": Multiply("$price", "$qty")}),
+				Project(M{"item": 1, "price": 1, "total": 1}),
+				Unset("total"),
+			},
+			[]string{
+				"stage 3: move $match before $unset",
+				"stage 2: move $match before $project",
+				"stage 1: move $match before $addFields",
+				"stage 0: move $match before $sort",
+			},
+		},
+		{
+			"blocked match",
+			A{
+				AddFields(M{"total": Multiply("$price", "$qty")}),
+				Match(M{"total": M{"$gt": 20}}),
+				Project(M{"item": 1, "qty": "$price"}),
+				Match(M{"qty": 10}),
+				Project(M{"_id": 0, "item": 1}),
+				Match(M{"_id": 1}),
+				Limit(1),
+				Match(M{"item": "abc"}),
+				Set(M{"x": 1}),
+				Match(M{"$expr": Eq("$x", 1)}),
+			},
+			A{
+				AddFields(M{"total": Multiply("$price", "$qty")}),
+				Match(M{"total": M{"$gt": 20}}),
+				Project(M{"item": 1, "qty": "$price"}),
+				Match(M{"qty": 10}),
+				Project(M{"_id": 0, "item": 1}),
+				Match(M{"_id": 1}),
+				Limit(1),
+				Match(M{"item": "abc"}),
+				Set(M{"x": 1}),
+				Match(M{"$expr": Eq("$x", 1)}),
+			},
+			nil,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			res, rewrites := OptimizeWithReport(c.pipeline)
+			assert.Equal(t, c.want, res)
+			var s []string
+			for _, i := range rewrites {
+				s = append(s, i.String())
+			}
+			assert.Equal(t, c.rewrites, s)
+			assert.Equal(t, runPipeline(t, c.pipeline, testOrders...), runPipeline(t, res, testOrders...))
+		})
+	}
+}
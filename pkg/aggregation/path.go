@@ -0,0 +1,18 @@
+package aggregation
+
+import "github.com/NateScarlet/mongo-operators/pkg/query"
+
+// Path alias query.Path
+type Path = query.Path
+
+// Field creates a path from field names.
+func Field(name ...string) Path {
+	return query.Field(name...)
+}
+
+// Var returns path of an aggregation variable,
+// Var("this") references "$$this".
+// https://docs.mongodb.com/manual/reference/aggregation-variables/
+func Var(name string) Path {
+	return query.Var(name)
+}
@@ -0,0 +1,554 @@
+package aggregation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Run executes pipeline over documents from input without a server.
+//
+// Supported stages: $addFields, $bucket, $count, $facet, $group, $limit,
+// $match, $project, $redact, $replaceRoot, $replaceWith, $sample, $set,
+// $skip, $sort, $sortByCount, $unset and $unwind.
+// Expressions support arithmetic, array, boolean, comparison, conditional,
+// date, literal, object, set, string, type and variable operators.
+// Stages or operators that require a server
+// ($lookup, $out, $text, $function ...) returns an error.
+func Run(ctx context.Context, pipeline A, input Iterator) (Iterator, error) {
+	var c = &pipelineCompiler{env: newEvaluator(nil, time.Now())}
+	stages, err := c.compile(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	docs, err := readAll(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range stages {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		docs, err = s.run(docs)
+		if err != nil {
+			return nil, fmt.Errorf("aggregation: stage %d: %s: %w", s.index, s.name, err)
+		}
+	}
+	return iterate(docs), nil
+}
+
+type stageFunc func(docs []primitive.D) ([]primitive.D, error)
+
+type stageCompiler func(c *pipelineCompiler, arg interface{}) (stageFunc, error)
+
+type compiledStage struct {
+	index int
+	name  string
+	run   stageFunc
+}
+
+var stageCompilers map[string]stageCompiler
+
+func init() {
+	stageCompilers = map[string]stageCompiler{
+		"$addFields":   compileAddFields,
+		"$bucket":      compileBucket,
+		"$count":       compileCount,
+		"$facet":       compileFacet,
+		"$group":       compileGroup,
+		"$limit":       compileLimit,
+		"$match":       compileMatch,
+		"$project":     compileProject,
+		"$redact":      compileRedact,
+		"$replaceRoot": compileReplaceRoot,
+		"$replaceWith": compileReplaceWith,
+		"$sample":      compileSample,
+		"$set":         compileAddFields,
+		"$skip":        compileSkip,
+		"$sort":        compileSort,
+		"$sortByCount": compileSortByCount,
+		"$unset":       compileUnset,
+		"$unwind":      compileUnwind,
+	}
+}
+
+type pipelineCompiler struct {
+	env *evaluator
+}
+
+func (c *pipelineCompiler) compile(pipeline A) ([]compiledStage, error) {
+	var ret = make([]compiledStage, 0, len(pipeline))
+	for index, i := range pipeline {
+		d, err := bsonutil.Doc(i)
+		if err != nil {
+			return nil, fmt.Errorf("aggregation: stage %d: %w", index, err)
+		}
+		if len(d) != 1 {
+			return nil, fmt.Errorf("aggregation: stage %d: a pipeline stage specification object must contain exactly one field", index)
+		}
+		var name = d[0].Key
+		fn, ok := stageCompilers[name]
+		if !ok {
+			return nil, fmt.Errorf("aggregation: stage %d: unsupported stage '%s'", index, name)
+		}
+		run, err := fn(c, d[0].Value)
+		if err != nil {
+			return nil, fmt.Errorf("aggregation: stage %d: %s: %w", index, name, err)
+		}
+		ret = append(ret, compiledStage{index, name, run})
+	}
+	return ret, nil
+}
+
+func (c *pipelineCompiler) runPipeline(stages []compiledStage, docs []primitive.D) ([]primitive.D, error) {
+	var err error
+	for _, s := range stages {
+		docs, err = s.run(docs)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %s: %w", s.index, s.name, err)
+		}
+	}
+	return docs, nil
+}
+
+// eval evaluates expr with doc as $$ROOT.
+func (c *pipelineCompiler) eval(doc primitive.D, expr interface{}) (interface{}, error) {
+	return c.env.withRoot(doc).eval(expr)
+}
+
+// mapStage creates a stage that transforms each document,
+// document is dropped when fn returns nil.
+func mapStage(fn func(doc primitive.D) (primitive.D, error)) stageFunc {
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		var ret = make([]primitive.D, 0, len(docs))
+		for _, i := range docs {
+			d, err := fn(i)
+			if err != nil {
+				return nil, err
+			}
+			if d != nil {
+				ret = append(ret, d)
+			}
+		}
+		return ret, nil
+	}
+}
+
+func compileMatch(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	m, err := query.CompileExpr(arg, func(expr interface{}, doc primitive.D) (interface{}, error) {
+		return c.eval(doc, expr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		var ret = make([]primitive.D, 0, len(docs))
+		for _, i := range docs {
+			ok, err := m.MatchE(i)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				ret = append(ret, i)
+			}
+		}
+		return ret, nil
+	}, nil
+}
+
+func requireDoc(arg interface{}, name string) (primitive.D, error) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		return nil, fmt.Errorf("%s must be an object, found %s", name, typeName(arg))
+	}
+	return d, nil
+}
+
+func compileReplaceRoot(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	d, err := requireDoc(arg, "specification")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = namedArgs(d, "newRoot"); err != nil {
+		return nil, err
+	}
+	newRoot, ok := bsonutil.Get(d, "newRoot")
+	if !ok {
+		return nil, errors.New("no newRoot specified")
+	}
+	return compileReplaceWith(c, newRoot)
+}
+
+func compileReplaceWith(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	return mapStage(func(doc primitive.D) (primitive.D, error) {
+		v, err := c.eval(doc, arg)
+		if err != nil {
+			return nil, err
+		}
+		d, ok := v.(primitive.D)
+		if !ok {
+			return nil, fmt.Errorf("'newRoot' expression must evaluate to an object, but resulting value was of type %s", typeName(v))
+		}
+		return d, nil
+	}), nil
+}
+
+func compileLimit(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	n, err := requireInt(arg)
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, errors.New("the limit must be positive")
+	}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		if int64(len(docs)) > n {
+			docs = docs[:n]
+		}
+		return docs, nil
+	}, nil
+}
+
+func compileSkip(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	n, err := requireInt(arg)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, errors.New("the skip must be non-negative")
+	}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		if int64(len(docs)) <= n {
+			return nil, nil
+		}
+		return docs[n:], nil
+	}, nil
+}
+
+func compileCount(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	field, ok := arg.(string)
+	if !ok || field == "" || strings.HasPrefix(field, "$") || strings.Contains(field, ".") {
+		return nil, errors.New("the count field must be a non-empty string without '$' prefix or '.'")
+	}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		if len(docs) == 0 {
+			return nil, nil
+		}
+		return []primitive.D{{{Key: field, Value: int32(len(docs))}}}, nil
+	}, nil
+}
+
+func compileSample(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	d, err := requireDoc(arg, "the $sample stage specification")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = namedArgs(d, "size"); err != nil {
+		return nil, err
+	}
+	size, _ := bsonutil.Get(d, "size")
+	n, err := requireInt(size)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, errors.New("size argument must not be negative")
+	}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		var ret = make([]primitive.D, 0, n)
+		for _, i := range rand.Perm(len(docs)) {
+			if int64(len(ret)) >= n {
+				break
+			}
+			ret = append(ret, docs[i])
+		}
+		return ret, nil
+	}, nil
+}
+
+// groupState holds accumulator of a single group.
+type groupState struct {
+	id   interface{}
+	accs []accumulator
+}
+
+// groupBy groups docs by idExpr in first seen order.
+func (c *pipelineCompiler) groupBy(
+	docs []primitive.D,
+	idFunc func(doc primitive.D) (interface{}, error),
+	fields []groupAccumulator,
+) ([]primitive.D, error) {
+	var groups = map[string]*groupState{}
+	var order []*groupState
+	for _, doc := range docs {
+		id, err := idFunc(doc)
+		if err != nil {
+			return nil, err
+		}
+		var key = bsonutil.Key(id)
+		g, ok := groups[key]
+		if !ok {
+			g = &groupState{id: id, accs: make([]accumulator, len(fields))}
+			for index, f := range fields {
+				g.accs[index] = f.factory()
+			}
+			groups[key] = g
+			order = append(order, g)
+		}
+		var e = c.env.withRoot(doc)
+		for index, f := range fields {
+			v, err := e.eval(f.expr)
+			if err != nil {
+				return nil, err
+			}
+			if err := g.accs[index].add(v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	var ret = make([]primitive.D, 0, len(order))
+	for _, g := range order {
+		var d = primitive.D{{Key: "_id", Value: g.id}}
+		for index, f := range fields {
+			d = append(d, primitive.E{Key: f.field, Value: g.accs[index].result()})
+		}
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+func compileGroup(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	d, err := requireDoc(arg, "a group's fields")
+	if err != nil {
+		return nil, err
+	}
+	idExpr, ok := bsonutil.Get(d, "_id")
+	if !ok {
+		return nil, errors.New("a group specification must include an _id")
+	}
+	var spec = make(primitive.D, 0, len(d))
+	for _, i := range d {
+		if i.Key != "_id" {
+			spec = append(spec, i)
+		}
+	}
+	fields, err := compileAccumulators(spec)
+	if err != nil {
+		return nil, err
+	}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		return c.groupBy(docs, func(doc primitive.D) (interface{}, error) {
+			id, err := c.eval(doc, idExpr)
+			return nullIfMissing(id), err
+		}, fields)
+	}, nil
+}
+
+func compileSortByCount(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	if s, ok := arg.(string); !ok || !strings.HasPrefix(s, "$") {
+		if d, ok := arg.(primitive.D); !ok || !isOperatorExpression(d) {
+			return nil, errors.New("the argument must be a field path or an operator expression")
+		}
+	}
+	var fields = []groupAccumulator{{field: "count", factory: accumulators["$sum"], expr: int32(1)}}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		ret, err := c.groupBy(docs, func(doc primitive.D) (interface{}, error) {
+			id, err := c.eval(doc, arg)
+			return nullIfMissing(id), err
+		}, fields)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(ret, func(i, j int) bool {
+			return bsonutil.Compare(ret[i][1].Value, ret[j][1].Value) > 0
+		})
+		return ret, nil
+	}, nil
+}
+
+func compileBucket(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	d, err := namedArgs(arg, "groupBy", "boundaries", "default", "output")
+	if err != nil {
+		return nil, err
+	}
+	groupBy, ok := bsonutil.Get(d, "groupBy")
+	if !ok {
+		return nil, errors.New("requires 'groupBy' and 'boundaries' to be specified")
+	}
+	v, _ := bsonutil.Get(d, "boundaries")
+	boundaries, ok := v.(primitive.A)
+	if !ok || len(boundaries) < 2 {
+		return nil, errors.New("the 'boundaries' field must be an array of at least 2 values")
+	}
+	for index := 1; index < len(boundaries); index++ {
+		if bsonutil.CanonicalOrder(boundaries[index]) != bsonutil.CanonicalOrder(boundaries[0]) {
+			return nil, errors.New("all values in the 'boundaries' option must have the same type")
+		}
+		if bsonutil.Compare(boundaries[index-1], boundaries[index]) >= 0 {
+			return nil, errors.New("the 'boundaries' option must be sorted in ascending order")
+		}
+	}
+	defaultValue, hasDefault := bsonutil.Get(d, "default")
+	if hasDefault &&
+		bsonutil.CanonicalOrder(defaultValue) == bsonutil.CanonicalOrder(boundaries[0]) &&
+		bsonutil.Compare(defaultValue, boundaries[0]) >= 0 &&
+		bsonutil.Compare(defaultValue, boundaries[len(boundaries)-1]) < 0 {
+		return nil, errors.New("the 'default' field must be less than the lowest boundary or greater than or equal to the highest boundary")
+	}
+	var output = primitive.D{{Key: "count", Value: primitive.D{{Key: "$sum", Value: int32(1)}}}}
+	if v, ok := bsonutil.Get(d, "output"); ok {
+		if output, ok = v.(primitive.D); !ok {
+			return nil, errors.New("the 'output' field must be an object")
+		}
+	}
+	fields, err := compileAccumulators(output)
+	if err != nil {
+		return nil, err
+	}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		ret, err := c.groupBy(docs, func(doc primitive.D) (interface{}, error) {
+			v, err := c.eval(doc, groupBy)
+			if err != nil {
+				return nil, err
+			}
+			v = nullIfMissing(v)
+			if bsonutil.CanonicalOrder(v) == bsonutil.CanonicalOrder(boundaries[0]) {
+				for index := 1; index < len(boundaries); index++ {
+					if bsonutil.Compare(v, boundaries[index]) < 0 {
+						if bsonutil.Compare(v, boundaries[index-1]) >= 0 {
+							return boundaries[index-1], nil
+						}
+						break
+					}
+				}
+			}
+			if !hasDefault {
+				return nil, fmt.Errorf("'groupBy' expression value %v does not fall into any bucket and no default was specified", v)
+			}
+			return defaultValue, nil
+		}, fields)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(ret, func(i, j int) bool {
+			var a, b = ret[i][0].Value, ret[j][0].Value
+			if hasDefault && bsonutil.Equal(b, defaultValue) {
+				return !bsonutil.Equal(a, defaultValue)
+			}
+			if hasDefault && bsonutil.Equal(a, defaultValue) {
+				return false
+			}
+			return bsonutil.Compare(a, b) < 0
+		})
+		return ret, nil
+	}, nil
+}
+
+func compileFacet(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	d, err := requireDoc(arg, "the $facet specification")
+	if err != nil {
+		return nil, err
+	}
+	if len(d) == 0 {
+		return nil, errors.New("the $facet specification must be a non-empty object")
+	}
+	var pipelines = make([][]compiledStage, len(d))
+	for index, i := range d {
+		a, ok := i.Value.(primitive.A)
+		if !ok {
+			return nil, fmt.Errorf("facet '%s': must be an array", i.Key)
+		}
+		for _, s := range a {
+			if s, ok := s.(primitive.D); ok && len(s) == 1 {
+				switch s[0].Key {
+				case "$facet", "$out", "$merge", "$geoNear", "$indexStats", "$collStats":
+					return nil, fmt.Errorf("facet '%s': %s is not allowed to be used within a $facet stage", i.Key, s[0].Key)
+				}
+			}
+		}
+		pipelines[index], err = c.compile(a)
+		if err != nil {
+			return nil, fmt.Errorf("facet '%s': %w", i.Key, err)
+		}
+	}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		var ret = make(primitive.D, 0, len(d))
+		for index, i := range d {
+			var input = append([]primitive.D(nil), docs...)
+			output, err := c.runPipeline(pipelines[index], input)
+			if err != nil {
+				return nil, fmt.Errorf("facet '%s': %w", i.Key, err)
+			}
+			var a = make(primitive.A, 0, len(output))
+			for _, j := range output {
+				a = append(a, j)
+			}
+			ret = append(ret, primitive.E{Key: i.Key, Value: a})
+		}
+		return []primitive.D{ret}, nil
+	}, nil
+}
+
+func compileRedact(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	var redact func(e *evaluator, doc primitive.D) (primitive.D, error)
+	var redactValue = func(e *evaluator, v interface{}) (interface{}, bool, error) {
+		switch v := v.(type) {
+		case primitive.D:
+			d, err := redact(e, v)
+			return d, d != nil, err
+		}
+		return v, true, nil
+	}
+	redact = func(e *evaluator, doc primitive.D) (primitive.D, error) {
+		var scope = e.with(map[string]interface{}{"CURRENT": doc})
+		v, err := scope.eval(arg)
+		if err != nil {
+			return nil, err
+		}
+		switch v {
+		case "keep":
+			return doc, nil
+		case "prune":
+			return nil, nil
+		case "descend":
+		default:
+			return nil, errors.New("expression should return $$DESCEND, $$PRUNE, or $$KEEP")
+		}
+		var ret = make(primitive.D, 0, len(doc))
+		for _, i := range doc {
+			if a, ok := i.Value.(primitive.A); ok {
+				var items = make(primitive.A, 0, len(a))
+				for _, j := range a {
+					v, ok, err := redactValue(e, j)
+					if err != nil {
+						return nil, err
+					}
+					if ok {
+						items = append(items, v)
+					}
+				}
+				ret = append(ret, primitive.E{Key: i.Key, Value: items})
+				continue
+			}
+			v, ok, err := redactValue(e, i.Value)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				ret = append(ret, primitive.E{Key: i.Key, Value: v})
+			}
+		}
+		return ret, nil
+	}
+	return mapStage(func(doc primitive.D) (primitive.D, error) {
+		return redact(c.env.withRoot(doc), doc)
+	}), nil
+}
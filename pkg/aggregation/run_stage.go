@@ -0,0 +1,584 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// projection is a parsed $project specification tree.
+type projection struct {
+	fields []*projectionField
+}
+
+type projectionField struct {
+	key      string
+	include  bool
+	computed bool
+	expr     interface{}
+	sub      *projection
+}
+
+func (p *projection) field(key string) *projectionField {
+	for _, i := range p.fields {
+		if i.key == key {
+			return i
+		}
+	}
+	return nil
+}
+
+func (p *projection) hasComputed() bool {
+	for _, i := range p.fields {
+		if i.computed || (i.sub != nil && i.sub.hasComputed()) {
+			return true
+		}
+	}
+	return false
+}
+
+// projectionMode
+const (
+	projectionUnknown = iota
+	projectionInclusion
+	projectionExclusion
+)
+
+type projectionParser struct {
+	mode int
+}
+
+func (p *projectionParser) setMode(mode int, path string) error {
+	if p.mode != projectionUnknown && p.mode != mode {
+		if mode == projectionExclusion {
+			return fmt.Errorf("cannot do exclusion on field %s in inclusion projection", path)
+		}
+		return fmt.Errorf("cannot do inclusion on field %s in exclusion projection", path)
+	}
+	p.mode = mode
+	return nil
+}
+
+func (p *projectionParser) parse(spec primitive.D, prefix string) (*projection, error) {
+	var ret = &projection{}
+	for _, i := range spec {
+		var path = strings.Split(i.Key, ".")
+		var node = ret
+		for _, k := range path[:len(path)-1] {
+			var f = node.field(k)
+			if f == nil {
+				f = &projectionField{key: k, sub: &projection{}}
+				node.fields = append(node.fields, f)
+			}
+			if f.sub == nil {
+				return nil, fmt.Errorf("path collision at %s", prefix+i.Key)
+			}
+			node = f.sub
+		}
+		var key = path[len(path)-1]
+		if node.field(key) != nil {
+			return nil, fmt.Errorf("path collision at %s", prefix+i.Key)
+		}
+		var f = &projectionField{key: key}
+		var fullPath = prefix + i.Key
+		switch v := i.Value.(type) {
+		case bool, int32, int64, float64, primitive.Decimal128:
+			f.include = bsonutil.Truthy(v)
+			if fullPath == "_id" {
+				break
+			}
+			var mode = projectionExclusion
+			if f.include {
+				mode = projectionInclusion
+			}
+			if err := p.setMode(mode, fullPath); err != nil {
+				return nil, err
+			}
+		case primitive.D:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("an empty object is not a valid value for field %s", fullPath)
+			}
+			if isOperatorExpression(v) {
+				f.computed, f.expr = true, v
+				if err := p.setMode(projectionInclusion, fullPath); err != nil {
+					return nil, err
+				}
+				break
+			}
+			sub, err := p.parse(v, fullPath+".")
+			if err != nil {
+				return nil, err
+			}
+			f.sub = sub
+		default:
+			f.computed, f.expr = true, v
+			if err := p.setMode(projectionInclusion, fullPath); err != nil {
+				return nil, err
+			}
+		}
+		node.fields = append(node.fields, f)
+	}
+	return ret, nil
+}
+
+// parseProjection parses a $project specification,
+// returns whether it is a exclusion projection.
+func parseProjection(spec primitive.D) (*projection, bool, error) {
+	if len(spec) == 0 {
+		return nil, false, errors.New("projection specification must have at least one field")
+	}
+	var p = new(projectionParser)
+	ret, err := p.parse(spec, "")
+	if err != nil {
+		return nil, false, err
+	}
+	var id = ret.field("_id")
+	if p.mode == projectionUnknown {
+		p.mode = projectionInclusion
+		if id != nil && id.sub == nil && !id.computed && !id.include {
+			p.mode = projectionExclusion
+		}
+	}
+	if p.mode == projectionInclusion && id == nil {
+		ret.fields = append([]*projectionField{{key: "_id", include: true}}, ret.fields...)
+	}
+	return ret, p.mode == projectionExclusion, nil
+}
+
+// includeValue applies inclusion projection to a field value.
+func (p *projection) includeValue(e *evaluator, v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case primitive.D:
+		return p.include(e, v)
+	case primitive.A:
+		var ret = make(primitive.A, 0, len(v))
+		for _, i := range v {
+			switch i.(type) {
+			case primitive.D, primitive.A:
+				r, err := p.includeValue(e, i)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, r)
+			}
+		}
+		return ret, nil
+	}
+	if p.hasComputed() {
+		return p.include(e, primitive.D{})
+	}
+	return missing{}, nil
+}
+
+func (p *projection) include(e *evaluator, doc primitive.D) (primitive.D, error) {
+	var ret = make(primitive.D, 0, len(p.fields))
+	for _, i := range doc {
+		var f = p.field(i.Key)
+		if f == nil || f.computed {
+			continue
+		}
+		if f.sub != nil {
+			v, err := f.sub.includeValue(e, i.Value)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := v.(missing); !ok {
+				ret = append(ret, primitive.E{Key: i.Key, Value: v})
+			}
+			continue
+		}
+		if f.include {
+			ret = append(ret, i)
+		}
+	}
+	for _, f := range p.fields {
+		switch {
+		case f.computed:
+			v, err := e.eval(f.expr)
+			if err != nil {
+				return nil, err
+			}
+			ret = setDocField(ret, f.key, v)
+		case f.sub != nil && f.sub.hasComputed():
+			if _, ok := bsonutil.Get(doc, f.key); !ok {
+				v, err := f.sub.include(e, primitive.D{})
+				if err != nil {
+					return nil, err
+				}
+				ret = setDocField(ret, f.key, v)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// excludeValue applies exclusion projection to a field value.
+func (p *projection) excludeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case primitive.D:
+		return p.exclude(v)
+	case primitive.A:
+		var ret = make(primitive.A, 0, len(v))
+		for _, i := range v {
+			ret = append(ret, p.excludeValue(i))
+		}
+		return ret
+	}
+	return v
+}
+
+func (p *projection) exclude(doc primitive.D) primitive.D {
+	var ret = make(primitive.D, 0, len(doc))
+	for _, i := range doc {
+		var f = p.field(i.Key)
+		switch {
+		case f == nil, f.include:
+			ret = append(ret, i)
+		case f.sub != nil:
+			ret = append(ret, primitive.E{Key: i.Key, Value: f.sub.excludeValue(i.Value)})
+		}
+	}
+	return ret
+}
+
+func projectStage(c *pipelineCompiler, spec primitive.D) (stageFunc, error) {
+	p, exclusion, err := parseProjection(spec)
+	if err != nil {
+		return nil, err
+	}
+	return mapStage(func(doc primitive.D) (primitive.D, error) {
+		if exclusion {
+			return p.exclude(doc), nil
+		}
+		return p.include(c.env.withRoot(doc), doc)
+	}), nil
+}
+
+func compileProject(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	d, err := requireDoc(arg, "$project specification")
+	if err != nil {
+		return nil, err
+	}
+	return projectStage(c, d)
+}
+
+func compileUnset(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	var fields primitive.A
+	switch v := arg.(type) {
+	case string:
+		fields = primitive.A{v}
+	case primitive.A:
+		fields = v
+	default:
+		return nil, errors.New("$unset specification must be a string or an array")
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("$unset specification must be a string or an array with at least one field")
+	}
+	var spec = make(primitive.D, 0, len(fields))
+	for _, i := range fields {
+		s, ok := i.(string)
+		if !ok || s == "" {
+			return nil, errors.New("$unset specification must be a string or an array containing only string values")
+		}
+		spec = append(spec, primitive.E{Key: s, Value: int32(0)})
+	}
+	return projectStage(c, spec)
+}
+
+// updatePath returns a copy of doc with value at path replaced by fn result,
+// arrays on the path are traversed.
+func updatePath(doc primitive.D, path []string, fn func(old interface{}) (interface{}, error)) (primitive.D, error) {
+	old, ok := bsonutil.Get(doc, path[0])
+	if !ok {
+		old = missing{}
+	}
+	if len(path) == 1 {
+		v, err := fn(old)
+		if err != nil {
+			return nil, err
+		}
+		return setDocField(doc, path[0], v), nil
+	}
+	var update func(v interface{}) (interface{}, error)
+	update = func(v interface{}) (interface{}, error) {
+		switch v := v.(type) {
+		case primitive.D:
+			return updatePath(v, path[1:], fn)
+		case primitive.A:
+			var ret = make(primitive.A, 0, len(v))
+			for _, i := range v {
+				r, err := update(i)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, r)
+			}
+			return ret, nil
+		}
+		return updatePath(primitive.D{}, path[1:], fn)
+	}
+	v, err := update(old)
+	if err != nil {
+		return nil, err
+	}
+	return setDocField(doc, path[0], v), nil
+}
+
+func addFields(e *evaluator, doc primitive.D, spec primitive.D) (primitive.D, error) {
+	var err error
+	for _, i := range spec {
+		var expr = i.Value
+		doc, err = updatePath(doc, strings.Split(i.Key, "."), func(old interface{}) (interface{}, error) {
+			if d, ok := expr.(primitive.D); ok && len(d) > 0 && !isOperatorExpression(d) {
+				base, ok := old.(primitive.D)
+				if !ok {
+					base = primitive.D{}
+				}
+				return addFields(e, base, d)
+			}
+			return e.eval(expr)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+func compileAddFields(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	spec, err := requireDoc(arg, "specification")
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range spec {
+		if strings.HasPrefix(i.Key, "$") {
+			return nil, fmt.Errorf("field path '%s' cannot begin with '$'", i.Key)
+		}
+	}
+	return mapStage(func(doc primitive.D) (primitive.D, error) {
+		return addFields(c.env.withRoot(doc), doc, spec)
+	}), nil
+}
+
+// getField resolves dotted path without traversing arrays.
+func getField(doc primitive.D, path []string) interface{} {
+	var v interface{} = doc
+	for _, k := range path {
+		d, ok := v.(primitive.D)
+		if !ok {
+			return missing{}
+		}
+		v, ok = bsonutil.Get(d, k)
+		if !ok {
+			return missing{}
+		}
+	}
+	return v
+}
+
+func compileUnwind(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	var path, includeArrayIndex string
+	var preserve bool
+	switch v := arg.(type) {
+	case string:
+		path = v
+	case primitive.D:
+		d, err := namedArgs(v, "path", "includeArrayIndex", "preserveNullAndEmptyArrays")
+		if err != nil {
+			return nil, err
+		}
+		p, _ := bsonutil.Get(d, "path")
+		path, _ = p.(string)
+		if i, ok := bsonutil.Get(d, "includeArrayIndex"); ok {
+			includeArrayIndex, ok = i.(string)
+			if !ok || includeArrayIndex == "" || strings.HasPrefix(includeArrayIndex, "$") {
+				return nil, errors.New("includeArrayIndex must be a non-empty string without '$' prefix")
+			}
+		}
+		if i, ok := bsonutil.Get(d, "preserveNullAndEmptyArrays"); ok {
+			preserve, ok = i.(bool)
+			if !ok {
+				return nil, errors.New("preserveNullAndEmptyArrays must be a boolean")
+			}
+		}
+	default:
+		return nil, errors.New("expected either a string or an object as specification")
+	}
+	if !strings.HasPrefix(path, "$") || len(path) < 2 {
+		return nil, errors.New("path option must be a field path prefixed with '$'")
+	}
+	var fieldPath = strings.Split(path[1:], ".")
+	var indexPath = strings.Split(includeArrayIndex, ".")
+	var withIndex = func(doc primitive.D, index interface{}) (primitive.D, error) {
+		if includeArrayIndex == "" {
+			return doc, nil
+		}
+		return updatePath(doc, indexPath, func(interface{}) (interface{}, error) {
+			return index, nil
+		})
+	}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		var ret = make([]primitive.D, 0, len(docs))
+		for _, doc := range docs {
+			var v = getField(doc, fieldPath)
+			a, ok := v.(primitive.A)
+			if !ok {
+				if isNullish(v) && !preserve {
+					continue
+				}
+				d, err := withIndex(doc, nil)
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, d)
+				continue
+			}
+			if len(a) == 0 {
+				if !preserve {
+					continue
+				}
+				d, err := updatePath(doc, fieldPath, func(interface{}) (interface{}, error) {
+					return missing{}, nil
+				})
+				if err != nil {
+					return nil, err
+				}
+				if d, err = withIndex(d, nil); err != nil {
+					return nil, err
+				}
+				ret = append(ret, d)
+				continue
+			}
+			for index, i := range a {
+				var item = i
+				d, err := updatePath(doc, fieldPath, func(interface{}) (interface{}, error) {
+					return item, nil
+				})
+				if err != nil {
+					return nil, err
+				}
+				if d, err = withIndex(d, int64(index)); err != nil {
+					return nil, err
+				}
+				ret = append(ret, d)
+			}
+		}
+		return ret, nil
+	}, nil
+}
+
+// sortKey is a value used for $sort comparison,
+// empty array sorts before null.
+type sortKey struct {
+	empty bool
+	value interface{}
+}
+
+func compareSortKey(a, b sortKey) int {
+	switch {
+	case a.empty && b.empty:
+		return 0
+	case a.empty:
+		return -1
+	case b.empty:
+		return 1
+	}
+	return bsonutil.Compare(a.value, b.value)
+}
+
+func flatten(v interface{}, ret primitive.A) primitive.A {
+	if a, ok := v.(primitive.A); ok {
+		for _, i := range a {
+			ret = flatten(i, ret)
+		}
+		return ret
+	}
+	return append(ret, v)
+}
+
+// newSortKey uses smallest array element for ascending sort
+// and largest for descending sort.
+func newSortKey(doc primitive.D, path []string, direction int) sortKey {
+	var v = getPath(doc, path)
+	if _, ok := v.(missing); ok {
+		return sortKey{value: nil}
+	}
+	if _, ok := v.(primitive.A); !ok {
+		return sortKey{value: v}
+	}
+	var items = flatten(v, nil)
+	if len(items) == 0 {
+		return sortKey{empty: true}
+	}
+	var ret = items[0]
+	for _, i := range items[1:] {
+		if bsonutil.Compare(i, ret)*direction < 0 {
+			ret = i
+		}
+	}
+	return sortKey{value: ret}
+}
+
+type sortField struct {
+	path      []string
+	direction int
+}
+
+func compileSortFields(d primitive.D) ([]sortField, error) {
+	if len(d) == 0 {
+		return nil, errors.New("$sort stage must have at least one sort key")
+	}
+	var fields = make([]sortField, 0, len(d))
+	for _, i := range d {
+		if _, ok := i.Value.(primitive.D); ok {
+			return nil, fmt.Errorf("$meta sort by '%s' requires a server", i.Key)
+		}
+		n, err := requireInt(i.Value)
+		if err != nil || (n != 1 && n != -1) {
+			return nil, fmt.Errorf("$sort key ordering must be 1 (for ascending) or -1 (for descending)")
+		}
+		fields = append(fields, sortField{strings.Split(i.Key, "."), int(n)})
+	}
+	return fields, nil
+}
+
+func compileSort(c *pipelineCompiler, arg interface{}) (stageFunc, error) {
+	d, err := requireDoc(arg, "the $sort key specification")
+	if err != nil {
+		return nil, err
+	}
+	fields, err := compileSortFields(d)
+	if err != nil {
+		return nil, err
+	}
+	return func(docs []primitive.D) ([]primitive.D, error) {
+		var keys = make([][]sortKey, len(docs))
+		var indexes = make([]int, len(docs))
+		for index, doc := range docs {
+			indexes[index] = index
+			keys[index] = make([]sortKey, len(fields))
+			for fieldIndex, f := range fields {
+				keys[index][fieldIndex] = newSortKey(doc, f.path, f.direction)
+			}
+		}
+		sort.SliceStable(indexes, func(i, j int) bool {
+			var a, b = keys[indexes[i]], keys[indexes[j]]
+			for fieldIndex, f := range fields {
+				if c := compareSortKey(a[fieldIndex], b[fieldIndex]); c != 0 {
+					return c*f.direction < 0
+				}
+			}
+			return false
+		})
+		var ret = make([]primitive.D, len(docs))
+		for index, i := range indexes {
+			ret[index] = docs[i]
+		}
+		return ret, nil
+	}, nil
+}
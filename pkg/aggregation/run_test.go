@@ -0,0 +1,306 @@
+package aggregation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var testOrders = []interface{}{
+	bson.D{{Key: "_id", Value: 1}, {Key: "item", Value: "abc"}, {Key: "price", Value: 10}, {Key: "qty", Value: 2}, {Key: "tags", Value: A{"a", "b"}}},
+	bson.D{{Key: "_id", Value: 2}, {Key: "item", Value: "jkl"}, {Key: "price", Value: 20}, {Key: "qty", Value: 1}, {Key: "tags", Value: A{}}},
+	bson.D{{Key: "_id", Value: 3}, {Key: "item", Value: "abc"}, {Key: "price", Value: 5.5}, {Key: "qty", Value: 10}, {Key: "tags", Value: A{"b"}}},
+	bson.D{{Key: "_id", Value: 4}, {Key: "item", Value: "xyz"}, {Key: "price", Value: 5}, {Key: "qty", Value: 5}},
+}
+
+func runPipeline(t *testing.T, pipeline A, docs ...interface{}) []bson.D {
+	it, err := Run(context.Background(), pipeline, Documents(docs...))
+	require.NoError(t, err)
+	var ret []bson.D
+	require.NoError(t, All(context.Background(), it, &ret))
+	return ret
+}
+
+func TestRun(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		pipeline A
+		want     []bson.D
+	}{
+		{
+			"match",
+			A{Match(M{"item": "abc", "qty": M{"$gt": 5}}), Project(M{"_id": 1})},
+			[]bson.D{{{Key: "_id", Value: int32(3)}}},
+		},
+		{
+			"match expr",
+			A{Match(M{"$expr": M{"$gt": A{"$price", "$qty"}}}), Project(M{"_id": 1})},
+			[]bson.D{{{Key: "_id", Value: int32(1)}}, {{Key: "_id", Value: int32(2)}}},
+		},
+		{
+			"group sort",
+			A{
+				Group(bson.D{
+					{Key: "_id", Value: "$item"},
+					{Key: "total", Value: M{"$sum": M{"$multiply": A{"$price", "$qty"}}}},
+					{Key: "count", Value: M{"$sum": 1}},
+				}),
+				Sort(Desc("total").Asc("_id")),
+			},
+			[]bson.D{
+				{{Key: "_id", Value: "abc"}, {Key: "total", Value: 75.0}, {Key: "count", Value: int32(2)}},
+				{{Key: "_id", Value: "xyz"}, {Key: "total", Value: int32(25)}, {Key: "count", Value: int32(1)}},
+				{{Key: "_id", Value: "jkl"}, {Key: "total", Value: int32(20)}, {Key: "count", Value: int32(1)}},
+			},
+		},
+		{
+			"unwind",
+			A{Unwind("tags").SetIncludeArrayIndex("i").SetPreserveNullAndEmptyArrays(true), Project(M{"tags": 1, "i": 1})},
+			[]bson.D{
+				{{Key: "_id", Value: int32(1)}, {Key: "tags", Value: "a"}, {Key: "i", Value: int64(0)}},
+				{{Key: "_id", Value: int32(1)}, {Key: "tags", Value: "b"}, {Key: "i", Value: int64(1)}},
+				{{Key: "_id", Value: int32(2)}, {Key: "i", Value: nil}},
+				{{Key: "_id", Value: int32(3)}, {Key: "tags", Value: "b"}, {Key: "i", Value: int64(0)}},
+				{{Key: "_id", Value: int32(4)}, {Key: "i", Value: nil}},
+			},
+		},
+		{
+			"group n accumulators",
+			A{Group(bson.D{
+				{Key: "_id", Value: nil},
+				{Key: "top", Value: TopN(2, Desc("price"), "$_id")},
+				{Key: "bottom", Value: BottomN(2, Desc("price"), "$_id")},
+				{Key: "least", Value: Top(Asc("qty"), "$item")},
+				{Key: "first", Value: FirstN("$_id", 3)},
+				{Key: "last", Value: LastN("$_id", 2)},
+				{Key: "max", Value: MaxN("$qty", 2)},
+				{Key: "min", Value: MinN("$price", 2)},
+				{Key: "percentile", Value: Percentile("$price", A{0.5, 1}, PercentileApproximate)},
+				{Key: "median", Value: Median("$price", PercentileApproximate)},
+			})},
+			[]bson.D{{
+				{Key: "_id", Value: nil},
+				{Key: "top", Value: A{int32(2), int32(1)}},
+				{Key: "bottom", Value: A{int32(3), int32(4)}},
+				{Key: "least", Value: "jkl"},
+				{Key: "first", Value: A{int32(1), int32(2), int32(3)}},
+				{Key: "last", Value: A{int32(3), int32(4)}},
+				{Key: "max", Value: A{int32(10), int32(5)}},
+				{Key: "min", Value: A{int32(5), 5.5}},
+				{Key: "percentile", Value: A{5.5, 20.0}},
+				{Key: "median", Value: 5.5},
+			}},
+		},
+		{
+			"sort spec",
+			A{Sort(Asc("item").Desc("price")), Project(M{"_id": 1})},
+			[]bson.D{
+				{{Key: "_id", Value: int32(1)}},
+				{{Key: "_id", Value: int32(3)}},
+				{{Key: "_id", Value: int32(2)}},
+				{{Key: "_id", Value: int32(4)}},
+			},
+		},
+		{
+			"sortByCount",
+			A{Unwind("$tags"), SortByCount("$tags")},
+			[]bson.D{
+				{{Key: "_id", Value: "b"}, {Key: "count", Value: int32(2)}},
+				{{Key: "_id", Value: "a"}, {Key: "count", Value: int32(1)}},
+			},
+		},
+		{
+			"project computed",
+			A{
+				Match(M{"_id": 1}),
+				Project(bson.D{
+					{Key: "_id", Value: 0},
+					{Key: "item", Value: M{"$toUpper": "$item"}},
+					{Key: "detail.qty", Value: 1},
+					{Key: "size", Value: M{"$size": "$tags"}},
+				}),
+			},
+			[]bson.D{{{Key: "item", Value: "ABC"}, {Key: "size", Value: int32(2)}}},
+		},
+		{
+			"exclusion",
+			A{Match(M{"_id": 4}), Project(M{"tags": 0, "price": 0})},
+			[]bson.D{{{Key: "_id", Value: int32(4)}, {Key: "item", Value: "xyz"}, {Key: "qty", Value: int32(5)}}},
+		},
+		{
+			"addFields nested",
+			A{
+				Match(M{"_id": 4}),
+				AddFields(bson.D{{Key: "a.b", Value: "$qty"}, {Key: "item", Value: "$$REMOVE"}}),
+				Unset("price", "tags", "qty"),
+			},
+			[]bson.D{{{Key: "_id", Value: int32(4)}, {Key: "a", Value: bson.D{{Key: "b", Value: int32(5)}}}}},
+		},
+		{
+			"skip limit count",
+			A{Sort(Asc("price")), Skip(1), Limit(2), Count("n")},
+			[]bson.D{{{Key: "n", Value: int32(2)}}},
+		},
+		{
+			"count empty",
+			A{Match(M{"item": "none"}), Count("n")},
+			nil,
+		},
+		{
+			"replaceRoot",
+			A{Match(M{"_id": 2}), ReplaceRoot(M{"name": "$item"})},
+			[]bson.D{{{Key: "name", Value: "jkl"}}},
+		},
+		{
+			"facet",
+			A{Facet(M{
+				"total": A{Count("n")},
+				"cheap": A{Match(M{"price": M{"$lt": 6}}), Project(M{"_id": 1})},
+			}), Project(M{"_id": 0, "total": 1})},
+			[]bson.D{{{Key: "total", Value: A{bson.D{{Key: "n", Value: int32(4)}}}}}},
+		},
+		{
+			"bucket",
+			A{Bucket("$price", A{0, 10, 100}).SetDefault("other")},
+			[]bson.D{
+				{{Key: "_id", Value: int32(0)}, {Key: "count", Value: int32(2)}},
+				{{Key: "_id", Value: int32(10)}, {Key: "count", Value: int32(2)}},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, runPipeline(t, c.pipeline, testOrders...))
+		})
+	}
+}
+
+func TestRunExpression(t *testing.T) {
+	var date = time.Date(2021, 3, 14, 15, 9, 26, 535e6, time.UTC)
+	var doc = bson.D{
+		{Key: "a", Value: 7},
+		{Key: "b", Value: 2},
+		{Key: "s", Value: " Hello, World "},
+		{Key: "arr", Value: A{3, 1, 2, 1}},
+		{Key: "date", Value: date},
+		{Key: "items", Value: A{M{"k": "x", "v": 1}, M{"k": "y", "v": 2}}},
+	}
+	for _, c := range []struct {
+		name string
+		expr interface{}
+		want interface{}
+	}{
+		{"add", M{"$add": A{"$a", "$b", 1}}, int32(10)},
+		{"add overflow", M{"$add": A{int32(2147483647), int32(1)}}, int64(2147483648)},
+		{"divide", M{"$divide": A{"$a", "$b"}}, 3.5},
+		{"mod", M{"$mod": A{"$a", "$b"}}, int32(1)},
+		{"round", M{"$round": A{2.5, 0}}, 2.0},
+		{"cond", M{"$cond": A{M{"$gt": A{"$a", 5}}, "big", "small"}}, "big"},
+		{"ifNull", M{"$ifNull": A{"$missing", "default"}}, "default"},
+		{"switch", M{"$switch": M{
+			"branches": A{M{"case": M{"$eq": A{"$b", 1}}, "then": "one"}, M{"case": M{"$eq": A{"$b", 2}}, "then": "two"}},
+			"default":  "other",
+		}}, "two"},
+		{"trim", M{"$trim": M{"input": "$s"}}, "Hello, World"},
+		{"split", M{"$split": A{"a,b", ","}}, A{"a", "b"}},
+		{"substrCP", M{"$substrCP": A{"héllo", 1, 3}}, "éll"},
+		{"regexMatch", M{"$regexMatch": M{"input": "$s", "regex": "world", "options": "i"}}, true},
+		{"concat null", M{"$concat": A{"a", nil}}, nil},
+		{"filter", M{"$filter": M{"input": "$arr", "cond": M{"$gt": A{"$$this", 1}}}}, A{int32(3), int32(2)}},
+		{"map", M{"$map": M{"input": "$arr", "as": "x", "in": M{"$multiply": A{"$$x", 2}}}}, A{int32(6), int32(2), int32(4), int32(2)}},
+		{"reduce", M{"$reduce": M{"input": "$arr", "initialValue": 0, "in": M{"$add": A{"$$value", "$$this"}}}}, int32(7)},
+		{"slice", M{"$slice": A{"$arr", -2}}, A{int32(2), int32(1)}},
+		{"setUnion", M{"$setUnion": A{"$arr", A{4}}}, A{int32(3), int32(1), int32(2), int32(4)}},
+		{"sortArray", SortArray("$arr", 1), A{int32(1), int32(1), int32(2), int32(3)}},
+		{"sortArray spec", Map(SortArray("$items", Desc("v")), "$$this.k"), A{"y", "x"}},
+		{"ArrayUnique", ArrayUnique("$arr"), A{int32(3), int32(1), int32(2)}},
+		{"ArrayFlatten", ArrayFlatten(A{1, A{2, A{3}}}, 1), A{int32(1), int32(2), A{int32(3)}}},
+		{"ArrayFlatten depth", ArrayFlatten(A{1, A{2, A{3}}}, 2), A{int32(1), int32(2), int32(3)}},
+		{"ArrayIndexBy", Map(ObjectToArray(ArrayIndexBy("$items", "k")), "$$this.k"), A{"x", "y"}},
+		{"ArrayCountIf", ArrayCountIf("$arr", Gt("$$this", 1)), int32(2)},
+		{"ConcatArraysLiteral", ConcatArraysLiteral("$arr", A{"$a"}), A{int32(3), int32(1), int32(2), int32(1), "$a"}},
+		{"field path array", "$items.k", A{"x", "y"}},
+		{"typed path", Field("items").Index(1).Sub("v"), A{}},
+		{"typed var", M{"$map": M{"input": Field("items"), "as": "i", "in": Var("i").Sub("k")}}, A{"x", "y"}},
+		{"arrayToObject", M{"$arrayToObject": "$items"}, bson.D{{Key: "x", Value: int32(1)}, {Key: "y", Value: int32(2)}}},
+		{"sum array", M{"$sum": "$arr"}, int32(7)},
+		{"avg", M{"$avg": A{"$a", "$b"}}, 4.5},
+		{"max", M{"$max": "$arr"}, int32(3)},
+		{"maxN", MaxN("$arr", 2), A{int32(3), int32(2)}},
+		{"minN", MinN("$arr", 3), A{int32(1), int32(1), int32(2)}},
+		{"median", Median("$arr", PercentileApproximate), 1.0},
+		{"percentile", Percentile("$arr", A{0.95}, PercentileApproximate), A{3.0}},
+		{"percentile scalar", Percentile("$a", A{0, 1}, PercentileApproximate), A{7.0, 7.0}},
+		{"firstN", FirstN("$arr", 2), A{int32(3), int32(1)}},
+		{"lastN", LastN("$arr", 5), A{int32(3), int32(1), int32(2), int32(1)}},
+		{"year", M{"$year": "$date"}, int32(2021)},
+		{"dateToString", M{"$dateToString": M{"date": "$date", "format": "%Y-%m-%d %H:%M", "timezone": "+08:00"}}, "2021-03-14 23:09"},
+		{"dateToString default", M{"$dateToString": M{"date": "$date"}}, "2021-03-14T15:09:26.535Z"},
+		{"dateFromParts", M{"$dateFromParts": M{"year": 2021, "month": 14, "day": 1}}, primitive.NewDateTimeFromTime(time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC))},
+		{"dateFromString", M{"$dateFromString": M{"dateString": "2021-03-14T15:09:26.535Z"}}, primitive.NewDateTimeFromTime(date)},
+		{"isoWeek", M{"$isoWeek": "$date"}, int32(10)},
+		{"dateAdd month end", DateAdd(time.Date(2021, 1, 31, 8, 0, 0, 0, time.UTC), TUMonth, 1), primitive.NewDateTimeFromTime(time.Date(2021, 2, 28, 8, 0, 0, 0, time.UTC))},
+		{"dateAdd day timezone", DateAdd("$date", TUDay, 1).SetTimezone("Asia/Shanghai"), primitive.NewDateTimeFromTime(date.AddDate(0, 0, 1))},
+		{"dateSubtract", DateSubtract("$date", TUHour, 1), primitive.NewDateTimeFromTime(date.Add(-time.Hour))},
+		{"dateDiff", DateDiff(time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC), "$date", TUYear), int64(1)},
+		{"dateDiff week", DateDiff(time.Date(2021, 3, 8, 0, 0, 0, 0, time.UTC), "$date", TUWeek), int64(1)},
+		{"dateDiff startOfWeek", DateDiff(time.Date(2021, 3, 8, 0, 0, 0, 0, time.UTC), "$date", TUWeek).SetStartOfWeek("mon"), int64(0)},
+		{"dateTrunc binSize", DateTruncNative("$date", TUHour).SetBinSize(2), primitive.NewDateTimeFromTime(time.Date(2021, 3, 14, 14, 0, 0, 0, time.UTC))},
+		{"dateTrunc week", DateTruncNative("$date", TUWeek).SetStartOfWeek("monday"), primitive.NewDateTimeFromTime(time.Date(2021, 3, 8, 0, 0, 0, 0, time.UTC))},
+		{"dateTrunc timezone", DateTruncNative("$date", TUQuarter).SetTimezone("+08:00"), primitive.NewDateTimeFromTime(time.Date(2020, 12, 31, 16, 0, 0, 0, time.UTC))},
+		{"DateTrunc", DateTrunc("month", "$date", "UTC"), primitive.NewDateTimeFromTime(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))},
+		{"DateTrunc week", DateTruncForVersion("4.4", "week", time.Date(2021, 3, 2, 10, 0, 0, 0, time.UTC), "UTC"), primitive.NewDateTimeFromTime(time.Date(2021, 2, 28, 0, 0, 0, 0, time.UTC))},
+		{"DateTrunc week timezone", DateTrunc("week", "$date", "+08:00"), primitive.NewDateTimeFromTime(time.Date(2021, 3, 13, 16, 0, 0, 0, time.UTC))},
+		{"DateTrunc quarter", DateTruncForVersion("4.4", "quarter", "$date", "UTC"), primitive.NewDateTimeFromTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))},
+		{"DateTrunc millisecond", DateTrunc("millisecond", "$date", "UTC"), primitive.NewDateTimeFromTime(date)},
+		{"DateTrunc native", DateTruncForVersion("5.0", "month", "$date", "UTC"), primitive.NewDateTimeFromTime(time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))},
+		{"toInt", M{"$toInt": "42"}, int32(42)},
+		{"toString", M{"$toString": 2.5}, "2.5"},
+		{"convert onError", M{"$convert": M{"input": "x", "to": "int", "onError": -1}}, int32(-1)},
+		{"type", M{"$type": "$missing"}, "missing"},
+		{"let", M{"$let": M{"vars": M{"x": "$a"}, "in": M{"$multiply": A{"$$x", "$$x"}}}}, int32(49)},
+		{"mergeObjects", M{"$mergeObjects": A{M{"a": 1}, M{"a": 2}}}, bson.D{{Key: "a", Value: int32(2)}}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var res = runPipeline(t, A{Project(M{"_id": 0, "v": c.expr})}, doc)
+			require.Len(t, res, 1)
+			var got interface{}
+			if len(res[0]) > 0 {
+				got = res[0][0].Value
+			}
+			assert.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestRunError(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		pipeline A
+	}{
+		{"unsupported stage", A{Out("foo")}},
+		{"unknown expression", A{Project(M{"v": M{"$foo": 1}})}},
+		{"mixed projection", A{Project(M{"a": 1, "b": 0})}},
+		{"group without id", A{Group(M{"n": M{"$sum": 1}})}},
+		{"topN without n", A{Group(M{"_id": nil, "n": M{"$topN": M{"sortBy": M{"a": 1}, "output": "$a"}}})}},
+		{"invalid percentile", A{Group(M{"_id": nil, "p": Percentile("$a", A{2}, PercentileApproximate)})}},
+		{"invalid n", A{Group(M{"_id": nil, "n": FirstN("$a", 0)})}},
+		{"field n", A{Group(M{"_id": nil, "n": M{"$firstN": M{"input": 2, "n": "$qty"}}})}},
+		{"fraction n", A{Group(M{"_id": nil, "n": M{"$topN": M{"n": 1.5, "sortBy": M{"a": 1}, "output": "$a"}}})}},
+		{"invalid n expression", A{Project(M{"v": M{"$firstN": M{"input": nil, "n": "x"}}})}},
+		{"invalid limit", A{Limit(0)}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := Run(context.Background(), c.pipeline, Documents(testOrders...))
+			assert.Error(t, err)
+		})
+	}
+	_, err := Run(context.Background(), A{Project(M{"v": M{"$divide": A{1, 0}}})}, Documents(testOrders...))
+	assert.Error(t, err)
+	_, err = Run(context.Background(), A{MatchExpr(M{"$divide": A{1, 0}})}, Documents(testOrders...))
+	assert.Error(t, err, "$expr error in $match")
+}
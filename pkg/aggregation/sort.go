@@ -0,0 +1,30 @@
+package aggregation
+
+import "github.com/NateScarlet/mongo-operators/pkg/query"
+
+// SortSpec alias query.SortSpec
+type SortSpec = query.SortSpec
+
+// Asc sorts by field in ascending order.
+func Asc(field Path) SortSpec {
+	return query.Asc(field)
+}
+
+// Desc sorts by field in descending order.
+func Desc(field Path) SortSpec {
+	return query.Desc(field)
+}
+
+// TextScore sorts by text search score in descending order,
+// as `{ field: { $meta: "textScore" } }`.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/meta/
+func TextScore(field Path) SortSpec {
+	return query.TextScore(field)
+}
+
+// SearchScore sorts by Atlas Search score in descending order,
+// as `{ field: { $meta: "searchScore" } }`.
+// https://docs.atlas.mongodb.com/reference/atlas-search/scoring/
+func SearchScore(field Path) SortSpec {
+	return query.SearchScore(field)
+}
@@ -1,5 +1,11 @@
 package aggregation
 
+import (
+	"github.com/NateScarlet/mongo-operators/pkg/geojson"
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
 // AddFields to documents. Similar to $project, $addFields reshapes
 // each document in the stream; specifically, by adding new fields
 // to output documents that contain both the existing fields from
@@ -109,6 +115,46 @@ func CurrentOp(options interface{}) M {
 	return M{"$currentOp": options}
 }
 
+// DensifyStage returned from Densify
+type DensifyStage M
+
+// Densify creates new documents in a sequence of documents
+// where certain values in field are missing.
+// New in version 5.1.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/densify/
+func Densify(field Path) DensifyStage {
+	return DensifyStage{"$densify": M{"field": field.String()}}
+}
+
+// SetRange specifies how data is densified, it is required.
+//
+// step is the amount to increment the field value in each document.
+// unit is required when field is a date, use empty string for numeric field.
+// bounds is "full", "partition" or a two element array of lower and upper bound.
+func (stage DensifyStage) SetRange(step interface{}, unit SetWindowFieldsUnit, bounds interface{}) DensifyStage {
+	var r = M{"step": step, "bounds": bounds}
+	if unit != "" {
+		r["unit"] = unit
+	}
+	stage["$densify"].(M)["range"] = r
+	return stage
+}
+
+// SetPartitionByFields specifies fields to group documents,
+// each group is densified separately.
+func (stage DensifyStage) SetPartitionByFields(fields ...Path) DensifyStage {
+	stage["$densify"].(M)["partitionByFields"] = fieldNames(fields)
+	return stage
+}
+
+func fieldNames(fields []Path) []string {
+	var ret = make([]string, 0, len(fields))
+	for _, i := range fields {
+		ret = append(ret, i.String())
+	}
+	return ret
+}
+
 // Facet Processes multiple aggregation pipelines within a single stage
 // on the same set of input documents.
 // Enables the creation of multi-faceted aggregations capable of
@@ -118,6 +164,68 @@ func Facet(outputs interface{}) M {
 	return M{"$facet": outputs}
 }
 
+// FillStage returned from Fill
+type FillStage M
+
+// FillStageOutput returned from FillOutputMethod and FillOutputValue
+type FillStageOutput M
+
+// FillMethod for FillOutputMethod
+type FillMethod string
+
+const (
+	FillLOCF   FillMethod = "locf"
+	FillLinear FillMethod = "linear"
+)
+
+// FillOutputMethod fills null and missing values of field with method.
+// FillLinear requires sort by of the stage.
+func FillOutputMethod(field Path, method FillMethod) FillStageOutput {
+	return FillStageOutput{field.String(): M{"method": method}}
+}
+
+// FillOutputValue fills null and missing values of field with value expression.
+func FillOutputValue(field Path, value interface{}) FillStageOutput {
+	return FillStageOutput{field.String(): M{"value": value}}
+}
+
+// Fill populates null and missing field values within documents.
+// New in version 5.3.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/fill/
+func Fill(outputs ...FillStageOutput) FillStage {
+	var output = M{}
+	for _, i := range outputs {
+		for k, v := range i {
+			output[k] = v
+		}
+	}
+	return FillStage{
+		"$fill": M{
+			"output": output,
+		},
+	}
+}
+
+// SetPartitionBy specifies an expression to group the documents,
+// can not be used with SetPartitionByFields.
+func (stage FillStage) SetPartitionBy(expression interface{}) FillStage {
+	stage["$fill"].(M)["partitionBy"] = expression
+	return stage
+}
+
+// SetPartitionByFields specifies fields to group the documents,
+// can not be used with SetPartitionBy.
+func (stage FillStage) SetPartitionByFields(fields ...Path) FillStage {
+	stage["$fill"].(M)["partitionByFields"] = fieldNames(fields)
+	return stage
+}
+
+// SetSortBy specifies the field(s) to sort the documents by in each partition.
+func (stage FillStage) SetSortBy(sort SortSpec) FillStage {
+	stage["$fill"].(M)["sortBy"] = sort
+	return stage
+}
+
 // GeoNearStage returned from GeoNear
 type GeoNearStage M
 
@@ -125,11 +233,12 @@ type GeoNearStage M
 // a geospatial point. Incorporates the functionality of $match, $sort,
 // and $limit for geospatial data. The output documents include an additional
 // distance field and can include a location identifier field.
+// near is a geojson.Point or a legacy coordinate pair.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/geoNear/
-func GeoNear(near interface{}, distanceField string) GeoNearStage {
+func GeoNear(near interface{}, distanceField Path) GeoNearStage {
 	return GeoNearStage{"$geoNear": M{
 		"near":          near,
-		"distanceField": distanceField,
+		"distanceField": distanceField.String(),
 	}}
 }
 
@@ -157,9 +266,24 @@ func (stage GeoNearStage) SetDistanceMultiplier(v float64) GeoNearStage {
 	return stage
 }
 
+// SetDistanceUnit sets distance multiplier to output distance in unit,
+// e.g. geojson.Kilometer or geojson.Mile.
+// Distance is in meters when near is GeoJSON point,
+// otherwise it is in radians and requires SetSpherical(true).
+// maxDistance and minDistance are not affected.
+func (stage GeoNearStage) SetDistanceUnit(unit geojson.Distance) GeoNearStage {
+	var multiplier = float64(geojson.Meter / unit)
+	if n, err := bsonutil.Normalize(stage["$geoNear"].(M)["near"]); err == nil {
+		if _, ok := n.(primitive.A); ok {
+			multiplier = float64(geojson.EarthRadius / unit)
+		}
+	}
+	return stage.SetDistanceMultiplier(multiplier)
+}
+
 // SetIncludeLocs option
-func (stage GeoNearStage) SetIncludeLocs(v string) GeoNearStage {
-	stage["$geoNear"].(M)["includeLocs"] = v
+func (stage GeoNearStage) SetIncludeLocs(v Path) GeoNearStage {
+	stage["$geoNear"].(M)["includeLocs"] = v.String()
 	return stage
 }
 
@@ -176,8 +300,8 @@ func (stage GeoNearStage) SetMinDistance(v float64) GeoNearStage {
 }
 
 // SetKey option
-func (stage GeoNearStage) SetKey(v string) GeoNearStage {
-	stage["$geoNear"].(M)["key"] = v
+func (stage GeoNearStage) SetKey(v Path) GeoNearStage {
+	stage["$geoNear"].(M)["key"] = v.String()
 	return stage
 }
 
@@ -188,13 +312,13 @@ type GraphLookupStage M
 // To each output document, adds a new array field that contains
 // the traversal results of the recursive search for that document.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/graphLookup/
-func GraphLookup(from string, startWith interface{}, connectFromField string, connectToField string, as string) GraphLookupStage {
+func GraphLookup(from string, startWith interface{}, connectFromField Path, connectToField Path, as Path) GraphLookupStage {
 	return GraphLookupStage{"$graphLookup": M{
 		"from":             from,
 		"startWith":        startWith,
-		"connectFromField": connectFromField,
-		"connectToField":   connectToField,
-		"as":               as,
+		"connectFromField": connectFromField.String(),
+		"connectToField":   connectToField.String(),
+		"as":               as.String(),
 	}}
 }
 
@@ -205,8 +329,8 @@ func (stage GraphLookupStage) SetMaxDepth(v int) GraphLookupStage {
 }
 
 // SetDepthField option
-func (stage GraphLookupStage) SetDepthField(v string) GraphLookupStage {
-	stage["$graphLookup"].(M)["depthField"] = v
+func (stage GraphLookupStage) SetDepthField(v Path) GraphLookupStage {
+	stage["$graphLookup"].(M)["depthField"] = v.String()
 	return stage
 }
 
@@ -262,12 +386,12 @@ func ListSessions(args interface{}) M {
 // with a field from the documents of the “joined” collection.
 // New in version 3.2.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/lookup/#equality-match
-func LookupF(from, localField, foreignField, as string) M {
+func LookupF(from string, localField, foreignField, as Path) M {
 	return M{"$lookup": M{
 		"from":         from,
-		"localField":   localField,
-		"foreignField": foreignField,
-		"as":           as,
+		"localField":   localField.String(),
+		"foreignField": foreignField.String(),
+		"as":           as.String(),
 	}}
 }
 
@@ -275,11 +399,11 @@ func LookupF(from, localField, foreignField, as string) M {
 // as well as allow other join conditions besides a single equality match.
 // New in version 3.2.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/lookup/#join-conditions-and-uncorrelated-sub-queries
-func LookupP(from string, let M, pipeline A, as string) M {
+func LookupP(from string, let M, pipeline A, as Path) M {
 	var opts = M{
 		"from":     from,
 		"pipeline": pipeline,
-		"as":       as,
+		"as":       as.String(),
 	}
 	if let != nil {
 		opts["let"] = let
@@ -399,12 +523,21 @@ func Sample(size int) M {
 // Search aggregation pipleline stage performs a full-text search
 // of the field or fields in an Atlas collection.
 // The fields must be covered by an Atlas Search index.
+// Build args with package search, e.g. search.New(search.Text("title", "mongo")).
 // https://docs.mongodb.com/manual/reference/operator/aggregation/search/
 // https://docs.atlas.mongodb.com/atlas-search/query-syntax/
 func Search(args interface{}) M {
 	return M{"$search": args}
 }
 
+// SearchMeta returns metadata result documents of an Atlas Search query,
+// e.g. count or facet results, without matched documents.
+// New in version 4.4.9.
+// https://docs.atlas.mongodb.com/reference/atlas-search/query-syntax/#-searchmeta
+func SearchMeta(args interface{}) M {
+	return M{"$searchMeta": args}
+}
+
 // Set Adds new fields to documents.
 // Similar to $project, $set reshapes each document in the stream;
 // specifically, by adding new fields to output documents that contain
@@ -521,7 +654,7 @@ func (stage SetWindowFieldsStage) SetPartitionBy(expression interface{}) SetWind
 
 // SetSortBy specifies the field(s) to sort the documents by in the partition.
 // Uses the same syntax as the $sort stage. Default is no sorting.
-func (stage SetWindowFieldsStage) SetSortBy(sort interface{}) SetWindowFieldsStage {
+func (stage SetWindowFieldsStage) SetSortBy(sort SortSpec) SetWindowFieldsStage {
 	stage["$setWindowFields"].(M)["sortBy"] = sort
 	return stage
 }
@@ -538,7 +671,7 @@ func Skip(n int) M {
 // Sort reorders the document stream by a specified sort key. Only the order changes;
 // the documents remain unmodified. For each input document, outputs one document.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/sort/
-func Sort(order interface{}) M {
+func Sort(order SortSpec) M {
 	return M{"$sort": order}
 }
 
@@ -569,11 +702,11 @@ func UnionWith(collection string, pipeline interface{}) M {
 // Unset removes/excludes fields from documents.
 // New in version 4.2.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/unset/
-func Unset(fields ...string) M {
+func Unset(fields ...Path) M {
 	if len(fields) == 1 {
-		return M{"$unset": fields[0]}
+		return M{"$unset": fields[0].String()}
 	}
-	return M{"$unset": fields}
+	return M{"$unset": fieldNames(fields)}
 }
 
 // UnwindStage returned from Unwind
@@ -584,17 +717,14 @@ type UnwindStage M
 // with an element value. For each input document, outputs n documents
 // where n is the number of array elements and can be zero for an empty array.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/unwind
-func Unwind(path string) UnwindStage {
-	if path[0] != '$' {
-		path = "$" + path
-	}
-	return UnwindStage{"$unwind": path}
+func Unwind(path Path) UnwindStage {
+	return UnwindStage{"$unwind": path.Ref()}
 }
 
 // SetIncludeArrayIndex option
-func (o UnwindStage) SetIncludeArrayIndex(v string) UnwindStage {
+func (o UnwindStage) SetIncludeArrayIndex(v Path) UnwindStage {
 	o["$unwind"] = wrap(o["$unwind"], "path")
-	o["$unwind"].(M)["includeArrayIndex"] = v
+	o["$unwind"].(M)["includeArrayIndex"] = v.String()
 	return o
 }
 
@@ -605,3 +735,52 @@ func (o UnwindStage) SetPreserveNullAndEmptyArrays(v bool) UnwindStage {
 	o["$unwind"].(M)["preserveNullAndEmptyArrays"] = v
 	return o
 }
+
+// VectorSearchStage returned from VectorSearch
+type VectorSearchStage M
+
+// VectorSearch performs an approximate nearest neighbor search
+// on path indexed as vector type in an Atlas Vector Search index,
+// and returns at most limit documents ordered by similarity.
+// Access the similarity with Meta(MetaVectorSearchScore).
+// numCandidates is required unless SetExact(true) is used.
+// New in version 6.0.11.
+// https://www.mongodb.com/docs/atlas/atlas-vector-search/vector-search-stage/
+func VectorSearch(index string, path Path, queryVector interface{}, limit int) VectorSearchStage {
+	return VectorSearchStage{"$vectorSearch": M{
+		"index":       index,
+		"path":        path.String(),
+		"queryVector": queryVector,
+		"limit":       limit,
+	}}
+}
+
+// SetNumCandidates number of nearest neighbors to use during the search,
+// must be greater than or equal to limit.
+func (stage VectorSearchStage) SetNumCandidates(v int) VectorSearchStage {
+	stage["$vectorSearch"].(M)["numCandidates"] = v
+	return stage
+}
+
+// SetFilter pre-filters documents on fields indexed as filter type,
+// e.g. query.M{"year": query.Gte(2000)}.
+// Only $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $not,
+// $and, $or and $nor are supported.
+// SetFilter panics when filter uses other operators.
+func (stage VectorSearchStage) SetFilter(filter interface{}) VectorSearchStage {
+	if d, err := bsonutil.Doc(filter); err == nil {
+		var v validator
+		v.vectorSearchFilter("filter", d)
+		for _, i := range v.issues {
+			panic("SetFilter: " + i.Path + ": " + i.Message)
+		}
+	}
+	stage["$vectorSearch"].(M)["filter"] = filter
+	return stage
+}
+
+// SetExact runs exact nearest neighbor search instead of approximate one.
+func (stage VectorSearchStage) SetExact(v bool) VectorSearchStage {
+	stage["$vectorSearch"].(M)["exact"] = v
+	return stage
+}
@@ -0,0 +1,31 @@
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/NateScarlet/mongo-operators/pkg/geojson"
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGeoNearSetDistanceUnit(t *testing.T) {
+	var distanceMultiplier = func(stage GeoNearStage) interface{} {
+		return stage["$geoNear"].(M)["distanceMultiplier"]
+	}
+	assert.Equal(t, 0.001, distanceMultiplier(GeoNear(geojson.Point{1, 2}, "d").SetDistanceUnit(geojson.Kilometer)))
+	assert.Equal(t, 1/1609.344, distanceMultiplier(GeoNear(M{"type": "Point", "coordinates": A{1, 2}}, "d").SetDistanceUnit(geojson.Mile)))
+	assert.Equal(t, 6378.1, distanceMultiplier(GeoNear(A{1, 2}, "d").SetSpherical(true).SetDistanceUnit(geojson.Kilometer)))
+	assert.InDelta(t, 3963.2, distanceMultiplier(GeoNear([]float64{1, 2}, "d").SetSpherical(true).SetDistanceUnit(geojson.Mile)), 0.1)
+}
+
+func TestVectorSearchSetFilter(t *testing.T) {
+	var stage = VectorSearch("index", "embedding", A{0.1}, 10).
+		SetFilter(query.M{"year": query.Gte(2000), "$or": A{M{"genre": query.In(A{"a", "b"})}}})
+	assert.Equal(t, query.M{"year": query.Gte(2000), "$or": A{M{"genre": query.In(A{"a", "b"})}}}, stage["$vectorSearch"].(M)["filter"])
+	assert.PanicsWithValue(t, "SetFilter: filter.$text: $text is not supported in $vectorSearch filter", func() {
+		VectorSearch("index", "embedding", A{0.1}, 10).SetFilter(M{"$text": M{"$search": "a"}})
+	})
+	assert.PanicsWithValue(t, "SetFilter: filter.$or[0].title.$not.$regex: $regex is not supported in $vectorSearch filter", func() {
+		VectorSearch("index", "embedding", A{0.1}, 10).SetFilter(M{"$or": A{M{"title": query.Not(M{"$regex": "^a"})}}})
+	})
+}
@@ -2,7 +2,18 @@ package aggregation
 
 // https://docs.mongodb.com/manual/reference/operator/aggregation/#text-expression-operator
 
-// Meta access text search metadata.
+// Metadata keywords of Meta.
+const (
+	MetaTextScore          = "textScore"
+	MetaIndexKey           = "indexKey"
+	MetaSearchScore        = "searchScore"
+	MetaSearchHighlights   = "searchHighlights"
+	MetaSearchScoreDetails = "searchScoreDetails"
+	MetaVectorSearchScore  = "vectorSearchScore"
+)
+
+// Meta access text search metadata, metaDataKeyword is one of Meta* constants,
+// e.g. Meta(MetaSearchScore) for score of $search.
 // https://docs.mongodb.com/manual/reference/operator/aggregation/meta/
 func Meta(metaDataKeyword string) M {
 	return M{"$meta": metaDataKeyword}
@@ -0,0 +1,235 @@
+package aggregation
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UpdatePipeline is an aggregation pipeline used as update of
+// update commands (e.g. UpdateOne, UpdateMany, findAndModify),
+// only stages allowed in that context can be added:
+//
+//	UpdatePipeline{}.Set(M{"total": Add("$a", "$b")}).Unset("a", "b")
+//
+// New in version 4.2.
+// https://docs.mongodb.com/manual/tutorial/update-with-aggregation-pipeline/
+type UpdatePipeline A
+
+func (p UpdatePipeline) with(stage M) UpdatePipeline {
+	var ret = make(UpdatePipeline, len(p), len(p)+1)
+	copy(ret, p)
+	return append(ret, stage)
+}
+
+// AddFields adds a $addFields stage.
+func (p UpdatePipeline) AddFields(fields interface{}) UpdatePipeline {
+	return p.with(AddFields(fields))
+}
+
+// Set adds a $set stage.
+func (p UpdatePipeline) Set(fields interface{}) UpdatePipeline {
+	return p.with(Set(fields))
+}
+
+// Project adds a $project stage.
+func (p UpdatePipeline) Project(specifications interface{}) UpdatePipeline {
+	return p.with(Project(specifications))
+}
+
+// Unset adds a $unset stage.
+func (p UpdatePipeline) Unset(fields ...Path) UpdatePipeline {
+	return p.with(Unset(fields...))
+}
+
+// ReplaceRoot adds a $replaceRoot stage.
+func (p UpdatePipeline) ReplaceRoot(newRoot interface{}) UpdatePipeline {
+	return p.with(ReplaceRoot(newRoot))
+}
+
+// ReplaceWith adds a $replaceWith stage.
+func (p UpdatePipeline) ReplaceWith(replacementDocument interface{}) UpdatePipeline {
+	return p.with(ReplaceWith(replacementDocument))
+}
+
+// A returns update pipeline as array.
+func (p UpdatePipeline) A() A {
+	return A(p)
+}
+
+// UpdateToPipeline translates a classic update document
+// (e.g. built with query.MergeOperators) to an equivalent UpdatePipeline,
+// so it can be extended with expressions that refer to other fields.
+//
+// Supported operators: $set, $unset, $inc, $mul, $min, $max, $rename,
+// $currentDate, $push (with $each, $position, $sort and $slice),
+// $addToSet, $pop, $pull (value only) and $pullAll.
+// $push with $sort uses $sortArray, that requires server 5.2.
+// $setOnInsert, $bit, $pull with a condition and
+// positional operators in field path returns an error.
+//
+// Field paths are resolved as aggregation field paths,
+// a numeric path component is a field name instead of an array index.
+func UpdateToPipeline(update interface{}) (UpdatePipeline, error) {
+	if issues := query.ValidateUpdate(update); len(issues) > 0 {
+		return nil, fmt.Errorf("aggregation: invalid update: %s", issues[0])
+	}
+	n, err := bsonutil.Normalize(bsonutil.Ordered(update, false))
+	if err != nil {
+		return nil, err
+	}
+	d, ok := n.(primitive.D)
+	if !ok {
+		return nil, fmt.Errorf("aggregation: update must be a document, got %s", typeName(n))
+	}
+	var t = new(updateTranslator)
+	for _, e := range d {
+		if !strings.HasPrefix(e.Key, "$") {
+			return nil, fmt.Errorf("aggregation: %s: not an update operator", e.Key)
+		}
+		fields, ok := e.Value.(primitive.D)
+		if !ok {
+			return nil, fmt.Errorf("aggregation: %s: requires a document", e.Key)
+		}
+		for _, i := range fields {
+			if err := t.operator(e.Key, i.Key, i.Value); err != nil {
+				return nil, fmt.Errorf("aggregation: %s.%s: %w", e.Key, i.Key, err)
+			}
+		}
+	}
+	var ret = UpdatePipeline{}
+	if len(t.set) > 0 {
+		ret = ret.Set(t.set)
+	}
+	if len(t.unset) > 0 {
+		ret = ret.Unset(t.unset...)
+	}
+	return ret, nil
+}
+
+type updateTranslator struct {
+	set   D
+	unset []Path
+}
+
+func (t *updateTranslator) operator(op, field string, value interface{}) error {
+	for _, i := range strings.Split(field, ".") {
+		if strings.HasPrefix(i, "$") {
+			return errors.New("positional operator is not supported")
+		}
+	}
+	var ref = Path(field).Ref()
+	var expr interface{}
+	switch op {
+	case "$set":
+		expr = literalValue(value)
+	case "$unset":
+		t.unset = append(t.unset, Path(field))
+		return nil
+	case "$inc":
+		expr = Add(IfNull(ref, 0), value)
+	case "$mul":
+		expr = Multiply(IfNull(ref, 0), value)
+	case "$min":
+		expr = Min(ref, literalValue(value))
+	case "$max":
+		expr = Max(ref, literalValue(value))
+	case "$rename":
+		s, ok := value.(string)
+		if !ok {
+			return errors.New("requires a string")
+		}
+		var to = Path(s)
+		t.set = append(t.set, E{
+			Key:   to.String(),
+			Value: Cond(Eq(Type(ref), "missing"), to.Ref(), ref),
+		})
+		t.unset = append(t.unset, Path(field))
+		return nil
+	case "$currentDate":
+		expr = "$$NOW"
+		if d, ok := value.(primitive.D); ok {
+			if v, _ := bsonutil.Get(d, "$type"); v == "timestamp" {
+				expr = "$$CLUSTER_TIME"
+			}
+		}
+	case "$push":
+		expr = pushExpr(ref, value)
+	case "$addToSet":
+		var values = primitive.A{value}
+		if d, ok := value.(primitive.D); ok {
+			if v, ok := bsonutil.Get(d, "$each"); ok {
+				values = v.(primitive.A)
+			}
+		}
+		expr = Reduce(
+			Literal(values),
+			IfNull(ref, A{}),
+			Cond(In("$$this", "$$value"), "$$value", ConcatArrays("$$value", A{"$$this"})),
+		)
+	case "$pop":
+		var n interface{} = Subtract(Size(ref), 1)
+		if v, _ := bsonutil.Int64(value); v < 0 {
+			n = Subtract(1, Size(ref))
+		}
+		expr = Cond(IsArray(ref), Slice(ref, n), ref)
+	case "$pull":
+		if _, ok := value.(primitive.D); ok {
+			return errors.New("condition is not supported")
+		}
+		expr = Cond(IsArray(ref), Filter(ref, Ne("$$this", literalValue(value))), ref)
+	case "$pullAll":
+		expr = Cond(IsArray(ref), Filter(ref, Not(In("$$this", Literal(value)))), ref)
+	case "$setOnInsert":
+		return errors.New("has no equivalent in update pipeline")
+	default:
+		return errors.New("operator is not supported")
+	}
+	t.set = append(t.set, E{Key: field, Value: expr})
+	return nil
+}
+
+func pushExpr(ref string, value interface{}) interface{} {
+	var base = IfNull(ref, A{})
+	var d, _ = value.(primitive.D)
+	var each, ok = bsonutil.Get(d, "$each")
+	if !ok {
+		return ConcatArrays(base, A{literalValue(value)})
+	}
+	var ret interface{} = ConcatArrays(base, Literal(each))
+	if v, ok := bsonutil.Get(d, "$position"); ok {
+		var index interface{} = v
+		if n, _ := bsonutil.Int64(v); n < 0 {
+			index = Max(0, Add(Size(base), v))
+		}
+		ret = ConcatArrays(
+			Slice(base, index),
+			Literal(each),
+			Slice(base, Add(Size(base), 1)).SetPos(index),
+		)
+	}
+	if v, ok := bsonutil.Get(d, "$sort"); ok {
+		ret = SortArray(ret, v)
+	}
+	if v, ok := bsonutil.Get(d, "$slice"); ok {
+		ret = Slice(ret, v)
+	}
+	return ret
+}
+
+// literalValue wraps v with $literal when it may be parsed as an expression.
+func literalValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "$") {
+			return Literal(v)
+		}
+	case primitive.D, primitive.A:
+		return Literal(v)
+	}
+	return v
+}
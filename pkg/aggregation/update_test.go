@@ -0,0 +1,131 @@
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUpdatePipeline(t *testing.T) {
+	var p = UpdatePipeline{}.Set(M{"a": 1})
+	var p2 = p.Unset("b", "c")
+	assert.Equal(t, A{M{"$set": M{"a": 1}}}, p.A())
+	assert.Equal(t, A{M{"$set": M{"a": 1}}, M{"$unset": []string{"b", "c"}}}, p2.A())
+	assert.Empty(t, Validate(p2.A()))
+	assert.Empty(t, query.ValidateUpdate(p2))
+}
+
+func TestUpdateToPipeline(t *testing.T) {
+	var doc = bson.D{
+		{Key: "_id", Value: 1},
+		{Key: "n", Value: 2},
+		{Key: "s", Value: "x"},
+		{Key: "tags", Value: A{"a", "b", "c"}},
+		{Key: "obj", Value: bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 2}}},
+	}
+	for _, c := range []struct {
+		name   string
+		update interface{}
+		want   bson.D
+	}{
+		{"set", query.Set(M{"s": "$y", "obj": M{"c": 3}, "n": 3}), bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "n", Value: int32(3)},
+			{Key: "s", Value: "$y"},
+			{Key: "tags", Value: A{"a", "b", "c"}},
+			{Key: "obj", Value: bson.D{{Key: "c", Value: int32(3)}}},
+		}},
+		{"inc and mul", query.MergeOperators(
+			query.Inc(M{"n": 1, "m": 2}),
+			query.Mul(M{"x": 2}),
+			query.Unset(M{"tags": "", "obj": ""}),
+		), bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "n", Value: int32(3)},
+			{Key: "s", Value: "x"},
+			{Key: "m", Value: int32(2)},
+			{Key: "x", Value: int32(0)},
+		}},
+		{"min max", query.MergeOperators(query.Min(M{"n": 1}), query.Max(M{"obj.a": 5})), bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "n", Value: int32(1)},
+			{Key: "s", Value: "x"},
+			{Key: "tags", Value: A{"a", "b", "c"}},
+			{Key: "obj", Value: bson.D{{Key: "a", Value: int32(5)}, {Key: "b", Value: int32(2)}}},
+		}},
+		{"rename", query.Rename(bson.D{{Key: "s", Value: "t"}, {Key: "missing", Value: "n"}}), bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "n", Value: int32(2)},
+			{Key: "tags", Value: A{"a", "b", "c"}},
+			{Key: "obj", Value: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(2)}}},
+			{Key: "t", Value: "x"},
+		}},
+		{"push", query.Push(bson.D{
+			{Key: "tags", Value: query.Each(A{"z", "y"}).Position(-1).Slice(-4)},
+			{Key: "new", Value: "$v"},
+		}), bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "n", Value: int32(2)},
+			{Key: "s", Value: "x"},
+			{Key: "tags", Value: A{"b", "z", "y", "c"}},
+			{Key: "obj", Value: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(2)}}},
+			{Key: "new", Value: A{"$v"}},
+		}},
+		{"push sort", query.Push(M{"tags": query.Each(A{"d", "0"}).Position(0).SortElements(-1)}), bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "n", Value: int32(2)},
+			{Key: "s", Value: "x"},
+			{Key: "tags", Value: A{"d", "c", "b", "a", "0"}},
+			{Key: "obj", Value: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(2)}}},
+		}},
+		{"array", query.MergeOperators(
+			query.AddToSet(M{"tags": query.Each(A{"a", "d", "d"})}),
+			query.Pop(M{"missing": 1}),
+			query.PullAll(M{"obj": A{1}}),
+		), bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "n", Value: int32(2)},
+			{Key: "s", Value: "x"},
+			{Key: "tags", Value: A{"a", "b", "c", "d"}},
+			{Key: "obj", Value: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(2)}}},
+		}},
+		{"pop and pull", bson.D{
+			{Key: "$pop", Value: M{"tags": -1}},
+			{Key: "$pull", Value: M{"other": "a"}},
+		}, bson.D{
+			{Key: "_id", Value: int32(1)},
+			{Key: "n", Value: int32(2)},
+			{Key: "s", Value: "x"},
+			{Key: "tags", Value: A{"b", "c"}},
+			{Key: "obj", Value: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(2)}}},
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := UpdateToPipeline(c.update)
+			require.NoError(t, err)
+			assert.Empty(t, query.ValidateUpdate(p))
+			var res = runPipeline(t, p.A(), doc)
+			require.Len(t, res, 1)
+			assert.Equal(t, c.want, res[0])
+		})
+	}
+}
+
+func TestUpdateToPipelineError(t *testing.T) {
+	for _, c := range []struct {
+		update interface{}
+		err    string
+	}{
+		{query.SetOnInsert(M{"a": 1}), "aggregation: $setOnInsert.a: has no equivalent in update pipeline"},
+		{query.Set(M{"a.$": 1}), "aggregation: $set.a.$: positional operator is not supported"},
+		{query.Pull(M{"a": query.Gt(1)}), "aggregation: $pull.a: condition is not supported"},
+		{query.Bit(M{"a": M{"and": 1}}), "aggregation: $bit.a: operator is not supported"},
+		{M{"a": 1}, "aggregation: a: not an update operator"},
+	} {
+		_, err := UpdateToPipeline(c.update)
+		assert.EqualError(t, err, c.err)
+	}
+}
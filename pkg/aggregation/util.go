@@ -35,10 +35,28 @@ func Unless(expr M, v bool) M {
 //   to="hour"   -> ISODate("2001-02-03T15:00:00Z")
 //   to="minute" -> ISODate("2001-02-03T15:04:00Z")
 //   to="second" -> ISODate("2001-02-03T15:04:05Z")
+//   to="week"   -> ISODate("2001-01-28T00:00:00Z"), week starts on sunday
+//   to="quarter" -> ISODate("2001-01-01T00:00:00Z")
+//
+// Date is rebuilt from parts with $dateFromParts,
+// use DateTruncForVersion to use native $dateTrunc when server supports it.
 func DateTrunc(to string, date interface{}, timezone string) M {
 	var ret = DateFromPartsC(Year(date).SetTimezone(timezone)).
 		SetTimezone(timezone)
 	switch to {
+	case "week":
+		// $dateFromParts carries out of range day to previous month.
+		ret.SetDay(Subtract(
+			DayOfMonth(date).SetTimezone(timezone),
+			Subtract(DayOfWeek(date).SetTimezone(timezone), 1),
+		))
+		ret.SetMonth(Month(date).SetTimezone(timezone))
+	case "quarter":
+		var month = Month(date).SetTimezone(timezone)
+		ret.SetMonth(Subtract(month, Mod(Subtract(month, 1), 3)))
+	case "millisecond":
+		ret.SetMillisecond(Millisecond(date).SetTimezone(timezone))
+		fallthrough
 	case "second":
 		ret.SetSecond(Second(date).SetTimezone(timezone))
 		fallthrough
@@ -56,3 +74,22 @@ func DateTrunc(to string, date interface{}, timezone string) M {
 	}
 	return M(ret)
 }
+
+// DateTruncForVersion is DateTrunc for server of version,
+// native $dateTrunc is used when version is at least 5.0.
+// It panics when to is not a TimeUnit.
+func DateTruncForVersion(version Version, to string, date interface{}, timezone string) M {
+	switch TimeUnit(to) {
+	case TUYear, TUQuarter, TUMonth, TUWeek, TUDay, TUHour, TUMinute, TUSecond, TUMillisecond:
+	default:
+		panic("DateTruncForVersion: unknown unit: " + to)
+	}
+	if version.Compare("5.0") < 0 {
+		return DateTrunc(to, date, timezone)
+	}
+	var ret = DateTruncNative(date, TimeUnit(to))
+	if timezone != "" {
+		ret.SetTimezone(timezone)
+	}
+	return M(ret)
+}
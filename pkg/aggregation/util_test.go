@@ -13,3 +13,21 @@ func TestUnless(t *testing.T) {
 	res = Unless(M{"$eq": A{1, 1}}, false)
 	assert.Equal(t, M{"$not": M{"$eq": A{1, 1}}}, res)
 }
+
+func TestDateTrunc(t *testing.T) {
+	assert.Equal(t, M{"$dateFromParts": M{
+		"year":     YearOperator{"$year": M{"date": "$at", "timezone": "UTC"}},
+		"month":    MonthOperator{"$month": M{"date": "$at", "timezone": "UTC"}},
+		"timezone": "UTC",
+	}}, DateTrunc("month", "$at", "UTC"))
+	assert.Equal(t, DateTrunc("month", "$at", "UTC"), DateTruncForVersion("4.4", "month", "$at", "UTC"))
+	assert.Equal(t, M{"$dateTrunc": M{"date": "$at", "unit": TUMonth, "timezone": "UTC"}}, DateTruncForVersion("5.0", "month", "$at", "UTC"))
+	assert.Equal(t, M{"$dateTrunc": M{"date": "$at", "unit": TUWeek}}, DateTruncForVersion("6.0", "week", "$at", ""))
+	assert.Panics(t, func() { DateTruncForVersion("4.4", "fortnight", "$at", "") })
+}
+
+func TestGetField(t *testing.T) {
+	assert.Equal(t, M{"$getField": M{"field": "a.b", "input": "$$ROOT"}}, GetField("a.b", "$$ROOT"))
+	assert.Equal(t, M{"$getField": M{"field": Literal("$price"), "input": "$$ROOT"}}, GetField(Literal("$price"), "$$ROOT"))
+	assert.Equal(t, M{"$unsetField": M{"field": "$price", "input": "$$ROOT"}}, UnsetField("$price", "$$ROOT"))
+}
@@ -0,0 +1,991 @@
+package aggregation
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Issue is a structural problem found by Validate.
+type Issue struct {
+	// Stage is index of the offending stage in validated pipeline,
+	// issues inside sub-pipelines ($facet, $lookup, $unionWith)
+	// use index of the outer stage.
+	Stage int
+	// Path locates the offending value in the stage document,
+	// keys are joined by "." and array indexes are written as "[i]",
+	// e.g. "$group.total.$push" or "$facet.byTag[1].$out".
+	Path    string
+	Message string
+}
+
+func (i Issue) String() string {
+	var ret = fmt.Sprintf("stage %d", i.Stage)
+	if i.Path != "" {
+		ret += ": " + i.Path
+	}
+	return ret + ": " + i.Message
+}
+
+// Validate walks a pipeline built with this package and reports
+// structural problems that would be rejected by server, e.g.
+// $out or $merge that is not the last stage, $search that is not the first stage,
+// $push accumulator used outside $group, or unknown operators.
+// Filters in $match are checked with query.ValidateFilter.
+//
+// It does not require a server and returns nil when no issue found.
+func Validate(pipeline A) []Issue {
+	var v = new(validator)
+	n, err := bsonutil.Normalize(pipeline)
+	if err != nil {
+		for index, i := range pipeline {
+			if path, err := unmarshalable("", i); err != nil {
+				v.stage = index
+				v.report(path, "%s", err)
+			}
+		}
+		if len(v.issues) == 0 {
+			v.report("", "%s", err)
+		}
+		return v.issues
+	}
+	var stages, _ = n.(primitive.A)
+	for index, i := range stages {
+		v.stage = index
+		v.pipelineStage("", i, index, len(stages), topPipeline)
+	}
+	return v.issues
+}
+
+var marshalerType = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+
+// unmarshalable locates the innermost value of v that fails to marshal,
+// e.g. an invalid geojson geometry, and returns its path and the error.
+func unmarshalable(path string, v interface{}) (string, error) {
+	var _, err = bsonutil.Normalize(v)
+	if err == nil || v == nil || reflect.TypeOf(v).Implements(marshalerType) {
+		return path, err
+	}
+	var rv = reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !rv.IsNil() {
+			return unmarshalable(path, rv.Elem().Interface())
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+		var keys = make([]string, 0, rv.Len())
+		for _, k := range rv.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			var value = rv.MapIndex(reflect.ValueOf(k).Convert(rv.Type().Key())).Interface()
+			if p, err := unmarshalable(query.JoinPath(path, k), value); err != nil {
+				return p, err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for index := 0; index < rv.Len(); index++ {
+			var elemPath, elem = query.IndexPath(path, index), rv.Index(index).Interface()
+			if e, ok := elem.(primitive.E); ok {
+				elemPath, elem = query.JoinPath(path, e.Key), e.Value
+			}
+			if p, err := unmarshalable(elemPath, elem); err != nil {
+				return p, err
+			}
+		}
+	}
+	return path, err
+}
+
+type pipelineKind int
+
+const (
+	topPipeline pipelineKind = iota
+	facetPipeline
+	subPipeline
+)
+
+// stagePosition marks stages that must be at a specific position.
+var stagePosition = map[string]int{
+	"$changeStream":      1,
+	"$collStats":         1,
+	"$currentOp":         1,
+	"$documents":         1,
+	"$geoNear":           1,
+	"$indexStats":        1,
+	"$listLocalSessions": 1,
+	"$listSessions":      1,
+	"$planCacheStats":    1,
+	"$search":            1,
+	"$searchMeta":        1,
+	"$vectorSearch":      1,
+	"$merge":             -1,
+	"$out":               -1,
+}
+
+// facetExcludedStages can not be used in $facet.
+var facetExcludedStages = map[string]bool{
+	"$collStats":      true,
+	"$facet":          true,
+	"$geoNear":        true,
+	"$indexStats":     true,
+	"$merge":          true,
+	"$out":            true,
+	"$planCacheStats": true,
+	"$search":         true,
+	"$searchMeta":     true,
+	"$vectorSearch":   true,
+}
+
+// operatorArity is number of arguments required by operators
+// with fixed positional arguments.
+var operatorArity = map[string]int{
+	"$arrayElemAt":   2,
+	"$atan2":         2,
+	"$cmp":           2,
+	"$divide":        2,
+	"$eq":            2,
+	"$gt":            2,
+	"$gte":           2,
+	"$in":            2,
+	"$log":           2,
+	"$lt":            2,
+	"$lte":           2,
+	"$mod":           2,
+	"$ne":            2,
+	"$pow":           2,
+	"$setDifference": 2,
+	"$setIsSubset":   2,
+	"$split":         2,
+	"$strcasecmp":    2,
+	"$subtract":      2,
+}
+
+// namedArguments is required arguments of operators
+// that takes a document argument.
+var namedArguments = map[string][]string{
+	"$accumulator":    {"init", "accumulate", "accumulateArgs", "merge", "lang"},
+	"$convert":        {"input", "to"},
+	"$dateAdd":        {"startDate", "unit", "amount"},
+	"$dateDiff":       {"startDate", "endDate", "unit"},
+	"$dateFromParts":  {},
+	"$dateFromString": {"dateString"},
+	"$dateToParts":    {"date"},
+	"$dateSubtract":   {"startDate", "unit", "amount"},
+	"$dateToString":   {"date"},
+	"$dateTrunc":      {"date", "unit"},
+	"$bottom":         {"sortBy", "output"},
+	"$bottomN":        {"n", "sortBy", "output"},
+	"$filter":         {"input", "cond"},
+	"$firstN":         {"input", "n"},
+	"$function":       {"body", "args", "lang"},
+	"$let":            {"vars", "in"},
+	"$lastN":          {"input", "n"},
+	"$ltrim":          {"input"},
+	"$maxN":           {"input", "n"},
+	"$median":         {"input", "method"},
+	"$minN":           {"input", "n"},
+	"$map":            {"input", "in"},
+	"$percentile":     {"input", "p", "method"},
+	"$reduce":         {"input", "initialValue", "in"},
+	"$regexFind":      {"input", "regex"},
+	"$regexFindAll":   {"input", "regex"},
+	"$regexMatch":     {"input", "regex"},
+	"$replaceAll":     {"input", "find", "replacement"},
+	"$replaceOne":     {"input", "find", "replacement"},
+	"$rtrim":          {"input"},
+	"$setField":       {"field", "input", "value"},
+	"$sortArray":      {"input", "sortBy"},
+	"$switch":         {"branches"},
+	"$top":            {"sortBy", "output"},
+	"$topN":           {"n", "sortBy", "output"},
+	"$trim":           {"input"},
+	"$unsetField":     {"field", "input"},
+	"$zip":            {"inputs"},
+}
+
+func isAccumulatorOperator(name string) bool {
+	var _, ok = AccumulatorVersions[name]
+	return ok
+}
+
+func isExpressionOperator(name string) bool {
+	var _, ok = ExpressionVersions[name]
+	return ok
+}
+
+func isWindowOperator(name string) bool {
+	var _, ok = WindowOperatorVersions[name]
+	return ok
+}
+
+type validator struct {
+	issues []Issue
+	stage  int
+}
+
+func (v *validator) report(path, format string, args ...interface{}) {
+	v.issues = append(v.issues, Issue{
+		Stage:   v.stage,
+		Path:    path,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) pipeline(path string, value interface{}, kind pipelineKind) {
+	stages, ok := value.(primitive.A)
+	if !ok {
+		v.report(path, "pipeline must be an array")
+		return
+	}
+	if kind == facetPipeline && len(stages) == 0 {
+		v.report(path, "sub-pipeline in $facet must not be empty")
+	}
+	for index, i := range stages {
+		v.pipelineStage(query.IndexPath(path, index), i, index, len(stages), kind)
+	}
+}
+
+func (v *validator) pipelineStage(path string, value interface{}, index, count int, kind pipelineKind) {
+	d, ok := value.(primitive.D)
+	if !ok || len(d) != 1 {
+		v.report(path, "stage must be a document with exactly one field")
+		return
+	}
+	var name, arg = d[0].Key, d[0].Value
+	path = query.JoinPath(path, name)
+	if _, ok := StageVersions[name]; !ok {
+		v.report(path, "unrecognized pipeline stage name: %s", name)
+		return
+	}
+	switch kind {
+	case facetPipeline:
+		if facetExcludedStages[name] {
+			v.report(path, "%s is not allowed to be used within a $facet stage", name)
+			return
+		}
+	case subPipeline:
+		if name == "$out" || name == "$merge" {
+			v.report(path, "%s is not allowed to be used within a sub-pipeline", name)
+			return
+		}
+	}
+	switch stagePosition[name] {
+	case 1:
+		if index != 0 {
+			v.report(path, "%s is only valid as the first stage in a pipeline", name)
+		}
+	case -1:
+		if index != count-1 {
+			v.report(path, "%s can only be the final stage in the pipeline", name)
+		}
+	}
+	v.stageArgument(path, name, arg, index)
+}
+
+func (v *validator) stageArgument(path, name string, arg interface{}, index int) {
+	switch name {
+	case "$addFields", "$set":
+		d, ok := arg.(primitive.D)
+		if !ok {
+			v.report(path, "%s specification stage must be an object", name)
+			return
+		}
+		v.objectExpression(path, d)
+	case "$project":
+		v.project(path, arg)
+	case "$match":
+		v.match(path, arg, index)
+	case "$group":
+		v.group(path, arg)
+	case "$bucket", "$bucketAuto":
+		v.bucket(path, name, arg)
+	case "$setWindowFields":
+		v.setWindowFields(path, arg)
+	case "$densify":
+		v.densify(path, arg)
+	case "$fill":
+		v.fill(path, arg)
+	case "$limit":
+		if n, ok := bsonutil.Int64(arg); !ok || n <= 0 {
+			v.report(path, "the limit must be positive")
+		}
+	case "$skip":
+		if n, ok := bsonutil.Int64(arg); !ok || n < 0 {
+			v.report(path, "the skip must be a non-negative number")
+		}
+	case "$sample":
+		d, ok := arg.(primitive.D)
+		if !ok {
+			v.report(path, "the argument to $sample must be an object")
+			return
+		}
+		if size, ok := bsonutil.Get(d, "size"); !ok {
+			v.report(path, "$sample stage must specify a size")
+		} else if n, ok := bsonutil.Int64(size); !ok || n < 0 {
+			v.report(query.JoinPath(path, "size"), "size argument to $sample must not be negative")
+		}
+	case "$sort":
+		v.sort(path, arg)
+	case "$count":
+		s, ok := arg.(string)
+		switch {
+		case !ok || s == "":
+			v.report(path, "the count field must be a non-empty string")
+		case strings.HasPrefix(s, "$"):
+			v.report(path, "the count field cannot be a $-prefixed path")
+		case strings.Contains(s, "."):
+			v.report(path, "the count field cannot contain '.'")
+		}
+	case "$unset":
+		switch arg := arg.(type) {
+		case string:
+		case primitive.A:
+			if len(arg) == 0 {
+				v.report(path, "$unset specification must be a string or an array with at least one field")
+			}
+			var seen []string
+			for index, i := range arg {
+				s, ok := i.(string)
+				if !ok {
+					v.report(query.IndexPath(path, index), "$unset specification must be a string or an array containing only string values")
+					continue
+				}
+				for _, other := range seen {
+					if s == other || strings.HasPrefix(s, other+".") || strings.HasPrefix(other, s+".") {
+						v.report(query.IndexPath(path, index), "invalid $unset specification: path collision at %s", s)
+						break
+					}
+				}
+				seen = append(seen, s)
+			}
+		default:
+			v.report(path, "$unset specification must be a string or an array")
+		}
+	case "$unwind":
+		var p = path
+		if d, ok := arg.(primitive.D); ok {
+			p = query.JoinPath(path, "path")
+			arg, _ = bsonutil.Get(d, "path")
+		}
+		if s, ok := arg.(string); !ok || !strings.HasPrefix(s, "$") || strings.HasPrefix(s, "$$") {
+			v.report(p, "path option to $unwind stage should be prefixed with a '$'")
+		}
+	case "$replaceRoot":
+		d, ok := arg.(primitive.D)
+		if !ok {
+			v.report(path, "expected an object as specification for $replaceRoot stage")
+			return
+		}
+		newRoot, ok := bsonutil.Get(d, "newRoot")
+		if !ok {
+			v.report(path, "no newRoot specified for the $replaceRoot stage")
+			return
+		}
+		v.expression(query.JoinPath(path, "newRoot"), newRoot)
+	case "$replaceWith", "$redact":
+		v.expression(path, arg)
+	case "$sortByCount":
+		switch arg := arg.(type) {
+		case string:
+			if !strings.HasPrefix(arg, "$") {
+				v.report(path, "the argument to $sortByCount must be a $-prefixed path or an operator expression")
+			}
+		case primitive.D:
+			if len(arg) == 0 || !strings.HasPrefix(arg[0].Key, "$") {
+				v.report(path, "the argument to $sortByCount must be a $-prefixed path or an operator expression")
+				return
+			}
+			v.expression(path, arg)
+		default:
+			v.report(path, "the argument to $sortByCount must be a $-prefixed path or an operator expression")
+		}
+	case "$facet":
+		d, ok := arg.(primitive.D)
+		if !ok || len(d) == 0 {
+			v.report(path, "the $facet specification must be a non-empty object")
+			return
+		}
+		for _, i := range d {
+			v.pipeline(query.JoinPath(path, i.Key), i.Value, facetPipeline)
+		}
+	case "$lookup":
+		v.lookup(path, arg)
+	case "$unionWith":
+		switch arg := arg.(type) {
+		case string:
+		case primitive.D:
+			if pipeline, ok := bsonutil.Get(arg, "pipeline"); ok {
+				v.pipeline(query.JoinPath(path, "pipeline"), pipeline, subPipeline)
+			}
+		default:
+			v.report(path, "the $unionWith stage specification must be an object or string")
+		}
+	case "$graphLookup":
+		v.requireFields(path, name, arg, "from", "startWith", "connectFromField", "connectToField", "as")
+		if d, ok := arg.(primitive.D); ok {
+			if startWith, ok := bsonutil.Get(d, "startWith"); ok {
+				v.expression(query.JoinPath(path, "startWith"), startWith)
+			}
+			if filter, ok := bsonutil.Get(d, "restrictSearchWithMatch"); ok {
+				v.filter(query.JoinPath(path, "restrictSearchWithMatch"), filter)
+			}
+		}
+	case "$geoNear":
+		v.requireFields(path, name, arg, "near", "distanceField")
+		if d, ok := arg.(primitive.D); ok {
+			if filter, ok := bsonutil.Get(d, "query"); ok {
+				v.filter(query.JoinPath(path, "query"), filter)
+			}
+		}
+	case "$vectorSearch":
+		v.vectorSearch(path, arg)
+	case "$merge":
+		switch arg.(type) {
+		case string:
+		case primitive.D:
+			v.requireFields(path, name, arg, "into")
+		default:
+			v.report(path, "$merge requires a string or an object argument")
+		}
+	case "$out":
+		switch arg.(type) {
+		case string:
+		case primitive.D:
+			v.requireFields(path, name, arg, "db", "coll")
+		default:
+			v.report(path, "$out requires a string or an object argument")
+		}
+	}
+}
+
+func (v *validator) requireFields(path, name string, arg interface{}, fields ...string) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		v.report(path, "%s requires an object argument", name)
+		return
+	}
+	for _, i := range fields {
+		if _, ok := bsonutil.Get(d, i); !ok {
+			v.report(path, "%s requires '%s' option", name, i)
+		}
+	}
+}
+
+func (v *validator) filter(path string, filter interface{}) {
+	d, ok := filter.(primitive.D)
+	if !ok {
+		v.report(path, "filter must be an object")
+		return
+	}
+	for _, i := range query.ValidateFilter(d) {
+		v.report(query.JoinPath(path, i.Path), "%s", i.Message)
+	}
+	v.filterExpressions(path, d)
+}
+
+// filterExpressions validates $expr in filter.
+func (v *validator) filterExpressions(path string, filter primitive.D) {
+	for _, e := range filter {
+		var p = query.JoinPath(path, e.Key)
+		switch e.Key {
+		case "$expr":
+			v.expression(p, e.Value)
+		case "$and", "$or", "$nor":
+			var a, _ = e.Value.(primitive.A)
+			for index, i := range a {
+				if d, ok := i.(primitive.D); ok {
+					v.filterExpressions(query.IndexPath(p, index), d)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) match(path string, arg interface{}, index int) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		v.report(path, "the match filter must be an expression in an object")
+		return
+	}
+	v.filter(path, d)
+	for _, e := range d {
+		switch e.Key {
+		case "$where":
+			v.report(query.JoinPath(path, e.Key), "$where is not allowed inside of a $match aggregation expression")
+		case "$text":
+			if index != 0 {
+				v.report(query.JoinPath(path, e.Key), "$match with $text is only allowed as the first pipeline stage")
+			}
+		}
+	}
+}
+
+func (v *validator) project(path string, arg interface{}) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		v.report(path, "$project specification must be an object")
+		return
+	}
+	if len(d) == 0 {
+		v.report(path, "$project requires at least one output field")
+		return
+	}
+	var include, exclude string
+	var walk func(path, prefix string, d primitive.D)
+	walk = func(path, prefix string, d primitive.D) {
+		for _, e := range d {
+			var p = query.JoinPath(path, e.Key)
+			var field = query.JoinPath(prefix, e.Key)
+			switch value := e.Value.(type) {
+			case bool, int32, int64, float64, primitive.Decimal128:
+				if field == "_id" {
+					continue
+				}
+				if bsonutil.Truthy(value) {
+					if exclude != "" {
+						v.report(p, "cannot do inclusion on field %s in exclusion projection", field)
+					}
+					include = field
+				} else {
+					if include != "" {
+						v.report(p, "cannot do exclusion on field %s in inclusion projection", field)
+					}
+					exclude = field
+				}
+			case primitive.D:
+				if len(value) > 0 && strings.HasPrefix(value[0].Key, "$") {
+					v.expression(p, value)
+					include = field
+					continue
+				}
+				walk(p, field, value)
+			default:
+				v.expression(p, value)
+				include = field
+			}
+		}
+	}
+	walk(path, "", d)
+}
+
+func (v *validator) sort(path string, arg interface{}) {
+	d, ok := arg.(primitive.D)
+	if !ok || len(d) == 0 {
+		v.report(path, "$sort key specification must be a non-empty object")
+		return
+	}
+	for _, e := range d {
+		var p = query.JoinPath(path, e.Key)
+		if meta, ok := e.Value.(primitive.D); ok {
+			if len(meta) != 1 || meta[0].Key != "$meta" {
+				v.report(p, "$sort key must be 1, -1 or a $meta expression")
+			}
+			continue
+		}
+		if n, ok := bsonutil.Float64(e.Value); !ok || (n != 1 && n != -1) {
+			v.report(p, "$sort key ordering must be 1 (for ascending) or -1 (for descending)")
+		}
+	}
+}
+
+func (v *validator) lookup(path string, arg interface{}) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		v.report(path, "the $lookup specification must be an object")
+		return
+	}
+	if _, ok := bsonutil.Get(d, "as"); !ok {
+		v.report(path, "$lookup requires 'as' option")
+	}
+	var _, hasLocal = bsonutil.Get(d, "localField")
+	var _, hasForeign = bsonutil.Get(d, "foreignField")
+	if hasLocal != hasForeign {
+		v.report(path, "$lookup requires both or neither of 'localField' and 'foreignField' to be specified")
+	}
+	pipeline, hasPipeline := bsonutil.Get(d, "pipeline")
+	if !hasLocal && !hasPipeline {
+		v.report(path, "$lookup requires either 'pipeline' or both 'localField' and 'foreignField' to be specified")
+	}
+	if hasPipeline {
+		v.pipeline(query.JoinPath(path, "pipeline"), pipeline, subPipeline)
+	}
+	if let, ok := bsonutil.Get(d, "let"); ok {
+		if let, ok := let.(primitive.D); ok {
+			v.objectExpression(query.JoinPath(path, "let"), let)
+		} else {
+			v.report(query.JoinPath(path, "let"), "$lookup argument 'let' must be an object")
+		}
+	}
+}
+
+func (v *validator) group(path string, arg interface{}) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		v.report(path, "a group's fields must be specified in an object")
+		return
+	}
+	id, ok := bsonutil.Get(d, "_id")
+	if !ok {
+		v.report(path, "a group specification must include an _id")
+	} else {
+		v.expression(query.JoinPath(path, "_id"), id)
+	}
+	for _, e := range d {
+		if e.Key == "_id" {
+			continue
+		}
+		v.accumulatorField(query.JoinPath(path, e.Key), e.Key, e.Value)
+	}
+}
+
+func (v *validator) accumulatorField(path, field string, value interface{}) {
+	if strings.Contains(field, ".") {
+		v.report(path, "the group aggregate field name '%s' cannot contain '.'", field)
+	}
+	d, ok := value.(primitive.D)
+	if !ok || len(d) != 1 {
+		v.report(path, "the field '%s' must be an accumulator object", field)
+		return
+	}
+	var name = d[0].Key
+	var p = query.JoinPath(path, name)
+	if !isAccumulatorOperator(name) {
+		v.report(p, "unknown group operator '%s'", name)
+		return
+	}
+	v.operatorArgument(p, name, d[0].Value)
+}
+
+func (v *validator) bucket(path, name string, arg interface{}) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		v.report(path, "argument to %s stage must be an object", name)
+		return
+	}
+	if groupBy, ok := bsonutil.Get(d, "groupBy"); !ok {
+		v.report(path, "%s requires 'groupBy' to be specified", name)
+	} else {
+		v.expression(query.JoinPath(path, "groupBy"), groupBy)
+	}
+	if name == "$bucket" {
+		boundaries, ok := bsonutil.Get(d, "boundaries")
+		if a, isArray := boundaries.(primitive.A); !ok || !isArray || len(a) < 2 {
+			v.report(query.JoinPath(path, "boundaries"), "$bucket requires 'boundaries' to be an array with at least 2 values")
+		}
+	} else {
+		buckets, ok := bsonutil.Get(d, "buckets")
+		if n, isInt := bsonutil.Int64(buckets); !ok || !isInt || n <= 0 {
+			v.report(query.JoinPath(path, "buckets"), "$bucketAuto requires 'buckets' to be a positive integer")
+		}
+	}
+	if output, ok := bsonutil.Get(d, "output"); ok {
+		var p = query.JoinPath(path, "output")
+		output, ok := output.(primitive.D)
+		if !ok {
+			v.report(p, "the 'output' field must be an object")
+			return
+		}
+		for _, e := range output {
+			v.accumulatorField(query.JoinPath(p, e.Key), e.Key, e.Value)
+		}
+	}
+}
+
+func (v *validator) setWindowFields(path string, arg interface{}) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		v.report(path, "$setWindowFields specification must be an object")
+		return
+	}
+	if partitionBy, ok := bsonutil.Get(d, "partitionBy"); ok {
+		v.expression(query.JoinPath(path, "partitionBy"), partitionBy)
+	}
+	if sortBy, ok := bsonutil.Get(d, "sortBy"); ok {
+		v.sort(query.JoinPath(path, "sortBy"), sortBy)
+	}
+	output, ok := bsonutil.Get(d, "output")
+	var outputDoc primitive.D
+	if ok {
+		outputDoc, ok = output.(primitive.D)
+	}
+	if !ok {
+		v.report(path, "$setWindowFields requires 'output' to be an object")
+		return
+	}
+	for _, e := range outputDoc {
+		var p = query.JoinPath(query.JoinPath(path, "output"), e.Key)
+		spec, ok := e.Value.(primitive.D)
+		if !ok {
+			v.report(p, "window function output field '%s' must be an object", e.Key)
+			continue
+		}
+		var operators int
+		for _, i := range spec {
+			if i.Key == "window" {
+				continue
+			}
+			operators++
+			var op = query.JoinPath(p, i.Key)
+			if !isAccumulatorOperator(i.Key) && !isWindowOperator(i.Key) {
+				v.report(op, "unrecognized window function, %s", i.Key)
+				continue
+			}
+			v.operatorArgument(op, i.Key, i.Value)
+		}
+		if operators != 1 {
+			v.report(p, "window function output field '%s' must specify exactly one window function", e.Key)
+		}
+	}
+}
+
+func (v *validator) densify(path string, arg interface{}) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		v.report(path, "$densify specification must be an object")
+		return
+	}
+	if field, ok := bsonutil.Get(d, "field"); !ok {
+		v.report(path, "$densify requires 'field' to be specified")
+	} else if s, ok := field.(string); !ok || s == "" || strings.HasPrefix(s, "$") {
+		v.report(query.JoinPath(path, "field"), "$densify 'field' must be a field name")
+	}
+	r, ok := bsonutil.Get(d, "range")
+	var rangeDoc primitive.D
+	if ok {
+		rangeDoc, ok = r.(primitive.D)
+	}
+	if !ok {
+		v.report(path, "$densify requires 'range' to be an object")
+		return
+	}
+	var p = query.JoinPath(path, "range")
+	if step, ok := bsonutil.Get(rangeDoc, "step"); !ok {
+		v.report(p, "$densify range requires 'step' to be specified")
+	} else if n, ok := bsonutil.Float64(step); !ok || n <= 0 {
+		v.report(query.JoinPath(p, "step"), "$densify range step must be a positive number")
+	}
+	switch bounds, _ := bsonutil.Get(rangeDoc, "bounds"); bounds := bounds.(type) {
+	case string:
+		if bounds != "full" && bounds != "partition" {
+			v.report(query.JoinPath(p, "bounds"), "$densify range bounds must be 'full', 'partition' or an array of two values")
+		}
+	case primitive.A:
+		if len(bounds) != 2 {
+			v.report(query.JoinPath(p, "bounds"), "$densify range bounds must be 'full', 'partition' or an array of two values")
+		}
+	default:
+		v.report(p, "$densify range requires 'bounds' to be specified")
+	}
+}
+
+func (v *validator) fill(path string, arg interface{}) {
+	d, ok := arg.(primitive.D)
+	if !ok {
+		v.report(path, "$fill specification must be an object")
+		return
+	}
+	partitionBy, hasPartitionBy := bsonutil.Get(d, "partitionBy")
+	if hasPartitionBy {
+		v.expression(query.JoinPath(path, "partitionBy"), partitionBy)
+	}
+	if _, ok := bsonutil.Get(d, "partitionByFields"); ok && hasPartitionBy {
+		v.report(path, "$fill can not specify both 'partitionBy' and 'partitionByFields'")
+	}
+	sortBy, hasSortBy := bsonutil.Get(d, "sortBy")
+	if hasSortBy {
+		v.sort(query.JoinPath(path, "sortBy"), sortBy)
+	}
+	output, ok := bsonutil.Get(d, "output")
+	var outputDoc primitive.D
+	if ok {
+		outputDoc, ok = output.(primitive.D)
+	}
+	if !ok || len(outputDoc) == 0 {
+		v.report(path, "$fill requires 'output' to be a non-empty object")
+		return
+	}
+	for _, e := range outputDoc {
+		var p = query.JoinPath(query.JoinPath(path, "output"), e.Key)
+		spec, ok := e.Value.(primitive.D)
+		if !ok || len(spec) != 1 || (spec[0].Key != "method" && spec[0].Key != "value") {
+			v.report(p, "$fill output field '%s' must specify exactly one of 'method' or 'value'", e.Key)
+			continue
+		}
+		if spec[0].Key == "value" {
+			v.expression(query.JoinPath(p, "value"), spec[0].Value)
+			continue
+		}
+		switch spec[0].Value {
+		case "locf":
+		case "linear":
+			if !hasSortBy {
+				v.report(p, "$fill method 'linear' requires 'sortBy'")
+			}
+		default:
+			v.report(query.JoinPath(p, "method"), "$fill method must be 'locf' or 'linear'")
+		}
+	}
+}
+
+// vectorSearchFilterOperators is operators supported in filter of $vectorSearch.
+var vectorSearchFilterOperators = map[string]bool{
+	"$eq":     true,
+	"$ne":     true,
+	"$gt":     true,
+	"$gte":    true,
+	"$lt":     true,
+	"$lte":    true,
+	"$in":     true,
+	"$nin":    true,
+	"$exists": true,
+	"$not":    true,
+}
+
+func (v *validator) vectorSearch(path string, arg interface{}) {
+	v.requireFields(path, "$vectorSearch", arg, "index", "path", "queryVector", "limit")
+	d, ok := arg.(primitive.D)
+	if !ok {
+		return
+	}
+	var limit, _ = bsonutil.Get(d, "limit")
+	n, ok := bsonutil.Int64(limit)
+	if limit != nil && (!ok || n <= 0) {
+		v.report(query.JoinPath(path, "limit"), "$vectorSearch limit must be a positive integer")
+	}
+	var exact, _ = bsonutil.Get(d, "exact")
+	if numCandidates, ok := bsonutil.Get(d, "numCandidates"); ok {
+		if exact == true {
+			v.report(query.JoinPath(path, "numCandidates"), "$vectorSearch numCandidates is not allowed when exact is true")
+		} else if m, ok := bsonutil.Int64(numCandidates); !ok || m < n {
+			v.report(query.JoinPath(path, "numCandidates"), "$vectorSearch numCandidates must be an integer greater than or equal to limit")
+		}
+	} else if exact != true {
+		v.report(path, "$vectorSearch requires 'numCandidates' option unless exact is true")
+	}
+	if filter, ok := bsonutil.Get(d, "filter"); ok {
+		var p = query.JoinPath(path, "filter")
+		v.filter(p, filter)
+		if d, ok := filter.(primitive.D); ok {
+			v.vectorSearchFilter(p, d)
+		}
+	}
+}
+
+// vectorSearchFilter reports operators not supported in $vectorSearch pre-filter.
+func (v *validator) vectorSearchFilter(path string, filter primitive.D) {
+	for _, e := range filter {
+		var p = query.JoinPath(path, e.Key)
+		switch {
+		case e.Key == "$and" || e.Key == "$or" || e.Key == "$nor":
+			var a, _ = e.Value.(primitive.A)
+			for index, i := range a {
+				if d, ok := i.(primitive.D); ok {
+					v.vectorSearchFilter(query.IndexPath(p, index), d)
+				}
+			}
+		case strings.HasPrefix(e.Key, "$"):
+			v.report(p, "%s is not supported in $vectorSearch filter", e.Key)
+		default:
+			if d, ok := e.Value.(primitive.D); ok && len(d) > 0 && strings.HasPrefix(d[0].Key, "$") {
+				v.vectorSearchCondition(p, d)
+			}
+		}
+	}
+}
+
+func (v *validator) vectorSearchCondition(path string, condition primitive.D) {
+	for _, e := range condition {
+		var p = query.JoinPath(path, e.Key)
+		if !vectorSearchFilterOperators[e.Key] {
+			v.report(p, "%s is not supported in $vectorSearch filter", e.Key)
+			continue
+		}
+		if d, ok := e.Value.(primitive.D); ok && e.Key == "$not" {
+			v.vectorSearchCondition(p, d)
+		}
+	}
+}
+
+// objectExpression validates d as expression object, each value is an expression.
+func (v *validator) objectExpression(path string, d primitive.D) {
+	for _, e := range d {
+		var p = query.JoinPath(path, e.Key)
+		if strings.HasPrefix(e.Key, "$") {
+			v.report(p, "field names must not start with '$': %s", e.Key)
+			continue
+		}
+		v.expression(p, e.Value)
+	}
+}
+
+// expression validates an aggregation expression
+// that is not in accumulator position.
+func (v *validator) expression(path string, value interface{}) {
+	switch value := value.(type) {
+	case primitive.A:
+		for index, i := range value {
+			v.expression(query.IndexPath(path, index), i)
+		}
+	case primitive.D:
+		if len(value) == 0 || !strings.HasPrefix(value[0].Key, "$") {
+			v.objectExpression(path, value)
+			return
+		}
+		if len(value) != 1 {
+			v.report(path, "an expression specification must contain exactly one field, the name of the expression")
+			return
+		}
+		var name = value[0].Key
+		var p = query.JoinPath(path, name)
+		switch {
+		case isExpressionOperator(name):
+			v.operatorArgument(p, name, value[0].Value)
+		case isAccumulatorOperator(name):
+			v.report(p, "%s is only valid in $group, $bucket, $bucketAuto and $setWindowFields stages", name)
+		case isWindowOperator(name):
+			v.report(p, "%s is only valid in $setWindowFields stage", name)
+		default:
+			v.report(p, "unrecognized expression operator: %s", name)
+		}
+	}
+}
+
+func (v *validator) operatorArgument(path, name string, arg interface{}) {
+	if name == "$literal" {
+		return
+	}
+	if n, ok := operatorArity[name]; ok {
+		if a, ok := arg.(primitive.A); !ok || len(a) != n {
+			v.report(path, "expression %s takes exactly %d arguments", name, n)
+			return
+		}
+	}
+	if fields, ok := namedArguments[name]; ok {
+		d, ok := arg.(primitive.D)
+		if !ok {
+			v.report(path, "%s requires an object as an argument", name)
+			return
+		}
+		for _, i := range fields {
+			if _, ok := bsonutil.Get(d, i); !ok {
+				v.report(path, "missing '%s' parameter to %s", i, name)
+			}
+		}
+		for _, e := range d {
+			v.expression(query.JoinPath(path, e.Key), e.Value)
+		}
+		return
+	}
+	v.expression(path, arg)
+}
@@ -0,0 +1,159 @@
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/NateScarlet/mongo-operators/pkg/geojson"
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		pipeline A
+		want     []Issue
+	}{
+		{"empty", A{}, nil},
+		{"valid", A{
+			Match(M{"age": query.Gte(18), "$expr": Gt("$score", 10)}),
+			Unwind(Field("tags")),
+			Group(M{
+				"_id":   "$tags",
+				"names": Push("$name"),
+				"total": Sum("$score"),
+				"count": CountAccumulator(),
+			}),
+			Project(M{"_id": 0, "tag": "$_id", "total": 1, "avg": Divide("$total", "$count")}),
+			Sort(Desc("total")),
+			Limit(10),
+			Facet(M{
+				"count": A{Count("n")},
+				"top":   A{Limit(1)},
+			}),
+			Out("result"),
+		}, nil},
+		{"out not last", A{Out("result"), Limit(1)}, []Issue{
+			{0, "$out", "$out can only be the final stage in the pipeline"},
+		}},
+		{"search not first", A{Limit(1), Search(M{"text": M{}})}, []Issue{
+			{1, "$search", "$search is only valid as the first stage in a pipeline"},
+		}},
+		{"vector search", A{
+			M{"$vectorSearch": M{
+				"index": "index", "path": "embedding", "queryVector": A{0.1, 0.2}, "limit": 10, "numCandidates": 100,
+				"filter": query.M{"year": query.Gte(2000), "$or": A{M{"genre": query.In(A{"a", "b"})}, M{"title": query.Not(M{"$regex": "^a"})}}},
+			}},
+			Project(M{"title": 1, "score": Meta(MetaVectorSearchScore)}),
+		}, []Issue{
+			{0, "$vectorSearch.filter.$or[1].title.$not.$regex", "$regex is not supported in $vectorSearch filter"},
+		}},
+		{"vector search options", A{
+			Limit(1),
+			M{"$vectorSearch": M{
+				"index": "index", "path": "embedding", "queryVector": A{0.1}, "limit": 10, "numCandidates": 5,
+				"filter": M{"$text": M{"$search": "a"}},
+			}},
+			VectorSearch("index", "embedding", A{0.1}, 10),
+			VectorSearch("index", "embedding", A{0.1}, 10).SetExact(true),
+		}, []Issue{
+			{1, "$vectorSearch", "$vectorSearch is only valid as the first stage in a pipeline"},
+			{1, "$vectorSearch.numCandidates", "$vectorSearch numCandidates must be an integer greater than or equal to limit"},
+			{1, "$vectorSearch.filter.$text", "$text is not supported in $vectorSearch filter"},
+			{2, "$vectorSearch", "$vectorSearch is only valid as the first stage in a pipeline"},
+			{2, "$vectorSearch", "$vectorSearch requires 'numCandidates' option unless exact is true"},
+			{3, "$vectorSearch", "$vectorSearch is only valid as the first stage in a pipeline"},
+		}},
+		{"geo near", A{
+			GeoNear(geojson.Point{-73.99, 40.73}, "distance").
+				SetSpherical(true).
+				SetQuery(M{"area": query.GeoIntersects(geojson.Polygon{{{-74, 40}, {-73, 40}, {-73, 41}, {-74, 40}}})}),
+		}, nil},
+		{"invalid geometry", A{GeoNear(geojson.Point{0, 100}, "distance")}, []Issue{
+			{0, "$geoNear.near", "geojson: coordinates: latitude 100 out of range [-90, 90]"},
+		}},
+		{"invalid geometry in query", A{
+			Limit(1),
+			Match(M{"area": query.GeoIntersects(geojson.Polygon{{{0, 0}, {1, 0}, {1, 1}}})}),
+		}, []Issue{
+			{1, "$match.area.$geoIntersects.$geometry", "geojson: coordinates[0]: requires at least 4 points"},
+		}},
+		{"unset path collision", A{Unset("a", "b", "a.c")}, []Issue{
+			{0, "$unset[2]", "invalid $unset specification: path collision at a.c"},
+		}},
+		{"push outside group", A{
+			AddFields(M{"names": Push("$name")}),
+		}, []Issue{
+			{0, "$addFields.names.$push", "$push is only valid in $group, $bucket, $bucketAuto and $setWindowFields stages"},
+		}},
+		{"nested push", A{
+			Project(M{"a": Cond(Gt(Size(AddToSet("$x")), 1), 1, 0)}),
+		}, []Issue{
+			{0, "$project.a.$cond[0].$gt[0].$size.$addToSet", "$addToSet is only valid in $group, $bucket, $bucketAuto and $setWindowFields stages"},
+		}},
+		{"and not array", A{Match(M{"$and": M{"a": 1}})}, []Issue{
+			{0, "$match.$and", "$and argument must be an array"},
+		}},
+		{"group", A{Group(bson.D{{Key: "avg", Value: "$a"}, {Key: "total", Value: M{"$foo": 1}}})}, []Issue{
+			{0, "$group", "a group specification must include an _id"},
+			{0, "$group.avg", "the field 'avg' must be an accumulator object"},
+			{0, "$group.total.$foo", "unknown group operator '$foo'"},
+		}},
+		{"facet", A{Facet(M{"a": A{Limit(1), Out("x")}})}, []Issue{
+			{0, "$facet.a[1].$out", "$out is not allowed to be used within a $facet stage"},
+		}},
+		{"lookup", A{Limit(1), LookupP("other", nil, A{Merge("x")}, Field("items"))}, []Issue{
+			{1, "$lookup.pipeline[0].$merge", "$merge is not allowed to be used within a sub-pipeline"},
+		}},
+		{"unknown stage", A{M{"$foo": 1}}, []Issue{
+			{0, "$foo", "unrecognized pipeline stage name: $foo"},
+		}},
+		{"unknown expression", A{Set(M{"a": M{"$foo": 1}})}, []Issue{
+			{0, "$set.a.$foo", "unrecognized expression operator: $foo"},
+		}},
+		{"arity", A{Set(M{"a": M{"$subtract": A{1}}})}, []Issue{
+			{0, "$set.a.$subtract", "expression $subtract takes exactly 2 arguments"},
+		}},
+		{"named arguments", A{Set(M{"a": M{"$filter": M{"input": "$items"}}})}, []Issue{
+			{0, "$set.a.$filter", "missing 'cond' parameter to $filter"},
+		}},
+		{"project", A{Project(bson.D{{Key: "a", Value: 1}, {Key: "b", Value: 0}})}, []Issue{
+			{0, "$project.b", "cannot do exclusion on field b in inclusion projection"},
+		}},
+		{"limit", A{Limit(0), Skip(-1)}, []Issue{
+			{0, "$limit", "the limit must be positive"},
+			{1, "$skip", "the skip must be a non-negative number"},
+		}},
+		{"text", A{Limit(1), Match(query.Text("foo"))}, []Issue{
+			{1, "$match.$text", "$match with $text is only allowed as the first pipeline stage"},
+		}},
+		{"window", A{SetWindowFields(SetWindowFieldsOutput("rank", Rank())).SetSortBy(Desc("score"))}, nil},
+		{"gap filling", A{
+			Densify("at").SetRange(1, SWFUHour, "full").SetPartitionByFields("sensor"),
+			Fill(FillOutputMethod("value", FillLinear), FillOutputValue("status", "unknown")).SetSortBy(Asc("at")),
+			SetWindowFields(SetWindowFieldsOutput("last", Locf("$value"))).SetSortBy(Asc("at")),
+		}, nil},
+		{"densify", A{M{"$densify": M{"field": "$at"}}, Densify("at").SetRange(0, "", A{1})}, []Issue{
+			{0, "$densify.field", "$densify 'field' must be a field name"},
+			{0, "$densify", "$densify requires 'range' to be an object"},
+			{1, "$densify.range.step", "$densify range step must be a positive number"},
+			{1, "$densify.range.bounds", "$densify range bounds must be 'full', 'partition' or an array of two values"},
+		}},
+		{"fill", A{
+			Fill(FillOutputMethod("a", FillLinear)).SetPartitionBy("$p").SetPartitionByFields("p"),
+			Fill(FillOutputMethod("a", "next")),
+		}, []Issue{
+			{0, "$fill", "$fill can not specify both 'partitionBy' and 'partitionByFields'"},
+			{0, "$fill.output.a", "$fill method 'linear' requires 'sortBy'"},
+			{1, "$fill.output.a.method", "$fill method must be 'locf' or 'linear'"},
+		}},
+		{"window outside", A{Set(M{"a": Rank()})}, []Issue{
+			{0, "$set.a.$rank", "$rank is only valid in $setWindowFields stage"},
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, Validate(c.pipeline))
+		})
+	}
+}
@@ -0,0 +1,549 @@
+package aggregation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Version alias query.Version
+type Version = query.Version
+
+// StageVersions maps pipeline stages to the first server version supports them.
+// Empty version means available in every server version this package targets.
+var StageVersions = map[string]Version{
+	"$addFields":         "3.4",
+	"$bucket":            "3.4",
+	"$bucketAuto":        "3.4",
+	"$changeStream":      "3.6",
+	"$collStats":         "3.4",
+	"$count":             "3.4",
+	"$currentOp":         "3.6",
+	"$densify":           "5.1",
+	"$documents":         "5.1",
+	"$facet":             "3.4",
+	"$fill":              "5.3",
+	"$geoNear":           "",
+	"$graphLookup":       "3.4",
+	"$group":             "",
+	"$indexStats":        "3.2",
+	"$limit":             "",
+	"$listLocalSessions": "3.6",
+	"$listSessions":      "3.6",
+	"$lookup":            "3.2",
+	"$match":             "",
+	"$merge":             "4.2",
+	"$out":               "",
+	"$planCacheStats":    "4.2",
+	"$project":           "",
+	"$redact":            "",
+	"$replaceRoot":       "3.4",
+	"$replaceWith":       "4.2",
+	"$sample":            "3.2",
+	"$search":            "4.2",
+	"$searchMeta":        "4.4.9",
+	"$set":               "4.2",
+	"$setWindowFields":   "5.0",
+	"$skip":              "",
+	"$sort":              "",
+	"$sortByCount":       "3.4",
+	"$unionWith":         "4.4",
+	"$unset":             "4.2",
+	"$unwind":            "",
+	"$vectorSearch":      "6.0.11",
+}
+
+// ExpressionVersions maps expression operators to the first server version supports them.
+// Empty version means available in every server version this package targets.
+var ExpressionVersions = map[string]Version{
+	"$abs":              "3.2",
+	"$acos":             "4.2",
+	"$acosh":            "4.2",
+	"$add":              "",
+	"$allElementsTrue":  "",
+	"$and":              "",
+	"$anyElementTrue":   "",
+	"$arrayElemAt":      "3.2",
+	"$arrayToObject":    "3.4.4",
+	"$asin":             "4.2",
+	"$asinh":            "4.2",
+	"$atan":             "4.2",
+	"$atan2":            "4.2",
+	"$atanh":            "4.2",
+	"$avg":              "3.2",
+	"$binarySize":       "4.4",
+	"$bsonSize":         "4.4",
+	"$ceil":             "3.2",
+	"$cmp":              "",
+	"$concat":           "",
+	"$concatArrays":     "3.2",
+	"$cond":             "",
+	"$convert":          "4.0",
+	"$cos":              "4.2",
+	"$cosh":             "4.2",
+	"$dateAdd":          "5.0",
+	"$dateDiff":         "5.0",
+	"$dateFromParts":    "3.6",
+	"$dateFromString":   "3.6",
+	"$dateToParts":      "3.6",
+	"$dateSubtract":     "5.0",
+	"$dateToString":     "",
+	"$dateTrunc":        "5.0",
+	"$dayOfMonth":       "",
+	"$dayOfWeek":        "",
+	"$dayOfYear":        "",
+	"$degreesToRadians": "4.2",
+	"$divide":           "",
+	"$eq":               "",
+	"$exp":              "3.2",
+	"$filter":           "3.2",
+	"$first":            "4.4",
+	"$firstN":           "5.2",
+	"$floor":            "3.2",
+	"$function":         "4.4",
+	"$getField":         "5.0",
+	"$gt":               "",
+	"$gte":              "",
+	"$hour":             "",
+	"$ifNull":           "",
+	"$in":               "3.4",
+	"$indexOfArray":     "3.4",
+	"$indexOfBytes":     "3.4",
+	"$indexOfCP":        "3.4",
+	"$isArray":          "3.2",
+	"$isNumber":         "4.4",
+	"$isoDayOfWeek":     "3.4",
+	"$isoWeek":          "3.4",
+	"$isoWeekYear":      "3.4",
+	"$last":             "4.4",
+	"$lastN":            "5.2",
+	"$let":              "",
+	"$literal":          "",
+	"$ln":               "3.2",
+	"$log":              "3.2",
+	"$log10":            "3.2",
+	"$lt":               "",
+	"$lte":              "",
+	"$ltrim":            "4.0",
+	"$map":              "",
+	"$max":              "3.2",
+	"$maxN":             "5.2",
+	"$median":           "7.0",
+	"$mergeObjects":     "3.6",
+	"$meta":             "",
+	"$millisecond":      "",
+	"$min":              "3.2",
+	"$minN":             "5.2",
+	"$minute":           "",
+	"$mod":              "",
+	"$month":            "",
+	"$multiply":         "",
+	"$ne":               "",
+	"$not":              "",
+	"$objectToArray":    "3.4.4",
+	"$or":               "",
+	"$percentile":       "7.0",
+	"$pow":              "3.2",
+	"$radiansToDegrees": "4.2",
+	"$rand":             "4.4.2",
+	"$range":            "3.4",
+	"$reduce":           "3.4",
+	"$regexFind":        "4.2",
+	"$regexFindAll":     "4.2",
+	"$regexMatch":       "4.2",
+	"$replaceAll":       "4.4",
+	"$replaceOne":       "4.4",
+	"$reverseArray":     "3.4",
+	"$round":            "4.2",
+	"$rtrim":            "4.0",
+	"$second":           "",
+	"$setDifference":    "",
+	"$setEquals":        "",
+	"$setField":         "5.0",
+	"$setIntersection":  "",
+	"$setIsSubset":      "",
+	"$setUnion":         "",
+	"$sin":              "4.2",
+	"$sinh":             "4.2",
+	"$size":             "",
+	"$slice":            "3.2",
+	"$sortArray":        "5.2",
+	"$split":            "3.4",
+	"$sqrt":             "3.2",
+	"$stdDevPop":        "3.2",
+	"$stdDevSamp":       "3.2",
+	"$strcasecmp":       "",
+	"$strLenBytes":      "3.4",
+	"$strLenCP":         "3.4",
+	"$substr":           "",
+	"$substrBytes":      "3.4",
+	"$substrCP":         "3.4",
+	"$subtract":         "",
+	"$sum":              "3.2",
+	"$switch":           "3.4",
+	"$tan":              "4.2",
+	"$tanh":             "4.2",
+	"$toBool":           "4.0",
+	"$toDate":           "4.0",
+	"$toDecimal":        "4.0",
+	"$toDouble":         "4.0",
+	"$toInt":            "4.0",
+	"$toLong":           "4.0",
+	"$toLower":          "",
+	"$toObjectId":       "4.0",
+	"$toString":         "4.0",
+	"$toUpper":          "",
+	"$trim":             "4.0",
+	"$trunc":            "3.2",
+	"$type":             "3.4",
+	"$unsetField":       "5.0",
+	"$week":             "",
+	"$year":             "",
+	"$zip":              "3.4",
+}
+
+// AccumulatorVersions maps accumulators of $group, $bucket and $bucketAuto
+// to the first server version supports them.
+// Empty version means available in every server version this package targets.
+var AccumulatorVersions = map[string]Version{
+	"$accumulator":  "4.4",
+	"$addToSet":     "",
+	"$avg":          "",
+	"$bottom":       "5.2",
+	"$bottomN":      "5.2",
+	"$count":        "5.0",
+	"$first":        "",
+	"$firstN":       "5.2",
+	"$last":         "",
+	"$lastN":        "5.2",
+	"$max":          "",
+	"$maxN":         "5.2",
+	"$median":       "7.0",
+	"$mergeObjects": "3.6",
+	"$min":          "",
+	"$minN":         "5.2",
+	"$percentile":   "7.0",
+	"$push":         "",
+	"$stdDevPop":    "3.2",
+	"$stdDevSamp":   "3.2",
+	"$sum":          "",
+	"$top":          "5.2",
+	"$topN":         "5.2",
+}
+
+// WindowOperatorVersions maps operators that only available in $setWindowFields
+// to the first server version supports them.
+// Accumulators are also available in $setWindowFields.
+var WindowOperatorVersions = map[string]Version{
+	"$covariancePop":  "5.0",
+	"$covarianceSamp": "5.0",
+	"$denseRank":      "5.0",
+	"$derivative":     "5.0",
+	"$documentNumber": "5.0",
+	"$expMovingAvg":   "5.0",
+	"$integral":       "5.0",
+	"$linearFill":     "5.3",
+	"$locf":           "5.2",
+	"$rank":           "5.0",
+	"$shift":          "5.0",
+}
+
+// VariableVersions maps system variables to the first server version supports them.
+var VariableVersions = map[string]Version{
+	"$$CLUSTER_TIME": "4.2",
+	"$$NOW":          "4.2",
+	"$$SEARCH_META":  "4.4.9",
+	"$$USER_ROLES":   "7.0",
+}
+
+// Incompatibility is an operator that requires a newer server version,
+// it is returned from CheckCompatibility.
+type Incompatibility struct {
+	// Stage is index of the stage contains the operator, see Issue.
+	Stage int
+	// Path locates the operator in the stage document, see Issue.
+	Path     string
+	Operator string
+	// Since is the first server version that supports the operator.
+	Since Version
+	// Unknown is true when Operator is not a known operator,
+	// or the checked value can not be analyzed (Operator is empty),
+	// it is reported for every version.
+	Unknown bool
+}
+
+// String describes i, e.g. "stage 0: $match.$expr: $expr requires 3.6".
+func (i Incompatibility) String() string {
+	return fmt.Sprintf("stage %d: %s", i.Stage, query.Incompatibility{
+		Path:     i.Path,
+		Operator: i.Operator,
+		Since:    i.Since,
+		Unknown:  i.Unknown,
+	})
+}
+
+// MinServerVersion returns the earliest server version that supports
+// every stage and operator used in pipeline.
+// It returns error when pipeline contains unknown stage or operator,
+// or can not be analyzed.
+func MinServerVersion(pipeline A) (Version, error) {
+	var ret Version
+	for _, i := range CheckCompatibility(pipeline, "") {
+		if i.Unknown {
+			return "", fmt.Errorf("aggregation: %s", i)
+		}
+		if i.Since.Compare(ret) > 0 {
+			ret = i.Since
+		}
+	}
+	return ret, nil
+}
+
+// CheckCompatibility lists stages and operators used in pipeline
+// that are not supported by server of given version,
+// e.g. CheckCompatibility(pipeline, "4.4").
+//
+// Besides operators, some stage options are reported as well:
+// "$lookup.pipeline" (3.6) and "$lookup.localField" used with pipeline (5.0).
+// Unknown stages and operators are always reported, and an unknown
+// Incompatibility is returned if pipeline can not be marshaled.
+func CheckCompatibility(pipeline A, version Version) []Incompatibility {
+	n, err := bsonutil.Normalize(pipeline)
+	if err != nil {
+		return []Incompatibility{{Unknown: true}}
+	}
+	var c = &compatibility{version: version}
+	var stages, _ = n.(primitive.A)
+	for index, i := range stages {
+		c.stage = index
+		c.pipelineStage("", i)
+	}
+	return c.ret
+}
+
+type compatibility struct {
+	version Version
+	stage   int
+	ret     []Incompatibility
+}
+
+func (c *compatibility) require(path, operator string, since Version) {
+	if since.Compare(c.version) > 0 {
+		c.ret = append(c.ret, Incompatibility{
+			Stage:    c.stage,
+			Path:     path,
+			Operator: operator,
+			Since:    since,
+		})
+	}
+}
+
+func (c *compatibility) unknown(path, operator string) {
+	c.ret = append(c.ret, Incompatibility{
+		Stage:    c.stage,
+		Path:     path,
+		Operator: operator,
+		Unknown:  true,
+	})
+}
+
+// lookup requires version of operator in registry.
+func (c *compatibility) lookup(path, operator string, registry map[string]Version) {
+	if since, ok := registry[operator]; ok {
+		c.require(path, operator, since)
+	} else {
+		c.unknown(path, operator)
+	}
+}
+
+func (c *compatibility) pipeline(path string, value interface{}) {
+	var stages, _ = value.(primitive.A)
+	for index, i := range stages {
+		c.pipelineStage(query.IndexPath(path, index), i)
+	}
+}
+
+func (c *compatibility) pipelineStage(path string, value interface{}) {
+	d, ok := value.(primitive.D)
+	if !ok || len(d) != 1 {
+		c.unknown(path, "")
+		return
+	}
+	var name, arg = d[0].Key, d[0].Value
+	path = query.JoinPath(path, name)
+	c.lookup(path, name, StageVersions)
+	var opts, _ = arg.(primitive.D)
+	var option = func(key string) (interface{}, string, bool) {
+		v, ok := bsonutil.Get(opts, key)
+		return v, query.JoinPath(path, key), ok
+	}
+	switch name {
+	case "$addFields", "$set", "$project":
+		c.expression(path, opts)
+	case "$match":
+		c.filter(path, arg)
+	case "$group":
+		for _, e := range opts {
+			var p = query.JoinPath(path, e.Key)
+			if e.Key == "_id" {
+				c.expression(p, e.Value)
+				continue
+			}
+			c.accumulator(p, e.Value, AccumulatorVersions)
+		}
+	case "$bucket", "$bucketAuto":
+		if v, p, ok := option("groupBy"); ok {
+			c.expression(p, v)
+		}
+		if v, p, ok := option("output"); ok {
+			var output, _ = v.(primitive.D)
+			for _, e := range output {
+				c.accumulator(query.JoinPath(p, e.Key), e.Value, AccumulatorVersions)
+			}
+		}
+	case "$setWindowFields":
+		if v, p, ok := option("partitionBy"); ok {
+			c.expression(p, v)
+		}
+		if v, p, ok := option("output"); ok {
+			var output, _ = v.(primitive.D)
+			for _, e := range output {
+				c.accumulator(query.JoinPath(p, e.Key), e.Value, AccumulatorVersions, WindowOperatorVersions)
+			}
+		}
+	case "$fill":
+		if v, p, ok := option("partitionBy"); ok {
+			c.expression(p, v)
+		}
+		if v, p, ok := option("output"); ok {
+			var output, _ = v.(primitive.D)
+			for _, e := range output {
+				var spec, _ = e.Value.(primitive.D)
+				if value, ok := bsonutil.Get(spec, "value"); ok {
+					c.expression(query.JoinPath(query.JoinPath(p, e.Key), "value"), value)
+				}
+			}
+		}
+	case "$replaceRoot":
+		if v, p, ok := option("newRoot"); ok {
+			c.expression(p, v)
+		}
+	case "$replaceWith", "$redact", "$sortByCount":
+		c.expression(path, arg)
+	case "$facet":
+		for _, e := range opts {
+			c.pipeline(query.JoinPath(path, e.Key), e.Value)
+		}
+	case "$lookup":
+		if v, p, ok := option("let"); ok {
+			c.expression(p, v)
+		}
+		if v, p, ok := option("pipeline"); ok {
+			c.require(p, "$lookup.pipeline", "3.6")
+			if _, p, ok := option("localField"); ok {
+				c.require(p, "$lookup.localField", "5.0")
+			}
+			c.pipeline(p, v)
+		}
+	case "$unionWith":
+		if v, p, ok := option("pipeline"); ok {
+			c.pipeline(p, v)
+		}
+	case "$graphLookup":
+		if v, p, ok := option("startWith"); ok {
+			c.expression(p, v)
+		}
+		if v, p, ok := option("restrictSearchWithMatch"); ok {
+			c.filter(p, v)
+		}
+	case "$geoNear":
+		if v, p, ok := option("query"); ok {
+			c.filter(p, v)
+		}
+	case "$vectorSearch":
+		if v, p, ok := option("filter"); ok {
+			c.filter(p, v)
+		}
+	}
+}
+
+func (c *compatibility) filter(path string, value interface{}) {
+	for _, i := range query.CheckFilterCompatibility(value, c.version) {
+		if i.Unknown {
+			c.unknown(query.JoinPath(path, i.Path), i.Operator)
+		} else {
+			c.require(query.JoinPath(path, i.Path), i.Operator, i.Since)
+		}
+	}
+	c.filterExpressions(path, value)
+}
+
+// filterExpressions checks aggregation expressions in $expr of filter.
+func (c *compatibility) filterExpressions(path string, value interface{}) {
+	var d, _ = value.(primitive.D)
+	for _, e := range d {
+		var p = query.JoinPath(path, e.Key)
+		switch e.Key {
+		case "$expr":
+			c.expression(p, e.Value)
+		case "$and", "$or", "$nor":
+			var a, _ = e.Value.(primitive.A)
+			for index, i := range a {
+				c.filterExpressions(query.IndexPath(p, index), i)
+			}
+		}
+	}
+}
+
+// accumulator checks a field spec like {$push: expr}, operator is looked up
+// in each registry in order.
+func (c *compatibility) accumulator(path string, value interface{}, registries ...map[string]Version) {
+	var d, _ = value.(primitive.D)
+	for _, e := range d {
+		if e.Key == "window" {
+			continue
+		}
+		var p = query.JoinPath(path, e.Key)
+		var known bool
+		for _, i := range registries {
+			if since, ok := i[e.Key]; ok {
+				c.require(p, e.Key, since)
+				known = true
+				break
+			}
+		}
+		if !known {
+			c.unknown(p, e.Key)
+		}
+		c.expression(p, e.Value)
+	}
+}
+
+func (c *compatibility) expression(path string, value interface{}) {
+	switch value := value.(type) {
+	case string:
+		if !strings.HasPrefix(value, "$$") {
+			return
+		}
+		var name = strings.SplitN(value, ".", 2)[0]
+		c.require(path, name, VariableVersions[name])
+	case primitive.A:
+		for index, i := range value {
+			c.expression(query.IndexPath(path, index), i)
+		}
+	case primitive.D:
+		for _, e := range value {
+			var p = query.JoinPath(path, e.Key)
+			if strings.HasPrefix(e.Key, "$") {
+				c.lookup(p, e.Key, ExpressionVersions)
+				if e.Key == "$literal" {
+					continue
+				}
+			}
+			c.expression(p, e.Value)
+		}
+	}
+}
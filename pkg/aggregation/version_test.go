@@ -0,0 +1,90 @@
+package aggregation
+
+import (
+	"testing"
+
+	"github.com/NateScarlet/mongo-operators/pkg/geojson"
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionRegistry(t *testing.T) {
+	for k := range expressionOperators {
+		assert.Contains(t, ExpressionVersions, k)
+	}
+	for k := range accumulators {
+		assert.Contains(t, AccumulatorVersions, k)
+	}
+	for k := range stageCompilers {
+		assert.Contains(t, StageVersions, k)
+	}
+}
+
+func TestMinServerVersion(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		pipeline A
+		want     Version
+	}{
+		{"empty", A{}, ""},
+		{"basic", A{Match(M{"a": 1}), Group(M{"_id": "$a", "first": First("$b")})}, ""},
+		{"stage", A{AddFields(M{"a": 1})}, "3.4"},
+		{"first as expression", A{Project(M{"a": FirstOfArray("$items")})}, "4.4"},
+		{"nested expression", A{Project(M{"a": Cond(Eq(GetField("a", "$$ROOT"), 1), 1, 0)})}, "5.0"},
+		{"match", A{Match(M{"flags": query.BitsAllSet(1)})}, "3.2"},
+		{"match expr", A{Match(query.Expr(Gt(Round("$a", 1), 1)))}, "4.2"},
+		{"variable", A{Set(M{"at": "$$NOW"})}, "4.2"},
+		{"count accumulator", A{Group(M{"_id": nil, "n": CountAccumulator()})}, "5.0"},
+		{"percentile window", A{SetWindowFields(SetWindowFieldsOutput("p", Median("$latency", PercentileApproximate)))}, "7.0"},
+		{"facet", A{Facet(M{"a": A{UnionWith("other", nil)}})}, "4.4"},
+		{"literal", A{Project(M{"a": Literal(M{"$getField": "a"})})}, ""},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := MinServerVersion(c.pipeline)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+
+	for _, c := range []struct {
+		name     string
+		pipeline A
+		err      string
+	}{
+		{"unknown stage", A{Limit(1), M{"$foo": 1}}, "aggregation: stage 1: $foo: unknown operator $foo"},
+		{"unknown expression", A{Project(M{"a": M{"$foo": 1}})}, "aggregation: stage 0: $project.a.$foo: unknown operator $foo"},
+		{"unknown accumulator", A{Group(M{"_id": nil, "a": M{"$foo": 1}})}, "aggregation: stage 0: $group.a.$foo: unknown operator $foo"},
+		{"update in match", A{Match(query.Set(M{"a": 1}))}, "aggregation: stage 0: $match.$set: unknown operator $set"},
+		{"invalid stage", A{M{"$limit": 1, "$skip": 1}}, "aggregation: stage 0: can not be analyzed"},
+		{"unmarshalable", A{GeoNear(geojson.Point{0, 100}, "d")}, "aggregation: stage 0: can not be analyzed"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := MinServerVersion(c.pipeline)
+			assert.EqualError(t, err, c.err)
+		})
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	var pipeline = A{
+		Match(M{"$expr": M{"$gt": A{M{"$toInt": "$a"}, 1}}}),
+		LookupP("other", M{"a": "$a"}, A{Match(M{"$sampleRate": 0.5})}, "items"),
+		Set(M{"items": ConcatArrays("$items", A{})}),
+		Merge("result"),
+	}
+	assert.Equal(t, []Incompatibility{
+		{0, "$match.$expr", "$expr", "3.6", false},
+		{0, "$match.$expr.$gt[0].$toInt", "$toInt", "4.0", false},
+		{1, "$lookup.pipeline", "$lookup.pipeline", "3.6", false},
+		{1, "$lookup.pipeline[0].$match.$sampleRate", "$sampleRate", "4.4.2", false},
+		{2, "$set", "$set", "4.2", false},
+		{3, "$merge", "$merge", "4.2", false},
+	}, CheckCompatibility(pipeline, "3.4"))
+	assert.Equal(t, []Incompatibility{
+		{1, "$lookup.pipeline[0].$match.$sampleRate", "$sampleRate", "4.4.2", false},
+	}, CheckCompatibility(pipeline, "4.4"))
+	got, err := MinServerVersion(pipeline)
+	require.NoError(t, err)
+	assert.Equal(t, Version("4.4.2"), got)
+}
@@ -137,6 +137,23 @@ func Integral(inputExpr interface{}) IntegralOperator {
 	}
 }
 
+// LinearFill fills null and missing fields in a window
+// using linear interpolation based on surrounding field values.
+// The $setWindowFields stage requires sort by a single field.
+// New in version 5.3.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/linearFill/
+func LinearFill(expr interface{}) M {
+	return M{"$linearFill": expr}
+}
+
+// Locf sets values for null and missing fields in a window
+// to the last non-null value for the field.
+// New in version 5.2.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/locf/
+func Locf(expr interface{}) M {
+	return M{"$locf": expr}
+}
+
 // Rank returns the document position (known as the rank)
 // relative to other documents in the $setWindowFields stage partition.
 // New in version 5.0.
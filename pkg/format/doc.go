@@ -0,0 +1,5 @@
+// Package format renders query documents and aggregation pipelines
+// as text that can be pasted into mongosh or Compass,
+// in mongo shell syntax or Extended JSON.
+// https://docs.mongodb.com/manual/reference/mongodb-extended-json/
+package format
@@ -0,0 +1,305 @@
+package format
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Style of formatted text.
+type Style int
+
+const (
+	// Shell is mongo shell syntax, e.g. { at: ISODate('2021-01-01T00:00:00.000Z') }.
+	Shell Style = iota
+	// Canonical is canonical Extended JSON, it preserves every bson type.
+	Canonical
+	// Relaxed is relaxed Extended JSON, numbers are written as JSON numbers.
+	Relaxed
+)
+
+func (s Style) String() string {
+	switch s {
+	case Shell:
+		return "shell"
+	case Canonical:
+		return "canonical"
+	case Relaxed:
+		return "relaxed"
+	}
+	return "Style(" + strconv.Itoa(int(s)) + ")"
+}
+
+// Options of formatted text.
+type Options struct {
+	Style Style
+	// Indent of each nesting level for pretty printing,
+	// output is a single line when empty.
+	Indent string
+	// SortKeys sorts keys of every document.
+	// By default, only keys of maps (e.g. M) are sorted since map has no order,
+	// keys of ordered documents (e.g. bson.D, struct) are kept as is.
+	SortKeys bool
+	// StageComments prefixes each stage of a pipeline with its index
+	// like /* 0 */, so it can be matched with validation issues.
+	// Only used by Shell style, as JSON has no comment.
+	StageComments bool
+}
+
+// Format renders doc as single line text of style.
+// doc can be a document, an aggregation pipeline (array of stages),
+// or any value marshals to bson.
+func Format(doc interface{}, style Style) (string, error) {
+	return Options{Style: style}.Format(doc)
+}
+
+// Format renders doc as text with options.
+func (o Options) Format(doc interface{}) (string, error) {
+	v, err := bsonutil.Normalize(bsonutil.Ordered(doc, o.SortKeys))
+	if err != nil {
+		return "", err
+	}
+	switch o.Style {
+	case Canonical, Relaxed:
+		return o.extJSON(v)
+	case Shell:
+		var w = &shellWriter{indent: o.Indent}
+		if a, ok := v.(primitive.A); ok && o.StageComments && isPipeline(a) {
+			w.comments = true
+		}
+		w.value(v, 0)
+		return w.buf.String(), nil
+	}
+	return "", fmt.Errorf("format: unknown style %s", o.Style)
+}
+
+func isPipeline(a primitive.A) bool {
+	for _, i := range a {
+		if d, ok := i.(primitive.D); !ok || len(d) != 1 || !strings.HasPrefix(d[0].Key, "$") {
+			return false
+		}
+	}
+	return len(a) > 0
+}
+
+func (o Options) extJSON(v interface{}) (string, error) {
+	b, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: v}}, o.Style == Canonical, false)
+	if err != nil {
+		return "", err
+	}
+	// unwrap {"v":...}
+	b = b[len(`{"v":`) : len(b)-1]
+	if o.Indent == "" {
+		return string(b), nil
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", o.Indent); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// maxSafeInteger is largest integer that javascript number represents exactly.
+const maxSafeInteger = 1<<53 - 1
+
+type shellWriter struct {
+	buf      bytes.Buffer
+	indent   string
+	comments bool
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+func (w *shellWriter) newline(depth int) {
+	if w.indent == "" {
+		w.buf.WriteByte(' ')
+		return
+	}
+	w.buf.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		w.buf.WriteString(w.indent)
+	}
+}
+
+func (w *shellWriter) key(k string) {
+	if identifierPattern.MatchString(k) {
+		w.buf.WriteString(k)
+		return
+	}
+	w.string(k)
+}
+
+func (w *shellWriter) string(s string) {
+	w.buf.WriteString(quote(s))
+}
+
+// quote returns s as a single quoted javascript string literal.
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('\'')
+	for _, r := range s {
+		switch r {
+		case '\'':
+			b.WriteString(`\'`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x2028 || r == 0x2029 {
+				fmt.Fprintf(&b, `\u%04x`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+func (w *shellWriter) value(v interface{}, depth int) {
+	switch v := v.(type) {
+	case nil:
+		w.buf.WriteString("null")
+	case primitive.D:
+		if len(v) == 0 {
+			w.buf.WriteString("{}")
+			return
+		}
+		w.buf.WriteByte('{')
+		for index, e := range v {
+			if index > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.newline(depth + 1)
+			w.key(e.Key)
+			w.buf.WriteString(": ")
+			w.value(e.Value, depth+1)
+		}
+		w.newline(depth)
+		w.buf.WriteByte('}')
+	case primitive.A:
+		if len(v) == 0 {
+			w.buf.WriteString("[]")
+			return
+		}
+		var comments = w.comments && depth == 0
+		w.buf.WriteByte('[')
+		for index, i := range v {
+			if index > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.newline(depth + 1)
+			if comments {
+				fmt.Fprintf(&w.buf, "/* %d */ ", index)
+			}
+			w.value(i, depth+1)
+		}
+		w.newline(depth)
+		w.buf.WriteByte(']')
+	case string:
+		w.string(v)
+	case bool:
+		w.buf.WriteString(strconv.FormatBool(v))
+	case int32:
+		w.buf.WriteString(strconv.FormatInt(int64(v), 10))
+	case int64:
+		if v > maxSafeInteger || v < -maxSafeInteger {
+			fmt.Fprintf(&w.buf, "NumberLong(%s)", quote(strconv.FormatInt(v, 10)))
+			return
+		}
+		fmt.Fprintf(&w.buf, "NumberLong(%d)", v)
+	case float64:
+		w.buf.WriteString(formatDouble(v))
+	case primitive.Decimal128:
+		fmt.Fprintf(&w.buf, "NumberDecimal(%s)", quote(v.String()))
+	case primitive.DateTime:
+		fmt.Fprintf(&w.buf, "ISODate(%s)", quote(formatDate(v)))
+	case primitive.ObjectID:
+		fmt.Fprintf(&w.buf, "ObjectId(%s)", quote(v.Hex()))
+	case primitive.Regex:
+		w.buf.WriteString(formatRegex(v))
+	case primitive.Binary:
+		fmt.Fprintf(&w.buf, "BinData(%d, %s)", v.Subtype, quote(base64.StdEncoding.EncodeToString(v.Data)))
+	case primitive.Timestamp:
+		fmt.Fprintf(&w.buf, "Timestamp(%d, %d)", v.T, v.I)
+	case primitive.MinKey:
+		w.buf.WriteString("MinKey()")
+	case primitive.MaxKey:
+		w.buf.WriteString("MaxKey()")
+	case primitive.Undefined:
+		w.buf.WriteString("undefined")
+	case primitive.Null:
+		w.buf.WriteString("null")
+	case primitive.Symbol:
+		w.string(string(v))
+	case primitive.JavaScript:
+		fmt.Fprintf(&w.buf, "Code(%s)", quote(string(v)))
+	case primitive.CodeWithScope:
+		fmt.Fprintf(&w.buf, "Code(%s, ", quote(string(v.Code)))
+		var scope, _ = bsonutil.Normalize(v.Scope)
+		w.value(scope, depth)
+		w.buf.WriteByte(')')
+	case primitive.DBPointer:
+		fmt.Fprintf(&w.buf, "DBPointer(%s, ObjectId(%s))", quote(v.DB), quote(v.Pointer.Hex()))
+	default:
+		fmt.Fprintf(&w.buf, "%v", v)
+	}
+}
+
+// formatDouble formats f as javascript number.
+func formatDouble(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func formatDate(v primitive.DateTime) string {
+	return v.Time().UTC().Format("2006-01-02T15:04:05.000Z07:00")
+}
+
+func formatRegex(v primitive.Regex) string {
+	var pattern = v.Pattern
+	if pattern == "" {
+		pattern = "(?:)"
+	}
+	var b strings.Builder
+	b.WriteByte('/')
+	var escaped bool
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '/':
+			b.WriteByte('\\')
+		case r == '\n':
+			b.WriteString(`\n`)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('/')
+	b.WriteString(v.Options)
+	return b.String()
+}
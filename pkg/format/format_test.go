@@ -0,0 +1,97 @@
+package format
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/NateScarlet/mongo-operators/pkg/aggregation"
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type M = primitive.M
+type A = primitive.A
+
+func TestFormat(t *testing.T) {
+	var id, _ = primitive.ObjectIDFromHex("5f1d7b1c2a3b4c5d6e7f8091")
+	var at = primitive.NewDateTimeFromTime(time.Date(2021, 1, 2, 3, 4, 5, 6e6, time.UTC))
+	for _, c := range []struct {
+		name  string
+		doc   interface{}
+		style Style
+		want  string
+	}{
+		{"empty", M{}, Shell, "{}"},
+		{"sorted map", M{"b": 1, "a": "x", "$c": true}, Shell, "{ $c: true, a: 'x', b: 1 }"},
+		{"ordered", bson.D{{Key: "b", Value: 1}, {Key: "a", Value: 2}}, Shell, "{ b: 1, a: 2 }"},
+		{"quoted key", M{"a.b": 1, "a-b": 2}, Shell, "{ 'a-b': 2, 'a.b': 1 }"},
+		{"string escape", M{"a": "it's\n"}, Shell, `{ a: 'it\'s\n' }`},
+		{"types", bson.D{
+			{Key: "id", Value: id},
+			{Key: "at", Value: at},
+			{Key: "long", Value: int64(1)},
+			{Key: "big", Value: int64(math.MaxInt64)},
+			{Key: "double", Value: 1.5},
+			{Key: "inf", Value: math.Inf(-1)},
+			{Key: "re", Value: primitive.Regex{Pattern: "^a/b", Options: "i"}},
+			{Key: "bin", Value: primitive.Binary{Subtype: 0, Data: []byte("foo")}},
+			{Key: "ts", Value: primitive.Timestamp{T: 1, I: 2}},
+			{Key: "null", Value: nil},
+			{Key: "arr", Value: A{}},
+		}, Shell, "{ id: ObjectId('5f1d7b1c2a3b4c5d6e7f8091'), at: ISODate('2021-01-02T03:04:05.006Z'), " +
+			"long: NumberLong(1), big: NumberLong('9223372036854775807'), double: 1.5, inf: -Infinity, " +
+			"re: /^a\\/b/i, bin: BinData(0, 'Zm9v'), ts: Timestamp(1, 2), null: null, arr: [] }"},
+		{"builder", M{"age": query.MergeOperators(query.Gte(18), query.Lt(65))}, Shell, "{ age: { $gte: 18, $lt: 65 } }"},
+		{"canonical", bson.D{{Key: "a", Value: 1}, {Key: "at", Value: at}}, Canonical,
+			`{"a":{"$numberInt":"1"},"at":{"$date":{"$numberLong":"1609556645006"}}}`},
+		{"relaxed", bson.D{{Key: "a", Value: 1}, {Key: "at", Value: at}}, Relaxed,
+			`{"a":1,"at":{"$date":"2021-01-02T03:04:05.006Z"}}`},
+		{"pipeline", A{
+			aggregation.Match(M{"a": 1}),
+			aggregation.Unwind(aggregation.Field("tags")),
+		}, Relaxed, `[{"$match":{"a":1}},{"$unwind":"$tags"}]`},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := Format(c.doc, c.style)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, s)
+		})
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	var pipeline = A{
+		aggregation.Match(bson.D{{Key: "b", Value: 1}, {Key: "a", Value: 2}}),
+		aggregation.Limit(1),
+	}
+	s, err := Options{Style: Shell, Indent: "  ", SortKeys: true, StageComments: true}.Format(pipeline)
+	require.NoError(t, err)
+	assert.Equal(t, `[
+  /* 0 */ {
+    $match: {
+      a: 2,
+      b: 1
+    }
+  },
+  /* 1 */ {
+    $limit: 1
+  }
+]`, s)
+
+	s, err = Options{Style: Canonical, Indent: "  "}.Format(M{"a": A{1}})
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "a": [
+    {
+      "$numberInt": "1"
+    }
+  ]
+}`, s)
+
+	_, err = Options{Style: Style(9)}.Format(M{})
+	assert.EqualError(t, err, "format: unknown style Style(9)")
+}
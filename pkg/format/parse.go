@@ -0,0 +1,737 @@
+package format
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Parse parses mongo shell syntax, canonical or relaxed Extended JSON text,
+// e.g. a pipeline copied from Compass or a filter from slow query log.
+//
+// Documents are returned as primitive.D with keys in order, arrays as primitive.A,
+// and other values as their primitive go type.
+// Shell helpers like ObjectId(...), ISODate(...), NumberLong(...),
+// regex literals and comments are supported.
+func Parse(text string) (interface{}, error) {
+	var p = &parser{src: text}
+	p.skipSpace()
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.peek() == ';' {
+		p.pos++
+		p.skipSpace()
+	}
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q after value", p.src[p.pos:p.pos+1])
+	}
+	return v, nil
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+// errorf returns error with line and column of current position.
+func (p *parser) errorf(format string, args ...interface{}) error {
+	var line, col = 1, 1
+	for _, r := range p.src[:p.pos] {
+		if r == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return fmt.Errorf("format: %d:%d: %s", line, col, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) peek() byte {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], "//"):
+			var end = strings.IndexByte(p.src[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.src)
+				return
+			}
+			p.pos += end + 1
+		case strings.HasPrefix(p.src[p.pos:], "/*"):
+			var end = strings.Index(p.src[p.pos+2:], "*/")
+			if end < 0 {
+				p.pos = len(p.src)
+				return
+			}
+			p.pos += end + 4
+		default:
+			r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+			if !unicode.IsSpace(r) {
+				return
+			}
+			p.pos += size
+		}
+	}
+}
+
+func (p *parser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		if p.pos >= len(p.src) {
+			return p.errorf("expected %q, got end of input", c)
+		}
+		return p.errorf("expected %q, got %q", c, p.src[p.pos:p.pos+1])
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) value() (interface{}, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == 0:
+		return nil, p.errorf("unexpected end of input")
+	case c == '{':
+		return p.object()
+	case c == '[':
+		return p.array()
+	case c == '"' || c == '\'':
+		return p.string()
+	case c == '/':
+		return p.regex()
+	case c == '-' || c == '+' || c == '.' || c >= '0' && c <= '9':
+		return p.number()
+	case isIdentifierStart(rune(c)):
+		return p.identifier()
+	}
+	return nil, p.errorf("unexpected %q", p.src[p.pos:p.pos+1])
+}
+
+func (p *parser) object() (interface{}, error) {
+	p.pos++
+	var d = primitive.D{}
+	for {
+		p.skipSpace()
+		if p.peek() == '}' {
+			p.pos++
+			break
+		}
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		d = append(d, primitive.E{Key: key, Value: v})
+		p.skipSpace()
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect('}'); err != nil {
+			return nil, err
+		}
+		break
+	}
+	return extendedValue(d, p)
+}
+
+func (p *parser) key() (string, error) {
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.string()
+	case c >= '0' && c <= '9':
+		var start = p.pos
+		for c := p.peek(); c >= '0' && c <= '9'; c = p.peek() {
+			p.pos++
+		}
+		return p.src[start:p.pos], nil
+	case isIdentifierStart(rune(c)):
+		return p.name(), nil
+	}
+	if p.pos >= len(p.src) {
+		return "", p.errorf("expected key, got end of input")
+	}
+	return "", p.errorf("expected key, got %q", p.src[p.pos:p.pos+1])
+}
+
+func (p *parser) array() (interface{}, error) {
+	p.pos++
+	var a = primitive.A{}
+	for {
+		p.skipSpace()
+		if p.peek() == ']' {
+			p.pos++
+			return a, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+		p.skipSpace()
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+}
+
+func (p *parser) string() (string, error) {
+	var quote = p.src[p.pos]
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		var c = p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\\':
+			p.pos++
+			if err := p.escape(&b); err != nil {
+				return "", err
+			}
+		case c == '\n':
+			return "", p.errorf("unterminated string")
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+func (p *parser) escape(b *strings.Builder) error {
+	if p.pos >= len(p.src) {
+		return p.errorf("unterminated string")
+	}
+	var c = p.src[p.pos]
+	p.pos++
+	switch c {
+	case 'n':
+		b.WriteByte('\n')
+	case 'r':
+		b.WriteByte('\r')
+	case 't':
+		b.WriteByte('\t')
+	case 'b':
+		b.WriteByte('\b')
+	case 'f':
+		b.WriteByte('\f')
+	case 'v':
+		b.WriteByte('\v')
+	case '0':
+		b.WriteByte(0)
+	case '\n':
+		// line continuation
+	case 'x', 'u':
+		var n = 2
+		if c == 'u' {
+			n = 4
+		}
+		if p.pos+n > len(p.src) {
+			return p.errorf("invalid escape sequence")
+		}
+		r, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+		if err != nil {
+			return p.errorf("invalid escape sequence")
+		}
+		p.pos += n
+		var rr = rune(r)
+		if c == 'u' && rr >= 0xd800 && rr < 0xdc00 && strings.HasPrefix(p.src[p.pos:], `\u`) && p.pos+6 <= len(p.src) {
+			// utf-16 surrogate pair
+			if low, err := strconv.ParseUint(p.src[p.pos+2:p.pos+6], 16, 32); err == nil && low >= 0xdc00 && low < 0xe000 {
+				rr = (rr-0xd800)<<10 + (rune(low) - 0xdc00) + 0x10000
+				p.pos += 6
+			}
+		}
+		b.WriteRune(rr)
+	default:
+		b.WriteByte(c)
+	}
+	return nil
+}
+
+func (p *parser) regex() (interface{}, error) {
+	var start = p.pos
+	p.pos++
+	var b strings.Builder
+	var inClass bool
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.pos = start
+			return nil, p.errorf("unterminated regular expression")
+		}
+		var c = p.src[p.pos]
+		p.pos++
+		switch {
+		case c == '\\' && p.pos < len(p.src):
+			if p.src[p.pos] != '/' {
+				b.WriteByte(c)
+			}
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+			continue
+		case c == '[':
+			inClass = true
+		case c == ']':
+			inClass = false
+		case c == '/' && !inClass:
+			var flags = p.pos
+			for p.pos < len(p.src) && isIdentifierPart(rune(p.src[p.pos])) {
+				p.pos++
+			}
+			return primitive.Regex{Pattern: b.String(), Options: p.src[flags:p.pos]}, nil
+		}
+		b.WriteByte(c)
+	}
+}
+
+func (p *parser) number() (interface{}, error) {
+	var start = p.pos
+	if c := p.peek(); c == '-' || c == '+' {
+		p.pos++
+	}
+	if isIdentifierStart(rune(p.peek())) {
+		// -Infinity
+		var name = p.name()
+		if name == "Infinity" {
+			if p.src[start] == '-' {
+				return math.Inf(-1), nil
+			}
+			return math.Inf(1), nil
+		}
+		p.pos = start
+		return nil, p.errorf("invalid number")
+	}
+	var isFloat bool
+	for p.pos < len(p.src) {
+		var c = p.src[p.pos]
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' || c == 'e' || c == 'E':
+			isFloat = true
+		case (c == '-' || c == '+') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E'):
+		default:
+			return p.parseNumber(start, isFloat)
+		}
+		p.pos++
+	}
+	return p.parseNumber(start, isFloat)
+}
+
+func (p *parser) parseNumber(start int, isFloat bool) (interface{}, error) {
+	var s = strings.TrimPrefix(p.src[start:p.pos], "+")
+	if !isFloat {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			if i >= math.MinInt32 && i <= math.MaxInt32 {
+				return int32(i), nil
+			}
+			return i, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("invalid number %q", s)
+	}
+	return f, nil
+}
+
+func isIdentifierStart(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r)
+}
+
+func isIdentifierPart(r rune) bool {
+	return isIdentifierStart(r) || unicode.IsDigit(r)
+}
+
+func (p *parser) name() string {
+	var start = p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !isIdentifierPart(r) {
+			break
+		}
+		p.pos += size
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *parser) identifier() (interface{}, error) {
+	var start = p.pos
+	var name = p.name()
+	if name == "new" {
+		p.skipSpace()
+		start = p.pos
+		name = p.name()
+	}
+	switch name {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "undefined":
+		return primitive.Undefined{}, nil
+	case "NaN":
+		return math.NaN(), nil
+	case "Infinity":
+		return math.Inf(1), nil
+	case "MinKey":
+		p.optionalCall()
+		return primitive.MinKey{}, nil
+	case "MaxKey":
+		p.optionalCall()
+		return primitive.MaxKey{}, nil
+	}
+	p.skipSpace()
+	if p.peek() != '(' {
+		p.pos = start
+		return nil, p.errorf("unexpected identifier %s", name)
+	}
+	args, err := p.args()
+	if err != nil {
+		return nil, err
+	}
+	v, err := call(name, args)
+	if err != nil {
+		p.pos = start
+		return nil, p.errorf("%s", err)
+	}
+	return v, nil
+}
+
+// optionalCall skips "()" after name.
+func (p *parser) optionalCall() {
+	var pos = p.pos
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], "(") {
+		p.pos++
+		p.skipSpace()
+		if p.peek() == ')' {
+			p.pos++
+			return
+		}
+	}
+	p.pos = pos
+}
+
+func (p *parser) args() ([]interface{}, error) {
+	p.pos++
+	var ret []interface{}
+	for {
+		p.skipSpace()
+		if p.peek() == ')' {
+			p.pos++
+			return ret, nil
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+		p.skipSpace()
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		if err := p.expect(')'); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+}
+
+// call evaluates shell helper function.
+func call(name string, args []interface{}) (interface{}, error) {
+	var str = func(index int) (string, error) {
+		if index >= len(args) {
+			return "", fmt.Errorf("%s: missing argument", name)
+		}
+		s, ok := args[index].(string)
+		if !ok {
+			return "", fmt.Errorf("%s: argument %d must be a string", name, index)
+		}
+		return s, nil
+	}
+	var integer = func(index int) (int64, error) {
+		if index >= len(args) {
+			return 0, fmt.Errorf("%s: missing argument", name)
+		}
+		switch v := args[index].(type) {
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("%s: argument %d must be an integer", name, index)
+	}
+	switch name {
+	case "ObjectId", "ObjectID":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s: hex string argument is required", name)
+		}
+		s, err := str(0)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.ObjectIDFromHex(s)
+	case "ISODate", "Date":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("%s: argument is required", name)
+		}
+		if s, ok := args[0].(string); ok {
+			t, err := parseDate(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			return primitive.NewDateTimeFromTime(t), nil
+		}
+		ms, err := integer(0)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.DateTime(ms), nil
+	case "NumberLong", "Long":
+		return integer(0)
+	case "NumberInt", "Int32":
+		i, err := integer(0)
+		if err != nil {
+			return nil, err
+		}
+		if i < math.MinInt32 || i > math.MaxInt32 {
+			return nil, fmt.Errorf("%s: %d overflows int32", name, i)
+		}
+		return int32(i), nil
+	case "Double":
+		switch v := args[0].(type) {
+		case int32:
+			return float64(v), nil
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		}
+		return nil, fmt.Errorf("%s: argument must be a number", name)
+	case "NumberDecimal", "Decimal128":
+		var s string
+		switch v := args[0].(type) {
+		case string:
+			s = v
+		case int32, int64:
+			s = fmt.Sprint(v)
+		case float64:
+			s = strconv.FormatFloat(v, 'g', -1, 64)
+		default:
+			return nil, fmt.Errorf("%s: argument must be a string", name)
+		}
+		return primitive.ParseDecimal128(s)
+	case "Timestamp":
+		if len(args) == 1 {
+			if d, ok := args[0].(primitive.D); ok {
+				var t, _ = lookup(d, "t")
+				var i, _ = lookup(d, "i")
+				args = []interface{}{t, i}
+			}
+		}
+		t, err := integer(0)
+		if err != nil {
+			return nil, err
+		}
+		i, err := integer(1)
+		if err != nil {
+			return nil, err
+		}
+		return primitive.Timestamp{T: uint32(t), I: uint32(i)}, nil
+	case "BinData":
+		subtype, err := integer(0)
+		if err != nil {
+			return nil, err
+		}
+		s, err := str(1)
+		if err != nil {
+			return nil, err
+		}
+		data, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return primitive.Binary{Subtype: byte(subtype), Data: data}, nil
+	case "HexData":
+		subtype, err := integer(0)
+		if err != nil {
+			return nil, err
+		}
+		s, err := str(1)
+		if err != nil {
+			return nil, err
+		}
+		data, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return primitive.Binary{Subtype: byte(subtype), Data: data}, nil
+	case "UUID":
+		s, err := str(0)
+		if err != nil {
+			return nil, err
+		}
+		data, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+		if err != nil || len(data) != 16 {
+			return nil, fmt.Errorf("%s: invalid uuid %q", name, s)
+		}
+		return primitive.Binary{Subtype: 4, Data: data}, nil
+	case "RegExp":
+		pattern, err := str(0)
+		if err != nil {
+			return nil, err
+		}
+		var options string
+		if len(args) > 1 {
+			if options, err = str(1); err != nil {
+				return nil, err
+			}
+		}
+		return primitive.Regex{Pattern: pattern, Options: options}, nil
+	case "Code":
+		code, err := str(0)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) > 1 {
+			return primitive.CodeWithScope{Code: primitive.JavaScript(code), Scope: args[1]}, nil
+		}
+		return primitive.JavaScript(code), nil
+	case "DBRef":
+		ns, err := str(0)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%s: missing argument", name)
+		}
+		var d = primitive.D{{Key: "$ref", Value: ns}, {Key: "$id", Value: args[1]}}
+		if len(args) > 2 {
+			d = append(d, primitive.E{Key: "$db", Value: args[2]})
+		}
+		return d, nil
+	case "DBPointer":
+		ns, err := str(0)
+		if err != nil {
+			return nil, err
+		}
+		id, ok := args[1].(primitive.ObjectID)
+		if !ok {
+			return nil, fmt.Errorf("%s: argument 1 must be an ObjectId", name)
+		}
+		return primitive.DBPointer{DB: ns, Pointer: id}, nil
+	}
+	return nil, fmt.Errorf("unknown function %s", name)
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999Z0700",
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02T15:04",
+		"2006-01-02",
+	} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+func lookup(d primitive.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// extendedKeys are keys of Extended JSON type wrapper documents.
+// $regex is not included as it is also a query operator.
+var extendedKeys = map[string]bool{
+	"$binary":            true,
+	"$code":              true,
+	"$date":              true,
+	"$dbPointer":         true,
+	"$maxKey":            true,
+	"$minKey":            true,
+	"$numberDecimal":     true,
+	"$numberDouble":      true,
+	"$numberInt":         true,
+	"$numberLong":        true,
+	"$oid":               true,
+	"$regularExpression": true,
+	"$symbol":            true,
+	"$timestamp":         true,
+	"$undefined":         true,
+}
+
+// extendedValue converts Extended JSON type wrapper document to bson value.
+func extendedValue(d primitive.D, p *parser) (interface{}, error) {
+	if len(d) == 0 || !extendedKeys[d[0].Key] {
+		return d, nil
+	}
+	if d[0].Key == "$code" && len(d) == 2 && d[1].Key == "$scope" {
+		// scope is already parsed
+		code, ok := d[0].Value.(string)
+		if !ok {
+			return nil, p.errorf("$code must be a string")
+		}
+		return primitive.CodeWithScope{Code: primitive.JavaScript(code), Scope: d[1].Value}, nil
+	}
+	b, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: d}}, false, false)
+	if err != nil {
+		return nil, p.errorf("%s", err)
+	}
+	var ret bson.D
+	if err := bson.UnmarshalExtJSON(b, false, &ret); err != nil {
+		return nil, p.errorf("%s", err)
+	}
+	return ret[0].Value, nil
+}
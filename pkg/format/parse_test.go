@@ -0,0 +1,109 @@
+package format
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type D = primitive.D
+type E = primitive.E
+
+func TestParse(t *testing.T) {
+	var id, _ = primitive.ObjectIDFromHex("5f1d7b1c2a3b4c5d6e7f8091")
+	var at = primitive.NewDateTimeFromTime(time.Date(2021, 1, 2, 3, 4, 5, 6e6, time.UTC))
+	for _, c := range []struct {
+		name string
+		text string
+		want interface{}
+	}{
+		{"empty", "{}", D{}},
+		{"shell", "{ a: 1, 'b-c': \"x\", $d: [true, null], }", D{
+			{Key: "a", Value: int32(1)},
+			{Key: "b-c", Value: "x"},
+			{Key: "$d", Value: A{true, nil}},
+		}},
+		{"numbers", "[1, -2, 3000000000, 1.5, 2e3, NumberLong(4), NumberInt('5'), -Infinity]", A{
+			int32(1), int32(-2), int64(3000000000), 1.5, 2000.0, int64(4), int32(5), math.Inf(-1),
+		}},
+		{"comments", "// pipeline\n[ /* 0 */ { $limit: 1 } ];", A{D{{Key: "$limit", Value: int32(1)}}}},
+		{"helpers", `{
+			id: ObjectId('5f1d7b1c2a3b4c5d6e7f8091'),
+			at: ISODate("2021-01-02T03:04:05.006Z"),
+			date: new Date(1609556645006),
+			re: /^a\/b/i,
+			bin: BinData(0, 'Zm9v'),
+			ts: Timestamp({ t: 1, i: 2 }),
+			min: MinKey,
+			dec: NumberDecimal('1.5'),
+		}`, D{
+			{Key: "id", Value: id},
+			{Key: "at", Value: at},
+			{Key: "date", Value: at},
+			{Key: "re", Value: primitive.Regex{Pattern: "^a/b", Options: "i"}},
+			{Key: "bin", Value: primitive.Binary{Subtype: 0, Data: []byte("foo")}},
+			{Key: "ts", Value: primitive.Timestamp{T: 1, I: 2}},
+			{Key: "min", Value: primitive.MinKey{}},
+			{Key: "dec", Value: func() primitive.Decimal128 { v, _ := primitive.ParseDecimal128("1.5"); return v }()},
+		}},
+		{"canonical", `{"a":{"$numberInt":"1"},"at":{"$date":{"$numberLong":"1609556645006"}},"id":{"$oid":"5f1d7b1c2a3b4c5d6e7f8091"}}`, D{
+			{Key: "a", Value: int32(1)},
+			{Key: "at", Value: at},
+			{Key: "id", Value: id},
+		}},
+		{"relaxed", `{"at":{"$date":"2021-01-02T03:04:05.006Z"},"n":{"$numberLong":"2"}}`, D{
+			{Key: "at", Value: at},
+			{Key: "n", Value: int64(2)},
+		}},
+		{"regex operator", `{"a":{"$regex":"^a","$options":"i"}}`, D{
+			{Key: "a", Value: D{{Key: "$regex", Value: "^a"}, {Key: "$options", Value: "i"}}},
+		}},
+		{"string escape", `'it\'s\né'`, "it's\né"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			v, err := Parse(c.text)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, v)
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, c := range []struct {
+		text string
+		want string
+	}{
+		{"", "format: 1:1: unexpected end of input"},
+		{"{ a: 1", "format: 1:7: expected '}', got end of input"},
+		{"{\n  a: foo }", "format: 2:6: unexpected identifier foo"},
+		{"[1] 2", "format: 1:5: unexpected \"2\" after value"},
+		{"ObjectId('x')", "format: 1:1: the provided hex string is not a valid ObjectID"},
+	} {
+		t.Run(c.text, func(t *testing.T) {
+			_, err := Parse(c.text)
+			assert.EqualError(t, err, c.want)
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	var doc = bson.D{
+		{Key: "a", Value: A{int32(1), int64(2), 1.5, "x"}},
+		{Key: "b", Value: primitive.Regex{Pattern: "a/b", Options: "i"}},
+		{Key: "c", Value: primitive.Timestamp{T: 1, I: 2}},
+	}
+	for _, style := range []Style{Shell, Canonical} {
+		t.Run(style.String(), func(t *testing.T) {
+			s, err := Format(doc, style)
+			require.NoError(t, err)
+			v, err := Parse(s)
+			require.NoError(t, err)
+			assert.Equal(t, doc, v)
+		})
+	}
+}
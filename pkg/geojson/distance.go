@@ -0,0 +1,51 @@
+package geojson
+
+import "math"
+
+// Distance on earth surface in meters,
+// e.g. 5 * Kilometer or Distance(100) * Mile.
+type Distance float64
+
+// Distance units.
+const (
+	Meter     Distance = 1
+	Kilometer Distance = 1000
+	Mile      Distance = 1609.344
+)
+
+// EarthRadius used to convert distance to radians,
+// it is the equatorial radius used in mongodb documentation.
+// https://docs.mongodb.com/manual/tutorial/calculate-distances-using-spherical-geometry-with-2d-geospatial-indexes/
+const EarthRadius = 6378.1 * Kilometer
+
+// DistanceFromRadians converts angular distance to distance on earth surface,
+// e.g. distance returned by $geoNear with legacy coordinate pairs.
+func DistanceFromRadians(radians float64) Distance {
+	return Distance(radians) * EarthRadius
+}
+
+// Meters of distance, used by GeoJSON $near, $nearSphere and $geoNear.
+func (d Distance) Meters() float64 {
+	return float64(d)
+}
+
+// Kilometers of distance.
+func (d Distance) Kilometers() float64 {
+	return float64(d / Kilometer)
+}
+
+// Miles of distance.
+func (d Distance) Miles() float64 {
+	return float64(d / Mile)
+}
+
+// Radians of distance, used by $centerSphere
+// and legacy coordinate pairs with spherical geometry.
+func (d Distance) Radians() float64 {
+	return float64(d / EarthRadius)
+}
+
+// Degrees of distance along a meridian.
+func (d Distance) Degrees() float64 {
+	return d.Radians() * 180 / math.Pi
+}
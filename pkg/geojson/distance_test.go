@@ -0,0 +1,20 @@
+package geojson
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistance(t *testing.T) {
+	var d = 10 * Kilometer
+	assert.Equal(t, 10000.0, d.Meters())
+	assert.Equal(t, 10.0, d.Kilometers())
+	assert.InDelta(t, 6.2137, d.Miles(), 1e-4)
+	assert.InDelta(t, 10/6378.1, d.Radians(), 1e-12)
+	assert.InDelta(t, 1.0, Mile.Miles(), 1e-12)
+	assert.InDelta(t, 3963.2, EarthRadius.Miles(), 0.1)
+	assert.InDelta(t, 180.0, (EarthRadius * math.Pi).Degrees(), 1e-9)
+	assert.InDelta(t, d.Meters(), DistanceFromRadians(d.Radians()).Meters(), 1e-9)
+}
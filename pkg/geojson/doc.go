@@ -0,0 +1,8 @@
+// Package geojson contains [GeoJSON](https://docs.mongodb.com/manual/reference/geojson/)
+// objects supported by mongodb. They are validated and marshaled to BSON directly,
+// use them with query.GeoWithIn, query.GeoIntersects, query.NearPoint,
+// query.NearSpherePoint and aggregation.GeoNear:
+//
+//	query.GeoWithIn(geojson.Polygon{{{0, 0}, {3, 0}, {3, 3}, {0, 3}, {0, 0}}})
+//	aggregation.GeoNear(geojson.Point{-73.99, 40.73}, "distance").SetSpherical(true)
+package geojson
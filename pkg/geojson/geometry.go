@@ -0,0 +1,389 @@
+package geojson
+
+import (
+	"fmt"
+	"math"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Geometry is a GeoJSON object of this package.
+type Geometry interface {
+	// Type of GeoJSON object, e.g. "Point".
+	Type() string
+	// Validate returns error when coordinates are invalid for mongodb.
+	Validate() error
+	// MarshalBSON validates the object and returns it as a BSON document.
+	MarshalBSON() ([]byte, error)
+	check(path string) error
+}
+
+func validate(g Geometry) error {
+	if err := g.check(""); err != nil {
+		return fmt.Errorf("geojson: %w", err)
+	}
+	return nil
+}
+
+func marshal(g Geometry, coordinates interface{}) ([]byte, error) {
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	return bson.Marshal(bson.D{
+		{Key: "type", Value: g.Type()},
+		{Key: "coordinates", Value: coordinates},
+	})
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func indexPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
+
+// Point is a position as [longitude, latitude].
+// https://docs.mongodb.com/manual/reference/geojson/#point
+type Point [2]float64
+
+// Longitude of point.
+func (p Point) Longitude() float64 {
+	return p[0]
+}
+
+// Latitude of point.
+func (p Point) Latitude() float64 {
+	return p[1]
+}
+
+// Type implements Geometry.
+func (p Point) Type() string {
+	return "Point"
+}
+
+// Validate checks longitude is in [-180, 180] and latitude is in [-90, 90].
+func (p Point) Validate() error {
+	return validate(p)
+}
+
+// MarshalBSON implements bson.Marshaler.
+func (p Point) MarshalBSON() ([]byte, error) {
+	return marshal(p, [2]float64(p))
+}
+
+func (p Point) check(path string) error {
+	return checkPosition(joinPath(path, "coordinates"), p)
+}
+
+func checkPosition(path string, p Point) error {
+	switch {
+	case math.IsNaN(p[0]) || math.IsNaN(p[1]):
+		return fmt.Errorf("%s: coordinates must be numbers", path)
+	case p[0] < -180 || p[0] > 180:
+		return fmt.Errorf("%s: longitude %v out of range [-180, 180]", path, p[0])
+	case p[1] < -90 || p[1] > 90:
+		return fmt.Errorf("%s: latitude %v out of range [-90, 90]", path, p[1])
+	}
+	return nil
+}
+
+func checkPositions(path string, points []Point, min int) error {
+	if len(points) < min {
+		return fmt.Errorf("%s: requires at least %d points", path, min)
+	}
+	for index, i := range points {
+		if err := checkPosition(indexPath(path, index), i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func positions(points []Point) [][2]float64 {
+	var ret = make([][2]float64, len(points))
+	for index, i := range points {
+		ret[index] = i
+	}
+	return ret
+}
+
+// LineString is a line of at least 2 points.
+// https://docs.mongodb.com/manual/reference/geojson/#linestring
+type LineString []Point
+
+// Type implements Geometry.
+func (l LineString) Type() string {
+	return "LineString"
+}
+
+// Validate checks point count and coordinate ranges.
+func (l LineString) Validate() error {
+	return validate(l)
+}
+
+// MarshalBSON implements bson.Marshaler.
+func (l LineString) MarshalBSON() ([]byte, error) {
+	return marshal(l, positions(l))
+}
+
+func (l LineString) check(path string) error {
+	return checkPositions(joinPath(path, "coordinates"), l, 2)
+}
+
+// Polygon is an array of linear rings, the first one is the exterior ring
+// and others are holes inside it.
+// A linear ring is closed, i.e. first point equals last point,
+// and has at least 4 points.
+// Winding order is only significant with StrictWindingCRS,
+// use ValidateWinding to check it and Oriented to fix it.
+// https://docs.mongodb.com/manual/reference/geojson/#polygon
+type Polygon [][]Point
+
+// Type implements Geometry.
+func (p Polygon) Type() string {
+	return "Polygon"
+}
+
+// Validate checks ring closure and coordinate ranges.
+func (p Polygon) Validate() error {
+	return validate(p)
+}
+
+// MarshalBSON implements bson.Marshaler.
+func (p Polygon) MarshalBSON() ([]byte, error) {
+	return marshal(p, p.coordinates())
+}
+
+func (p Polygon) coordinates() [][][2]float64 {
+	var ret = make([][][2]float64, len(p))
+	for index, i := range p {
+		ret[index] = positions(i)
+	}
+	return ret
+}
+
+func (p Polygon) check(path string) error {
+	return checkPolygon(joinPath(path, "coordinates"), p)
+}
+
+func checkPolygon(path string, p Polygon) error {
+	if len(p) == 0 {
+		return fmt.Errorf("%s: requires an exterior ring", path)
+	}
+	for index, ring := range p {
+		var ringPath = indexPath(path, index)
+		if err := checkPositions(ringPath, ring, 4); err != nil {
+			return err
+		}
+		if ring[0] != ring[len(ring)-1] {
+			return fmt.Errorf("%s: linear ring must be closed", ringPath)
+		}
+		if signedArea(ring) == 0 {
+			return fmt.Errorf("%s: linear ring must have non-zero area", ringPath)
+		}
+	}
+	return nil
+}
+
+// StrictWindingCRS is name of crs that requires polygon
+// with counterclockwise exterior ring, e.g. for polygon larger than a hemisphere.
+// https://docs.mongodb.com/manual/reference/operator/query/geometry/#big-polygons
+const StrictWindingCRS = "urn:x-mongodb:crs:strictwinding:EPSG:4326"
+
+// ValidateWinding checks p as Validate, and checks exterior ring is counterclockwise
+// and holes are clockwise, as RFC 7946 and StrictWindingCRS require.
+func (p Polygon) ValidateWinding() error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	for index, ring := range p {
+		var area = signedArea(ring)
+		switch {
+		case index == 0 && area < 0:
+			return fmt.Errorf("geojson: coordinates[0]: exterior ring must be counterclockwise")
+		case index > 0 && area > 0:
+			return fmt.Errorf("geojson: coordinates[%d]: interior ring must be clockwise", index)
+		}
+	}
+	return nil
+}
+
+// signedArea is positive when ring is counterclockwise,
+// longitude is unwrapped so edges crossing the antimeridian take the short way.
+// A ring that goes around a pole is closed through the pole it encloses,
+// i.e. north pole when it goes eastward.
+func signedArea(ring []Point) float64 {
+	var ret float64
+	var x1 float64
+	for index := 1; index < len(ring); index++ {
+		var a, b = ring[index-1], ring[index]
+		var dx = b[0] - a[0]
+		switch {
+		case dx > 180:
+			dx -= 360
+		case dx < -180:
+			dx += 360
+		}
+		var x2 = x1 + dx
+		ret += x1*b[1] - x2*a[1]
+		x1 = x2
+	}
+	if math.Abs(x1) > 180 {
+		var pole = math.Copysign(90, x1)
+		ret += 2*x1*pole - x1*ring[0][1]
+	}
+	return ret / 2
+}
+
+// Oriented returns a copy of p with counterclockwise exterior ring
+// and clockwise holes.
+func (p Polygon) Oriented() Polygon {
+	var ret = make(Polygon, len(p))
+	for index, ring := range p {
+		var area = signedArea(ring)
+		ret[index] = append([]Point(nil), ring...)
+		if (index == 0 && area < 0) || (index > 0 && area > 0) {
+			for i, j := 0, len(ring)-1; i < j; i, j = i+1, j-1 {
+				ret[index][i], ret[index][j] = ret[index][j], ret[index][i]
+			}
+		}
+	}
+	return ret
+}
+
+// MultiPoint is an array of points.
+// https://docs.mongodb.com/manual/reference/geojson/#multipoint
+type MultiPoint []Point
+
+// Type implements Geometry.
+func (m MultiPoint) Type() string {
+	return "MultiPoint"
+}
+
+// Validate checks coordinate ranges.
+func (m MultiPoint) Validate() error {
+	return validate(m)
+}
+
+// MarshalBSON implements bson.Marshaler.
+func (m MultiPoint) MarshalBSON() ([]byte, error) {
+	return marshal(m, positions(m))
+}
+
+func (m MultiPoint) check(path string) error {
+	return checkPositions(joinPath(path, "coordinates"), m, 1)
+}
+
+// MultiLineString is an array of line strings.
+// https://docs.mongodb.com/manual/reference/geojson/#multilinestring
+type MultiLineString []LineString
+
+// Type implements Geometry.
+func (m MultiLineString) Type() string {
+	return "MultiLineString"
+}
+
+// Validate checks point count and coordinate ranges of each line.
+func (m MultiLineString) Validate() error {
+	return validate(m)
+}
+
+// MarshalBSON implements bson.Marshaler.
+func (m MultiLineString) MarshalBSON() ([]byte, error) {
+	var coordinates = make([][][2]float64, len(m))
+	for index, i := range m {
+		coordinates[index] = positions(i)
+	}
+	return marshal(m, coordinates)
+}
+
+func (m MultiLineString) check(path string) error {
+	path = joinPath(path, "coordinates")
+	if len(m) == 0 {
+		return fmt.Errorf("%s: requires at least 1 line", path)
+	}
+	for index, i := range m {
+		if err := checkPositions(indexPath(path, index), i, 2); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MultiPolygon is an array of polygons.
+// https://docs.mongodb.com/manual/reference/geojson/#multipolygon
+type MultiPolygon []Polygon
+
+// Type implements Geometry.
+func (m MultiPolygon) Type() string {
+	return "MultiPolygon"
+}
+
+// Validate checks each polygon as Polygon.Validate.
+func (m MultiPolygon) Validate() error {
+	return validate(m)
+}
+
+// MarshalBSON implements bson.Marshaler.
+func (m MultiPolygon) MarshalBSON() ([]byte, error) {
+	var coordinates = make([][][][2]float64, len(m))
+	for index, i := range m {
+		coordinates[index] = i.coordinates()
+	}
+	return marshal(m, coordinates)
+}
+
+func (m MultiPolygon) check(path string) error {
+	path = joinPath(path, "coordinates")
+	if len(m) == 0 {
+		return fmt.Errorf("%s: requires at least 1 polygon", path)
+	}
+	for index, i := range m {
+		if err := checkPolygon(indexPath(path, index), i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GeometryCollection is an array of geometries.
+// https://docs.mongodb.com/manual/reference/geojson/#geometrycollection
+type GeometryCollection []Geometry
+
+// Type implements Geometry.
+func (c GeometryCollection) Type() string {
+	return "GeometryCollection"
+}
+
+// Validate checks each geometry.
+func (c GeometryCollection) Validate() error {
+	return validate(c)
+}
+
+// MarshalBSON implements bson.Marshaler.
+func (c GeometryCollection) MarshalBSON() ([]byte, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return bson.Marshal(bson.D{
+		{Key: "type", Value: c.Type()},
+		{Key: "geometries", Value: []Geometry(c)},
+	})
+}
+
+func (c GeometryCollection) check(path string) error {
+	path = joinPath(path, "geometries")
+	for index, i := range c {
+		if i == nil {
+			return fmt.Errorf("%s: geometry must not be nil", indexPath(path, index))
+		}
+		if err := i.check(indexPath(path, index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package geojson
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var square = Polygon{
+	{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}},
+	{{2, 2}, {2, 4}, {4, 4}, {4, 2}, {2, 2}},
+}
+
+func marshalDoc(t *testing.T, v interface{}) bson.D {
+	b, err := bson.Marshal(bson.D{{Key: "v", Value: v}})
+	require.NoError(t, err)
+	var d bson.D
+	require.NoError(t, bson.Unmarshal(b, &d))
+	return d[0].Value.(bson.D)
+}
+
+func TestMarshal(t *testing.T) {
+	assert.Equal(t, bson.D{
+		{Key: "type", Value: "Point"},
+		{Key: "coordinates", Value: bson.A{-73.99, 40.73}},
+	}, marshalDoc(t, Point{-73.99, 40.73}))
+	assert.Equal(t, bson.D{
+		{Key: "type", Value: "LineString"},
+		{Key: "coordinates", Value: bson.A{bson.A{0.0, 0.0}, bson.A{1.0, 1.0}}},
+	}, marshalDoc(t, LineString{{0, 0}, {1, 1}}))
+	assert.Equal(t, bson.D{
+		{Key: "type", Value: "Polygon"},
+		{Key: "coordinates", Value: bson.A{
+			bson.A{bson.A{0.0, 0.0}, bson.A{10.0, 0.0}, bson.A{10.0, 10.0}, bson.A{0.0, 10.0}, bson.A{0.0, 0.0}},
+			bson.A{bson.A{2.0, 2.0}, bson.A{2.0, 4.0}, bson.A{4.0, 4.0}, bson.A{4.0, 2.0}, bson.A{2.0, 2.0}},
+		}},
+	}, marshalDoc(t, square))
+	assert.Equal(t, bson.D{
+		{Key: "type", Value: "MultiPolygon"},
+		{Key: "coordinates", Value: bson.A{bson.A{bson.A{bson.A{0.0, 0.0}, bson.A{1.0, 0.0}, bson.A{1.0, 1.0}, bson.A{0.0, 0.0}}}}},
+	}, marshalDoc(t, MultiPolygon{{{{0, 0}, {1, 0}, {1, 1}, {0, 0}}}}))
+	assert.Equal(t, bson.D{
+		{Key: "type", Value: "GeometryCollection"},
+		{Key: "geometries", Value: bson.A{
+			bson.D{{Key: "type", Value: "Point"}, {Key: "coordinates", Value: bson.A{1.0, 2.0}}},
+			bson.D{{Key: "type", Value: "MultiPoint"}, {Key: "coordinates", Value: bson.A{bson.A{1.0, 2.0}}}},
+			bson.D{{Key: "type", Value: "MultiLineString"}, {Key: "coordinates", Value: bson.A{bson.A{bson.A{1.0, 2.0}, bson.A{3.0, 4.0}}}}},
+		}},
+	}, marshalDoc(t, GeometryCollection{Point{1, 2}, MultiPoint{{1, 2}}, MultiLineString{{{1, 2}, {3, 4}}}}))
+
+	_, err := bson.Marshal(bson.M{"v": Point{200, 0}})
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		geometry Geometry
+		err      string
+	}{
+		{"point", Point{180, -90}, ""},
+		{"longitude", Point{180.5, 0}, "geojson: coordinates: longitude 180.5 out of range [-180, 180]"},
+		{"latitude", MultiPoint{{0, 0}, {0, 91}}, "geojson: coordinates[1]: latitude 91 out of range [-90, 90]"},
+		{"line", LineString{{0, 0}}, "geojson: coordinates: requires at least 2 points"},
+		{"polygon", square, ""},
+		{"empty polygon", Polygon{}, "geojson: coordinates: requires an exterior ring"},
+		{"ring size", Polygon{{{0, 0}, {1, 1}, {0, 0}}}, "geojson: coordinates[0]: requires at least 4 points"},
+		{"ring closure", Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 1}}}, "geojson: coordinates[0]: linear ring must be closed"},
+		{"ring area", Polygon{{{0, 0}, {1, 1}, {2, 2}, {0, 0}}}, "geojson: coordinates[0]: linear ring must have non-zero area"},
+		{"clockwise", Polygon{{{0, 0}, {0, 1}, {1, 1}, {0, 0}}}, ""},
+		{"multi polygon", MultiPolygon{square, {{{0, 0}, {0, 1}, {1, 0}, {0, 0}}}}, ""},
+		{"multi polygon ring", MultiPolygon{square, {{{0, 0}, {0, 1}, {1, 1}}}}, "geojson: coordinates[1][0]: requires at least 4 points"},
+		{"multi line", MultiLineString{{{0, 0}, {1, 1}}, {{0, 0}, {0, -100}}}, "geojson: coordinates[1][1]: latitude -100 out of range [-90, 90]"},
+		{"collection", GeometryCollection{Point{0, 0}, LineString{{0, 0}}}, "geojson: geometries[1].coordinates: requires at least 2 points"},
+		{"nil in collection", GeometryCollection{nil}, "geojson: geometries[0]: geometry must not be nil"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var err = c.geometry.Validate()
+			if c.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, c.err)
+			}
+		})
+	}
+}
+
+func TestPolygonValidateWinding(t *testing.T) {
+	var square = Polygon{{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}}
+	for _, c := range []struct {
+		name    string
+		polygon Polygon
+		err     string
+	}{
+		{"counterclockwise", square, ""},
+		{"antimeridian", Polygon{{{170, 0}, {-170, 0}, {-170, 10}, {170, 10}, {170, 0}}}, ""},
+		{"exterior", Polygon{{{0, 0}, {0, 1}, {1, 1}, {0, 0}}}, "geojson: coordinates[0]: exterior ring must be counterclockwise"},
+		{"antimeridian exterior", Polygon{{{170, 0}, {170, 10}, {-170, 10}, {-170, 0}, {170, 0}}}, "geojson: coordinates[0]: exterior ring must be counterclockwise"},
+		{"hole", Polygon{square[0], {{2, 2}, {4, 2}, {4, 4}, {2, 2}}}, "geojson: coordinates[1]: interior ring must be clockwise"},
+		{"invalid", Polygon{{{0, 0}, {1, 0}, {1, 1}, {0, 1}}}, "geojson: coordinates[0]: linear ring must be closed"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var err = c.polygon.ValidateWinding()
+			if c.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, c.err)
+			}
+		})
+	}
+}
+
+func TestPolygonOriented(t *testing.T) {
+	var p = Polygon{
+		{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}},
+		{{2, 2}, {4, 2}, {4, 4}, {2, 4}, {2, 2}},
+	}
+	assert.Error(t, p.ValidateWinding())
+	var o = p.Oriented()
+	assert.NoError(t, o.ValidateWinding())
+	assert.Equal(t, Point{10, 0}, o[0][1])
+	assert.Equal(t, Point{2, 4}, o[1][1])
+	assert.Equal(t, Point{0, 10}, p[0][1], "should not modify original polygon")
+	assert.Equal(t, square, square.Oriented())
+}
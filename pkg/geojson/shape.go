@@ -0,0 +1,110 @@
+package geojson
+
+import "math"
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func toDegrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+// normalizeLongitude wraps longitude into [-180, 180].
+func normalizeLongitude(v float64) float64 {
+	if v >= -180 && v <= 180 {
+		return v
+	}
+	return math.Mod(math.Mod(v+180, 360)+360, 360) - 180
+}
+
+// Destination is the point at distance from p along bearing,
+// bearing is degrees clockwise from north.
+func (p Point) Destination(distance Distance, bearing float64) Point {
+	var lat, lng = toRadians(p.Latitude()), toRadians(p.Longitude())
+	var angle, theta = distance.Radians(), toRadians(bearing)
+	var lat2 = math.Asin(math.Sin(lat)*math.Cos(angle) + math.Cos(lat)*math.Sin(angle)*math.Cos(theta))
+	var lng2 = lng + math.Atan2(
+		math.Sin(theta)*math.Sin(angle)*math.Cos(lat),
+		math.Cos(angle)-math.Sin(lat)*math.Sin(lat2),
+	)
+	return Point{normalizeLongitude(toDegrees(lng2)), toDegrees(lat2)}
+}
+
+// Circle returns a polygon with segments edges that approximates
+// a circle of radius around center, use it with $geoWithin or $geoIntersects.
+// segments less than 3 is treated as 3.
+// Use query.CenterSpherePoint for an exact circle with $geoWithin.
+// Edges are geodesics, so the circle may cross the antimeridian
+// or contain a pole.
+func Circle(center Point, radius Distance, segments int) Polygon {
+	if segments < 3 {
+		segments = 3
+	}
+	var ring = make([]Point, segments+1)
+	for index := 0; index < segments; index++ {
+		// counterclockwise: north, west, south, east.
+		ring[index] = center.Destination(radius, -360*float64(index)/float64(segments))
+	}
+	ring[segments] = ring[0]
+	return Polygon{ring}
+}
+
+// Bounds returns south-west and north-east corners of the smallest box
+// that contains circle of radius around center, e.g. for query.Box.
+// Latitude is clamped to [-90, 90], longitude covers [-180, 180]
+// when circle contains a pole.
+// Longitude of southWest is greater than northEast
+// when the box crosses the antimeridian.
+func Bounds(center Point, radius Distance) (southWest, northEast Point) {
+	var angle = radius.Radians()
+	var lat = toRadians(center.Latitude())
+	var minLat, maxLat = lat - angle, lat + angle
+	var minLng, maxLng = -180.0, 180.0
+	if minLat > -math.Pi/2 && maxLat < math.Pi/2 {
+		var delta = toDegrees(math.Asin(math.Sin(angle) / math.Cos(lat)))
+		minLng = normalizeLongitude(center.Longitude() - delta)
+		maxLng = normalizeLongitude(center.Longitude() + delta)
+	}
+	return Point{minLng, toDegrees(math.Max(minLat, -math.Pi/2))},
+		Point{maxLng, toDegrees(math.Min(maxLat, math.Pi/2))}
+}
+
+// BoundingBox returns Bounds as a polygon.
+// Polygon edges are geodesics on a 2dsphere index,
+// so the box is approximate near poles.
+// The box may cross the antimeridian,
+// it is a polar cap bounded by the other latitude when circle contains a pole.
+func BoundingBox(center Point, radius Distance) Polygon {
+	var sw, ne = Bounds(center, radius)
+	switch {
+	case ne.Latitude() == 90:
+		return polarCap(center.Longitude(), sw.Latitude(), 1)
+	case sw.Latitude() == -90:
+		return polarCap(center.Longitude(), ne.Latitude(), -1)
+	}
+	return Polygon{{
+		sw,
+		{ne[0], sw[1]},
+		ne,
+		{sw[0], ne[1]},
+		sw,
+	}}
+}
+
+// polarCap returns a counterclockwise ring along latitude
+// that encloses north pole when direction is 1, or south pole when -1.
+// It goes eastward around north pole and westward around south pole,
+// starting from longitude.
+func polarCap(longitude, latitude, direction float64) Polygon {
+	const segments = 8
+	var ring = make([]Point, segments+1)
+	for index := 0; index < segments; index++ {
+		ring[index] = Point{
+			normalizeLongitude(longitude + direction*360*float64(index)/segments),
+			latitude,
+		}
+	}
+	ring[segments] = ring[0]
+	return Polygon{ring}
+}
@@ -0,0 +1,85 @@
+package geojson
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// haversine distance between a and b.
+func haversine(a, b Point) Distance {
+	var lat1, lat2 = toRadians(a.Latitude()), toRadians(b.Latitude())
+	var dLat, dLng = lat2 - lat1, toRadians(b.Longitude() - a.Longitude())
+	var h = math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLng/2), 2)
+	return DistanceFromRadians(2 * math.Asin(math.Sqrt(h)))
+}
+
+func TestDestination(t *testing.T) {
+	var p = Point{-73.99, 40.73}
+	var north = p.Destination(EarthRadius*math.Pi/180, 0)
+	assert.InDelta(t, -73.99, north.Longitude(), 1e-9)
+	assert.InDelta(t, 41.73, north.Latitude(), 1e-9)
+	for _, bearing := range []float64{30, 90, 200, 315} {
+		assert.InDelta(t, 5000, haversine(p, p.Destination(5*Kilometer, bearing)).Meters(), 1e-6)
+	}
+	assert.InDelta(t, -179.0, Point{179, 0}.Destination(EarthRadius*math.Pi/90, 90).Longitude(), 1e-9)
+}
+
+func TestCircle(t *testing.T) {
+	var center = Point{-73.99, 40.73}
+	var c = Circle(center, 2*Kilometer, 32)
+	require.NoError(t, c.Validate())
+	require.Len(t, c, 1)
+	require.Len(t, c[0], 33)
+	for _, i := range c[0] {
+		assert.InDelta(t, 2000, haversine(center, i).Meters(), 1e-6)
+	}
+	assert.InDelta(t, center.Longitude(), c[0][0].Longitude(), 1e-9)
+	assert.Greater(t, c[0][0].Latitude(), center.Latitude())
+	assert.Len(t, Circle(center, Kilometer, 0)[0], 4)
+	require.NoError(t, Circle(Point{0, 89.99}, 5*Kilometer, 16).ValidateWinding(), "contains pole")
+
+	// crosses antimeridian
+	c = Circle(Point{179.99, 0}, 5*Kilometer, 16)
+	require.NoError(t, c.ValidateWinding())
+	assert.InDelta(t, 179.945, c[0][4].Longitude(), 1e-3, "west")
+	assert.InDelta(t, -179.965, c[0][12].Longitude(), 1e-3, "east")
+}
+
+func TestBounds(t *testing.T) {
+	var center = Point{-73.99, 40.73}
+	var sw, ne = Bounds(center, 10*Kilometer)
+	var b = BoundingBox(center, 10*Kilometer)
+	require.NoError(t, b.Validate())
+	assert.Equal(t, Polygon{{sw, {ne[0], sw[1]}, ne, {sw[0], ne[1]}, sw}}, b)
+	assert.InDelta(t, (10 * Kilometer).Degrees(), ne.Latitude()-center.Latitude(), 1e-9)
+	assert.InDelta(t, (10 * Kilometer).Degrees(), center.Latitude()-sw.Latitude(), 1e-9)
+	// circle points are inside box.
+	for _, i := range Circle(center, 10*Kilometer, 64)[0] {
+		assert.True(t, i[0] >= sw[0]-1e-9 && i[0] <= ne[0]+1e-9, "longitude %v", i[0])
+		assert.True(t, i[1] >= sw[1]-1e-9 && i[1] <= ne[1]+1e-9, "latitude %v", i[1])
+	}
+
+	sw, ne = Bounds(Point{10, 89.99}, 10*Kilometer)
+	assert.Equal(t, Point{-180, sw.Latitude()}, sw)
+	assert.Equal(t, Point{180, 90}, ne)
+	b = BoundingBox(Point{10, 89.99}, 10*Kilometer)
+	require.NoError(t, b.ValidateWinding())
+	require.Len(t, b[0], 9)
+	assert.Equal(t, Point{10, sw.Latitude()}, b[0][0])
+	assert.Equal(t, Point{55, sw.Latitude()}, b[0][1])
+	assert.Equal(t, Point{-170, sw.Latitude()}, b[0][4])
+
+	sw, ne = Bounds(Point{0, -89.99}, 10*Kilometer)
+	b = BoundingBox(Point{0, -89.99}, 10*Kilometer)
+	require.NoError(t, b.ValidateWinding())
+	assert.Equal(t, Point{-45, ne.Latitude()}, b[0][1])
+
+	sw, ne = Bounds(Point{179.99, 0}, 10*Kilometer)
+	assert.Greater(t, sw.Longitude(), ne.Longitude())
+	b = BoundingBox(Point{179.99, 0}, 10*Kilometer)
+	require.NoError(t, b.ValidateWinding())
+	assert.Equal(t, Polygon{{sw, {ne[0], sw[1]}, ne, {sw[0], ne[1]}, sw}}, b)
+}
@@ -0,0 +1,192 @@
+package bsonutil
+
+import (
+	"bytes"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CanonicalOrder returns rank of value type in bson comparison order.
+// Values of same rank are comparable with each other.
+// https://docs.mongodb.com/manual/reference/bson-type-comparison-order/
+func CanonicalOrder(v interface{}) int {
+	switch Type(v) {
+	case bsontype.MinKey:
+		return 1
+	case bsontype.Null, bsontype.Undefined:
+		return 2
+	case bsontype.Int32, bsontype.Int64, bsontype.Double, bsontype.Decimal128:
+		return 3
+	case bsontype.String, bsontype.Symbol:
+		return 4
+	case bsontype.EmbeddedDocument:
+		return 5
+	case bsontype.Array:
+		return 6
+	case bsontype.Binary:
+		return 7
+	case bsontype.ObjectID:
+		return 8
+	case bsontype.Boolean:
+		return 9
+	case bsontype.DateTime:
+		return 10
+	case bsontype.Timestamp:
+		return 11
+	case bsontype.Regex:
+		return 12
+	case bsontype.DBPointer:
+		return 13
+	case bsontype.JavaScript:
+		return 14
+	case bsontype.CodeWithScope:
+		return 15
+	case bsontype.MaxKey:
+		return 127
+	}
+	// missing sort before everything
+	return 0
+}
+
+// Compare two normalized values using bson comparison order.
+// Returns -1, 0 or 1.
+func Compare(a, b interface{}) int {
+	var oa, ob = CanonicalOrder(a), CanonicalOrder(b)
+	if oa != ob {
+		return compareInt(int64(oa), int64(ob))
+	}
+	switch a := a.(type) {
+	case int32, int64, float64, primitive.Decimal128:
+		return compareNumber(a, b)
+	case string:
+		return strings.Compare(a, stringValue(b))
+	case primitive.Symbol:
+		return strings.Compare(string(a), stringValue(b))
+	case primitive.D:
+		return compareDoc(a, b.(primitive.D))
+	case primitive.A:
+		return compareArray(a, b.(primitive.A))
+	case primitive.Binary:
+		var b = b.(primitive.Binary)
+		if len(a.Data) != len(b.Data) {
+			return compareInt(int64(len(a.Data)), int64(len(b.Data)))
+		}
+		if a.Subtype != b.Subtype {
+			return compareInt(int64(a.Subtype), int64(b.Subtype))
+		}
+		return bytes.Compare(a.Data, b.Data)
+	case primitive.ObjectID:
+		var b = b.(primitive.ObjectID)
+		return bytes.Compare(a[:], b[:])
+	case bool:
+		var b = b.(bool)
+		if a == b {
+			return 0
+		}
+		if b {
+			return -1
+		}
+		return 1
+	case primitive.DateTime:
+		return compareInt(int64(a), int64(b.(primitive.DateTime)))
+	case primitive.Timestamp:
+		return primitive.CompareTimestamp(a, b.(primitive.Timestamp))
+	case primitive.Regex:
+		var b = b.(primitive.Regex)
+		if c := strings.Compare(a.Pattern, b.Pattern); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Options, b.Options)
+	case primitive.DBPointer:
+		var b = b.(primitive.DBPointer)
+		if c := strings.Compare(a.DB, b.DB); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.Pointer[:], b.Pointer[:])
+	case primitive.JavaScript:
+		return strings.Compare(string(a), string(b.(primitive.JavaScript)))
+	case primitive.CodeWithScope:
+		var b = b.(primitive.CodeWithScope)
+		return strings.Compare(string(a.Code), string(b.Code))
+	}
+	return 0
+}
+
+// Equal reports whether two normalized values are equivalent.
+// Numbers of different type are equal when having same value.
+func Equal(a, b interface{}) bool {
+	return Compare(a, b) == 0
+}
+
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case primitive.Symbol:
+		return string(v)
+	}
+	return ""
+}
+
+func compareInt(a, b int64) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// NaN is less than any other number and equal to NaN.
+func compareNumber(a, b interface{}) int {
+	if ia, ok := a.(int32); ok {
+		a = int64(ia)
+	}
+	if ib, ok := b.(int32); ok {
+		b = int64(ib)
+	}
+	if ia, ok := a.(int64); ok {
+		if ib, ok := b.(int64); ok {
+			return compareInt(ia, ib)
+		}
+	}
+	fa, okA := BigFloat(a)
+	fb, okB := BigFloat(b)
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	return fa.Cmp(fb)
+}
+
+func compareDoc(a, b primitive.D) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		var ea, eb = a[i], b[i]
+		if c := compareInt(int64(CanonicalOrder(ea.Value)), int64(CanonicalOrder(eb.Value))); c != 0 {
+			return c
+		}
+		if c := strings.Compare(ea.Key, eb.Key); c != 0 {
+			return c
+		}
+		if c := Compare(ea.Value, eb.Value); c != 0 {
+			return c
+		}
+	}
+	return compareInt(int64(len(a)), int64(len(b)))
+}
+
+func compareArray(a, b primitive.A) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(int64(len(a)), int64(len(b)))
+}
@@ -0,0 +1,46 @@
+package bsonutil
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCompare(t *testing.T) {
+	var d128, _ = primitive.ParseDecimal128("1.5")
+	for _, c := range []struct {
+		a, b interface{}
+		want int
+	}{
+		{int32(1), int64(1), 0},
+		{int32(1), 1.0, 0},
+		{int64(2), 1.5, 1},
+		{d128, 1.5, 0},
+		{math.NaN(), int32(-100), -1},
+		{math.NaN(), math.NaN(), 0},
+		{nil, int32(0), -1},
+		{int32(100), "a", -1},
+		{"a", primitive.D{}, -1},
+		{primitive.D{}, primitive.A{}, -1},
+		{true, false, 1},
+		{primitive.MinKey{}, nil, -1},
+		{primitive.MaxKey{}, primitive.Regex{}, 1},
+		{primitive.A{int32(1), int32(2)}, primitive.A{int32(1)}, 1},
+		{
+			primitive.D{{Key: "a", Value: int32(1)}},
+			primitive.D{{Key: "a", Value: "1"}},
+			-1,
+		},
+		{primitive.DateTime(1), primitive.DateTime(2), -1},
+	} {
+		assert.Equal(t, c.want, Compare(c.a, c.b), "%v <=> %v", c.a, c.b)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	v, err := Normalize(map[string]interface{}{"a": []int{1}})
+	assert.NoError(t, err)
+	assert.Equal(t, primitive.D{{Key: "a", Value: primitive.A{int32(1)}}}, v)
+}
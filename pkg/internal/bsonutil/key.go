@@ -0,0 +1,55 @@
+package bsonutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Key returns a string that is same for equal values,
+// so values can be used as map key.
+func Key(v interface{}) string {
+	var b strings.Builder
+	writeKey(&b, v)
+	return b.String()
+}
+
+func writeKey(b *strings.Builder, v interface{}) {
+	b.WriteString(strconv.Itoa(CanonicalOrder(v)))
+	b.WriteByte(':')
+	switch v := v.(type) {
+	case nil, primitive.Undefined, Missing:
+	case int32, int64, float64, primitive.Decimal128:
+		if f, ok := BigFloat(v); ok && f.Sign() == 0 {
+			b.WriteString("0")
+		} else if ok {
+			b.WriteString(f.Text('g', -1))
+		} else {
+			b.WriteString("NaN")
+		}
+	case string:
+		b.WriteString(strconv.Quote(v))
+	case primitive.Symbol:
+		b.WriteString(strconv.Quote(string(v)))
+	case primitive.D:
+		b.WriteByte('{')
+		for _, e := range v {
+			b.WriteString(strconv.Quote(e.Key))
+			b.WriteByte('=')
+			writeKey(b, e.Value)
+			b.WriteByte(',')
+		}
+		b.WriteByte('}')
+	case primitive.A:
+		b.WriteByte('[')
+		for _, i := range v {
+			writeKey(b, i)
+			b.WriteByte(',')
+		}
+		b.WriteByte(']')
+	default:
+		fmt.Fprintf(b, "%#v", v)
+	}
+}
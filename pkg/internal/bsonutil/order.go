@@ -0,0 +1,95 @@
+package bsonutil
+
+import (
+	"reflect"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Ordered converts maps in v to documents with sorted keys,
+// so it marshals to same bytes every time.
+// Key order of primitive.D and structs is kept, unless sortAll is set.
+// Values implement bson.Marshaler or bson.ValueMarshaler are kept as is.
+func Ordered(v interface{}, sortAll bool) interface{} {
+	return order(reflect.ValueOf(v), sortAll)
+}
+
+var (
+	marshalerType      = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+	valueMarshalerType = reflect.TypeOf((*bson.ValueMarshaler)(nil)).Elem()
+	dType              = reflect.TypeOf(primitive.D{})
+)
+
+func order(v reflect.Value, sortAll bool) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	var isRef = v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface
+	if isRef && v.IsNil() {
+		return nil
+	}
+	if v.Type().Implements(marshalerType) || v.Type().Implements(valueMarshalerType) {
+		return v.Interface()
+	}
+	if isRef {
+		return order(v.Elem(), sortAll)
+	}
+	if v.Type() == dType {
+		var d = v.Interface().(primitive.D)
+		var ret = make(primitive.D, len(d))
+		for index, e := range d {
+			ret[index] = primitive.E{Key: e.Key, Value: order(reflect.ValueOf(e.Value), sortAll)}
+		}
+		if sortAll {
+			sortDoc(ret)
+		}
+		return ret
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+		var ret = make(primitive.D, 0, v.Len())
+		var iter = v.MapRange()
+		for iter.Next() {
+			ret = append(ret, primitive.E{
+				Key:   iter.Key().String(),
+				Value: order(iter.Value(), sortAll),
+			})
+		}
+		sortDoc(ret)
+		return ret
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// binary data and object id
+			return v.Interface()
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		var ret = make(primitive.A, v.Len())
+		for index := range ret {
+			ret[index] = order(v.Index(index), sortAll)
+		}
+		return ret
+	case reflect.Struct:
+		n, err := Normalize(v.Interface())
+		if err != nil {
+			return v.Interface()
+		}
+		if d, ok := n.(primitive.D); ok {
+			return order(reflect.ValueOf(d), sortAll)
+		}
+		return n
+	}
+	return v.Interface()
+}
+
+func sortDoc(d primitive.D) {
+	sort.SliceStable(d, func(i, j int) bool {
+		return d[i].Key < d[j].Key
+	})
+}
@@ -0,0 +1,26 @@
+package bsonutil
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Regexp compiles a mongodb regular expression with options,
+// supported options are i, m, s and u.
+func Regexp(pattern, options string) (*regexp.Regexp, error) {
+	var flags string
+	for _, i := range options {
+		switch i {
+		case 'i', 'm', 's':
+			flags += string(i)
+		case 'u':
+		default:
+			return nil, fmt.Errorf("unsupported regex option: %c", i)
+		}
+	}
+	var expr = pattern
+	if flags != "" {
+		expr = "(?" + flags + ")" + pattern
+	}
+	return regexp.Compile(expr)
+}
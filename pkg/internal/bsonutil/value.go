@@ -0,0 +1,293 @@
+// Package bsonutil contains bson value helpers shared by
+// the in-memory evaluators of query and aggregation package.
+package bsonutil
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Missing marks a field that does not exist,
+// it is distinct from null.
+type Missing struct{}
+
+// Normalize converts v to canonical bson value tree:
+// documents become primitive.D, arrays become primitive.A,
+// and other values become their primitive go type
+// (int32, int64, float64, string, primitive.DateTime, ...).
+func Normalize(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case Missing:
+		return v, nil
+	}
+	b, err := bson.Marshal(bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	err = bson.Unmarshal(b, &d)
+	if err != nil {
+		return nil, err
+	}
+	return d[0].Value, nil
+}
+
+// Doc normalize v and require it to be a document.
+func Doc(v interface{}) (primitive.D, error) {
+	n, err := Normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := n.(primitive.D)
+	if !ok {
+		return nil, fmt.Errorf("bsonutil: expected document, got %T", v)
+	}
+	return d, nil
+}
+
+// Get returns value of top level field key.
+func Get(d primitive.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Type returns bson type of a normalized value.
+func Type(v interface{}) bsontype.Type {
+	switch v.(type) {
+	case nil:
+		return bsontype.Null
+	case float64:
+		return bsontype.Double
+	case string:
+		return bsontype.String
+	case primitive.D:
+		return bsontype.EmbeddedDocument
+	case primitive.A:
+		return bsontype.Array
+	case primitive.Binary:
+		return bsontype.Binary
+	case primitive.Undefined:
+		return bsontype.Undefined
+	case primitive.ObjectID:
+		return bsontype.ObjectID
+	case bool:
+		return bsontype.Boolean
+	case primitive.DateTime:
+		return bsontype.DateTime
+	case primitive.Regex:
+		return bsontype.Regex
+	case primitive.DBPointer:
+		return bsontype.DBPointer
+	case primitive.JavaScript:
+		return bsontype.JavaScript
+	case primitive.Symbol:
+		return bsontype.Symbol
+	case primitive.CodeWithScope:
+		return bsontype.CodeWithScope
+	case int32:
+		return bsontype.Int32
+	case primitive.Timestamp:
+		return bsontype.Timestamp
+	case int64:
+		return bsontype.Int64
+	case primitive.Decimal128:
+		return bsontype.Decimal128
+	case primitive.MinKey:
+		return bsontype.MinKey
+	case primitive.MaxKey:
+		return bsontype.MaxKey
+	}
+	return 0
+}
+
+var typeAliases = map[bsontype.Type]string{
+	bsontype.Double:           "double",
+	bsontype.String:           "string",
+	bsontype.EmbeddedDocument: "object",
+	bsontype.Array:            "array",
+	bsontype.Binary:           "binData",
+	bsontype.Undefined:        "undefined",
+	bsontype.ObjectID:         "objectId",
+	bsontype.Boolean:          "bool",
+	bsontype.DateTime:         "date",
+	bsontype.Null:             "null",
+	bsontype.Regex:            "regex",
+	bsontype.DBPointer:        "dbPointer",
+	bsontype.JavaScript:       "javascript",
+	bsontype.Symbol:           "symbol",
+	bsontype.CodeWithScope:    "javascriptWithScope",
+	bsontype.Int32:            "int",
+	bsontype.Timestamp:        "timestamp",
+	bsontype.Int64:            "long",
+	bsontype.Decimal128:       "decimal",
+	bsontype.MinKey:           "minKey",
+	bsontype.MaxKey:           "maxKey",
+}
+
+// TypeAlias returns mongodb string alias of bson type,
+// e.g. "int" for bsontype.Int32.
+func TypeAlias(t bsontype.Type) string {
+	return typeAliases[t]
+}
+
+// TypeFromAlias is the reverse of TypeAlias.
+func TypeFromAlias(alias string) (bsontype.Type, bool) {
+	for k, v := range typeAliases {
+		if v == alias {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// TypeNumber returns the number used by $type for a bson type.
+// MinKey and MaxKey are -1 and 127.
+func TypeNumber(t bsontype.Type) int {
+	switch t {
+	case bsontype.MinKey:
+		return -1
+	case bsontype.MaxKey:
+		return 127
+	}
+	return int(t)
+}
+
+// IsNumber reports whether v is int32, int64, float64 or Decimal128.
+func IsNumber(v interface{}) bool {
+	switch v.(type) {
+	case int32, int64, float64, primitive.Decimal128:
+		return true
+	}
+	return false
+}
+
+// IsNullish reports whether v is null, undefined or missing.
+func IsNullish(v interface{}) bool {
+	switch v.(type) {
+	case nil, primitive.Undefined, Missing:
+		return true
+	}
+	return false
+}
+
+// Float64 converts a number to float64.
+func Float64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case primitive.Decimal128:
+		f, ok := decimalFloat(v)
+		if !ok {
+			return math.NaN(), true
+		}
+		r, _ := f.Float64()
+		return r, true
+	}
+	return 0, false
+}
+
+// Int64 converts a number to int64, fractional part is truncated.
+func Int64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return 0, false
+		}
+		return int64(v), true
+	case primitive.Decimal128:
+		f, ok := Float64(v)
+		if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, false
+		}
+		return int64(f), true
+	}
+	return 0, false
+}
+
+func decimalFloat(d primitive.Decimal128) (*big.Float, bool) {
+	if d.IsNaN() {
+		return nil, false
+	}
+	switch d.IsInf() {
+	case 1:
+		return new(big.Float).SetInf(false), true
+	case -1:
+		return new(big.Float).SetInf(true), true
+	}
+	f, _, err := big.ParseFloat(d.String(), 10, 128, big.ToNearestEven)
+	if err != nil {
+		return nil, false
+	}
+	return f, true
+}
+
+// BigFloat converts a number to *big.Float, returns false for NaN.
+func BigFloat(v interface{}) (*big.Float, bool) {
+	switch v := v.(type) {
+	case int32:
+		return new(big.Float).SetInt64(int64(v)), true
+	case int64:
+		return new(big.Float).SetInt64(v), true
+	case float64:
+		if math.IsNaN(v) {
+			return nil, false
+		}
+		return new(big.Float).SetFloat64(v), true
+	case primitive.Decimal128:
+		return decimalFloat(v)
+	}
+	return nil, false
+}
+
+// Truthy reports whether v is considered true.
+// false, null, undefined, missing and numeric zero are false,
+// everything else (include empty string and empty array) is true.
+func Truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case nil, primitive.Undefined, Missing:
+		return false
+	}
+	if IsNumber(v) {
+		f, ok := Float64(v)
+		return !ok || f != 0
+	}
+	return true
+}
+
+// Decimal converts f to Decimal128, value is rounded to 34 significant digits.
+func Decimal(f *big.Float) primitive.Decimal128 {
+	if f.IsInf() {
+		if f.Sign() < 0 {
+			d, _ := primitive.ParseDecimal128("-Infinity")
+			return d
+		}
+		d, _ := primitive.ParseDecimal128("Infinity")
+		return d
+	}
+	d, err := primitive.ParseDecimal128(f.Text('g', 34))
+	if err != nil {
+		d, _ = primitive.ParseDecimal128("NaN")
+	}
+	return d
+}
@@ -0,0 +1,9 @@
+package jsonschema
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// An A alias primitive.A
+type A = primitive.A
+
+// M alias primitive.M
+type M = primitive.M
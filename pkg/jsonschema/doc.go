@@ -0,0 +1,11 @@
+// Package jsonschema contains helper functions to construct
+// [$jsonSchema](https://docs.mongodb.com/manual/reference/operator/query/jsonSchema/)
+// documents for collection validators and query.JSONSchema:
+//
+//	query.JSONSchema(jsonschema.Object().
+//		SetRequired("name").
+//		SetProperty("name", jsonschema.BSONType("string").SetMinLength(1)).
+//		SetProperty("age", jsonschema.BSONType("int").SetMinimum(0)))
+//
+// FromStruct generates schema from a Go struct.
+package jsonschema
@@ -0,0 +1,395 @@
+package jsonschema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	marshalerType      = reflect.TypeOf((*bson.Marshaler)(nil)).Elem()
+	valueMarshalerType = reflect.TypeOf((*bson.ValueMarshaler)(nil)).Elem()
+)
+
+// knownTypes maps types handled by bson codecs to $type aliases.
+var knownTypes = map[reflect.Type]string{
+	reflect.TypeOf(time.Time{}):              "date",
+	reflect.TypeOf(primitive.DateTime(0)):    "date",
+	reflect.TypeOf(primitive.ObjectID{}):     "objectId",
+	reflect.TypeOf(primitive.Decimal128{}):   "decimal",
+	reflect.TypeOf(primitive.Binary{}):       "binData",
+	reflect.TypeOf(primitive.Regex{}):        "regex",
+	reflect.TypeOf(primitive.Timestamp{}):    "timestamp",
+	reflect.TypeOf(primitive.JavaScript("")): "javascript",
+	reflect.TypeOf(primitive.Symbol("")):     "symbol",
+	reflect.TypeOf(primitive.D{}):            "object",
+	reflect.TypeOf(primitive.M{}):            "object",
+}
+
+// FromStruct generates schema from struct v,
+// v is a struct, a pointer to struct or a reflect.Type of them.
+//
+// Fields are named and skipped as bson encoder does, with `bson` tags,
+// fields are required unless tagged omitempty.
+// Pointers, slices, maps and interfaces also allow null,
+// since nil is encoded as null.
+//
+// Optional `validate` tags in go-playground/validator style are converted
+// to schema keywords: required (and not null), omitempty, min, max, len,
+// gt, gte, lt, lte, oneof, unique and dive.
+// Other validate tags are ignored.
+func FromStruct(v interface{}) (Schema, error) {
+	var t, ok = v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("jsonschema: expected struct, got %v", t)
+	}
+	var g = &generator{visiting: map[reflect.Type]bool{}}
+	return g.structSchema(t)
+}
+
+type generator struct {
+	visiting map[reflect.Type]bool
+}
+
+func (g *generator) structSchema(t reflect.Type) (Schema, error) {
+	var ret = Object()
+	if g.visiting[t] {
+		// recursive type
+		return ret, nil
+	}
+	g.visiting[t] = true
+	defer delete(g.visiting, t)
+	if err := g.fields(ret, t); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (g *generator) fields(s Schema, t reflect.Type) error {
+	for index := 0; index < t.NumField(); index++ {
+		var f = t.Field(index)
+		if f.PkgPath != "" {
+			continue
+		}
+		var tag = f.Tag.Get("bson")
+		if tag == "-" {
+			continue
+		}
+		var parts = strings.Split(tag, ",")
+		var name = parts[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		var omitempty, minsize, inline bool
+		for _, i := range parts[1:] {
+			switch i {
+			case "omitempty":
+				omitempty = true
+			case "minsize":
+				minsize = true
+			case "inline":
+				inline = true
+			}
+		}
+
+		if inline {
+			var ft = f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			switch ft.Kind() {
+			case reflect.Struct:
+				if err := g.fields(s, ft); err != nil {
+					return err
+				}
+				continue
+			case reflect.Map:
+				items, err := g.typeSchema(ft.Elem(), false)
+				if err != nil {
+					return fmt.Errorf("jsonschema: %s.%s: %w", t, f.Name, err)
+				}
+				if len(items) > 0 {
+					s.SetAdditionalProperties(items)
+				}
+				continue
+			}
+		}
+
+		fs, err := g.typeSchema(f.Type, minsize)
+		if err == nil {
+			var required bool
+			required, err = applyValidate(fs, f.Type, strings.Split(f.Tag.Get("validate"), ","))
+			omitempty = omitempty && !required
+		}
+		if err != nil {
+			return fmt.Errorf("jsonschema: %s.%s: %w", t, f.Name, err)
+		}
+		s.SetProperty(name, fs)
+		if !omitempty && !hasTag(f.Tag.Get("validate"), "omitempty") {
+			s.SetRequired(name)
+		}
+	}
+	return nil
+}
+
+func hasTag(tags, name string) bool {
+	for _, i := range strings.Split(tags, ",") {
+		if i == "dive" {
+			return false
+		}
+		if i == name {
+			return true
+		}
+	}
+	return false
+}
+
+// typeSchema returns schema of values of t, as encoded by bson default registry.
+func (g *generator) typeSchema(t reflect.Type, minsize bool) (Schema, error) {
+	if alias, ok := knownTypes[t]; ok {
+		return BSONType(alias), nil
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return Object(), nil
+	}
+	if t.Implements(valueMarshalerType) || reflect.PtrTo(t).Implements(valueMarshalerType) {
+		return New(), nil
+	}
+	var intOrLong = func(minsize bool) Schema {
+		if minsize {
+			return BSONType("int", "long")
+		}
+		return BSONType("long")
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return BSONType("bool"), nil
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return BSONType("int"), nil
+	case reflect.Int:
+		return intOrLong(true), nil
+	case reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return intOrLong(minsize), nil
+	case reflect.Float32, reflect.Float64:
+		return BSONType("double"), nil
+	case reflect.String:
+		return BSONType("string"), nil
+	case reflect.Interface:
+		return New(), nil
+	case reflect.Ptr:
+		s, err := g.typeSchema(t.Elem(), minsize)
+		return nullable(s), err
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nullable(BSONType("binData")), nil
+		}
+		s, err := g.arraySchema(t)
+		return nullable(s), err
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return BSONType("binData"), nil
+		}
+		return g.arraySchema(t)
+	case reflect.Map:
+		var ret = Object()
+		items, err := g.typeSchema(t.Elem(), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) > 0 {
+			ret.SetAdditionalProperties(items)
+		}
+		return nullable(ret), nil
+	case reflect.Struct:
+		return g.structSchema(t)
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+func (g *generator) arraySchema(t reflect.Type) (Schema, error) {
+	items, err := g.typeSchema(t.Elem(), false)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return Array(nil), nil
+	}
+	return Array(items), nil
+}
+
+// nullable allows null in bsonType of s.
+func nullable(s Schema) Schema {
+	switch v := s["bsonType"].(type) {
+	case string:
+		s["bsonType"] = A{v, "null"}
+	case A:
+		s["bsonType"] = append(v, "null")
+	}
+	return s
+}
+
+// notNull removes null from bsonType of s.
+func notNull(s Schema) {
+	var v, ok = s["bsonType"].(A)
+	if !ok {
+		return
+	}
+	var types = make(A, 0, len(v))
+	for _, i := range v {
+		if i != "null" {
+			types = append(types, i)
+		}
+	}
+	if len(types) == 1 {
+		s["bsonType"] = types[0]
+	} else {
+		s["bsonType"] = types
+	}
+}
+
+// applyValidate converts validate tags of value with type t to keywords of s,
+// returns whether value is required.
+func applyValidate(s Schema, t reflect.Type, tags []string) (required bool, err error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var minKey, maxKey string
+	var _, isKnown = knownTypes[t]
+	switch {
+	case isKnown:
+	case t.Kind() == reflect.String:
+		minKey, maxKey = "minLength", "maxLength"
+	case (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8:
+		minKey, maxKey = "minItems", "maxItems"
+	case t.Kind() == reflect.Map:
+		minKey, maxKey = "minProperties", "maxProperties"
+	}
+	var isNumber = !isKnown && isNumberKind(t.Kind())
+	var isScalar = isNumber || minKey == "minLength"
+	for index, tag := range tags {
+		var name, param = tag, ""
+		if i := strings.Index(tag, "="); i >= 0 {
+			name, param = tag[:i], tag[i+1:]
+		}
+		if strings.Contains(name, "|") {
+			continue
+		}
+		switch name {
+		case "required":
+			required = true
+			notNull(s)
+		case "dive":
+			var items, _ = s["items"].(Schema)
+			if t.Kind() == reflect.Map {
+				items, _ = s["additionalProperties"].(Schema)
+			}
+			if items == nil {
+				return required, fmt.Errorf("dive requires items schema")
+			}
+			_, err = applyValidate(items, t.Elem(), tags[index+1:])
+			return required, err
+		case "unique":
+			if minKey == "minItems" {
+				s.SetUniqueItems(true)
+			}
+		case "oneof":
+			if !isScalar {
+				continue
+			}
+			var values = A{}
+			for _, i := range strings.Fields(param) {
+				v, err := parseParam(t, i)
+				if err != nil {
+					return required, err
+				}
+				values = append(values, v)
+			}
+			s.SetEnum(values...)
+		case "min", "max", "len", "gt", "gte", "lt", "lte":
+			if isNumber {
+				v, err := parseParam(t, param)
+				if err != nil {
+					return required, err
+				}
+				applyNumberBound(s, name, v)
+			} else if minKey != "" {
+				n, err := strconv.Atoi(param)
+				if err != nil {
+					return required, fmt.Errorf("invalid %s parameter: %s", name, param)
+				}
+				applyLengthBound(s, name, n, minKey, maxKey)
+			}
+		}
+	}
+	return required, nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// parseParam parses tag parameter as value of t.
+func parseParam(t reflect.Type, param string) (interface{}, error) {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseInt(param, 10, 64); err == nil {
+			return n, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, err := strconv.ParseFloat(param, 64); err == nil {
+			return n, nil
+		}
+	default:
+		return param, nil
+	}
+	return nil, fmt.Errorf("invalid number parameter: %s", param)
+}
+
+func applyNumberBound(s Schema, name string, v interface{}) {
+	switch name {
+	case "min", "gte":
+		s.SetMinimum(v)
+	case "max", "lte":
+		s.SetMaximum(v)
+	case "len":
+		s.SetMinimum(v).SetMaximum(v)
+	case "gt":
+		s.SetMinimum(v).SetExclusiveMinimum(true)
+	case "lt":
+		s.SetMaximum(v).SetExclusiveMaximum(true)
+	}
+}
+
+func applyLengthBound(s Schema, name string, n int, minKey, maxKey string) {
+	switch name {
+	case "min", "gte":
+		s[minKey] = n
+	case "max", "lte":
+		s[maxKey] = n
+	case "len":
+		s[minKey] = n
+		s[maxKey] = n
+	case "gt":
+		s[minKey] = n + 1
+	case "lt":
+		s[maxKey] = n - 1
+	}
+}
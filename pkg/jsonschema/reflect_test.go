@@ -0,0 +1,94 @@
+package jsonschema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/NateScarlet/mongo-operators/pkg/geojson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testAddress struct {
+	City string `bson:"city" validate:"required,min=1"`
+	Zip  string `bson:"zip,omitempty" validate:"len=5"`
+}
+
+type Timestamps struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	CreatedAt time.Time          `bson:"createdAt"`
+}
+
+type testUser struct {
+	Timestamps `bson:",inline"`
+	Name       string            `bson:"name" validate:"required,min=1,max=50"`
+	Age        int               `bson:"age,omitempty" validate:"gte=0,lt=200"`
+	Score      float64           `bson:"score" validate:"gt=0"`
+	Level      int32             `bson:"level" validate:"oneof=1 2 3"`
+	Count      int64             `bson:"count,minsize"`
+	Status     string            `bson:"status" validate:"oneof=active deleted"`
+	Tags       []string          `bson:"tags" validate:"required,unique,max=10,dive,min=2"`
+	Address    *testAddress      `bson:"address"`
+	Labels     map[string]string `bson:"labels,omitempty"`
+	Avatar     []byte            `bson:"avatar,omitempty"`
+	Location   geojson.Point     `bson:"location"`
+	Extra      interface{}       `bson:"extra" validate:"omitempty"`
+	Parent     *testUser         `bson:"parent,omitempty"`
+	Enabled    bool
+	Ignored    string `bson:"-"`
+	private    string
+}
+
+func TestFromStruct(t *testing.T) {
+	s, err := FromStruct(&testUser{})
+	require.NoError(t, err)
+	assert.Equal(t, Schema{
+		"bsonType": "object",
+		"required": []string{"createdAt", "name", "score", "level", "count", "status", "tags", "address", "location", "enabled"},
+		"properties": M{
+			"_id":       Schema{"bsonType": "objectId"},
+			"createdAt": Schema{"bsonType": "date"},
+			"name":      Schema{"bsonType": "string", "minLength": 1, "maxLength": 50},
+			"age":       Schema{"bsonType": A{"int", "long"}, "minimum": int64(0), "maximum": int64(200), "exclusiveMaximum": true},
+			"score":     Schema{"bsonType": "double", "minimum": 0.0, "exclusiveMinimum": true},
+			"level":     Schema{"bsonType": "int", "enum": A{int64(1), int64(2), int64(3)}},
+			"count":     Schema{"bsonType": A{"int", "long"}},
+			"status":    Schema{"bsonType": "string", "enum": A{"active", "deleted"}},
+			"tags": Schema{
+				"bsonType":    "array",
+				"items":       Schema{"bsonType": "string", "minLength": 2},
+				"uniqueItems": true,
+				"maxItems":    10,
+			},
+			"address": Schema{
+				"bsonType": A{"object", "null"},
+				"required": []string{"city"},
+				"properties": M{
+					"city": Schema{"bsonType": "string", "minLength": 1},
+					"zip":  Schema{"bsonType": "string", "minLength": 5, "maxLength": 5},
+				},
+			},
+			"labels":   Schema{"bsonType": A{"object", "null"}, "additionalProperties": Schema{"bsonType": "string"}},
+			"avatar":   Schema{"bsonType": A{"binData", "null"}},
+			"location": Schema{"bsonType": "object"},
+			"extra":    Schema{},
+			"parent":   Schema{"bsonType": A{"object", "null"}},
+			"enabled":  Schema{"bsonType": "bool"},
+		},
+	}, s)
+
+	s2, err := FromStruct(reflect.TypeOf(testUser{}))
+	require.NoError(t, err)
+	assert.Equal(t, s, s2)
+
+	_, err = FromStruct(1)
+	assert.EqualError(t, err, "jsonschema: expected struct, got int")
+	_, err = FromStruct(struct{ C chan int }{})
+	assert.EqualError(t, err, "jsonschema: struct { C chan int }.C: unsupported type chan int")
+	_, err = FromStruct(struct {
+		N int `validate:"min=a"`
+	}{})
+	assert.EqualError(t, err, "jsonschema: struct { N int \"validate:\\\"min=a\\\"\" }.N: invalid number parameter: a")
+}
@@ -0,0 +1,259 @@
+package jsonschema
+
+// https://docs.mongodb.com/manual/reference/operator/query/jsonSchema/#available-keywords
+
+// Schema is a $jsonSchema document.
+type Schema M
+
+// New returns an empty schema that matches any value.
+func New() Schema {
+	return Schema{}
+}
+
+// BSONType schema matches values of any of types,
+// types are $type aliases, e.g. "string", "int", "long" or "number".
+// https://docs.mongodb.com/manual/reference/operator/query/type/#available-types
+func BSONType(types ...string) Schema {
+	if len(types) == 1 {
+		return Schema{"bsonType": types[0]}
+	}
+	var a = make(A, len(types))
+	for index, i := range types {
+		a[index] = i
+	}
+	return Schema{"bsonType": a}
+}
+
+// Object schema matches embedded documents,
+// use SetProperty and SetRequired to describe fields.
+func Object() Schema {
+	return BSONType("object")
+}
+
+// Array schema matches arrays, items is a Schema for every item,
+// or an array of schemas for items by position, nil for any items.
+func Array(items interface{}) Schema {
+	var ret = BSONType("array")
+	if items != nil {
+		ret["items"] = items
+	}
+	return ret
+}
+
+// Enum schema matches one of values.
+func Enum(values ...interface{}) Schema {
+	return New().SetEnum(values...)
+}
+
+// AllOf schema matches when all schemas match.
+func AllOf(schemas ...Schema) Schema {
+	return New().SetAllOf(schemas...)
+}
+
+// AnyOf schema matches when at least one of schemas match.
+func AnyOf(schemas ...Schema) Schema {
+	return New().SetAnyOf(schemas...)
+}
+
+// OneOf schema matches when exactly one of schemas match.
+func OneOf(schemas ...Schema) Schema {
+	return New().SetOneOf(schemas...)
+}
+
+// Not schema matches when schema not match.
+func Not(schema Schema) Schema {
+	return New().SetNot(schema)
+}
+
+func schemaList(schemas []Schema) A {
+	var ret = make(A, len(schemas))
+	for index, i := range schemas {
+		ret[index] = i
+	}
+	return ret
+}
+
+// SetBSONType option, see BSONType.
+func (s Schema) SetBSONType(types ...string) Schema {
+	s["bsonType"] = BSONType(types...)["bsonType"]
+	return s
+}
+
+// SetTitle option
+func (s Schema) SetTitle(v string) Schema {
+	s["title"] = v
+	return s
+}
+
+// SetDescription option, mongodb includes it in validation error details.
+func (s Schema) SetDescription(v string) Schema {
+	s["description"] = v
+	return s
+}
+
+// SetEnum option
+func (s Schema) SetEnum(values ...interface{}) Schema {
+	s["enum"] = A(values)
+	return s
+}
+
+// SetAllOf option
+func (s Schema) SetAllOf(schemas ...Schema) Schema {
+	s["allOf"] = schemaList(schemas)
+	return s
+}
+
+// SetAnyOf option
+func (s Schema) SetAnyOf(schemas ...Schema) Schema {
+	s["anyOf"] = schemaList(schemas)
+	return s
+}
+
+// SetOneOf option
+func (s Schema) SetOneOf(schemas ...Schema) Schema {
+	s["oneOf"] = schemaList(schemas)
+	return s
+}
+
+// SetNot option
+func (s Schema) SetNot(schema Schema) Schema {
+	s["not"] = schema
+	return s
+}
+
+// SetProperty sets schema of field name.
+func (s Schema) SetProperty(name string, schema Schema) Schema {
+	var properties, _ = s["properties"].(M)
+	if properties == nil {
+		properties = M{}
+		s["properties"] = properties
+	}
+	properties[name] = schema
+	return s
+}
+
+// SetProperties option, properties maps field names to Schema.
+func (s Schema) SetProperties(properties M) Schema {
+	s["properties"] = properties
+	return s
+}
+
+// SetRequired option, fields are appended to existing required fields.
+func (s Schema) SetRequired(fields ...string) Schema {
+	var v, _ = s["required"].([]string)
+	s["required"] = append(v, fields...)
+	return s
+}
+
+// SetAdditionalProperties option, v is a bool or a Schema
+// for fields not listed in properties.
+// Remember to list _id in properties when v is false.
+func (s Schema) SetAdditionalProperties(v interface{}) Schema {
+	s["additionalProperties"] = v
+	return s
+}
+
+// SetPatternProperties option, properties maps regular expressions of
+// field names to Schema.
+func (s Schema) SetPatternProperties(properties M) Schema {
+	s["patternProperties"] = properties
+	return s
+}
+
+// SetMinProperties option
+func (s Schema) SetMinProperties(v int) Schema {
+	s["minProperties"] = v
+	return s
+}
+
+// SetMaxProperties option
+func (s Schema) SetMaxProperties(v int) Schema {
+	s["maxProperties"] = v
+	return s
+}
+
+// SetDependencies option, dependencies maps field names to
+// an array of required fields or a Schema.
+func (s Schema) SetDependencies(dependencies M) Schema {
+	s["dependencies"] = dependencies
+	return s
+}
+
+// SetMinimum option
+func (s Schema) SetMinimum(v interface{}) Schema {
+	s["minimum"] = v
+	return s
+}
+
+// SetExclusiveMinimum option
+func (s Schema) SetExclusiveMinimum(v bool) Schema {
+	s["exclusiveMinimum"] = v
+	return s
+}
+
+// SetMaximum option
+func (s Schema) SetMaximum(v interface{}) Schema {
+	s["maximum"] = v
+	return s
+}
+
+// SetExclusiveMaximum option
+func (s Schema) SetExclusiveMaximum(v bool) Schema {
+	s["exclusiveMaximum"] = v
+	return s
+}
+
+// SetMultipleOf option
+func (s Schema) SetMultipleOf(v interface{}) Schema {
+	s["multipleOf"] = v
+	return s
+}
+
+// SetMinLength option
+func (s Schema) SetMinLength(v int) Schema {
+	s["minLength"] = v
+	return s
+}
+
+// SetMaxLength option
+func (s Schema) SetMaxLength(v int) Schema {
+	s["maxLength"] = v
+	return s
+}
+
+// SetPattern option, a regular expression string.
+func (s Schema) SetPattern(v string) Schema {
+	s["pattern"] = v
+	return s
+}
+
+// SetItems option, see Array.
+func (s Schema) SetItems(items interface{}) Schema {
+	s["items"] = items
+	return s
+}
+
+// SetAdditionalItems option, v is a bool or a Schema
+// for items not covered by an items array.
+func (s Schema) SetAdditionalItems(v interface{}) Schema {
+	s["additionalItems"] = v
+	return s
+}
+
+// SetMinItems option
+func (s Schema) SetMinItems(v int) Schema {
+	s["minItems"] = v
+	return s
+}
+
+// SetMaxItems option
+func (s Schema) SetMaxItems(v int) Schema {
+	s["maxItems"] = v
+	return s
+}
+
+// SetUniqueItems option
+func (s Schema) SetUniqueItems(v bool) Schema {
+	s["uniqueItems"] = v
+	return s
+}
@@ -0,0 +1,47 @@
+package jsonschema
+
+import (
+	"testing"
+
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSchema(t *testing.T) {
+	var s = Object().
+		SetRequired("name", "status").
+		SetProperty("name", BSONType("string").SetMinLength(1).SetMaxLength(100).SetPattern("^[a-z]")).
+		SetProperty("age", BSONType("int", "long").SetMinimum(0).SetMaximum(200).SetExclusiveMaximum(true)).
+		SetProperty("status", Enum("active", "deleted").SetDescription("must be active or deleted")).
+		SetProperty("tags", Array(BSONType("string")).SetMinItems(1).SetUniqueItems(true)).
+		SetProperty("contact", OneOf(
+			Object().SetRequired("email"),
+			Object().SetRequired("phone"),
+		)).
+		SetProperty("note", Not(BSONType("null"))).
+		SetAdditionalProperties(false)
+	assert.Equal(t, Schema{
+		"bsonType": "object",
+		"required": []string{"name", "status"},
+		"properties": M{
+			"name":   Schema{"bsonType": "string", "minLength": 1, "maxLength": 100, "pattern": "^[a-z]"},
+			"age":    Schema{"bsonType": A{"int", "long"}, "minimum": 0, "maximum": 200, "exclusiveMaximum": true},
+			"status": Schema{"enum": A{"active", "deleted"}, "description": "must be active or deleted"},
+			"tags":   Schema{"bsonType": "array", "items": Schema{"bsonType": "string"}, "minItems": 1, "uniqueItems": true},
+			"contact": Schema{"oneOf": A{
+				Schema{"bsonType": "object", "required": []string{"email"}},
+				Schema{"bsonType": "object", "required": []string{"phone"}},
+			}},
+			"note": Schema{"not": Schema{"bsonType": "null"}},
+		},
+		"additionalProperties": false,
+	}, s)
+
+	var filter = query.JSONSchema(s)
+	_, err := bson.Marshal(filter)
+	assert.NoError(t, err)
+	assert.Empty(t, query.ValidateFilter(filter))
+	assert.Equal(t, Schema{"bsonType": "array"}, Array(nil))
+	assert.Equal(t, Schema{"anyOf": A{Schema{"bsonType": "int"}}, "allOf": A{}}, AnyOf(BSONType("int")).SetAllOf())
+}
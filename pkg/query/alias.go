@@ -9,3 +9,9 @@ type A = primitive.A
 
 // M alias primitive.M
 type M = primitive.M
+
+// D alias primitive.D, an ordered document.
+type D = primitive.D
+
+// E alias primitive.E, an element of D.
+type E = primitive.E
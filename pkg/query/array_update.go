@@ -1,5 +1,12 @@
 package query
 
+import (
+	"sort"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
 // https://docs.mongodb.com/manual/reference/operator/update-array/
 
 // AddToSet adds elements to an array only if they do not already exist in the set.
@@ -64,9 +71,52 @@ func (m EachModifier) Slice(num int) EachModifier {
 	return m
 }
 
-// Sort modifier orders the elements of an array during a $push operation.
+// Sort modifier orders the document elements of an array during a $push operation.
 // https://docs.mongodb.com/manual/reference/operator/update/sort/
-func (m EachModifier) Sort(sort interface{}) EachModifier {
+func (m EachModifier) Sort(sort SortSpec) EachModifier {
 	m["$sort"] = sort
 	return m
 }
+
+// SortElements modifier orders the elements of an array that are not documents
+// during a $push operation, order is 1 for ascending or -1 for descending.
+// https://docs.mongodb.com/manual/reference/operator/update/sort/
+func (m EachModifier) SortElements(order int) EachModifier {
+	m["$sort"] = order
+	return m
+}
+
+// eachModifiers in order of the $push documentation.
+var eachModifiers = []string{"$each", "$position", "$slice", "$sort"}
+
+// MarshalBSON implements bson.Marshaler,
+// modifiers are written in a stable order: $each, $position, $slice, $sort.
+// Use D for a sort specification with multiple fields to keep its order.
+func (m EachModifier) MarshalBSON() ([]byte, error) {
+	var d = make(D, 0, len(m))
+	for _, k := range eachModifiers {
+		if v, ok := m[k]; ok {
+			d = append(d, E{Key: k, Value: bsonutil.Ordered(v, false)})
+		}
+	}
+	var others = make([]string, 0, len(m)-len(d))
+	for k := range m {
+		if !isEachModifier(k) {
+			others = append(others, k)
+		}
+	}
+	sort.Strings(others)
+	for _, k := range others {
+		d = append(d, E{Key: k, Value: bsonutil.Ordered(m[k], false)})
+	}
+	return bson.Marshal(d)
+}
+
+func isEachModifier(key string) bool {
+	for _, i := range eachModifiers {
+		if i == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,15 @@
+package query
+
+import (
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+)
+
+// Canonicalize converts doc to an ordered document with stable key order,
+// so it marshals to same bytes every time, e.g. for golden tests.
+//
+// Keys of maps (e.g. M returned by builders) are sorted,
+// key order of D and struct fields is kept.
+// Nested documents and arrays are converted as well.
+func Canonicalize(doc interface{}) (D, error) {
+	return bsonutil.Doc(bsonutil.Ordered(doc, false))
+}
@@ -0,0 +1,54 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestCanonicalize(t *testing.T) {
+	var doc = M{
+		"b":   MergeOperators(Gte(1), Lt(2)),
+		"a":   D{{Key: "z", Value: 1}, {Key: "y", Value: M{"d": 1, "c": 2}}},
+		"$or": A{M{"x": 1, "w": 2}},
+	}
+	d, err := Canonicalize(doc)
+	require.NoError(t, err)
+	assert.Equal(t, D{
+		{Key: "$or", Value: A{D{{Key: "w", Value: int32(2)}, {Key: "x", Value: int32(1)}}}},
+		{Key: "a", Value: D{
+			{Key: "z", Value: int32(1)},
+			{Key: "y", Value: D{{Key: "c", Value: int32(2)}, {Key: "d", Value: int32(1)}}},
+		}},
+		{Key: "b", Value: D{{Key: "$gte", Value: int32(1)}, {Key: "$lt", Value: int32(2)}}},
+	}, d)
+
+	var first, _ = bson.Marshal(d)
+	for i := 0; i < 10; i++ {
+		d, err := Canonicalize(doc)
+		require.NoError(t, err)
+		b, _ := bson.Marshal(d)
+		assert.Equal(t, first, b)
+	}
+
+	_, err = Canonicalize(A{})
+	assert.Error(t, err)
+}
+
+func TestEachModifierOrder(t *testing.T) {
+	var update = Push(M{"scores": Each(A{1, 2}).
+		Sort(SortSpec{{Key: "score", Value: -1}, {Key: "name", Value: 1}}).
+		Slice(3).
+		Position(0),
+	})
+	d, err := Canonicalize(update)
+	require.NoError(t, err)
+	assert.Equal(t, D{{Key: "$push", Value: D{{Key: "scores", Value: D{
+		{Key: "$each", Value: A{int32(1), int32(2)}},
+		{Key: "$position", Value: int32(0)},
+		{Key: "$slice", Value: int32(3)},
+		{Key: "$sort", Value: D{{Key: "score", Value: int32(-1)}, {Key: "name", Value: int32(1)}}},
+	}}}}}, d)
+}
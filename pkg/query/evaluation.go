@@ -13,6 +13,7 @@ func Expr(expr interface{}) M {
 }
 
 // JSONSchema validate documents against the given JSON Schema.
+// Build schema with package jsonschema, e.g. jsonschema.FromStruct(User{}).
 // https://docs.mongodb.com/manual/reference/operator/query/jsonSchema/
 func JSONSchema(schema interface{}) M {
 	return M{"$jsonSchema": schema}
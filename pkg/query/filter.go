@@ -0,0 +1,216 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AndFilters combines filters that all must match.
+//
+// Operator documents on the same field are merged,
+// e.g. M{"age": Gte(18)} and M{"age": Lt(65)} become
+// M{"age": M{"$gte": 18, "$lt": 65}}.
+// Conditions that can not be merged (e.g. two $elemMatch on same field,
+// or two $or) are hoisted to $and, and nested $and is flattened.
+// Filters are not modified.
+func AndFilters(filters ...M) M {
+	var conditions, clauses = andConditions(filters)
+	var ret = M{}
+	for _, e := range conditions {
+		existing, ok := ret[e.Key]
+		if !ok {
+			ret[e.Key] = e.Value
+			continue
+		}
+		if merged, ok := mergeOperatorDocs(e.Key, existing, e.Value); ok {
+			ret[e.Key] = merged
+			continue
+		}
+		clauses = append(clauses, M{e.Key: e.Value})
+	}
+	if len(clauses) > 0 {
+		ret["$and"] = clauses
+	}
+	return ret
+}
+
+// andConditions returns top level conditions of filters with $and expanded,
+// clauses of $and that is not M are returned as is.
+func andConditions(filters []M) (conditions D, clauses []interface{}) {
+	for _, f := range filters {
+		for _, k := range sortedKeys(f) {
+			var l, ok = filterList(f[k])
+			if k != "$and" || !ok {
+				conditions = append(conditions, E{Key: k, Value: f[k]})
+				continue
+			}
+			for _, i := range l {
+				m, ok := i.(M)
+				if !ok {
+					clauses = append(clauses, i)
+					continue
+				}
+				c1, c2 := andConditions([]M{m})
+				conditions = append(conditions, c1...)
+				clauses = append(clauses, c2...)
+			}
+		}
+	}
+	return
+}
+
+// OrFilters combines filters that any must match.
+// Nested $or is flattened, and a filter that matches every document
+// (empty filter) makes the result match every document.
+// OrFilters() matches no document.
+func OrFilters(filters ...M) M {
+	var clauses []interface{}
+	for _, f := range filters {
+		if len(f) == 0 {
+			return M{}
+		}
+		if l, ok := filterList(f["$or"]); ok && len(f) == 1 {
+			clauses = append(clauses, l...)
+			continue
+		}
+		clauses = append(clauses, f)
+	}
+	switch len(clauses) {
+	case 0:
+		return MatchNone()
+	case 1:
+		if m, ok := clauses[0].(M); ok {
+			return m
+		}
+	}
+	return M{"$or": clauses}
+}
+
+// NotFilter negates a whole filter, it matches documents
+// that filter does not match.
+// Unlike Not, that is only valid on field level,
+// it negates each condition following De Morgan's laws,
+// e.g. M{"a": 1, "b": Gt(2)} becomes
+// M{"$or": []interface{}{M{"a": M{"$ne": 1}}, M{"b": M{"$not": M{"$gt": 2}}}}}.
+// Conditions that can not be negated in place are wrapped with $nor.
+func NotFilter(filter M) M {
+	var conditions, clauses = andConditions([]M{filter})
+	var negated = make([]M, 0, len(conditions)+len(clauses))
+	for _, e := range conditions {
+		negated = append(negated, negateCondition(e.Key, e.Value))
+	}
+	for _, i := range clauses {
+		negated = append(negated, M{"$nor": []interface{}{i}})
+	}
+	return OrFilters(negated...)
+}
+
+func negateCondition(key string, value interface{}) M {
+	switch {
+	case key == "$or":
+		if l, ok := filterList(value); ok {
+			return M{"$nor": l}
+		}
+	case key == "$nor":
+		if l, ok := filterList(value); ok {
+			var filters = make([]M, 0, len(l))
+			for _, i := range l {
+				m, ok := i.(M)
+				if !ok {
+					return M{"$nor": []interface{}{M{key: value}}}
+				}
+				filters = append(filters, m)
+			}
+			return OrFilters(filters...)
+		}
+	case strings.HasPrefix(key, "$"):
+	case hasOnlyOperators(value):
+		if m, ok := value.(M); ok && len(m) == 1 {
+			if v, ok := m["$not"]; ok {
+				return M{key: v}
+			}
+			if v, ok := m["$ne"]; ok {
+				return M{key: M{"$eq": v}}
+			}
+		}
+		return M{key: M{"$not": value}}
+	default:
+		if _, ok := value.(primitive.Regex); ok {
+			return M{key: M{"$not": value}}
+		}
+		return M{key: M{"$ne": value}}
+	}
+	return M{"$nor": []interface{}{M{key: value}}}
+}
+
+// mergeOperatorDocs merges operator documents of field key,
+// ok is false when they can not be merged.
+func mergeOperatorDocs(key string, a, b interface{}) (_ M, ok bool) {
+	if strings.HasPrefix(key, "$") {
+		return nil, false
+	}
+	m1, ok1 := a.(M)
+	m2, ok2 := b.(M)
+	if !ok1 || !ok2 || !hasOnlyOperators(m1) || !hasOnlyOperators(m2) {
+		return nil, false
+	}
+	var ret = make(M, len(m1)+len(m2))
+	for k, v := range m1 {
+		ret[k] = v
+	}
+	for k, v := range m2 {
+		if _, ok := ret[k]; ok {
+			return nil, false
+		}
+		ret[k] = v
+	}
+	return ret, true
+}
+
+// hasOnlyOperators reports whether v is a non-empty M or D
+// that every key is a field level operator, e.g. M{"$gt": 1}.
+func hasOnlyOperators(v interface{}) bool {
+	var keys []string
+	switch v := v.(type) {
+	case M:
+		keys = sortedKeys(v)
+	case D:
+		for _, e := range v {
+			keys = append(keys, e.Key)
+		}
+	}
+	for _, k := range keys {
+		if !strings.HasPrefix(k, "$") {
+			return false
+		}
+	}
+	return len(keys) > 0
+}
+
+// filterList returns filters of a logical operator argument.
+func filterList(v interface{}) ([]interface{}, bool) {
+	switch v := v.(type) {
+	case []interface{}:
+		return v, true
+	case A:
+		return v, true
+	case []M:
+		var ret = make([]interface{}, len(v))
+		for index, i := range v {
+			ret[index] = i
+		}
+		return ret, true
+	}
+	return nil, false
+}
+
+func sortedKeys(m M) []string {
+	var ret = make([]string, 0, len(m))
+	for k := range m {
+		ret = append(ret, k)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,94 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var filterTestDocs = []M{
+	{},
+	{"age": 10},
+	{"age": 20, "name": "foo"},
+	{"age": 70, "name": "bar", "tags": A{"a"}},
+	{"age": nil, "tags": A{"a", "b"}},
+	{"items": A{M{"qty": 5, "sku": "x"}, M{"qty": 15, "sku": "y"}}},
+}
+
+func matchAll(t *testing.T, filter M) []bool {
+	m, err := Compile(filter)
+	require.NoError(t, err)
+	var ret = make([]bool, len(filterTestDocs))
+	for index, i := range filterTestDocs {
+		ret[index] = m.Match(i)
+	}
+	return ret
+}
+
+func TestAndFilters(t *testing.T) {
+	var a = M{"age": Gte(18)}
+	assert.Equal(t, M{"age": M{"$gte": 18, "$lt": 65}}, AndFilters(a, M{"age": Lt(65)}))
+	assert.Equal(t, M{"age": Gte(18)}, a)
+
+	assert.Equal(t, M{
+		"items": ElemMatch(M{"sku": "x"}),
+		"$and":  []interface{}{M{"items": ElemMatch(M{"qty": Gt(10)})}},
+	}, AndFilters(M{"items": ElemMatch(M{"sku": "x"})}, M{"items": ElemMatch(M{"qty": Gt(10)})}))
+
+	assert.Equal(t, M{
+		"age":  M{"$gt": 1, "$lt": 65},
+		"name": "foo",
+		"$and": []interface{}{M{"name": "bar"}},
+	}, AndFilters(
+		And(M{"age": Gt(1)}, M{"name": "foo"}),
+		M{"$and": A{M{"age": Lt(65)}, M{"name": "bar"}}},
+	))
+	assert.Equal(t, M{}, AndFilters())
+}
+
+func TestOrFilters(t *testing.T) {
+	assert.Equal(t, M{"$or": []interface{}{M{"a": 1}, M{"b": 2}, M{"c": 3}}},
+		OrFilters(Or(M{"a": 1}, M{"b": 2}), M{"c": 3}))
+	assert.Equal(t, M{"a": 1}, OrFilters(M{"a": 1}))
+	assert.Equal(t, M{}, OrFilters(M{"a": 1}, M{}))
+	assert.Equal(t, []bool{false, false, false, false, false, false}, matchAll(t, OrFilters()))
+}
+
+func TestNotFilter(t *testing.T) {
+	assert.Equal(t, M{"$or": []interface{}{
+		M{"a": M{"$ne": 1}},
+		M{"b": M{"$not": M{"$gt": 2}}},
+	}}, NotFilter(M{"a": 1, "b": Gt(2)}))
+	assert.Equal(t, M{"a": M{"$eq": 1}}, NotFilter(M{"a": Not(M{"$eq": 1})}))
+	assert.Equal(t, M{"$nor": []interface{}{M{"a": 1}, M{"b": 2}}}, NotFilter(Or(M{"a": 1}, M{"b": 2})))
+
+	for _, c := range []struct {
+		name   string
+		filter M
+	}{
+		{"empty", M{}},
+		{"equal", M{"name": "foo"}},
+		{"range", M{"age": M{"$gte": 18, "$lt": 65}}},
+		{"regex", M{"name": primitive.Regex{Pattern: "^f"}}},
+		{"array", M{"tags": "a", "age": Ne(nil)}},
+		{"ne", M{"age": Ne(20)}},
+		{"or", M{"$or": A{M{"age": Lt(18)}, M{"name": "bar"}}, "tags": Exists(true)}},
+		{"nor", Nor(M{"age": 10}, M{"age": 20})},
+		{"elemMatch", AndFilters(
+			M{"items": ElemMatch(M{"sku": "x"})},
+			M{"items": ElemMatch(M{"qty": Gt(10)})},
+		)},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var want = matchAll(t, c.filter)
+			for index := range want {
+				want[index] = !want[index]
+			}
+			var res = NotFilter(c.filter)
+			assert.Empty(t, ValidateFilter(res))
+			assert.Equal(t, want, matchAll(t, res))
+		})
+	}
+}
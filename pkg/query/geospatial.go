@@ -1,20 +1,37 @@
 package query
 
+import (
+	"github.com/NateScarlet/mongo-operators/pkg/geojson"
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
 // https://docs.mongodb.com/manual/reference/operator/query-geospatial/
 
+// geometryArg wraps GeoJSON object as $geometry operator.
+func geometryArg(geometry interface{}) interface{} {
+	if g, ok := geometry.(geojson.Geometry); ok {
+		return GeometryOperator{"$geometry": g}
+	}
+	return geometry
+}
+
 // GeoIntersects selects documents whose geospatial data
 // intersects with a specified GeoJSON object;
 // i.e. where the intersection of the data and the specified object is non-empty.
+// geometry is a geojson.Geometry or a $geometry operator.
 // https://docs.mongodb.com/manual/reference/operator/query/geoIntersects/
 func GeoIntersects(geometry interface{}) M {
-	return M{"$geoIntersects": geometry}
+	return M{"$geoIntersects": geometryArg(geometry)}
 }
 
 // GeoWithIn selects documents with geospatial data
 // that exists entirely within a specified shape.
+// geometry is a geojson.Polygon, a geojson.MultiPolygon
+// or a shape operator, e.g. Geometry, Box or CenterSphere.
 // https://docs.mongodb.com/manual/reference/operator/query/geoWithin/
 func GeoWithIn(geometry interface{}) M {
-	return M{"$geoWithin": geometry}
+	return M{"$geoWithin": geometryArg(geometry)}
 }
 
 // NearOperator returned from Near.
@@ -24,7 +41,12 @@ type NearOperator M
 // Requires a geospatial index.
 // https://docs.mongodb.com/manual/reference/operator/query/near/
 func Near(longitude, latitude float64) NearOperator {
-	return NearOperator{"$near": Geometry("Point", []float64{longitude, latitude})}
+	return NearPoint(geojson.Point{longitude, latitude})
+}
+
+// NearPoint is Near with a GeoJSON point.
+func NearPoint(point geojson.Point) NearOperator {
+	return NearOperator{"$near": M{"$geometry": point}}
 }
 
 // SetMinDistance option
@@ -61,7 +83,12 @@ type NearSphereOperator M
 // Requires a geospatial index.
 // https://docs.mongodb.com/manual/reference/operator/query/nearSphere/
 func NearSphere(longitude, latitude float64) NearSphereOperator {
-	return NearSphereOperator{"$nearSphere": Geometry("Point", []float64{longitude, latitude})}
+	return NearSpherePoint(geojson.Point{longitude, latitude})
+}
+
+// NearSpherePoint is NearSphere with a GeoJSON point.
+func NearSpherePoint(point geojson.Point) NearSphereOperator {
+	return NearSphereOperator{"$nearSphere": M{"$geometry": point}}
 }
 
 // SetMaxDistance option
@@ -122,10 +149,17 @@ func CenterSphere(x, y, radius float64) M {
 	return M{"$centerSphere": A{[2]float64{x, y}, radius}}
 }
 
+// CenterSpherePoint is CenterSphere with radius as distance on earth surface,
+// e.g. GeoWithIn(CenterSpherePoint(geojson.Point{-73.99, 40.73}, 5*geojson.Kilometer)).
+func CenterSpherePoint(center geojson.Point, radius geojson.Distance) M {
+	return CenterSphere(center.Longitude(), center.Latitude(), radius.Radians())
+}
+
 // GeometryOperator returned from Geometry
 type GeometryOperator M
 
 // Geometry specifies a geometry in GeoJSON format to geospatial query operators.
+// Prefer GeometryOf with types of package geojson, they validate coordinates.
 // https://docs.mongodb.com/manual/reference/operator/query/geometry/
 func Geometry(typ string, coordinates interface{}) GeometryOperator {
 	return GeometryOperator{"$geometry": M{
@@ -134,12 +168,64 @@ func Geometry(typ string, coordinates interface{}) GeometryOperator {
 	}}
 }
 
-// SetCRS option
+// GeometryOf specifies a GeoJSON object to geospatial query operators,
+// use it to set crs of geometry.
+func GeometryOf(geometry geojson.Geometry) GeometryOperator {
+	return GeometryOperator{"$geometry": geometry}
+}
+
+// SetCRS option, e.g. for big polygon:
+// M{"type": "name", "properties": M{"name": geojson.StrictWindingCRS}}
+// Winding order of geojson.Polygon is checked when marshaled with this crs.
 func (op GeometryOperator) SetCRS(v interface{}) GeometryOperator {
-	op["$geometry"].(M)["crs"] = v
+	switch g := op["$geometry"].(type) {
+	case M:
+		g["crs"] = v
+	case geojson.Geometry:
+		op["$geometry"] = geometryWithCRS{g, v}
+	case geometryWithCRS:
+		op["$geometry"] = geometryWithCRS{g.geometry, v}
+	}
 	return op
 }
 
+type geometryWithCRS struct {
+	geometry geojson.Geometry
+	crs      interface{}
+}
+
+func (g geometryWithCRS) MarshalBSON() ([]byte, error) {
+	if p, ok := g.geometry.(geojson.Polygon); ok && crsName(g.crs) == geojson.StrictWindingCRS {
+		if err := p.ValidateWinding(); err != nil {
+			return nil, err
+		}
+	}
+	b, err := g.geometry.MarshalBSON()
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err = bson.Unmarshal(b, &d); err != nil {
+		return nil, err
+	}
+	return bson.Marshal(append(d, bson.E{Key: "crs", Value: g.crs}))
+}
+
+// crsName returns properties.name of named crs.
+func crsName(crs interface{}) string {
+	d, err := bsonutil.Doc(crs)
+	if err != nil {
+		return ""
+	}
+	properties, _ := bsonutil.Get(d, "properties")
+	if properties, ok := properties.(bson.D); ok {
+		name, _ := bsonutil.Get(properties, "name")
+		s, _ := name.(string)
+		return s
+	}
+	return ""
+}
+
 // Polygon specifies a polygon to using legacy coordinate pairs
 // for $geoWithin queries. The 2d index supports $center.
 // https://docs.mongodb.com/manual/reference/operator/query/polygon/
@@ -0,0 +1,58 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/NateScarlet/mongo-operators/pkg/geojson"
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGeoJSON(t *testing.T) {
+	var polygon = geojson.Polygon{{{0, 0}, {3, 0}, {3, 3}, {0, 3}, {0, 0}}}
+	var point = bson.D{{Key: "type", Value: "Point"}, {Key: "coordinates", Value: bson.A{1.0, 2.0}}}
+	var crs = bson.D{{Key: "type", Value: "name"}, {Key: "properties", Value: M{"name": geojson.StrictWindingCRS}}}
+	for _, c := range []struct {
+		name   string
+		filter M
+		want   bson.D
+	}{
+		{"within", M{"loc": GeoWithIn(polygon)}, bson.D{{Key: "loc", Value: bson.D{{Key: "$geoWithin", Value: bson.D{{Key: "$geometry", Value: bson.D{
+			{Key: "type", Value: "Polygon"},
+			{Key: "coordinates", Value: bson.A{bson.A{bson.A{0.0, 0.0}, bson.A{3.0, 0.0}, bson.A{3.0, 3.0}, bson.A{0.0, 3.0}, bson.A{0.0, 0.0}}}},
+		}}}}}}}},
+		{"intersects", M{"loc": GeoIntersects(geojson.Point{1, 2})}, bson.D{{Key: "loc", Value: bson.D{{Key: "$geoIntersects", Value: bson.D{{Key: "$geometry", Value: point}}}}}}},
+		{"crs", M{"loc": GeoWithIn(GeometryOf(geojson.Point{1, 2}).SetCRS(crs))}, bson.D{{Key: "loc", Value: bson.D{{Key: "$geoWithin", Value: bson.D{{Key: "$geometry", Value: append(point[:2:2], bson.E{Key: "crs", Value: bson.D{
+			{Key: "type", Value: "name"},
+			{Key: "properties", Value: bson.D{{Key: "name", Value: "urn:x-mongodb:crs:strictwinding:EPSG:4326"}}},
+		}})}}}}}}},
+		{"near", M{"loc": Near(1, 2).SetMaxDistance(100)}, bson.D{{Key: "loc", Value: bson.D{{Key: "$near", Value: bson.D{
+			{Key: "$geometry", Value: point},
+			{Key: "$maxDistance", Value: 100.0},
+		}}}}}},
+		{"near sphere", M{"loc": NearSpherePoint(geojson.Point{1, 2}).SetMinDistance(10)}, bson.D{{Key: "loc", Value: bson.D{{Key: "$nearSphere", Value: bson.D{
+			{Key: "$geometry", Value: point},
+			{Key: "$minDistance", Value: int32(10)},
+		}}}}}},
+		{"center sphere", M{"loc": GeoWithIn(CenterSpherePoint(geojson.Point{1, 2}, geojson.EarthRadius))}, bson.D{{Key: "loc", Value: bson.D{{Key: "$geoWithin", Value: bson.D{
+			{Key: "$centerSphere", Value: bson.A{bson.A{1.0, 2.0}, 1.0}},
+		}}}}}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := bsonutil.Normalize(bsonutil.Ordered(c.filter, true))
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+			assert.Empty(t, ValidateFilter(c.filter))
+		})
+	}
+
+	var clockwise = geojson.Polygon{{{0, 0}, {0, 3}, {3, 3}, {0, 0}}}
+	_, err := bson.Marshal(M{"loc": GeoWithIn(clockwise)})
+	assert.NoError(t, err)
+	_, err = bson.Marshal(M{"loc": GeoWithIn(GeometryOf(clockwise).SetCRS(
+		M{"type": "name", "properties": M{"name": geojson.StrictWindingCRS}},
+	))})
+	assert.EqualError(t, err, "geojson: coordinates[0]: exterior ring must be counterclockwise")
+}
@@ -0,0 +1,694 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Matcher tests documents against a filter without a server,
+// it is returned from Compile.
+type Matcher struct {
+	match docMatch
+}
+
+// Compile a filter document so it can be evaluated in memory.
+//
+// Supports comparison, logical, element, array, bitwise operators
+// and $regex, $mod from evaluation operators.
+// Values are compared using bson type comparison order,
+// and array fields are traversed implicitly as the server does.
+// Operators that require a server ($text, $where, geospatial ...)
+// returns an error.
+func Compile(filter interface{}) (*Matcher, error) {
+	return CompileExpr(filter, nil)
+}
+
+// ExprFunc evaluates an aggregation expression with doc as $$ROOT.
+type ExprFunc func(expr interface{}, doc primitive.D) (interface{}, error)
+
+// CompileExpr is like Compile, but also supports $expr by evaluating it with fn.
+// Error returned from fn is returned from MatchE.
+func CompileExpr(filter interface{}, fn ExprFunc) (*Matcher, error) {
+	d, err := bsonutil.Doc(filter)
+	if err != nil {
+		return nil, err
+	}
+	var c = &compiler{expr: fn}
+	m, err := c.compileDoc(d)
+	if err != nil {
+		return nil, err
+	}
+	return &Matcher{m}, nil
+}
+
+// Match reports whether doc matches the filter.
+// doc can be anything marshals to a bson document, e.g. M, bson.D, bson.Raw or a struct.
+// Returns false if doc is not a document or $expr evaluation failed,
+// use MatchE to get the error.
+func (m *Matcher) Match(doc interface{}) bool {
+	ok, _ := m.MatchE(doc)
+	return ok
+}
+
+// MatchE is like Match, but returns error if doc is not a document
+// or $expr evaluation failed.
+func (m *Matcher) MatchE(doc interface{}) (bool, error) {
+	d, err := bsonutil.Doc(doc)
+	if err != nil {
+		return false, err
+	}
+	return m.match(d)
+}
+
+type docMatch func(doc primitive.D) (bool, error)
+
+type compiler struct {
+	expr ExprFunc
+}
+
+// candidate is a value resolved from a field path.
+type candidate struct {
+	value interface{}
+	// element is true when value comes from expanding an array at the end of path.
+	element bool
+}
+
+type valueMatch func(cs []candidate) bool
+
+func (c *compiler) compileDoc(filter primitive.D) (docMatch, error) {
+	var matches = make([]docMatch, 0, len(filter))
+	for _, e := range filter {
+		var m docMatch
+		var err error
+		if strings.HasPrefix(e.Key, "$") {
+			m, err = c.compileDocOperator(e.Key, e.Value)
+		} else {
+			m, err = c.compileField(e.Key, e.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if m != nil {
+			matches = append(matches, m)
+		}
+	}
+	return andMatch(matches), nil
+}
+
+// andMatch matches document that matches every item of matches.
+func andMatch(matches []docMatch) docMatch {
+	return func(doc primitive.D) (bool, error) {
+		for _, i := range matches {
+			if ok, err := i(doc); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+}
+
+func (c *compiler) compileDocList(op string, v interface{}) ([]docMatch, error) {
+	a, ok := v.(primitive.A)
+	if !ok || len(a) == 0 {
+		return nil, fmt.Errorf("%s must be a nonempty array", op)
+	}
+	var ret = make([]docMatch, 0, len(a))
+	for _, i := range a {
+		d, ok := i.(primitive.D)
+		if !ok {
+			return nil, fmt.Errorf("%s argument's entries must be objects", op)
+		}
+		m, err := c.compileDoc(d)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, m)
+	}
+	return ret, nil
+}
+
+func (c *compiler) compileDocOperator(op string, v interface{}) (docMatch, error) {
+	switch op {
+	case "$and":
+		ms, err := c.compileDocList(op, v)
+		if err != nil {
+			return nil, err
+		}
+		return andMatch(ms), nil
+	case "$or", "$nor":
+		ms, err := c.compileDocList(op, v)
+		if err != nil {
+			return nil, err
+		}
+		var want = op == "$or"
+		return func(doc primitive.D) (bool, error) {
+			for _, m := range ms {
+				ok, err := m(doc)
+				if err != nil {
+					return false, err
+				}
+				if ok {
+					return want, nil
+				}
+			}
+			return !want, nil
+		}, nil
+	case "$comment":
+		return nil, nil
+	case "$expr":
+		if c.expr == nil {
+			return nil, fmt.Errorf("unsupported operator: %s", op)
+		}
+		var fn = c.expr
+		return func(doc primitive.D) (bool, error) {
+			r, err := fn(v, doc)
+			if err != nil {
+				return false, err
+			}
+			return bsonutil.Truthy(r), nil
+		}, nil
+	case "$text", "$where", "$jsonSchema":
+		return nil, fmt.Errorf("unsupported operator: %s", op)
+	}
+	return nil, fmt.Errorf("unknown top level operator: %s", op)
+}
+
+func (c *compiler) compileField(path string, v interface{}) (docMatch, error) {
+	m, err := c.compileFieldValue(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var parts = strings.Split(path, ".")
+	return func(doc primitive.D) (bool, error) {
+		return m(lookup(doc, parts)), nil
+	}, nil
+}
+
+// isOperatorDoc reports whether v is a document of field level operators.
+func isOperatorDoc(v interface{}) bool {
+	d, ok := v.(primitive.D)
+	return ok && len(d) > 0 && strings.HasPrefix(d[0].Key, "$")
+}
+
+func (c *compiler) compileFieldValue(v interface{}) (valueMatch, error) {
+	if isOperatorDoc(v) {
+		return c.compileOperatorDoc(v.(primitive.D))
+	}
+	if re, ok := v.(primitive.Regex); ok {
+		return compileRegex(re.Pattern, re.Options)
+	}
+	return eq(v), nil
+}
+
+func (c *compiler) compileOperatorDoc(d primitive.D) (valueMatch, error) {
+	var matches = make([]valueMatch, 0, len(d))
+	var regexOptions, hasRegexOptions = bsonutil.Get(d, "$options")
+	for _, e := range d {
+		var m valueMatch
+		var err error
+		if e.Key == "$options" {
+			if _, ok := bsonutil.Get(d, "$regex"); !ok {
+				return nil, fmt.Errorf("$options needs a $regex")
+			}
+			continue
+		}
+		if e.Key == "$regex" && hasRegexOptions {
+			var opts, _ = regexOptions.(string)
+			switch re := e.Value.(type) {
+			case string:
+				m, err = compileRegex(re, opts)
+			case primitive.Regex:
+				m, err = compileRegex(re.Pattern, opts)
+			default:
+				err = fmt.Errorf("$regex has to be a string")
+			}
+		} else {
+			m, err = c.compileOperator(e.Key, e.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return func(cs []candidate) bool {
+		for _, i := range matches {
+			if !i(cs) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
+
+func (c *compiler) compileOperator(op string, v interface{}) (valueMatch, error) {
+	switch op {
+	case "$eq":
+		return eq(v), nil
+	case "$ne":
+		return not(eq(v)), nil
+	case "$gt":
+		return compare(v, func(c int) bool { return c > 0 }), nil
+	case "$gte":
+		return compare(v, func(c int) bool { return c >= 0 }), nil
+	case "$lt":
+		return compare(v, func(c int) bool { return c < 0 }), nil
+	case "$lte":
+		return compare(v, func(c int) bool { return c <= 0 }), nil
+	case "$in", "$nin":
+		a, ok := v.(primitive.A)
+		if !ok {
+			return nil, fmt.Errorf("%s needs an array", op)
+		}
+		var ms = make([]valueMatch, 0, len(a))
+		for _, i := range a {
+			if isOperatorDoc(i) {
+				return nil, fmt.Errorf("cannot nest $ under %s", op)
+			}
+			if re, ok := i.(primitive.Regex); ok {
+				m, err := compileRegex(re.Pattern, re.Options)
+				if err != nil {
+					return nil, err
+				}
+				ms = append(ms, m)
+				continue
+			}
+			ms = append(ms, eq(i))
+		}
+		var m = anyOf(ms)
+		if op == "$nin" {
+			return not(m), nil
+		}
+		return m, nil
+	case "$exists":
+		var want = bsonutil.Truthy(v)
+		return func(cs []candidate) bool {
+			for _, c := range cs {
+				if _, ok := c.value.(bsonutil.Missing); !ok {
+					return want
+				}
+			}
+			return !want
+		}, nil
+	case "$type":
+		return compileType(v)
+	case "$size":
+		n, ok := bsonutil.Int64(v)
+		if !ok {
+			return nil, fmt.Errorf("$size needs a number")
+		}
+		return func(cs []candidate) bool {
+			for _, c := range cs {
+				if a, ok := c.value.(primitive.A); ok && !c.element && int64(len(a)) == n {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case "$all":
+		a, ok := v.(primitive.A)
+		if !ok {
+			return nil, fmt.Errorf("$all needs an array")
+		}
+		if len(a) == 0 {
+			return func([]candidate) bool { return false }, nil
+		}
+		var ms = make([]valueMatch, 0, len(a))
+		for _, i := range a {
+			if d, ok := i.(primitive.D); ok && len(d) == 1 && d[0].Key == "$elemMatch" {
+				m, err := c.compileOperator("$elemMatch", d[0].Value)
+				if err != nil {
+					return nil, err
+				}
+				ms = append(ms, m)
+				continue
+			}
+			m, err := c.compileFieldValue(i)
+			if err != nil {
+				return nil, err
+			}
+			ms = append(ms, m)
+		}
+		return allOf(ms), nil
+	case "$elemMatch":
+		return c.compileElemMatch(v)
+	case "$not":
+		switch v := v.(type) {
+		case primitive.Regex:
+			m, err := compileRegex(v.Pattern, v.Options)
+			if err != nil {
+				return nil, err
+			}
+			return not(m), nil
+		case primitive.D:
+			if !isOperatorDoc(v) {
+				return nil, fmt.Errorf("$not needs a regex or a document of operators")
+			}
+			m, err := c.compileOperatorDoc(v)
+			if err != nil {
+				return nil, err
+			}
+			return not(m), nil
+		}
+		return nil, fmt.Errorf("$not needs a regex or a document")
+	case "$regex":
+		switch v := v.(type) {
+		case string:
+			return compileRegex(v, "")
+		case primitive.Regex:
+			return compileRegex(v.Pattern, v.Options)
+		}
+		return nil, fmt.Errorf("$regex has to be a string")
+	case "$mod":
+		a, ok := v.(primitive.A)
+		if !ok || len(a) != 2 {
+			return nil, fmt.Errorf("malformed mod, needs to be an array of 2 elements")
+		}
+		divisor, ok1 := bsonutil.Int64(a[0])
+		remainder, ok2 := bsonutil.Int64(a[1])
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("malformed mod, elements must be numbers")
+		}
+		if divisor == 0 {
+			return nil, fmt.Errorf("divisor cannot be 0")
+		}
+		return anyValue(func(v interface{}) bool {
+			if !bsonutil.IsNumber(v) {
+				return false
+			}
+			n, ok := bsonutil.Int64(v)
+			return ok && n%divisor == remainder
+		}), nil
+	case "$bitsAllSet", "$bitsAllClear", "$bitsAnySet", "$bitsAnyClear":
+		return compileBits(op, v)
+	case "$comment":
+		return func([]candidate) bool { return true }, nil
+	case "$geoWithin", "$geoIntersects", "$near", "$nearSphere", "$text", "$where":
+		return nil, fmt.Errorf("unsupported operator: %s", op)
+	}
+	return nil, fmt.Errorf("unknown operator: %s", op)
+}
+
+func (c *compiler) compileElemMatch(v interface{}) (valueMatch, error) {
+	d, ok := v.(primitive.D)
+	if !ok {
+		return nil, fmt.Errorf("$elemMatch needs an Object")
+	}
+	var elemMatch func(elem interface{}) bool
+	if isOperatorDoc(d) && !isDocOperator(d[0].Key) {
+		m, err := c.compileOperatorDoc(d)
+		if err != nil {
+			return nil, err
+		}
+		elemMatch = func(elem interface{}) bool {
+			return m(lookup(elem, nil))
+		}
+	} else {
+		// $expr can only be applied to the top-level document,
+		// so m never returns error.
+		m, err := new(compiler).compileDoc(d)
+		if err != nil {
+			return nil, err
+		}
+		elemMatch = func(elem interface{}) bool {
+			d, ok := elem.(primitive.D)
+			if !ok {
+				return false
+			}
+			ok, _ = m(d)
+			return ok
+		}
+	}
+	return func(cs []candidate) bool {
+		for _, c := range cs {
+			a, ok := c.value.(primitive.A)
+			if !ok || c.element {
+				continue
+			}
+			for _, i := range a {
+				if elemMatch(i) {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
+
+func isDocOperator(op string) bool {
+	switch op {
+	case "$and", "$or", "$nor", "$expr", "$where", "$comment":
+		return true
+	}
+	return false
+}
+
+func compileType(v interface{}) (valueMatch, error) {
+	var specs primitive.A
+	if a, ok := v.(primitive.A); ok {
+		specs = a
+	} else {
+		specs = primitive.A{v}
+	}
+	var types = make([]bsontype.Type, 0, len(specs))
+	var number bool
+	for _, i := range specs {
+		if s, ok := i.(string); ok {
+			if s == "number" {
+				number = true
+				continue
+			}
+			t, ok := bsonutil.TypeFromAlias(s)
+			if !ok {
+				return nil, fmt.Errorf("unknown type name alias: %s", s)
+			}
+			types = append(types, t)
+			continue
+		}
+		n, ok := bsonutil.Int64(i)
+		if !ok {
+			return nil, fmt.Errorf("type must be represented as a number or a string")
+		}
+		switch n {
+		case -1:
+			types = append(types, bsontype.MinKey)
+		case 127:
+			types = append(types, bsontype.MaxKey)
+		default:
+			types = append(types, bsontype.Type(n))
+		}
+	}
+	return func(cs []candidate) bool {
+		for _, c := range cs {
+			if _, ok := c.value.(bsonutil.Missing); ok {
+				continue
+			}
+			if number && bsonutil.IsNumber(c.value) {
+				return true
+			}
+			var t = bsonutil.Type(c.value)
+			for _, i := range types {
+				if i == t {
+					return true
+				}
+			}
+		}
+		return false
+	}, nil
+}
+
+func compileRegex(pattern, options string) (valueMatch, error) {
+	re, err := bsonutil.Regexp(pattern, options)
+	if err != nil {
+		return nil, err
+	}
+	var raw = primitive.Regex{Pattern: pattern, Options: options}
+	return anyValue(func(v interface{}) bool {
+		switch v := v.(type) {
+		case string:
+			return re.MatchString(v)
+		case primitive.Symbol:
+			return re.MatchString(string(v))
+		case primitive.Regex:
+			return v.Equal(raw)
+		}
+		return false
+	}), nil
+}
+
+func compileBits(op string, v interface{}) (valueMatch, error) {
+	var positions []uint
+	switch v := v.(type) {
+	case primitive.A:
+		for _, i := range v {
+			n, ok := bsonutil.Int64(i)
+			if !ok || n < 0 {
+				return nil, fmt.Errorf("%s bit positions must be non-negative integers", op)
+			}
+			positions = append(positions, uint(n))
+		}
+	case primitive.Binary:
+		for index, b := range v.Data {
+			for bit := uint(0); bit < 8; bit++ {
+				if b&(1<<bit) != 0 {
+					positions = append(positions, uint(index)*8+bit)
+				}
+			}
+		}
+	default:
+		n, ok := bsonutil.Int64(v)
+		if !ok || n < 0 {
+			return nil, fmt.Errorf("%s bitmask must be a non-negative integer", op)
+		}
+		for bit := uint(0); bit < 64; bit++ {
+			if n&(1<<bit) != 0 {
+				positions = append(positions, bit)
+			}
+		}
+	}
+	var wantSet = op == "$bitsAllSet" || op == "$bitsAnySet"
+	var requireAll = op == "$bitsAllSet" || op == "$bitsAllClear"
+	return anyValue(func(v interface{}) bool {
+		var bitAt func(pos uint) bool
+		switch v := v.(type) {
+		case primitive.Binary:
+			bitAt = func(pos uint) bool {
+				var index = int(pos / 8)
+				return index < len(v.Data) && v.Data[index]&(1<<(pos%8)) != 0
+			}
+		default:
+			if !bsonutil.IsNumber(v) {
+				return false
+			}
+			n, ok := bsonutil.Int64(v)
+			if !ok {
+				return false
+			}
+			if f, ok := v.(float64); ok && float64(n) != f {
+				return false
+			}
+			bitAt = func(pos uint) bool {
+				if pos >= 64 {
+					return n < 0
+				}
+				return n&(1<<pos) != 0
+			}
+		}
+		for _, pos := range positions {
+			if bitAt(pos) == wantSet {
+				if !requireAll {
+					return true
+				}
+			} else if requireAll {
+				return false
+			}
+		}
+		return requireAll
+	}), nil
+}
+
+// lookup resolves path in v, arrays are traversed implicitly.
+func lookup(v interface{}, path []string) []candidate {
+	if len(path) == 0 {
+		var ret = []candidate{{value: v}}
+		if a, ok := v.(primitive.A); ok {
+			for _, i := range a {
+				ret = append(ret, candidate{value: i, element: true})
+			}
+		}
+		return ret
+	}
+	switch v := v.(type) {
+	case primitive.D:
+		if i, ok := bsonutil.Get(v, path[0]); ok {
+			return lookup(i, path[1:])
+		}
+	case primitive.A:
+		var ret []candidate
+		if index, err := strconv.Atoi(path[0]); err == nil && index >= 0 && index < len(v) {
+			ret = append(ret, lookup(v[index], path[1:])...)
+		}
+		for _, i := range v {
+			if _, ok := i.(primitive.D); ok {
+				ret = append(ret, lookup(i, path)...)
+			}
+		}
+		if len(ret) > 0 {
+			return ret
+		}
+	}
+	return []candidate{{value: bsonutil.Missing{}}}
+}
+
+func anyValue(fn func(v interface{}) bool) valueMatch {
+	return func(cs []candidate) bool {
+		for _, c := range cs {
+			if fn(c.value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func eq(v interface{}) valueMatch {
+	if bsonutil.IsNullish(v) {
+		return anyValue(bsonutil.IsNullish)
+	}
+	return anyValue(func(i interface{}) bool {
+		return bsonutil.CanonicalOrder(i) == bsonutil.CanonicalOrder(v) && bsonutil.Equal(i, v)
+	})
+}
+
+func compare(v interface{}, fn func(c int) bool) valueMatch {
+	switch v.(type) {
+	case primitive.MinKey, primitive.MaxKey:
+		return anyValue(func(i interface{}) bool {
+			if _, ok := i.(bsonutil.Missing); ok {
+				i = nil
+			}
+			return fn(bsonutil.Compare(i, v))
+		})
+	}
+	if bsonutil.IsNullish(v) {
+		return anyValue(func(i interface{}) bool {
+			return bsonutil.IsNullish(i) && fn(0)
+		})
+	}
+	var order = bsonutil.CanonicalOrder(v)
+	return anyValue(func(i interface{}) bool {
+		return bsonutil.CanonicalOrder(i) == order && fn(bsonutil.Compare(i, v))
+	})
+}
+
+func not(m valueMatch) valueMatch {
+	return func(cs []candidate) bool {
+		return !m(cs)
+	}
+}
+
+func anyOf(ms []valueMatch) valueMatch {
+	return func(cs []candidate) bool {
+		for _, m := range ms {
+			if m(cs) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func allOf(ms []valueMatch) valueMatch {
+	return func(cs []candidate) bool {
+		for _, m := range ms {
+			if !m(cs) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,137 @@
+package query
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCompile(t *testing.T) {
+	var doc = M{
+		"name": "foo",
+		"age":  int32(20),
+		"tags": A{"a", "b"},
+		"items": A{
+			M{"sku": "x", "qty": 5},
+			M{"sku": "y", "qty": 15},
+		},
+		"flags":  54,
+		"nested": A{A{1, 2}},
+		"null":   nil,
+	}
+	for _, c := range []struct {
+		name   string
+		filter M
+		want   bool
+	}{
+		{"empty", M{}, true},
+		{"eq", M{"name": "foo"}, true},
+		{"eq number types", M{"age": 20.0}, true},
+		{"eq array element", M{"tags": "b"}, true},
+		{"eq whole array", M{"tags": A{"a", "b"}}, true},
+		{"eq nested array", M{"nested": A{1, 2}}, true},
+		{"eq null missing", M{"missing": nil}, true},
+		{"eq null", M{"null": nil}, true},
+		{"ne", M{"tags": Ne("a")}, false},
+		{"gt", M{"age": Gt(18)}, true},
+		{"gt type bracketing", M{"name": Gt(1)}, false},
+		{"lt", M{"age": Lt(18)}, false},
+		{"range", M{"age": MergeOperators(Gte(18), Lt(65))}, true},
+		{"in", M{"name": In(A{"bar", "foo"})}, true},
+		{"in regex", M{"name": In(A{primitive.Regex{Pattern: "^F", Options: "i"}})}, true},
+		{"nin", M{"tags": Nin(A{"c", "b"})}, false},
+		{"and", And(M{"name": "foo"}, M{"age": 20}), true},
+		{"or", Or(M{"name": "bar"}, M{"age": 20}), true},
+		{"nor", Nor(M{"name": "bar"}, M{"age": 20}), false},
+		{"not", M{"age": Not(Gt(30))}, true},
+		{"exists", M{"null": Exists(true)}, true},
+		{"not exists", M{"missing": Exists(false)}, true},
+		{"type alias", M{"age": Type("int")}, true},
+		{"type number", M{"age": Type("number")}, true},
+		{"type array", M{"tags": Type("array")}, true},
+		{"type multiple", M{"name": Type(A{"int", 2})}, true},
+		{"size", M{"tags": Size(2)}, true},
+		{"all", M{"tags": All(A{"b", "a"})}, true},
+		{"all missing element", M{"tags": All(A{"b", "c"})}, false},
+		{"dotted array path", M{"items.sku": "y"}, true},
+		{"array index path", M{"items.0.sku": "y"}, false},
+		{"elemMatch doc", M{"items": ElemMatch(M{"sku": "x", "qty": Gt(10)})}, false},
+		{"dotted across elements", M{"items.sku": "x", "items.qty": Gt(10)}, true},
+		{"elemMatch value", M{"tags": ElemMatch(M{"$gte": "b"})}, true},
+		{"regex", M{"name": Regex(primitive.Regex{Pattern: "^f"})}, true},
+		{"regex options", M{"name": M{"$regex": "^F", "$options": "i"}}, true},
+		{"mod", M{"age": Mod(3, 2)}, true},
+		{"bitsAllSet", M{"flags": BitsAllSet(A{1, 5})}, true},
+		{"bitsAnyClear", M{"flags": BitsAnyClear(6)}, false},
+		{"bitsAllClear", M{"flags": BitsAllClear(A{0, 3})}, true},
+		{"comment", M{"$comment": "x", "name": "foo"}, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := Compile(c.filter)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, m.Match(doc))
+		})
+	}
+}
+
+func TestCompileEmbeddedDocumentOrder(t *testing.T) {
+	var doc = bson.D{{Key: "a", Value: bson.D{{Key: "x", Value: 1}, {Key: "y", Value: 2}}}}
+	m, err := Compile(bson.D{{Key: "a", Value: bson.D{{Key: "x", Value: 1}, {Key: "y", Value: 2}}}})
+	require.NoError(t, err)
+	assert.True(t, m.Match(doc))
+	m, err = Compile(bson.D{{Key: "a", Value: bson.D{{Key: "y", Value: 2}, {Key: "x", Value: 1}}}})
+	require.NoError(t, err)
+	assert.False(t, m.Match(doc))
+}
+
+func TestCompileError(t *testing.T) {
+	for _, filter := range []M{
+		{"$and": M{}},
+		{"$or": A{}},
+		{"a": M{"$foo": 1}},
+		{"a": In(1)},
+		{"a": Mod(0, 1)},
+		{"a": Not(1)},
+		M(Text("foo")),
+	} {
+		_, err := Compile(filter)
+		assert.Error(t, err, filter)
+	}
+}
+
+func TestMatchRaw(t *testing.T) {
+	raw, err := bson.Marshal(M{"a": 1})
+	require.NoError(t, err)
+	m, err := Compile(M{"a": 1})
+	require.NoError(t, err)
+	assert.True(t, m.Match(bson.Raw(raw)))
+	assert.True(t, m.Match(struct {
+		A int `bson:"a"`
+	}{1}))
+	assert.False(t, m.Match(1))
+	_, err = m.MatchE(1)
+	assert.Error(t, err)
+}
+
+func TestMatchExprError(t *testing.T) {
+	var exprErr = errors.New("expr error")
+	m, err := CompileExpr(M{"$or": A{M{"a": 2}, Expr(true)}}, func(expr interface{}, doc bson.D) (interface{}, error) {
+		return nil, exprErr
+	})
+	require.NoError(t, err)
+	ok, err := m.MatchE(M{"a": 2})
+	require.NoError(t, err, "matched before $expr")
+	assert.True(t, ok)
+	_, err = m.MatchE(M{"a": 1})
+	assert.Equal(t, exprErr, err)
+	assert.False(t, m.Match(M{"a": 1}))
+
+	_, err = CompileExpr(M{"items": ElemMatch(Expr(true))}, func(expr interface{}, doc bson.D) (interface{}, error) {
+		return true, nil
+	})
+	assert.Error(t, err, "$expr in $elemMatch")
+}
@@ -11,7 +11,8 @@ func Explain() M {
 
 // Hint operator forces the query optimizer
 // to use a specific index to fulfill the query.
-// Specify the index either by the index name or by document.
+// Specify the index either by the index name or by document,
+// use D for a compound index so key order is kept.
 // https://docs.mongodb.com/manual/reference/operator/meta/hint/
 func Hint(hint interface{}) M {
 	return M{"$hint": hint}
@@ -43,7 +44,7 @@ func MinIndex(bound interface{}) M {
 
 // OrderBy sorts the results of a query in ascending or descending order.
 // https://docs.mongodb.com/manual/reference/operator/meta/orderby/
-func OrderBy(sort interface{}) M {
+func OrderBy(sort SortSpec) M {
 	return M{"$orderBy": sort}
 }
 
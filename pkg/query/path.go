@@ -0,0 +1,73 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Path is a field path in dot notation, e.g. "items.0.sku".
+//
+// Use String for a field name (document key, stage options like localField),
+// and Ref for an aggregation expression that references the field.
+// A Path marshals to bson as its Ref, so it can be used as
+// aggregation expression directly.
+//
+// A leading "$" is optional, Path("tags") and Path("$tags") are the same field.
+type Path string
+
+// Field creates a path from field names.
+func Field(name ...string) Path {
+	return Path(strings.Join(name, "."))
+}
+
+// Var returns path of an aggregation variable,
+// Var("this") references "$$this".
+// https://docs.mongodb.com/manual/reference/aggregation-variables/
+func Var(name string) Path {
+	return Path("$$" + name)
+}
+
+// IsVar reports whether the path references an aggregation variable.
+func (p Path) IsVar() bool {
+	return strings.HasPrefix(string(p), "$$")
+}
+
+// Sub returns path of nested field.
+func (p Path) Sub(name ...string) Path {
+	var parts = make([]string, 0, len(name)+1)
+	if p != "" {
+		parts = append(parts, string(p))
+	}
+	parts = append(parts, name...)
+	return Path(strings.Join(parts, "."))
+}
+
+// Index returns path of array element at index.
+func (p Path) Index(index int) Path {
+	return p.Sub(strconv.Itoa(index))
+}
+
+// String returns field name without "$" prefix,
+// variable path keeps its "$$" prefix.
+func (p Path) String() string {
+	if !p.IsVar() && strings.HasPrefix(string(p), "$") {
+		return string(p[1:])
+	}
+	return string(p)
+}
+
+// Ref returns field path expression with "$" prefix, e.g. "$items.sku".
+func (p Path) Ref() string {
+	if strings.HasPrefix(string(p), "$") {
+		return string(p)
+	}
+	return "$" + string(p)
+}
+
+// MarshalBSONValue implements bson.ValueMarshaler.
+func (p Path) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bsontype.String, bsoncore.AppendString(nil, p.Ref()), nil
+}
@@ -0,0 +1,29 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPath(t *testing.T) {
+	var p = Field("items").Index(2).Sub("sku")
+	assert.Equal(t, "items.2.sku", p.String())
+	assert.Equal(t, "$items.2.sku", p.Ref())
+	assert.Equal(t, "tags", Path("$tags").String())
+	assert.Equal(t, "$tags", Path("$tags").Ref())
+	assert.Equal(t, "a.b", Path("").Sub("a", "b").String())
+
+	var v = Var("this").Sub("name")
+	assert.True(t, v.IsVar())
+	assert.Equal(t, "$$this.name", v.String())
+	assert.Equal(t, "$$this.name", v.Ref())
+
+	b, err := bson.Marshal(M{"v": p})
+	require.NoError(t, err)
+	var res M
+	require.NoError(t, bson.Unmarshal(b, &res))
+	assert.Equal(t, M{"v": "$items.2.sku"}, res)
+}
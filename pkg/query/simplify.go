@@ -0,0 +1,395 @@
+package query
+
+import (
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Simplify returns an equivalent filter with stable shape:
+//
+//   - nested $and is flattened, and conditions on same field are merged
+//   - duplicated conditions and $or, $nor branches are removed
+//   - $in and $nin with one value become equality and $ne,
+//     $or with one branch is merged to its parent
+//   - bounds in same direction on a field (e.g. $gt 5 and $gte 10) keep the tighter one
+//
+// When the filter never matches, e.g. $in with empty array,
+// $exists true and false on same field, or $eq and $ne of same value,
+// MatchNone() is returned, check it with IsMatchNone.
+// Contradictory bounds (e.g. $gt 10 with $lt 5) are only detected
+// inside $elemMatch, since an array field matches them with different elements.
+//
+// Filter is not modified.
+func Simplify(filter M) M {
+	ret, ok := simplifyFilter(filter)
+	if !ok {
+		return MatchNone()
+	}
+	return ret
+}
+
+// MatchNone returns a filter that matches no document.
+func MatchNone() M {
+	return M{"$nor": []interface{}{M{}}}
+}
+
+// IsMatchNone reports whether filter is returned from MatchNone.
+func IsMatchNone(filter M) bool {
+	if len(filter) != 1 {
+		return false
+	}
+	l, ok := filterList(filter["$nor"])
+	if !ok || len(l) != 1 {
+		return false
+	}
+	m, ok := l[0].(M)
+	return ok && len(m) == 0
+}
+
+// simplifyFilter returns simplified filter,
+// ok is false when it never matches.
+func simplifyFilter(filter M) (_ M, ok bool) {
+	var conditions, clauses = andConditions([]M{filter})
+	var parts []M
+	var collapsed bool
+	var fields []string
+	var fieldValues = map[string][]interface{}{}
+	for _, e := range conditions {
+		var l, isList = filterList(e.Value)
+		switch {
+		case e.Key == "$or" && isList:
+			branches, matchAll := simplifyBranches(l)
+			switch {
+			case matchAll:
+			case len(branches) == 0:
+				return nil, false
+			case len(branches) == 1 && isM(branches[0]):
+				parts = append(parts, branches[0].(M))
+				collapsed = true
+			default:
+				parts = append(parts, M{"$or": branches})
+			}
+		case e.Key == "$nor" && isList:
+			branches, matchAll := simplifyBranches(l)
+			switch {
+			case matchAll:
+				return nil, false
+			case len(branches) > 0:
+				parts = append(parts, M{"$nor": branches})
+			}
+		case strings.HasPrefix(e.Key, "$"):
+			parts = append(parts, M{e.Key: e.Value})
+		default:
+			if _, ok := fieldValues[e.Key]; !ok {
+				fields = append(fields, e.Key)
+			}
+			fieldValues[e.Key] = append(fieldValues[e.Key], e.Value)
+		}
+	}
+	for _, k := range fields {
+		var c = &fieldConditions{}
+		for _, i := range fieldValues[k] {
+			if !c.add(i) {
+				return nil, false
+			}
+		}
+		for _, i := range c.values() {
+			parts = append(parts, M{k: i})
+		}
+	}
+	var ret = AndFilters(parts...)
+	if l, ok := filterList(ret["$and"]); ok || len(clauses) > 0 {
+		ret["$and"] = uniqueValues(append(l, clauses...))
+	}
+	if collapsed {
+		return simplifyFilter(ret)
+	}
+	return ret, true
+}
+
+// simplifyBranches simplifies branches of $or or $nor,
+// branches never match are removed and nested $or is flattened.
+// matchAll is true when any branch matches every document.
+func simplifyBranches(l []interface{}) (branches []interface{}, matchAll bool) {
+	for _, i := range l {
+		m, ok := i.(M)
+		if !ok {
+			branches = append(branches, i)
+			continue
+		}
+		m, ok = simplifyFilter(m)
+		switch {
+		case !ok:
+			continue
+		case len(m) == 0:
+			return nil, true
+		}
+		if l, ok := filterList(m["$or"]); ok && len(m) == 1 {
+			branches = append(branches, l...)
+			continue
+		}
+		branches = append(branches, m)
+	}
+	return uniqueValues(branches), false
+}
+
+// fieldConditions merges conditions on one field.
+type fieldConditions struct {
+	// scalar is set when field value is never an array,
+	// e.g. operators of $elemMatch.
+	scalar bool
+	ops    D
+	// others can not be merged to ops.
+	others []interface{}
+}
+
+// add condition value v, returns false when conditions never match.
+func (c *fieldConditions) add(v interface{}) bool {
+	if !hasOnlyOperators(v) {
+		if _, ok := v.(primitive.Regex); ok {
+			c.addOther(v)
+			return true
+		}
+		return c.addOp("$eq", v)
+	}
+	var ops = operatorList(v)
+	for _, e := range ops {
+		if e.Key == "$regex" || e.Key == "$options" {
+			// $regex and $options must be kept together
+			c.addOther(v)
+			return true
+		}
+	}
+	for _, e := range ops {
+		if !c.addOp(e.Key, e.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *fieldConditions) addOp(op string, arg interface{}) bool {
+	switch op {
+	case "$in", "$nin":
+		var l, ok = filterList(arg)
+		if !ok {
+			break
+		}
+		l = uniqueValues(l)
+		switch {
+		case len(l) == 0 && op == "$in":
+			return false
+		case len(l) == 0:
+			return true
+		case len(l) == 1 && op == "$nin":
+			return c.addOp("$ne", l[0])
+		case len(l) == 1:
+			if _, ok := l[0].(primitive.Regex); ok {
+				c.addOther(l[0])
+				return true
+			}
+			return c.addOp("$eq", l[0])
+		}
+		arg = l
+	case "$gt", "$gte":
+		return c.addBound(op, arg, "$gt", "$gte", 1)
+	case "$lt", "$lte":
+		return c.addBound(op, arg, "$lt", "$lte", -1)
+	case "$exists":
+		if v, ok := c.get("$exists"); ok && bsonutil.Truthy(normalized(v)) != bsonutil.Truthy(normalized(arg)) {
+			return false
+		}
+	case "$eq":
+		if v, ok := c.get("$ne"); ok && equalValue(v, arg) {
+			return false
+		}
+		if v, ok := c.get("$eq"); ok && c.scalar && !equalValue(v, arg) {
+			return false
+		}
+	case "$ne":
+		if v, ok := c.get("$eq"); ok && equalValue(v, arg) {
+			return false
+		}
+	case "$elemMatch":
+		var m, ok = arg.(M)
+		if !ok {
+			break
+		}
+		if hasOnlyOperators(m) {
+			var e = &fieldConditions{scalar: true}
+			if !e.add(m) {
+				return false
+			}
+			if len(e.others) == 0 {
+				m, _ = e.operators()
+			}
+		} else if m, ok = simplifyFilter(m); !ok {
+			return false
+		}
+		arg = m
+	}
+	c.set(op, arg)
+	return true
+}
+
+// addBound merges a lower (sign 1) or upper (sign -1) bound.
+func (c *fieldConditions) addBound(op string, arg interface{}, exclusive, inclusive string, sign int) bool {
+	var existingOp = exclusive
+	var existing, ok = c.get(exclusive)
+	if !ok {
+		existingOp = inclusive
+		existing, ok = c.get(inclusive)
+	}
+	if ok {
+		var a, b = normalized(arg), normalized(existing)
+		if bsonutil.CanonicalOrder(a) != bsonutil.CanonicalOrder(b) {
+			c.addOther(M{op: arg})
+			return true
+		}
+		var d = bsonutil.Compare(a, b) * sign
+		if d < 0 || d == 0 && op == inclusive {
+			return true
+		}
+		c.remove(existingOp)
+	}
+	c.set(op, arg)
+	return !c.scalar || c.boundsSatisfiable()
+}
+
+// boundsSatisfiable reports whether a single value may satisfy lower and upper bound.
+func (c *fieldConditions) boundsSatisfiable() bool {
+	var lower, lowerOK = c.get("$gt")
+	var lowerExclusive = lowerOK
+	if !lowerOK {
+		lower, lowerOK = c.get("$gte")
+	}
+	var upper, upperOK = c.get("$lt")
+	var upperExclusive = upperOK
+	if !upperOK {
+		upper, upperOK = c.get("$lte")
+	}
+	if !lowerOK || !upperOK {
+		return true
+	}
+	var a, b = normalized(lower), normalized(upper)
+	if bsonutil.CanonicalOrder(a) != bsonutil.CanonicalOrder(b) {
+		return false
+	}
+	var d = bsonutil.Compare(a, b)
+	return d < 0 || d == 0 && !lowerExclusive && !upperExclusive
+}
+
+func (c *fieldConditions) get(op string) (interface{}, bool) {
+	for _, e := range c.ops {
+		if e.Key == op {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+func (c *fieldConditions) remove(op string) {
+	for index, e := range c.ops {
+		if e.Key == op {
+			c.ops = append(c.ops[:index:index], c.ops[index+1:]...)
+			return
+		}
+	}
+}
+
+// set op, conflicting with existing one is added to others.
+func (c *fieldConditions) set(op string, arg interface{}) {
+	if v, ok := c.get(op); ok {
+		if !equalValue(v, arg) {
+			c.addOther(M{op: arg})
+		}
+		return
+	}
+	c.ops = append(c.ops, E{Key: op, Value: arg})
+}
+
+func (c *fieldConditions) addOther(v interface{}) {
+	for _, i := range c.others {
+		if equalValue(i, v) {
+			return
+		}
+	}
+	c.others = append(c.others, v)
+}
+
+// operators returns ops as operator document, equality is kept as $eq.
+func (c *fieldConditions) operators() (M, bool) {
+	if len(c.ops) == 0 {
+		return nil, false
+	}
+	var ret = make(M, len(c.ops))
+	for _, e := range c.ops {
+		ret[e.Key] = e.Value
+	}
+	return ret, true
+}
+
+// values returns condition values of the field.
+func (c *fieldConditions) values() []interface{} {
+	var ret []interface{}
+	if m, ok := c.operators(); ok {
+		var v, isEq = m["$eq"]
+		var _, isRegex = v.(primitive.Regex)
+		if isEq && len(m) == 1 && !isRegex && !hasOnlyOperators(v) {
+			ret = append(ret, v)
+		} else {
+			ret = append(ret, m)
+		}
+	}
+	return append(ret, c.others...)
+}
+
+func isM(v interface{}) bool {
+	_, ok := v.(M)
+	return ok
+}
+
+// operatorList returns operators of an operator document in stable order.
+func operatorList(v interface{}) D {
+	switch v := v.(type) {
+	case M:
+		var ret = make(D, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			ret = append(ret, E{Key: k, Value: v[k]})
+		}
+		return ret
+	case D:
+		return v
+	}
+	return nil
+}
+
+// normalized returns v as canonical bson value for comparison.
+func normalized(v interface{}) interface{} {
+	ret, err := bsonutil.Normalize(bsonutil.Ordered(v, false))
+	if err != nil {
+		return v
+	}
+	return ret
+}
+
+func equalValue(a, b interface{}) bool {
+	return bsonutil.Key(normalized(a)) == bsonutil.Key(normalized(b))
+}
+
+// uniqueValues removes duplicated values and keeps order.
+func uniqueValues(l []interface{}) []interface{} {
+	var ret = make([]interface{}, 0, len(l))
+	var seen = map[string]bool{}
+	for _, i := range l {
+		var k = bsonutil.Key(normalized(i))
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		ret = append(ret, i)
+	}
+	return ret
+}
@@ -0,0 +1,47 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSimplify(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		filter M
+		want   M
+	}{
+		{"empty", M{}, M{}},
+		{"and", And(M{"a": 1}), M{"a": 1}},
+		{"nested and", And(And(M{"a": 1}, M{"b": 2}), M{"a": 1}), M{"a": 1, "b": 2}},
+		{"in", M{"a": In(A{1}), "b": Nin(A{2, 2}), "c": In(A{3, 3, 4})}, M{"a": 1, "b": M{"$ne": 2}, "c": M{"$in": []interface{}{3, 4}}}},
+		{"in regex", M{"a": In(A{primitive.Regex{Pattern: "^a"}})}, M{"a": primitive.Regex{Pattern: "^a"}}},
+		{"or", Or(M{"a": 1}, M{"a": 1}), M{"a": 1}},
+		{"or merged", M{"a": Gt(1), "$or": A{M{"a": Lt(5)}}}, M{"a": M{"$gt": 1, "$lt": 5}}},
+		{"or match all", M{"a": 1, "$or": A{M{"b": 1}, M{}}}, M{"a": 1}},
+		{"nested or", Or(Or(M{"a": 1}, M{"b": 2}), M{"c": In(A{})}, M{"b": 2}), M{"$or": []interface{}{M{"a": 1}, M{"b": 2}}}},
+		{"nor", M{"$nor": A{M{"a": In(A{})}}}, M{}},
+		{"bounds", AndFilters(M{"a": Gt(5)}, M{"a": Gte(10)}, M{"a": Lte(20)}, M{"a": Lt(20)}), M{"a": M{"$gte": 10, "$lt": 20}}},
+		{"bounds of different type", And(M{"a": Gt(5)}, M{"a": Gt("x")}), M{"a": M{"$gt": 5}, "$and": []interface{}{M{"a": M{"$gt": "x"}}}}},
+		{"contradictory bounds", M{"a": M{"$gt": 10, "$lt": 5}}, M{"a": M{"$gt": 10, "$lt": 5}}},
+		{"elemMatch", M{"a": ElemMatch(M{"$in": A{1}})}, M{"a": ElemMatch(M{"$eq": 1})}},
+		{"elemMatch contradictory bounds", M{"a": ElemMatch(M{"$gt": 10, "$lt": 5})}, MatchNone()},
+		{"elemMatch filter", M{"a": ElemMatch(M{"b": In(A{})})}, MatchNone()},
+		{"empty in", M{"a": 1, "b": In(A{})}, MatchNone()},
+		{"exists", And(M{"a": Exists(true)}, M{"a": Exists(false)}), MatchNone()},
+		{"eq and ne", And(M{"a": 1}, M{"a": Ne(1)}), MatchNone()},
+		{"or match none", Or(M{"a": In(A{})}, M{"b": Nin(A{})}), M{}},
+		{"match none", MatchNone(), MatchNone()},
+		{"duplicated elemMatch", And(M{"a": ElemMatch(M{"b": 1})}, M{"a": ElemMatch(M{"b": 1})}), M{"a": ElemMatch(M{"b": 1})}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			var res = Simplify(c.filter)
+			assert.Equal(t, c.want, res)
+			assert.Equal(t, matchAll(t, c.filter), matchAll(t, res))
+		})
+	}
+	assert.True(t, IsMatchNone(Simplify(M{"a": In(A{})})))
+	assert.False(t, IsMatchNone(M{}))
+}
@@ -0,0 +1,84 @@
+package query
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SortSpec is a sort specification that keeps key order,
+// so sorting on multiple keys is correct by construction,
+// unlike M whose key order is random:
+//
+//	Asc("a").Desc("b").TextScore("score")
+//
+// It is taken wherever a sort document is,
+// e.g. OrderBy, EachModifier.Sort, aggregation Sort and SetSortBy.
+// Other sort values can be written as literal, e.g. SortSpec{{Key: "a", Value: 1}}.
+type SortSpec D
+
+// Asc sorts by field in ascending order.
+func Asc(field Path) SortSpec {
+	return SortSpec{}.Asc(field)
+}
+
+// Desc sorts by field in descending order.
+func Desc(field Path) SortSpec {
+	return SortSpec{}.Desc(field)
+}
+
+// TextScore sorts by text search score in descending order,
+// as `{ field: { $meta: "textScore" } }`.
+// https://docs.mongodb.com/manual/reference/operator/aggregation/meta/
+func TextScore(field Path) SortSpec {
+	return SortSpec{}.TextScore(field)
+}
+
+// SearchScore sorts by Atlas Search score in descending order,
+// as `{ field: { $meta: "searchScore" } }`.
+// https://docs.atlas.mongodb.com/reference/atlas-search/scoring/
+func SearchScore(field Path) SortSpec {
+	return SortSpec{}.SearchScore(field)
+}
+
+func (s SortSpec) with(field Path, order interface{}) SortSpec {
+	var ret = make(SortSpec, 0, len(s)+1)
+	for _, i := range s {
+		if i.Key != field.String() {
+			ret = append(ret, i)
+		}
+	}
+	return append(ret, E{Key: field.String(), Value: order})
+}
+
+// Asc adds field in ascending order,
+// a field that already exists is moved to the end.
+func (s SortSpec) Asc(field Path) SortSpec {
+	return s.with(field, 1)
+}
+
+// Desc adds field in descending order,
+// a field that already exists is moved to the end.
+func (s SortSpec) Desc(field Path) SortSpec {
+	return s.with(field, -1)
+}
+
+// TextScore adds text search score of field,
+// a field that already exists is moved to the end.
+func (s SortSpec) TextScore(field Path) SortSpec {
+	return s.with(field, M{"$meta": "textScore"})
+}
+
+// SearchScore adds Atlas Search score of field,
+// a field that already exists is moved to the end.
+func (s SortSpec) SearchScore(field Path) SortSpec {
+	return s.with(field, M{"$meta": "searchScore"})
+}
+
+// D returns sort specification as ordered document.
+func (s SortSpec) D() D {
+	return D(s)
+}
+
+// MarshalBSON implements bson.Marshaler.
+func (s SortSpec) MarshalBSON() ([]byte, error) {
+	return bson.Marshal(D(s))
+}
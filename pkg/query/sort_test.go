@@ -0,0 +1,50 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortSpec(t *testing.T) {
+	var spec = Asc("a").Desc(Field("b", "c")).TextScore("score")
+	assert.Equal(t, D{
+		{Key: "a", Value: 1},
+		{Key: "b.c", Value: -1},
+		{Key: "score", Value: M{"$meta": "textScore"}},
+	}, spec.D())
+
+	// builders do not share underlying array
+	var base = Desc("a")
+	var x, y = base.Asc("x"), base.Asc("y")
+	assert.Equal(t, "x", x[1].Key)
+	assert.Equal(t, "y", y[1].Key)
+
+	// existing field is moved to the end
+	assert.Equal(t, D{{Key: "b", Value: 1}, {Key: "a", Value: -1}}, Asc("a").Asc("b").Desc("a").D())
+
+	for _, c := range []struct {
+		name string
+		doc  interface{}
+		want D
+	}{
+		{"order by", OrderBy(Desc("b").Asc("a")), D{{Key: "$orderBy", Value: D{
+			{Key: "b", Value: int32(-1)},
+			{Key: "a", Value: int32(1)},
+		}}}},
+		{"each", Push(M{"items": Each(A{}).Sort(SearchScore("s").Asc("a"))}), D{{Key: "$push", Value: D{{Key: "items", Value: D{
+			{Key: "$each", Value: A{}},
+			{Key: "$sort", Value: D{
+				{Key: "s", Value: D{{Key: "$meta", Value: "searchScore"}}},
+				{Key: "a", Value: int32(1)},
+			}},
+		}}}}}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			d, err := Canonicalize(c.doc)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, d)
+		})
+	}
+}
@@ -1,7 +1,16 @@
 package query
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+)
+
 // MergeOperators in a last win manner.
 // only merge top level fields.
+// Use MergeOperatorsDeep to combine fields of same update operator.
 func MergeOperators(operators ...M) M {
 	var ret = M{}
 	for _, i := range operators {
@@ -11,3 +20,110 @@ func MergeOperators(operators ...M) M {
 	}
 	return ret
 }
+
+// MergeOperatorsDeep merges update operators and combines fields of same operator,
+// e.g. MergeOperatorsDeep(Set(M{"a": 1}), Set(M{"b": 2}), Inc(M{"n": 1}))
+// returns M{"$set": M{"a": 1, "b": 2}, "$inc": M{"n": 1}}.
+//
+// Returns an error when updated paths conflict, that server would reject:
+// same path is updated twice, or a path is prefix of another
+// (e.g. $set "a.b" with $unset "a").
+// Target of $rename is counted as updated path.
+func MergeOperatorsDeep(operators ...M) (M, error) {
+	var ret = M{}
+	var paths = map[string]string{}
+	for _, i := range operators {
+		var keys = make([]string, 0, len(i))
+		for k := range i {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, op := range keys {
+			if !strings.HasPrefix(op, "$") {
+				return nil, fmt.Errorf("%s: not an update operator", op)
+			}
+			fields, err := updateFields(i[op])
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", op, err)
+			}
+			merged, _ := ret[op].(M)
+			if merged == nil {
+				merged = M{}
+				ret[op] = merged
+			}
+			for _, e := range fields {
+				var updated = []string{e.Key}
+				if to, ok := e.Value.(string); ok && op == "$rename" {
+					updated = append(updated, to)
+				}
+				for _, p := range updated {
+					if err := addUpdatePath(paths, p, JoinPath(op, e.Key)); err != nil {
+						return nil, err
+					}
+				}
+				merged[e.Key] = e.Value
+			}
+		}
+	}
+	return ret, nil
+}
+
+// updateFields returns fields of update operator argument,
+// values of M and D are kept as is.
+func updateFields(v interface{}) (D, error) {
+	switch v := v.(type) {
+	case M:
+		var ret = make(D, 0, len(v))
+		for k, v := range v {
+			ret = append(ret, E{Key: k, Value: v})
+		}
+		sort.Slice(ret, func(i, j int) bool { return ret[i].Key < ret[j].Key })
+		return ret, nil
+	case D:
+		return v, nil
+	}
+	return bsonutil.Doc(v)
+}
+
+// addUpdatePath adds path updated by source to paths,
+// returns an error when it conflicts with existing one.
+func addUpdatePath(paths map[string]string, path, source string) error {
+	if conflicts := updatePathConflicts(paths, path); len(conflicts) > 0 {
+		return fmt.Errorf("%s: %s", source, conflicts[0].message(path))
+	}
+	paths[path] = source
+	return nil
+}
+
+// updatePathConflict is a conflict between an updated path
+// and a path that already updated by source.
+type updatePathConflict struct {
+	at     string
+	source string
+}
+
+func (c updatePathConflict) message(path string) string {
+	return fmt.Sprintf("updating the path '%s' would create a conflict at '%s' with %s", path, c.at, c.source)
+}
+
+// updatePathConflicts compares path with every path in paths,
+// returns conflicts when one is equal to or a prefix of another,
+// sorted by updated path.
+// paths maps updated path to its source.
+func updatePathConflicts(paths map[string]string, path string) []updatePathConflict {
+	var keys = make([]string, 0, len(paths))
+	for k := range paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var ret []updatePathConflict
+	for _, k := range keys {
+		switch {
+		case k == path, strings.HasPrefix(path, k+"."):
+			ret = append(ret, updatePathConflict{k, paths[k]})
+		case strings.HasPrefix(k, path+"."):
+			ret = append(ret, updatePathConflict{path, paths[k]})
+		}
+	}
+	return ret
+}
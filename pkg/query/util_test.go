@@ -4,9 +4,48 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMergeOperators(t *testing.T) {
 	res := MergeOperators(M{"a": 1}, M{"b": 2}, M{"a": 3})
 	assert.Equal(t, M{"a": 3, "b": 2}, res)
 }
+
+func TestMergeOperatorsDeep(t *testing.T) {
+	res, err := MergeOperatorsDeep(
+		Set(M{"a": 1}),
+		Set(D{{Key: "b", Value: 2}}),
+		MergeOperators(Inc(M{"n": 1}), Rename(M{"x": "y"})),
+		Push(M{"tags": Each(A{"x"}).Slice(-5)}),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, M{
+		"$set":    M{"a": 1, "b": 2},
+		"$inc":    M{"n": 1},
+		"$rename": M{"x": "y"},
+		"$push":   M{"tags": Each(A{"x"}).Slice(-5)},
+	}, res)
+	assert.Empty(t, ValidateUpdate(res))
+
+	for _, c := range []struct {
+		operators []M
+		err       string
+	}{
+		{[]M{Set(M{"a.b": 1}), Unset(M{"a": ""})}, "$unset.a: updating the path 'a' would create a conflict at 'a' with $set.a.b"},
+		{[]M{Inc(M{"n": 1}), Set(M{"n": 2})}, "$set.n: updating the path 'n' would create a conflict at 'n' with $inc.n"},
+		{[]M{Set(M{"a": 1}), Set(M{"a": 2})}, "$set.a: updating the path 'a' would create a conflict at 'a' with $set.a"},
+		{[]M{Set(M{"y.z": 1}), Rename(M{"x": "y"})}, "$rename.x: updating the path 'y' would create a conflict at 'y' with $set.y.z"},
+		{[]M{Set(M{"a.b": 1, "a-b": 1}), Unset(M{"a": ""})}, "$unset.a: updating the path 'a' would create a conflict at 'a' with $set.a.b"},
+		{[]M{{"a": 1}}, "a: not an update operator"},
+	} {
+		_, err := MergeOperatorsDeep(c.operators...)
+		assert.EqualError(t, err, c.err)
+	}
+
+	// same conflicts as ValidateUpdate
+	var update = MergeOperators(Set(M{"a.b": 1, "a-b": 1}), Unset(M{"a": ""}))
+	_, err = MergeOperatorsDeep(update)
+	assert.Error(t, err)
+	assert.NotEmpty(t, ValidateUpdate(update))
+}
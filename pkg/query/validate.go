@@ -0,0 +1,555 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Issue is a structural problem found by Validate.
+type Issue struct {
+	// Path locates the offending value in validated document,
+	// keys are joined by "." and array indexes are written as "[i]",
+	// e.g. "$or[1].age.$in".
+	Path    string
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Path == "" {
+		return i.Message
+	}
+	return i.Path + ": " + i.Message
+}
+
+// JoinPath appends key to a validation issue path.
+func JoinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// IndexPath appends array index to a validation issue path.
+func IndexPath(path string, index int) string {
+	return path + "[" + strconv.Itoa(index) + "]"
+}
+
+type validator struct {
+	issues []Issue
+}
+
+func (v *validator) report(path, format string, args ...interface{}) {
+	v.issues = append(v.issues, Issue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate walks a filter document built with this package and
+// reports structural problems that would be rejected by server,
+// e.g. non-array argument to $and, unknown operators,
+// or $options without $regex.
+//
+// Update documents are validated as well when every top level key
+// is an update operator, see ValidateUpdate.
+//
+// It does not require a server and returns nil when no issue found.
+func Validate(filter interface{}) []Issue {
+	d, err := bsonutil.Doc(filter)
+	if err != nil {
+		return []Issue{{Message: err.Error()}}
+	}
+	for _, e := range d {
+		if isUpdateOperator(e.Key) {
+			return validateUpdate(d)
+		}
+	}
+	var v = new(validator)
+	v.filter("", d)
+	return v.issues
+}
+
+// ValidateUpdate walks an update document built with this package
+// and reports structural problems, e.g. mixing update operators with
+// replacement fields, non-numeric $inc value or conflicting paths.
+//
+// Pipeline updates (array of stages) are checked for allowed stage names only,
+// use aggregation.Validate for the stages themselves.
+func ValidateUpdate(update interface{}) []Issue {
+	n, err := bsonutil.Normalize(update)
+	if err != nil {
+		return []Issue{{Message: err.Error()}}
+	}
+	switch n := n.(type) {
+	case primitive.D:
+		return validateUpdate(n)
+	case primitive.A:
+		var v = new(validator)
+		v.updatePipeline(n)
+		return v.issues
+	}
+	return []Issue{{Message: fmt.Sprintf("update must be a document or an array, got %T", update)}}
+}
+
+// ValidateFilter is like Validate, but always treats doc as a filter.
+func ValidateFilter(filter interface{}) []Issue {
+	d, err := bsonutil.Doc(filter)
+	if err != nil {
+		return []Issue{{Message: err.Error()}}
+	}
+	var v = new(validator)
+	v.filter("", d)
+	return v.issues
+}
+
+func validateUpdate(d primitive.D) []Issue {
+	var v = new(validator)
+	v.update(d)
+	return v.issues
+}
+
+func (v *validator) filter(path string, d primitive.D) {
+	for _, e := range d {
+		var p = JoinPath(path, e.Key)
+		if strings.HasPrefix(e.Key, "$") {
+			v.topLevelOperator(p, e.Key, e.Value)
+			continue
+		}
+		if e.Key == "" {
+			v.report(p, "field name must not be empty")
+		}
+		v.fieldValue(p, e.Value)
+	}
+}
+
+func (v *validator) docList(path, op string, value interface{}) {
+	a, ok := value.(primitive.A)
+	if !ok {
+		v.report(path, "%s argument must be an array", op)
+		return
+	}
+	if len(a) == 0 {
+		v.report(path, "%s argument must be a nonempty array", op)
+		return
+	}
+	for index, i := range a {
+		var p = IndexPath(path, index)
+		d, ok := i.(primitive.D)
+		if !ok {
+			v.report(p, "%s argument's entries must be documents", op)
+			continue
+		}
+		v.filter(p, d)
+	}
+}
+
+func (v *validator) topLevelOperator(path, op string, value interface{}) {
+	switch op {
+	case "$and", "$or", "$nor":
+		v.docList(path, op, value)
+	case "$text":
+		d, ok := value.(primitive.D)
+		if !ok {
+			v.report(path, "$text argument must be a document")
+			return
+		}
+		if s, ok := bsonutil.Get(d, "$search"); !ok {
+			v.report(path, "$text requires $search")
+		} else if _, ok := s.(string); !ok {
+			v.report(JoinPath(path, "$search"), "$search must be a string")
+		}
+	case "$where":
+		switch value.(type) {
+		case string, primitive.JavaScript, primitive.CodeWithScope:
+		default:
+			v.report(path, "$where argument must be a string or javascript code")
+		}
+	case "$jsonSchema":
+		if _, ok := value.(primitive.D); !ok {
+			v.report(path, "$jsonSchema argument must be a document")
+		}
+	case "$sampleRate":
+		if f, ok := bsonutil.Float64(value); !ok || f < 0 || f > 1 {
+			v.report(path, "$sampleRate argument must be a number between 0 and 1")
+		}
+	case "$expr", "$comment":
+	default:
+		v.report(path, "unknown top level operator: %s", op)
+	}
+}
+
+func (v *validator) fieldValue(path string, value interface{}) {
+	d, ok := value.(primitive.D)
+	if !ok || len(d) == 0 || !strings.HasPrefix(d[0].Key, "$") {
+		return
+	}
+	var _, hasRegex = bsonutil.Get(d, "$regex")
+	for _, e := range d {
+		var p = JoinPath(path, e.Key)
+		if !strings.HasPrefix(e.Key, "$") {
+			v.report(p, "cannot mix operators and fields in a field condition, unknown operator: %s", e.Key)
+			continue
+		}
+		if e.Key == "$options" {
+			if !hasRegex {
+				v.report(p, "$options needs a $regex")
+			} else if _, ok := e.Value.(string); !ok {
+				v.report(p, "$options has to be a string")
+			}
+			continue
+		}
+		v.fieldOperator(p, e.Key, e.Value)
+	}
+}
+
+func (v *validator) fieldOperator(path, op string, value interface{}) {
+	switch op {
+	case "$eq", "$ne", "$gt", "$gte", "$lt", "$lte", "$exists", "$comment":
+	case "$in", "$nin", "$all":
+		if _, ok := value.(primitive.A); !ok {
+			v.report(path, "%s needs an array", op)
+		}
+	case "$size":
+		if n, ok := bsonutil.Int64(value); !ok || n < 0 {
+			v.report(path, "$size needs a non-negative integer")
+		}
+	case "$mod":
+		if a, ok := value.(primitive.A); !ok || len(a) != 2 || !bsonutil.IsNumber(a[0]) || !bsonutil.IsNumber(a[1]) {
+			v.report(path, "$mod needs an array of divisor and remainder numbers")
+		} else if n, _ := bsonutil.Float64(a[0]); n == 0 {
+			v.report(path, "$mod divisor must not be 0")
+		}
+	case "$regex":
+		switch value.(type) {
+		case string, primitive.Regex:
+		default:
+			v.report(path, "$regex has to be a string")
+		}
+	case "$type":
+		v.typeSpec(path, value)
+	case "$elemMatch":
+		d, ok := value.(primitive.D)
+		if !ok {
+			v.report(path, "$elemMatch needs a document")
+			return
+		}
+		if isOperatorDoc(d) && !isDocOperator(d[0].Key) {
+			v.fieldValue(path, d)
+		} else {
+			v.filter(path, d)
+		}
+	case "$not":
+		switch value := value.(type) {
+		case primitive.Regex:
+		case primitive.D:
+			if len(value) == 0 {
+				v.report(path, "$not cannot be empty")
+				return
+			}
+			if !isOperatorDoc(value) {
+				v.report(path, "$not needs a regex or a document of operators")
+				return
+			}
+			v.fieldValue(path, value)
+		default:
+			v.report(path, "$not needs a regex or a document")
+		}
+	case "$bitsAllClear", "$bitsAllSet", "$bitsAnyClear", "$bitsAnySet":
+		switch value := value.(type) {
+		case primitive.Binary:
+		case primitive.A:
+			for index, i := range value {
+				if n, ok := bsonutil.Int64(i); !ok || n < 0 {
+					v.report(IndexPath(path, index), "bit positions must be non-negative integers")
+				}
+			}
+		default:
+			if n, ok := bsonutil.Int64(value); !ok || n < 0 {
+				v.report(path, "%s takes a non-negative integer bitmask, a BinData or an array of bit positions", op)
+			}
+		}
+	case "$geoWithin", "$geoIntersects":
+		if _, ok := value.(primitive.D); !ok {
+			v.report(path, "%s needs a document", op)
+		}
+	case "$near", "$nearSphere":
+		switch value.(type) {
+		case primitive.D, primitive.A:
+		default:
+			v.report(path, "%s needs a document or legacy coordinate pair", op)
+		}
+	case "$maxDistance", "$minDistance":
+		if n, ok := bsonutil.Float64(value); !ok || n < 0 {
+			v.report(path, "%s must be a non-negative number", op)
+		}
+	case "$geometry", "$box", "$polygon", "$center", "$centerSphere":
+	default:
+		v.report(path, "unknown operator: %s", op)
+	}
+}
+
+func (v *validator) typeSpec(path string, value interface{}) {
+	var check = func(path string, i interface{}) {
+		switch i := i.(type) {
+		case string:
+			if i == "number" {
+				return
+			}
+			if _, ok := bsonutil.TypeFromAlias(i); !ok {
+				v.report(path, "unknown type name alias: %s", i)
+			}
+		default:
+			if !bsonutil.IsNumber(i) {
+				v.report(path, "type must be represented as a number or a string")
+			}
+		}
+	}
+	if a, ok := value.(primitive.A); ok {
+		if len(a) == 0 {
+			v.report(path, "$type must match at least one type")
+		}
+		for index, i := range a {
+			check(IndexPath(path, index), i)
+		}
+		return
+	}
+	check(path, value)
+}
+
+var updateOperators = map[string]bool{
+	"$currentDate": true,
+	"$inc":         true,
+	"$min":         true,
+	"$max":         true,
+	"$mul":         true,
+	"$rename":      true,
+	"$set":         true,
+	"$setOnInsert": true,
+	"$unset":       true,
+	"$addToSet":    true,
+	"$pop":         true,
+	"$pull":        true,
+	"$push":        true,
+	"$pullAll":     true,
+	"$bit":         true,
+}
+
+func isUpdateOperator(key string) bool {
+	return updateOperators[key]
+}
+
+var updatePipelineStages = map[string]bool{
+	"$addFields":   true,
+	"$set":         true,
+	"$project":     true,
+	"$unset":       true,
+	"$replaceRoot": true,
+	"$replaceWith": true,
+}
+
+func (v *validator) updatePipeline(a primitive.A) {
+	for index, i := range a {
+		var p = IndexPath("", index)
+		d, ok := i.(primitive.D)
+		if !ok || len(d) != 1 {
+			v.report(p, "pipeline stage must be a document with exactly one field")
+			continue
+		}
+		if !updatePipelineStages[d[0].Key] {
+			v.report(JoinPath(p, d[0].Key), "%s is not allowed to be used within an update", d[0].Key)
+		}
+	}
+}
+
+func (v *validator) update(d primitive.D) {
+	var operators, fields []string
+	for _, e := range d {
+		if strings.HasPrefix(e.Key, "$") {
+			operators = append(operators, e.Key)
+		} else {
+			fields = append(fields, e.Key)
+		}
+	}
+	if len(operators) == 0 {
+		// replacement document
+		return
+	}
+	for _, i := range fields {
+		v.report(i, "update document cannot mix update operators and replacement fields")
+	}
+
+	var paths = map[string]string{}
+	for _, e := range d {
+		if !strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+		if !isUpdateOperator(e.Key) {
+			v.report(e.Key, "unknown modifier: %s", e.Key)
+			continue
+		}
+		args, ok := e.Value.(primitive.D)
+		if !ok {
+			v.report(e.Key, "modifier %s's argument must be a document", e.Key)
+			continue
+		}
+		for _, arg := range args {
+			var p = JoinPath(e.Key, arg.Key)
+			v.updatePath(p, arg.Key)
+			v.updateOperator(p, e.Key, arg.Value)
+			var updated = []string{arg.Key}
+			if e.Key == "$rename" {
+				if to, ok := arg.Value.(string); ok && to != "" {
+					if to == arg.Key {
+						v.report(p, "$rename source and target must differ")
+					}
+					updated = append(updated, to)
+				}
+			}
+			for _, i := range updated {
+				var conflicts = updatePathConflicts(paths, i)
+				for _, c := range conflicts {
+					v.report(p, "%s", c.message(i))
+				}
+				if len(conflicts) == 0 {
+					paths[i] = p
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) updatePath(path, field string) {
+	if field == "" {
+		v.report(path, "field name must not be empty")
+		return
+	}
+	for _, i := range strings.Split(field, ".") {
+		switch {
+		case i == "":
+			v.report(path, "field path must not contain empty element")
+			return
+		case i == "$" || i == "$[]" || strings.HasPrefix(i, "$[") && strings.HasSuffix(i, "]"):
+			// positional operators
+		case strings.HasPrefix(i, "$"):
+			v.report(path, "field name must not start with '$': %s", i)
+			return
+		}
+	}
+}
+
+func (v *validator) updateOperator(path, op string, value interface{}) {
+	switch op {
+	case "$inc", "$mul":
+		if !bsonutil.IsNumber(value) {
+			v.report(path, "cannot %s with non-numeric argument", op)
+		}
+	case "$rename":
+		to, ok := value.(string)
+		if !ok || to == "" {
+			v.report(path, "$rename target must be a non-empty string")
+			return
+		}
+		if strings.HasPrefix(to, "$") {
+			v.report(path, "$rename target must not start with '$'")
+		}
+	case "$pop":
+		if n, ok := bsonutil.Float64(value); !ok || (n != 1 && n != -1) {
+			v.report(path, "$pop expects 1 or -1")
+		}
+	case "$pullAll":
+		if _, ok := value.(primitive.A); !ok {
+			v.report(path, "$pullAll requires an array argument")
+		}
+	case "$currentDate":
+		switch value := value.(type) {
+		case bool:
+		case primitive.D:
+			t, ok := bsonutil.Get(value, "$type")
+			if len(value) != 1 || !ok || (t != "date" && t != "timestamp") {
+				v.report(path, "$currentDate expects true or {$type: 'date' | 'timestamp'}")
+			}
+		default:
+			v.report(path, "$currentDate expects true or {$type: 'date' | 'timestamp'}")
+		}
+	case "$bit":
+		d, ok := value.(primitive.D)
+		if !ok || len(d) == 0 {
+			v.report(path, "$bit requires a document of and, or, xor")
+			return
+		}
+		for _, e := range d {
+			switch e.Key {
+			case "and", "or", "xor":
+				switch e.Value.(type) {
+				case int32, int64:
+				default:
+					v.report(JoinPath(path, e.Key), "$bit value must be an integer")
+				}
+			default:
+				v.report(JoinPath(path, e.Key), "$bit only supports and, or, xor")
+			}
+		}
+	case "$push", "$addToSet":
+		v.pushModifiers(path, op, value)
+	case "$pull":
+		if d, ok := value.(primitive.D); ok {
+			if isOperatorDoc(d) && !isDocOperator(d[0].Key) {
+				v.fieldValue(path, d)
+			} else {
+				v.filter(path, d)
+			}
+		}
+	}
+}
+
+func (v *validator) pushModifiers(path, op string, value interface{}) {
+	d, ok := value.(primitive.D)
+	if !ok {
+		return
+	}
+	each, hasEach := bsonutil.Get(d, "$each")
+	if !hasEach {
+		if isOperatorDoc(d) {
+			v.report(path, "%s modifiers require $each", op)
+		}
+		return
+	}
+	if _, ok := each.(primitive.A); !ok {
+		v.report(JoinPath(path, "$each"), "$each requires an array")
+	}
+	for _, e := range d {
+		var p = JoinPath(path, e.Key)
+		if e.Key == "$each" {
+			continue
+		}
+		if op == "$addToSet" {
+			v.report(p, "$addToSet only supports $each modifier")
+			continue
+		}
+		switch e.Key {
+		case "$slice", "$position":
+			if _, ok := bsonutil.Int64(e.Value); !ok {
+				v.report(p, "%s requires an integer", e.Key)
+			}
+		case "$sort":
+			switch s := e.Value.(type) {
+			case primitive.D:
+				if len(s) == 0 {
+					v.report(p, "$sort requires a non-empty document")
+				}
+				for _, i := range s {
+					if n, ok := bsonutil.Float64(i.Value); !ok || (n != 1 && n != -1) {
+						v.report(JoinPath(p, i.Key), "$sort value must be 1 or -1")
+					}
+				}
+			default:
+				if n, ok := bsonutil.Float64(s); !ok || (n != 1 && n != -1) {
+					v.report(p, "$sort value must be 1, -1 or a document")
+				}
+			}
+		default:
+			v.report(p, "unrecognized clause in $push: %s", e.Key)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		doc  interface{}
+		want []Issue
+	}{
+		{"empty", M{}, nil},
+		{"valid filter", And(
+			M{"name": In(A{"foo", "bar"})},
+			M{"age": MergeOperators(Gte(18), Lt(65))},
+			M{"tags": ElemMatch(M{"$eq": "a"})},
+			M{"name": Not(Regex(primitive.Regex{Pattern: "^f"}))},
+			M{"flags": BitsAllSet(A{1, 5})},
+		), nil},
+		{"and not array", M{"$and": M{"name": "foo"}}, []Issue{
+			{"$and", "$and argument must be an array"},
+		}},
+		{"or empty", M{"$or": A{}}, []Issue{
+			{"$or", "$or argument must be a nonempty array"},
+		}},
+		{"or entry", Or(M{"name": "foo"}, "bar"), []Issue{
+			{"$or[1]", "$or argument's entries must be documents"},
+		}},
+		{"nested", Or(M{"name": "foo"}, M{"age": M{"$in": 1}}), []Issue{
+			{"$or[1].age.$in", "$in needs an array"},
+		}},
+		{"unknown top level operator", M{"$foo": 1}, []Issue{
+			{"$foo", "unknown top level operator: $foo"},
+		}},
+		{"unknown operator", M{"age": M{"$foo": 1}}, []Issue{
+			{"age.$foo", "unknown operator: $foo"},
+		}},
+		{"mixed operator", bson.D{{Key: "age", Value: bson.D{{Key: "$gt", Value: 1}, {Key: "x", Value: 1}}}}, []Issue{
+			{"age.x", "cannot mix operators and fields in a field condition, unknown operator: x"},
+		}},
+		{"options without regex", M{"name": M{"$options": "i"}}, []Issue{
+			{"name.$options", "$options needs a $regex"},
+		}},
+		{"size", M{"tags": Size(-1)}, []Issue{
+			{"tags.$size", "$size needs a non-negative integer"},
+		}},
+		{"type alias", M{"age": Type(A{"int", "integer"})}, []Issue{
+			{"age.$type[1]", "unknown type name alias: integer"},
+		}},
+		{"not", M{"age": Not(18)}, []Issue{
+			{"age.$not", "$not needs a regex or a document"},
+		}},
+		{"mod", M{"age": M{"$mod": A{0, 1}}}, []Issue{
+			{"age.$mod", "$mod divisor must not be 0"},
+		}},
+		{"valid update", bson.D{
+			{Key: "$set", Value: M{"name": "foo", "tags.$": "b"}},
+			{Key: "$inc", Value: M{"age": 1}},
+			{Key: "$push", Value: M{"items": Each(A{1, 2}).Slice(-5).Sort(Desc("score"))}},
+			{Key: "$rename", Value: M{"nick": "alias"}},
+			{Key: "$currentDate", Value: M{"updated": M{"$type": "timestamp"}}},
+		}, nil},
+		{"update mixed replacement", bson.D{
+			{Key: "$set", Value: M{"name": "foo"}},
+			{Key: "age", Value: 1},
+		}, []Issue{
+			{"age", "update document cannot mix update operators and replacement fields"},
+		}},
+		{"update argument", Set(1), []Issue{
+			{"$set", "modifier $set's argument must be a document"},
+		}},
+		{"update non-numeric", Inc(M{"age": "1"}), []Issue{
+			{"$inc.age", "cannot $inc with non-numeric argument"},
+		}},
+		{"update conflict", bson.D{
+			{Key: "$set", Value: M{"name": "foo"}},
+			{Key: "$unset", Value: M{"name": ""}},
+		}, []Issue{
+			{"$unset.name", "updating the path 'name' would create a conflict at 'name' with $set.name"},
+		}},
+		{"update prefix conflict", Set(bson.D{
+			{Key: "a", Value: 1},
+			{Key: "a.b", Value: 1},
+		}), []Issue{
+			{"$set.a.b", "updating the path 'a.b' would create a conflict at 'a' with $set.a"},
+		}},
+		{"update prefix conflict with sibling", bson.D{
+			{Key: "$set", Value: bson.D{{Key: "a.b", Value: 1}, {Key: "a-b", Value: 1}}},
+			{Key: "$unset", Value: bson.D{{Key: "a", Value: ""}}},
+		}, []Issue{
+			{"$unset.a", "updating the path 'a' would create a conflict at 'a' with $set.a.b"},
+		}},
+		{"update prefix conflict with children", bson.D{
+			{Key: "$set", Value: bson.D{{Key: "a.b", Value: 1}, {Key: "a.c", Value: 1}}},
+			{Key: "$unset", Value: bson.D{{Key: "a", Value: ""}}},
+		}, []Issue{
+			{"$unset.a", "updating the path 'a' would create a conflict at 'a' with $set.a.b"},
+			{"$unset.a", "updating the path 'a' would create a conflict at 'a' with $set.a.c"},
+		}},
+		{"update field name", Set(M{"a.$foo": 1}), []Issue{
+			{"$set.a.$foo", "field name must not start with '$': $foo"},
+		}},
+		{"update pop", Pop(M{"tags": 2}), []Issue{
+			{"$pop.tags", "$pop expects 1 or -1"},
+		}},
+		{"update each", AddToSet(M{"tags": Each("a").Slice(1)}), []Issue{
+			{"$addToSet.tags.$each", "$each requires an array"},
+			{"$addToSet.tags.$slice", "$addToSet only supports $each modifier"},
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, Validate(c.doc))
+		})
+	}
+}
+
+func TestValidateUpdate(t *testing.T) {
+	assert.Nil(t, ValidateUpdate(M{"name": "foo"}))
+	assert.Nil(t, ValidateUpdate(A{M{"$set": M{"a": 1}}, M{"$unset": "b"}}))
+	assert.Equal(t, []Issue{
+		{"[1].$match", "$match is not allowed to be used within an update"},
+	}, ValidateUpdate(A{M{"$set": M{"a": 1}}, M{"$match": M{}}}))
+	assert.Equal(t, []Issue{
+		{"", "update must be a document or an array, got int"},
+	}, ValidateUpdate(1))
+}
@@ -0,0 +1,324 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/NateScarlet/mongo-operators/pkg/internal/bsonutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Version is a MongoDB server version, e.g. "4.4" or "4.4.2".
+// Empty version is earlier than any other version.
+type Version string
+
+// Compare returns -1 if v is earlier than other, 1 if later, 0 if same.
+// Missing parts are treated as 0, so "4.4" equals to "4.4.0".
+func (v Version) Compare(other Version) int {
+	var a, b = v.parts(), other.parts()
+	for len(a) < len(b) {
+		a = append(a, 0)
+	}
+	for len(b) < len(a) {
+		b = append(b, 0)
+	}
+	for index := range a {
+		switch {
+		case a[index] < b[index]:
+			return -1
+		case a[index] > b[index]:
+			return 1
+		}
+	}
+	return 0
+}
+
+func (v Version) parts() []int {
+	if v == "" {
+		return nil
+	}
+	var s = strings.Split(string(v), ".")
+	var ret = make([]int, len(s))
+	for index, i := range s {
+		ret[index], _ = strconv.Atoi(i)
+	}
+	return ret
+}
+
+// Incompatibility is an operator that requires a newer server version,
+// it is returned from CheckCompatibility.
+type Incompatibility struct {
+	// Path locates the operator in checked document, see Issue.
+	Path     string
+	Operator string
+	// Since is the first server version that supports the operator.
+	Since Version
+	// Unknown is true when Operator is not a known operator,
+	// or the checked value can not be analyzed (Operator is empty),
+	// it is reported for every version.
+	Unknown bool
+}
+
+// String describes i, e.g. "$expr: $expr requires 3.6".
+func (i Incompatibility) String() string {
+	var ret string
+	if i.Path != "" {
+		ret = i.Path + ": "
+	}
+	switch {
+	case i.Unknown && i.Operator == "":
+		return ret + "can not be analyzed"
+	case i.Unknown:
+		return ret + "unknown operator " + i.Operator
+	}
+	return ret + i.Operator + " requires " + string(i.Since)
+}
+
+// QueryOperatorVersions maps query operators to the first server version supports them.
+// Empty version means available in every server version this package targets.
+var QueryOperatorVersions = map[string]Version{
+	"$all":           "",
+	"$and":           "",
+	"$bitsAllClear":  "3.2",
+	"$bitsAllSet":    "3.2",
+	"$bitsAnyClear":  "3.2",
+	"$bitsAnySet":    "3.2",
+	"$box":           "",
+	"$center":        "",
+	"$centerSphere":  "",
+	"$comment":       "",
+	"$elemMatch":     "",
+	"$eq":            "",
+	"$exists":        "",
+	"$expr":          "3.6",
+	"$geoIntersects": "",
+	"$geometry":      "",
+	"$geoWithin":     "",
+	"$gt":            "",
+	"$gte":           "",
+	"$in":            "",
+	"$jsonSchema":    "3.6",
+	"$lt":            "",
+	"$lte":           "",
+	"$maxDistance":   "",
+	"$minDistance":   "",
+	"$mod":           "",
+	"$ne":            "",
+	"$near":          "",
+	"$nearSphere":    "",
+	"$nin":           "",
+	"$nor":           "",
+	"$not":           "",
+	"$options":       "",
+	"$or":            "",
+	"$polygon":       "",
+	"$regex":         "",
+	"$sampleRate":    "4.4.2",
+	"$size":          "",
+	"$text":          "",
+	"$type":          "",
+	"$where":         "",
+}
+
+// UpdateOperatorVersions maps update operators, modifiers and
+// positional operators to the first server version supports them.
+// Empty version means available in every server version this package targets.
+var UpdateOperatorVersions = map[string]Version{
+	"$":             "",
+	"$[]":           "3.6",
+	"$[identifier]": "3.6",
+	"$addToSet":     "",
+	"$bit":          "",
+	"$currentDate":  "",
+	"$each":         "",
+	"$inc":          "",
+	"$max":          "",
+	"$min":          "",
+	"$mul":          "",
+	"$pop":          "",
+	"$position":     "",
+	"$pull":         "",
+	"$pullAll":      "",
+	"$push":         "",
+	"$rename":       "",
+	"$set":          "",
+	"$setOnInsert":  "",
+	"$slice":        "",
+	"$sort":         "",
+	"$unset":        "",
+}
+
+// MinServerVersion returns the earliest server version that supports
+// every operator used in a filter or update document.
+// Aggregation expressions inside $expr are not inspected,
+// use aggregation.MinServerVersion with a $match stage for them.
+// It returns error when doc contains unknown operator or can not be analyzed,
+// e.g. an update pipeline.
+func MinServerVersion(doc interface{}) (Version, error) {
+	return minServerVersion(CheckCompatibility(doc, ""))
+}
+
+func minServerVersion(incompatibilities []Incompatibility) (Version, error) {
+	var ret Version
+	for _, i := range incompatibilities {
+		if i.Unknown {
+			return "", fmt.Errorf("query: %s", i)
+		}
+		if i.Since.Compare(ret) > 0 {
+			ret = i.Since
+		}
+	}
+	return ret, nil
+}
+
+// CheckCompatibility lists operators used in a filter or update document
+// that are not supported by server of given version.
+// Unknown operators are always reported, and an unknown Incompatibility
+// is returned if doc is not a document.
+func CheckCompatibility(doc interface{}, version Version) []Incompatibility {
+	d, err := bsonutil.Doc(doc)
+	if err != nil {
+		return []Incompatibility{{Unknown: true}}
+	}
+	var c = &compatibility{version: version}
+	var isUpdate bool
+	for _, e := range d {
+		if isUpdateOperator(e.Key) {
+			isUpdate = true
+		}
+	}
+	if isUpdate {
+		c.update(d)
+	} else {
+		c.filter("", d)
+	}
+	return c.ret
+}
+
+// CheckFilterCompatibility is CheckCompatibility for a filter document,
+// update operators in it are reported as unknown.
+func CheckFilterCompatibility(filter interface{}, version Version) []Incompatibility {
+	d, err := bsonutil.Doc(filter)
+	if err != nil {
+		return []Incompatibility{{Unknown: true}}
+	}
+	var c = &compatibility{version: version}
+	c.filter("", d)
+	return c.ret
+}
+
+type compatibility struct {
+	version Version
+	ret     []Incompatibility
+}
+
+func (c *compatibility) require(path, operator string, since Version) {
+	if since.Compare(c.version) > 0 {
+		c.ret = append(c.ret, Incompatibility{Path: path, Operator: operator, Since: since})
+	}
+}
+
+func (c *compatibility) unknown(path, operator string) {
+	c.ret = append(c.ret, Incompatibility{Path: path, Operator: operator, Unknown: true})
+}
+
+// lookup requires version of operator in registry.
+func (c *compatibility) lookup(path, operator string, registry map[string]Version) {
+	if since, ok := registry[operator]; ok {
+		c.require(path, operator, since)
+	} else {
+		c.unknown(path, operator)
+	}
+}
+
+func (c *compatibility) operator(path, operator string) {
+	c.lookup(path, operator, QueryOperatorVersions)
+}
+
+func (c *compatibility) filter(path string, d primitive.D) {
+	for _, e := range d {
+		var p = JoinPath(path, e.Key)
+		if !strings.HasPrefix(e.Key, "$") {
+			c.fieldValue(p, e.Value)
+			continue
+		}
+		c.operator(p, e.Key)
+		switch e.Key {
+		case "$and", "$or", "$nor":
+			var a, _ = e.Value.(primitive.A)
+			for index, i := range a {
+				if i, ok := i.(primitive.D); ok {
+					c.filter(IndexPath(p, index), i)
+				}
+			}
+		}
+	}
+}
+
+func (c *compatibility) fieldValue(path string, value interface{}) {
+	if !isOperatorDoc(value) {
+		return
+	}
+	for _, e := range value.(primitive.D) {
+		var p = JoinPath(path, e.Key)
+		c.operator(p, e.Key)
+		switch e.Key {
+		case "$not":
+			c.fieldValue(p, e.Value)
+		case "$elemMatch":
+			if d, ok := e.Value.(primitive.D); ok {
+				if isOperatorDoc(d) && !isDocOperator(d[0].Key) {
+					c.fieldValue(p, d)
+				} else {
+					c.filter(p, d)
+				}
+			}
+		case "$geoWithin", "$geoIntersects", "$near", "$nearSphere":
+			if d, ok := e.Value.(primitive.D); ok {
+				for _, i := range d {
+					c.operator(JoinPath(p, i.Key), i.Key)
+				}
+			}
+		}
+	}
+}
+
+func (c *compatibility) update(d primitive.D) {
+	for _, e := range d {
+		c.lookup(e.Key, e.Key, UpdateOperatorVersions)
+		args, _ := e.Value.(primitive.D)
+		for _, arg := range args {
+			var p = JoinPath(e.Key, arg.Key)
+			c.updatePath(p, arg.Key)
+			switch e.Key {
+			case "$push", "$addToSet":
+				if d, ok := arg.Value.(primitive.D); ok && isOperatorDoc(d) {
+					for _, i := range d {
+						c.lookup(JoinPath(p, i.Key), i.Key, UpdateOperatorVersions)
+					}
+				}
+			case "$pull":
+				if d, ok := arg.Value.(primitive.D); ok {
+					if isOperatorDoc(d) && !isDocOperator(d[0].Key) {
+						c.fieldValue(p, d)
+					} else {
+						c.filter(p, d)
+					}
+				}
+			}
+		}
+	}
+}
+
+// updatePath checks positional operators in field path.
+func (c *compatibility) updatePath(path, field string) {
+	for _, i := range strings.Split(field, ".") {
+		switch {
+		case i == "$" || i == "$[]":
+			c.require(path, i, UpdateOperatorVersions[i])
+		case strings.HasPrefix(i, "$[") && strings.HasSuffix(i, "]"):
+			c.require(path, "$[identifier]", UpdateOperatorVersions["$[identifier]"])
+		}
+	}
+}
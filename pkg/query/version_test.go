@@ -0,0 +1,77 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestVersionCompare(t *testing.T) {
+	assert.Equal(t, 0, Version("4.4").Compare("4.4.0"))
+	assert.Equal(t, -1, Version("4.4").Compare("4.4.2"))
+	assert.Equal(t, 1, Version("10.0").Compare("4.4"))
+	assert.Equal(t, -1, Version("").Compare("2.6"))
+	assert.Equal(t, 0, Version("").Compare(""))
+}
+
+func TestMinServerVersion(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		doc  interface{}
+		want Version
+	}{
+		{"empty", M{}, ""},
+		{"basic", M{"name": In(A{"foo"}), "age": Gt(1)}, ""},
+		{"bits", M{"flags": BitsAllSet(1)}, "3.2"},
+		{"nested", Or(M{"a": 1}, M{"b": ElemMatch(M{"c": BitsAnySet(1)})}), "3.2"},
+		{"expr", bson.D{{Key: "$expr", Value: M{"$dateAdd": M{}}}, {Key: "flags", Value: BitsAllSet(1)}}, "3.6"},
+		{"update", Set(M{"items.$[].qty": 1}), "3.6"},
+		{"update pull", Pull(M{"tags": M{"$bitsAllSet": 1}}), "3.2"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := MinServerVersion(c.doc)
+			require.NoError(t, err)
+			assert.Equal(t, c.want, got)
+		})
+	}
+
+	for _, c := range []struct {
+		name string
+		doc  interface{}
+		err  string
+	}{
+		{"unknown operator", M{"a": M{"$foo": 1}}, "query: a.$foo: unknown operator $foo"},
+		{"unknown update operator", M{"$foo": M{"a": 1}, "$set": M{"b": 1}}, "query: $foo: unknown operator $foo"},
+		{"update pipeline", A{M{"$set": M{"a": 1}}}, "query: can not be analyzed"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := MinServerVersion(c.doc)
+			assert.EqualError(t, err, c.err)
+		})
+	}
+}
+
+func TestCheckCompatibility(t *testing.T) {
+	var filter = And(
+		M{"flags": BitsAllSet(1)},
+		Expr(M{"$eq": A{"$a", "$b"}}),
+		M{"$sampleRate": 0.5},
+	)
+	assert.Equal(t, []Incompatibility{
+		{"$and[1].$expr", "$expr", "3.6", false},
+		{"$and[2].$sampleRate", "$sampleRate", "4.4.2", false},
+	}, CheckCompatibility(filter, "3.4"))
+	assert.Equal(t, []Incompatibility{
+		{"$and[2].$sampleRate", "$sampleRate", "4.4.2", false},
+	}, CheckCompatibility(filter, "4.4"))
+	assert.Nil(t, CheckCompatibility(filter, "4.4.2"))
+	assert.Equal(t, []Incompatibility{
+		{"$set.items.$[i].qty", "$[identifier]", "3.6", false},
+	}, CheckCompatibility(Set(M{"items.$[i].qty": 1}), "3.4"))
+	assert.Equal(t, []Incompatibility{
+		{"$set", "$set", "", true},
+	}, CheckFilterCompatibility(Set(M{"a": 1}), "7.0"))
+	assert.Equal(t, []Incompatibility{{Unknown: true}}, CheckCompatibility(1, "7.0"))
+}
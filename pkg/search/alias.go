@@ -0,0 +1,15 @@
+package search
+
+import (
+	"github.com/NateScarlet/mongo-operators/pkg/query"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// An A alias primitive.A
+type A = primitive.A
+
+// M alias primitive.M
+type M = primitive.M
+
+// Path alias query.Path
+type Path = query.Path
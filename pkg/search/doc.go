@@ -0,0 +1,11 @@
+// Package search contains helper functions to construct
+// [Atlas Search](https://docs.atlas.mongodb.com/atlas-search/) queries,
+// used as argument of aggregation.Search and aggregation.SearchMeta:
+//
+//	q, err := search.New(
+//		search.Compound().
+//			Must(search.Text("title", "mongo")).
+//			Filter(search.Range("year").SetGte(2000)),
+//	)
+//	aggregation.Search(q.SetIndex("default"))
+package search
@@ -0,0 +1,61 @@
+package search
+
+// FacetCollector returned from Facet
+type FacetCollector M
+
+// Facet groups results by values or ranges of fields,
+// facets maps facet names to StringFacet, NumberFacet or DateFacet.
+// Use it with $searchMeta, or with $search and read $$SEARCH_META.
+// operator is optional, nil matches all indexed documents.
+// https://docs.atlas.mongodb.com/reference/atlas-search/facet/
+func Facet(operator interface{}, facets M) FacetCollector {
+	var m = M{"facets": facets}
+	if operator != nil {
+		m["operator"] = operator
+	}
+	return FacetCollector{"facet": m}
+}
+
+// StringFacetDefinition returned from StringFacet
+type StringFacetDefinition M
+
+// StringFacet narrows down results based on the most frequent string values of path.
+func StringFacet(path Path) StringFacetDefinition {
+	return StringFacetDefinition{"type": "string", "path": path.String()}
+}
+
+// SetNumBuckets max number of facet categories to return, defaults to 10.
+func (f StringFacetDefinition) SetNumBuckets(v int) StringFacetDefinition {
+	f["numBuckets"] = v
+	return f
+}
+
+// NumberFacetDefinition returned from NumberFacet
+type NumberFacetDefinition M
+
+// NumberFacet groups numeric values of path into ranges,
+// boundaries are sorted numbers that separate each bucket.
+func NumberFacet(path Path, boundaries A) NumberFacetDefinition {
+	return NumberFacetDefinition{"type": "number", "path": path.String(), "boundaries": boundaries}
+}
+
+// SetDefault name of the bucket for values not in boundaries.
+func (f NumberFacetDefinition) SetDefault(v string) NumberFacetDefinition {
+	f["default"] = v
+	return f
+}
+
+// DateFacetDefinition returned from DateFacet
+type DateFacetDefinition M
+
+// DateFacet groups date values of path into ranges,
+// boundaries are sorted dates that separate each bucket.
+func DateFacet(path Path, boundaries A) DateFacetDefinition {
+	return DateFacetDefinition{"type": "date", "path": path.String(), "boundaries": boundaries}
+}
+
+// SetDefault name of the bucket for values not in boundaries.
+func (f DateFacetDefinition) SetDefault(v string) DateFacetDefinition {
+	f["default"] = v
+	return f
+}
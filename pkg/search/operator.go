@@ -0,0 +1,252 @@
+package search
+
+// https://docs.atlas.mongodb.com/reference/atlas-search/operators-and-collectors/
+
+// Wildcard matches field names by pattern, use it as path of operators.
+// https://docs.atlas.mongodb.com/reference/atlas-search/path-construction/
+func Wildcard(pattern string) M {
+	return M{"wildcard": pattern}
+}
+
+// Multi uses alternate analyzer of path, use it as path of operators.
+// https://docs.atlas.mongodb.com/reference/atlas-search/path-construction/
+func Multi(path Path, analyzer string) M {
+	return M{"value": path.String(), "multi": analyzer}
+}
+
+// pathValue converts Path in path of operators to field name,
+// since Path marshals with "$" prefix.
+func pathValue(path interface{}) interface{} {
+	switch v := path.(type) {
+	case Path:
+		return v.String()
+	case []Path:
+		var ret = make([]string, 0, len(v))
+		for _, i := range v {
+			ret = append(ret, i.String())
+		}
+		return ret
+	case A:
+		var ret = make(A, 0, len(v))
+		for _, i := range v {
+			ret = append(ret, pathValue(i))
+		}
+		return ret
+	}
+	return path
+}
+
+// AutocompleteOperator returned from Autocomplete
+type AutocompleteOperator M
+
+// Autocomplete performs a search for a word or phrase
+// that contains a sequence of characters from an incomplete input string.
+// path must be indexed as autocomplete type.
+// https://docs.atlas.mongodb.com/reference/atlas-search/autocomplete/
+func Autocomplete(path Path, query interface{}) AutocompleteOperator {
+	return AutocompleteOperator{"autocomplete": M{
+		"path":  path.String(),
+		"query": query,
+	}}
+}
+
+// SetFuzzy enables fuzzy search with max single-character edits.
+func (op AutocompleteOperator) SetFuzzy(maxEdits int) AutocompleteOperator {
+	op["autocomplete"].(M)["fuzzy"] = M{"maxEdits": maxEdits}
+	return op
+}
+
+// SetTokenOrder option, "any" or "sequential".
+func (op AutocompleteOperator) SetTokenOrder(v string) AutocompleteOperator {
+	op["autocomplete"].(M)["tokenOrder"] = v
+	return op
+}
+
+// SetScore option
+func (op AutocompleteOperator) SetScore(score Score) AutocompleteOperator {
+	op["autocomplete"].(M)["score"] = score
+	return op
+}
+
+// CompoundOperator returned from Compound
+type CompoundOperator M
+
+// Compound combines other operators into a single query.
+// Clauses are operators of this package, e.g. Text, Range or nested Compound.
+// https://docs.atlas.mongodb.com/reference/atlas-search/compound/
+func Compound() CompoundOperator {
+	return CompoundOperator{"compound": M{}}
+}
+
+func (op CompoundOperator) add(key string, clauses []interface{}) CompoundOperator {
+	var m = op["compound"].(M)
+	var v, _ = m[key].(A)
+	m[key] = append(v, clauses...)
+	return op
+}
+
+// Must clauses must match, they contribute to score.
+func (op CompoundOperator) Must(clauses ...interface{}) CompoundOperator {
+	return op.add("must", clauses)
+}
+
+// MustNot clauses must not match.
+func (op CompoundOperator) MustNot(clauses ...interface{}) CompoundOperator {
+	return op.add("mustNot", clauses)
+}
+
+// Should clauses are preferred to match, matched ones increase score.
+func (op CompoundOperator) Should(clauses ...interface{}) CompoundOperator {
+	return op.add("should", clauses)
+}
+
+// Filter clauses must match, they do not contribute to score.
+func (op CompoundOperator) Filter(clauses ...interface{}) CompoundOperator {
+	return op.add("filter", clauses)
+}
+
+// SetMinimumShouldMatch option
+func (op CompoundOperator) SetMinimumShouldMatch(v int) CompoundOperator {
+	op["compound"].(M)["minimumShouldMatch"] = v
+	return op
+}
+
+// SetScore option
+func (op CompoundOperator) SetScore(score Score) CompoundOperator {
+	op["compound"].(M)["score"] = score
+	return op
+}
+
+// EqualsOperator returned from Equals
+type EqualsOperator M
+
+// Equals checks whether a field matches a value,
+// value is a boolean, ObjectID, number, date or string.
+// https://docs.atlas.mongodb.com/reference/atlas-search/equals/
+func Equals(path Path, value interface{}) EqualsOperator {
+	return EqualsOperator{"equals": M{
+		"path":  path.String(),
+		"value": value,
+	}}
+}
+
+// SetScore option
+func (op EqualsOperator) SetScore(score Score) EqualsOperator {
+	op["equals"].(M)["score"] = score
+	return op
+}
+
+// ExistsOperator returned from Exists
+type ExistsOperator M
+
+// Exists tests if a path to a specified indexed field name exists in a document.
+// https://docs.atlas.mongodb.com/reference/atlas-search/exists/
+func Exists(path Path) ExistsOperator {
+	return ExistsOperator{"exists": M{"path": path.String()}}
+}
+
+// SetScore option
+func (op ExistsOperator) SetScore(score Score) ExistsOperator {
+	op["exists"].(M)["score"] = score
+	return op
+}
+
+// PhraseOperator returned from Phrase
+type PhraseOperator M
+
+// Phrase performs search for documents containing an ordered sequence of terms.
+// path is a Path, array of paths, Wildcard or Multi,
+// query is a string or array of strings.
+// https://docs.atlas.mongodb.com/reference/atlas-search/phrase/
+func Phrase(path, query interface{}) PhraseOperator {
+	return PhraseOperator{"phrase": M{
+		"path":  pathValue(path),
+		"query": query,
+	}}
+}
+
+// SetSlop allowable distance between words in the query phrase.
+func (op PhraseOperator) SetSlop(v int) PhraseOperator {
+	op["phrase"].(M)["slop"] = v
+	return op
+}
+
+// SetScore option
+func (op PhraseOperator) SetScore(score Score) PhraseOperator {
+	op["phrase"].(M)["score"] = score
+	return op
+}
+
+// RangeOperator returned from Range
+type RangeOperator M
+
+// Range supports querying and scoring numeric and date values,
+// use SetGt, SetGte, SetLt and SetLte to set bounds.
+// path is a Path, array of paths or Wildcard.
+// https://docs.atlas.mongodb.com/reference/atlas-search/range/
+func Range(path interface{}) RangeOperator {
+	return RangeOperator{"range": M{"path": pathValue(path)}}
+}
+
+// SetGt option
+func (op RangeOperator) SetGt(v interface{}) RangeOperator {
+	op["range"].(M)["gt"] = v
+	return op
+}
+
+// SetGte option
+func (op RangeOperator) SetGte(v interface{}) RangeOperator {
+	op["range"].(M)["gte"] = v
+	return op
+}
+
+// SetLt option
+func (op RangeOperator) SetLt(v interface{}) RangeOperator {
+	op["range"].(M)["lt"] = v
+	return op
+}
+
+// SetLte option
+func (op RangeOperator) SetLte(v interface{}) RangeOperator {
+	op["range"].(M)["lte"] = v
+	return op
+}
+
+// SetScore option
+func (op RangeOperator) SetScore(score Score) RangeOperator {
+	op["range"].(M)["score"] = score
+	return op
+}
+
+// TextOperator returned from Text
+type TextOperator M
+
+// Text performs a full-text search using the analyzer
+// specified in the index configuration.
+// path is a Path, array of paths, Wildcard or Multi,
+// query is a string or array of strings.
+// https://docs.atlas.mongodb.com/reference/atlas-search/text/
+func Text(path, query interface{}) TextOperator {
+	return TextOperator{"text": M{
+		"path":  pathValue(path),
+		"query": query,
+	}}
+}
+
+// SetFuzzy enables fuzzy search with max single-character edits.
+func (op TextOperator) SetFuzzy(maxEdits int) TextOperator {
+	op["text"].(M)["fuzzy"] = M{"maxEdits": maxEdits}
+	return op
+}
+
+// SetSynonyms uses synonym mapping of the index.
+func (op TextOperator) SetSynonyms(mapping string) TextOperator {
+	op["text"].(M)["synonyms"] = mapping
+	return op
+}
+
+// SetScore option
+func (op TextOperator) SetScore(score Score) TextOperator {
+	op["text"].(M)["score"] = score
+	return op
+}
@@ -0,0 +1,116 @@
+package search
+
+import (
+	"fmt"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Query is argument of $search and $searchMeta stage.
+type Query M
+
+// New returns a query runs operator or collector,
+// e.g. New(Text("title", "mongo")) or New(Facet(Text("title", "mongo"), facets)).
+// operator can also be a document with a single operator field,
+// e.g. a M, a D or a struct, other than map and D it is marshaled with bson.
+// New returns error when operator can not be marshaled as a document,
+// operators and collectors of this package never fail.
+// https://docs.atlas.mongodb.com/atlas-search/query-syntax/
+func New(operator interface{}) (Query, error) {
+	var ret = Query{}
+	var v = reflect.ValueOf(operator)
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+		var it = v.MapRange()
+		for it.Next() {
+			ret[it.Key().String()] = it.Value().Interface()
+		}
+		return ret, nil
+	}
+	var d, ok = operator.(primitive.D)
+	if !ok && operator != nil {
+		b, err := bson.Marshal(operator)
+		if err == nil {
+			err = bson.Unmarshal(b, &d)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("search: %w", err)
+		}
+	}
+	for _, e := range d {
+		ret[e.Key] = e.Value
+	}
+	return ret, nil
+}
+
+// SetIndex name of the Atlas Search index to use, defaults to "default".
+func (q Query) SetIndex(name string) Query {
+	q["index"] = name
+	return q
+}
+
+// SetHighlight returns highlighted passages of matched terms,
+// access them with aggregation.Meta(aggregation.MetaSearchHighlights).
+func (q Query) SetHighlight(v Highlight) Query {
+	q["highlight"] = v
+	return q
+}
+
+// SetCount option, e.g. CountTotal() or CountLowerBound(1000).
+// Access the count with $$SEARCH_META in $search,
+// or from output document of $searchMeta.
+func (q Query) SetCount(v Count) Query {
+	q["count"] = v
+	return q
+}
+
+// SetReturnStoredSource returns only stored source fields
+// of the index, instead of full documents from the database.
+func (q Query) SetReturnStoredSource(v bool) Query {
+	q["returnStoredSource"] = v
+	return q
+}
+
+// SetScoreDetails computes score details of documents,
+// access them with aggregation.Meta(aggregation.MetaSearchScoreDetails).
+func (q Query) SetScoreDetails(v bool) Query {
+	q["scoreDetails"] = v
+	return q
+}
+
+// Highlight returned from NewHighlight
+type Highlight M
+
+// NewHighlight highlights matched terms in path,
+// path is same as Text.
+// https://docs.atlas.mongodb.com/reference/atlas-search/highlighting/
+func NewHighlight(path interface{}) Highlight {
+	return Highlight{"path": pathValue(path)}
+}
+
+// SetMaxCharsToExamine option
+func (h Highlight) SetMaxCharsToExamine(v int) Highlight {
+	h["maxCharsToExamine"] = v
+	return h
+}
+
+// SetMaxNumPassages option
+func (h Highlight) SetMaxNumPassages(v int) Highlight {
+	h["maxNumPassages"] = v
+	return h
+}
+
+// Count option of query.
+// https://docs.atlas.mongodb.com/reference/atlas-search/counting/
+type Count M
+
+// CountTotal counts all matched documents.
+func CountTotal() Count {
+	return Count{"type": "total"}
+}
+
+// CountLowerBound counts matched documents accurately up to threshold.
+func CountLowerBound(threshold int) Count {
+	return Count{"type": "lowerBound", "threshold": threshold}
+}
@@ -0,0 +1,33 @@
+package search
+
+// https://docs.atlas.mongodb.com/reference/atlas-search/scoring/
+
+// Score modifies score of documents matched by an operator,
+// use it with SetScore of operators.
+type Score M
+
+// Boost multiplies score by value.
+// https://docs.atlas.mongodb.com/reference/atlas-search/scoring/#boost
+func Boost(value float64) Score {
+	return Score{"boost": M{"value": value}}
+}
+
+// BoostPath multiplies score by value of numeric field path,
+// undefined is used when the field is missing.
+// https://docs.atlas.mongodb.com/reference/atlas-search/scoring/#boost
+func BoostPath(path Path, undefined float64) Score {
+	return Score{"boost": M{"path": path.String(), "undefined": undefined}}
+}
+
+// Constant replaces score with value.
+// https://docs.atlas.mongodb.com/reference/atlas-search/scoring/#constant
+func Constant(value float64) Score {
+	return Score{"constant": M{"value": value}}
+}
+
+// Function alters score with an expression,
+// e.g. M{"multiply": A{M{"path": M{"value": "rating", "undefined": 1}}, M{"score": "relevance"}}}.
+// https://docs.atlas.mongodb.com/reference/atlas-search/scoring/#function
+func Function(expression interface{}) Score {
+	return Score{"function": expression}
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/NateScarlet/mongo-operators/pkg/aggregation"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func mustNew(t *testing.T, operator interface{}) Query {
+	q, err := New(operator)
+	assert.NoError(t, err)
+	return q
+}
+
+func TestNew(t *testing.T) {
+	var q = mustNew(t,
+		Compound().
+			Must(Text(A{"title", "plot"}, "mongo").SetFuzzy(1).SetScore(Boost(2))).
+			Should(Phrase("plot", "data base").SetSlop(2), Autocomplete("title", "mon").SetTokenOrder("sequential")).
+			Filter(Range("year").SetGte(2000).SetLt(2020), Equals("released", true)).
+			MustNot(Exists("deleted").SetScore(Constant(1))).
+			SetMinimumShouldMatch(1),
+	).
+		SetIndex("movies").
+		SetHighlight(NewHighlight(Wildcard("*")).SetMaxNumPassages(3)).
+		SetCount(CountLowerBound(1000)).
+		SetReturnStoredSource(true)
+	assert.Equal(t, Query{
+		"compound": M{
+			"must": A{TextOperator{"text": M{
+				"path":  A{"title", "plot"},
+				"query": "mongo",
+				"fuzzy": M{"maxEdits": 1},
+				"score": Score{"boost": M{"value": 2.0}},
+			}}},
+			"should": A{
+				PhraseOperator{"phrase": M{"path": "plot", "query": "data base", "slop": 2}},
+				AutocompleteOperator{"autocomplete": M{"path": "title", "query": "mon", "tokenOrder": "sequential"}},
+			},
+			"filter": A{
+				RangeOperator{"range": M{"path": "year", "gte": 2000, "lt": 2020}},
+				EqualsOperator{"equals": M{"path": "released", "value": true}},
+			},
+			"mustNot": A{
+				ExistsOperator{"exists": M{"path": "deleted", "score": Score{"constant": M{"value": 1.0}}}},
+			},
+			"minimumShouldMatch": 1,
+		},
+		"index":              "movies",
+		"highlight":          Highlight{"path": M{"wildcard": "*"}, "maxNumPassages": 3},
+		"count":              Count{"type": "lowerBound", "threshold": 1000},
+		"returnStoredSource": true,
+	}, q)
+
+	_, err := bson.Marshal(aggregation.Search(q))
+	assert.NoError(t, err)
+	assert.Empty(t, aggregation.Validate(A{
+		aggregation.Search(q),
+		aggregation.Project(M{
+			"title":      1,
+			"score":      aggregation.Meta(aggregation.MetaSearchScore),
+			"highlights": aggregation.Meta(aggregation.MetaSearchHighlights),
+		}),
+	}))
+}
+
+func TestFacet(t *testing.T) {
+	var q = mustNew(t, Facet(Text("title", "mongo"), M{
+		"genres": StringFacet("genres").SetNumBuckets(5),
+		"years":  NumberFacet("year", A{1990, 2000, 2010}).SetDefault("other"),
+	})).SetCount(CountTotal())
+	assert.Equal(t, Query{
+		"facet": M{
+			"operator": TextOperator{"text": M{"path": "title", "query": "mongo"}},
+			"facets": M{
+				"genres": StringFacetDefinition{"type": "string", "path": "genres", "numBuckets": 5},
+				"years":  NumberFacetDefinition{"type": "number", "path": "year", "boundaries": A{1990, 2000, 2010}, "default": "other"},
+			},
+		},
+		"count": Count{"type": "total"},
+	}, q)
+	assert.Equal(t, M{"$searchMeta": q}, aggregation.SearchMeta(q))
+	version, err := aggregation.MinServerVersion(A{aggregation.SearchMeta(q)})
+	assert.NoError(t, err)
+	assert.Equal(t, aggregation.Version("4.4.9"), version)
+	assert.Equal(t, Query{"facet": M{"facets": M{}}}, mustNew(t, Facet(nil, M{})))
+}
+
+type textQuery struct {
+	Text struct {
+		Path  string `bson:"path"`
+		Query string `bson:"query"`
+	} `bson:"text"`
+}
+
+func TestNewDocument(t *testing.T) {
+	var want = Query{"text": M{"path": "title", "query": "mongo"}}
+	assert.Equal(t, want, mustNew(t, M{"text": M{"path": "title", "query": "mongo"}}))
+	assert.Equal(t, want, mustNew(t, bson.D{{Key: "text", Value: M{"path": "title", "query": "mongo"}}}))
+	var s textQuery
+	s.Text.Path, s.Text.Query = "title", "mongo"
+	assert.Equal(t, Query{"text": bson.D{{Key: "path", Value: "title"}, {Key: "query", Value: "mongo"}}}, mustNew(t, s))
+	assert.Equal(t, Query{}, mustNew(t, nil))
+	_, err := New("text")
+	assert.Error(t, err)
+}
+
+func TestPath(t *testing.T) {
+	var title = Path("$title")
+	assert.Equal(t, TextOperator{"text": M{"path": "title", "query": "mongo"}}, Text(title, "mongo"))
+	assert.Equal(t, PhraseOperator{"phrase": M{"path": []string{"title", "plot"}, "query": "mongo"}}, Phrase([]Path{title, "plot"}, "mongo"))
+	assert.Equal(t, RangeOperator{"range": M{"path": A{"year", M{"wildcard": "date.*"}}}}, Range(A{Path("$year"), Wildcard("date.*")}))
+	assert.Equal(t, Highlight{"path": M{"value": "title", "multi": "english"}}, NewHighlight(Multi(title, "english")))
+	assert.Equal(t, EqualsOperator{"equals": M{"path": "released", "value": true}}, Equals(Path("$released"), true))
+	assert.Equal(t, StringFacetDefinition{"type": "string", "path": "genres"}, StringFacet(Path("genres")))
+	assert.Equal(t, Score{"boost": M{"path": "rating", "undefined": 1.0}}, BoostPath(Path("$rating"), 1))
+}